@@ -1,16 +1,45 @@
 package api
 
 import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"log"
+	"mime"
 	"net/http"
+	"path"
+	"path/filepath"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 
 	"zerodupe/internal/server/auth"
+	"zerodupe/internal/server/gc"
 	"zerodupe/internal/server/model"
+	"zerodupe/internal/server/scrub"
 	"zerodupe/internal/server/storage"
+	"zerodupe/internal/server/storage/cache"
+	"zerodupe/internal/server/storage/filesystem"
+	"zerodupe/pkg/hasher"
+)
+
+// maxTopChunks is the most shared chunks a stats request may ask for
+const maxTopChunks = 100
+
+const (
+	// defaultShareLinkExpiry is how long share links are valid unless a request says otherwise
+	defaultShareLinkExpiry = 24 * time.Hour
+
+	// maxShareLinkExpiry is how long share links may be valid at most
+	maxShareLinkExpiry = 30 * 24 * time.Hour
+
+	// maxPathLength is the longest path allowed in the namespace of a user
+	maxPathLength = 4096
 )
 
 // Handler handles all API requests
@@ -18,6 +47,15 @@ type Handler struct {
 	fileStorage  storage.FileSystem
 	dbStorage    storage.DB
 	tokenHandler auth.TokenManager
+	scrubber     *scrub.Scrubber               // set by the server, which runs scheduled scrubs with it
+	collector    *gc.Collector                 // set by the server, which runs scheduled collections with it
+	admins       map[string]bool               // usernames allowed to manage any user, set by the server
+	defaultQuota model.Quota                   // quota of users without one of their own, set by the server
+	blocks       *filesystem.FilesystemStorage // the filesystem chunk store for block stats, nil with other stores
+	cache        *cache.CachedStorage          // nil without a chunk cache
+
+	reservedMu sync.Mutex
+	reserved   map[uint]model.Usage // bytes of chunks being uploaded, counted against quotas until saved
 }
 
 func NewHandler(fileStorage storage.FileSystem, dbStorage storage.DB, tokenHandler auth.TokenManager) *Handler {
@@ -50,20 +88,53 @@ type UploadRequest struct {
 	FileHash   string `json:"file_hash" binding:"required"`
 	ChunkHash  string `json:"chunk_hash" binding:"required"`
 	ChunkOrder int    `json:"chunk_order" binding:"required"`
+	Chunker    string `json:"chunker" example:"fastcdc:262144:1048576:4194304"`
 	Content    []byte `json:"content"`
+	// TotalChunks is the number of chunks of the file, so the server verifies it once it has them all
+	TotalChunks int `json:"total_chunks" example:"4"`
+	// FileName and ContentType describe the file; the first upload of a file records them
+	FileName    string `json:"file_name" example:"report.pdf"`
+	ContentType string `json:"content_type" example:"application/pdf"`
 }
 
 // UploadResponse represents a response to an upload request
 type UploadResponse struct {
-	Message      string `json:"message"`
-	FileHash     string `json:"file_hash"`
-	HashMismatch bool   `json:"hash_mismatch"`
+	Message  string `json:"message"`
+	FileHash string `json:"file_hash"`
+}
+
+// DeleteFileResponse represents a response to a file deletion request
+type DeleteFileResponse struct {
+	Message  string `json:"message"`
+	FileHash string `json:"file_hash"`
 }
 
 // CheckFileResponse represents a response to a file existence check
 type CheckFileResponse struct {
 	Exists bool   `json:"exists"`
 	Hash   string `json:"hash"`
+	Owned  bool   `json:"owned"` // the caller owns the file, others upload it again to own it without sending chunk content
+}
+
+// UsageResponse represents the storage accounted to a user and the quota that applies to them
+type UsageResponse struct {
+	Username string      `json:"username"`
+	Usage    model.Usage `json:"usage"`
+	Quota    model.Quota `json:"quota"` // the limits that apply in bytes: the user's own, the server default where those are 0, and 0 where there is no limit
+}
+
+// StatsResponse represents the deduplication statistics of the caller's files and, for administrators, of all files
+type StatsResponse struct {
+	Username string       `json:"username"`
+	User     model.Stats  `json:"user"`
+	Global   *GlobalStats `json:"global,omitempty"`
+}
+
+// GlobalStats represents the deduplication statistics of all files and the stats of the chunk store
+type GlobalStats struct {
+	model.Stats
+	Blocks *filesystem.BlockStats `json:"blocks,omitempty"` // with the filesystem chunk store only
+	Cache  *cache.Stats           `json:"cache,omitempty"`  // with a chunk cache only
 }
 
 // CheckChunksResponse represents a response to a chunks existence check
@@ -76,6 +147,117 @@ type DownloadFileResponse struct {
 	FileHash    string   `json:"file_hash" binding:"required"`
 	ChunkHashes []string `json:"chunk_hashes"`
 	ChunksCount int      `json:"chunks_count"`
+	Chunker     string   `json:"chunker"`
+	// Proofs holds the Merkle inclusion proof of each chunk, in chunk order.
+	// It is omitted for files uploaded before file hashes were Merkle roots.
+	Proofs []hasher.MerkleProof `json:"proofs,omitempty"`
+	// Damaged is set when a chunk of the file was found corrupt by a scrub and quarantined
+	Damaged bool `json:"damaged,omitempty"`
+	// Size is the size of the file in bytes
+	Size int64 `json:"size"`
+	// Name, ContentType, CreatedAt and Uploader are empty for files stored before they were recorded.
+	// Name and Uploader are those of the first upload, only shown to its uploader and to administrators.
+	Name        string      `json:"name,omitempty" example:"report.pdf"`
+	ContentType string      `json:"content_type,omitempty" example:"application/pdf"`
+	CreatedAt   *time.Time  `json:"created_at,omitempty"`
+	Uploader    string      `json:"uploader,omitempty"`
+	Chunks      []ChunkInfo `json:"chunks"`
+}
+
+// ChunkInfo describes a chunk of a file and where it starts in the file
+type ChunkInfo struct {
+	ChunkHash string `json:"chunk_hash"`
+	Size      int64  `json:"size"`
+	Offset    int64  `json:"offset"`
+}
+
+// GrantRequest represents a request to grant a user read access to a file
+type GrantRequest struct {
+	Username string `json:"username" binding:"required" example:"jane_doe"`
+}
+
+// ShareLinkRequest represents a request to create a share link to a file
+type ShareLinkRequest struct {
+	// ExpiresIn is how long the link is valid, 24h if empty and at most 720h
+	ExpiresIn string `json:"expires_in" example:"72h"`
+	// Password must be given to download the file through the link, if set
+	Password string `json:"password" example:"secret"`
+}
+
+// GrantResponse describes a user granted read access to a file
+type GrantResponse struct {
+	Username  string    `json:"username"`
+	GrantedAt time.Time `json:"granted_at"`
+}
+
+// ShareLinkResponse describes a share link to a file
+type ShareLinkResponse struct {
+	Token string `json:"token"`
+	// Path serves the file without authentication, relative to the server URL
+	Path      string    `json:"path" example:"/shared/3q2-7wE..."`
+	Protected bool      `json:"protected"` // a password is needed to download the file
+	ExpiresAt time.Time `json:"expires_at"`
+	Expired   bool      `json:"expired"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SharesResponse lists the users granted access to a file and its share links
+type SharesResponse struct {
+	FileHash string              `json:"file_hash"`
+	Grants   []GrantResponse     `json:"grants"`
+	Links    []ShareLinkResponse `json:"links"`
+}
+
+// MkdirRequest represents a request to create a directory in the namespace of the caller
+type MkdirRequest struct {
+	Path string `json:"path" binding:"required" example:"/docs/reports"`
+	// Parents creates the missing parents of the directory too, and accepts a directory that exists
+	Parents bool `json:"parents"`
+}
+
+// MoveRequest represents a request to move a file or directory in the namespace of the caller
+type MoveRequest struct {
+	From string `json:"from" binding:"required" example:"/docs/report.pdf"`
+	// To is the new path, or a directory to move the entry into keeping its name
+	To string `json:"to" binding:"required" example:"/archive"`
+}
+
+// SaveFileRequest represents a request to save a file at a path in the namespace of the caller
+type SaveFileRequest struct {
+	Path     string `json:"path" binding:"required" example:"/docs/report.pdf"`
+	FileHash string `json:"file_hash" binding:"required"`
+}
+
+// PathEntryResponse describes a directory or a file in the namespace of the caller
+type PathEntryResponse struct {
+	Path string `json:"path" example:"/docs/report.pdf"`
+	Name string `json:"name" example:"report.pdf"`
+	Type string `json:"type" enums:"dir,file"`
+	// FileHash, Size and ContentType describe the file saved at the path, for files
+	FileHash    string     `json:"file_hash,omitempty"`
+	Size        int64      `json:"size"`
+	ContentType string     `json:"content_type,omitempty" example:"application/pdf"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"` // nil for the root directory
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+}
+
+// ListDirectoryResponse lists the entries of a directory, or the file at a path
+type ListDirectoryResponse struct {
+	Path    string              `json:"path"`
+	Entries []PathEntryResponse `json:"entries"`
+}
+
+// RemovePathResponse represents a response to a path removal request
+type RemovePathResponse struct {
+	Message string `json:"message"`
+	Path    string `json:"path"`
+	Removed int64  `json:"removed"` // entries removed, with those below a directory
+}
+
+// ScrubStatusResponse represents the progress and results of block store scrubs
+type ScrubStatusResponse struct {
+	scrub.Status
+	DamagedFiles []string `json:"damaged_files"` // all files marked damaged, by any scrub
 }
 
 // CheckChunksRequest represents the request body for checking chunk hashes
@@ -91,7 +273,7 @@ type CheckChunksRequest struct {
 // @Param request body SignUpRequest true "User registration data"
 // @Success 200 {string} string "user registered successfully"
 // @Failure 400 {object} map[string]interface{} "Invalid request format or password mismatch"
-// @Failure 409 {object} map[string]interface{} "User already exists"
+// @Failure 409 {object} map[string]interface{} "User already exists or the username is reserved for an administrator"
 // @Failure 500 {string} string "Internal server error"
 // @Router /auth/signup [post]
 func (h *Handler) SignUpHandler(c *gin.Context) {
@@ -113,6 +295,11 @@ func (h *Handler) SignUpHandler(c *gin.Context) {
 		c.JSON(http.StatusConflict, gin.H{"error": "user already exists"})
 		return
 	}
+	// Administrators are matched by username, so nobody else may take a configured name that is not registered yet
+	if h.admins[request.Username] {
+		c.JSON(http.StatusConflict, gin.H{"error": "username is reserved for an administrator"})
+		return
+	}
 
 	password, err := auth.HashAndSaltPassword([]byte(request.Password))
 	if err != nil {
@@ -152,7 +339,7 @@ func (h *Handler) LoginHandler(c *gin.Context) {
 	}
 
 	user, err := h.dbStorage.GetUserByUsername(request.Username)
-	if err == gorm.ErrRecordNotFound {
+	if errors.Is(err, storage.ErrUserNotFound) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "user does not exist"})
 		return
 	} else if err != nil {
@@ -210,7 +397,10 @@ func (h *Handler) RefreshTokenHandler(c *gin.Context) {
 // @Success 200 {object} UploadResponse "File uploaded successfully"
 // @Failure 400 {object} map[string]interface{} "Invalid request format"
 // @Failure 404 {object} map[string]interface{} "Chunk does not exist"
+// @Failure 409 {object} map[string]interface{} "Another chunk is stored at this position of the file, or the file is complete"
+// @Failure 422 {object} map[string]interface{} "Chunk content does not match its hash"
 // @Failure 500 {object} map[string]interface{} "Failed to save chunk data"
+// @Failure 507 {object} map[string]interface{} "Quota exceeded"
 // @Router /upload [post]
 func (h *Handler) UploadFileHandler(c *gin.Context) {
 	var request UploadRequest
@@ -219,40 +409,22 @@ func (h *Handler) UploadFileHandler(c *gin.Context) {
 		return
 	}
 
-	// special case: one chunk file, save chunk directly without metadata
-	if request.FileHash == request.ChunkHash {
-		_, err := h.fileStorage.SaveChunkData(request.ChunkHash, request.Content)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save chunk data"})
-			return
-		}
-		response := UploadResponse{
-			Message:      "File uploaded successfully",
-			FileHash:     request.FileHash,
-			HashMismatch: false,
-		}
-		c.JSON(http.StatusOK, response)
+	chunker, err := parseChunker(request.Chunker)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	log.Printf("Received chunk: Hash=%s, ChunkOrder=%d\n",
 		request.FileHash, request.ChunkOrder)
 
-	if err := h.dbStorage.SaveChunkMetadata(request.FileHash, request.ChunkHash, request.ChunkOrder); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save chunk metadata"})
-		return
+	// garbage collection must not sweep the chunk between finding it stored and the file referencing it
+	if h.collector != nil {
+		defer h.collector.HoldUpload()()
 	}
 
-	hashMismatch := false
-	if (len(request.Content)) > 0 {
-		calculatedHash, err := h.fileStorage.SaveChunkData(request.ChunkHash, request.Content)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save chunk data"})
-			return
-		}
-		hashMismatch = calculatedHash != request.ChunkHash
-	}
-	if (len(request.Content)) == 0 {
+	chunkSize := int64(len(request.Content))
+	if len(request.Content) == 0 {
 		exists, _, err := h.fileStorage.CheckChunkExists([]string{request.ChunkHash})
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check chunk existence"})
@@ -262,12 +434,96 @@ func (h *Handler) UploadFileHandler(c *gin.Context) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Chunk does not exist"})
 			return
 		}
+		if chunkSize, err = h.storedChunkSize(request.ChunkHash); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check chunk existence"})
+			return
+		}
+	}
+
+	userID := c.GetUint("userID")
+	release, exceeded, err := h.reserveQuota(c.GetString("username"), userID, request.FileHash, request.ChunkHash, request.ChunkOrder, chunkSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check quota"})
+		return
+	}
+	if exceeded != "" {
+		c.JSON(http.StatusInsufficientStorage, gin.H{"error": exceeded})
+		return
+	}
+	defer release()
+
+	// the chunk must be stored and verified before any file references it
+	if len(request.Content) > 0 {
+		if _, err := h.fileStorage.SaveChunkData(request.ChunkHash, request.Content); err != nil {
+			if errors.Is(err, storage.ErrHashMismatch) {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save chunk data"})
+			return
+		}
+	} else {
+		// renew the chunk so garbage collection does not remove it before the file references it
+		if err := h.fileStorage.TouchChunk(request.ChunkHash); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check chunk existence"})
+			return
+		}
+	}
+
+	err = h.dbStorage.SaveChunkMetadata(request.FileHash, request.ChunkHash, request.ChunkOrder, chunkSize, chunker)
+	if errors.Is(err, storage.ErrChunkConflict) && userID != 0 {
+		// the chunk stored first may not be the file's, so the caller's chunks are recorded below
+		// and replace those of the file once they hash to the file hash
+		err = nil
+	}
+	if err != nil {
+		if errors.Is(err, storage.ErrChunkConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Another chunk is stored at this position of the file"})
+			return
+		}
+		if errors.Is(err, storage.ErrFileComplete) {
+			c.JSON(http.StatusConflict, gin.H{"error": "File is complete, no chunk can be added to it"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save chunk metadata"})
+		return
+	}
+
+	if _, err := h.dbStorage.CompleteFile(request.FileHash, request.TotalChunks); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify file"})
+		return
+	}
+
+	// uploading every chunk of a verified file makes the caller an owner of it, so knowing the
+	// file hash alone is not enough to own a file that is already stored
+	if userID != 0 {
+		if _, err := h.dbStorage.RecordUploadedChunk(request.FileHash, userID, request.ChunkOrder, request.ChunkHash, chunkSize); err != nil {
+			if errors.Is(err, storage.ErrChunkConflict) {
+				c.JSON(http.StatusConflict, gin.H{"error": "Another chunk is stored at this position of the file"})
+				return
+			}
+			if errors.Is(err, storage.ErrFileComplete) {
+				c.JSON(http.StatusConflict, gin.H{"error": "File is complete, no chunk can be added to it"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file owner"})
+			return
+		}
+	}
+
+	// after recording the chunk, which clears the name of a file whose chunks it replaces
+	contentType := request.ContentType
+	if contentType == "" && request.ChunkOrder == 1 && len(request.Content) > 0 {
+		contentType = http.DetectContentType(request.Content)
+	}
+	if err := h.dbStorage.SetFileInfo(request.FileHash, fileName(request.FileName), contentType, c.GetString("username")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file info"})
+		return
 	}
 
 	response := UploadResponse{
-		Message:      "File uploaded successfully",
-		FileHash:     request.FileHash,
-		HashMismatch: hashMismatch,
+		Message:  "File uploaded successfully",
+		FileHash: request.FileHash,
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -291,21 +547,31 @@ func (h *Handler) CheckFileHashHandler(c *gin.Context) {
 		return
 	}
 
-	dbExists, err := h.dbStorage.CheckFileExists(fileHash)
+	exists, err := h.dbStorage.CheckFileExists(fileHash)
 	if err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
 
-	fsExists, err := h.fileStorage.CheckFileExists(fileHash)
-	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
-		return
+	// files the caller may not read are reported missing, so their hashes reveal nothing
+	owned := false
+	if exists {
+		if exists, err = h.canAccessFile(c, fileHash); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if exists {
+		if owned, err = h.dbStorage.CheckFileOwner(fileHash, c.GetUint("userID")); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
 	}
 
 	response := CheckFileResponse{
-		Exists: dbExists || fsExists,
+		Exists: exists,
 		Hash:   fileHash,
+		Owned:  owned,
 	}
 
 	c.JSON(200, response)
@@ -328,12 +594,21 @@ func (h *Handler) CheckChunkHashesHandler(c *gin.Context) {
 		return
 	}
 
-	_, missing, err := h.fileStorage.CheckChunkExists(request.Hashes)
+	existing, missing, err := h.fileStorage.CheckChunkExists(request.Hashes)
 	if err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
 
+	// the client is about to reference the existing chunks instead of uploading them,
+	// renewing them keeps garbage collection from removing them in the meantime
+	for _, chunkHash := range existing {
+		if err := h.fileStorage.TouchChunk(chunkHash); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	response := CheckChunksResponse{
 		Missing: missing,
 	}
@@ -342,7 +617,7 @@ func (h *Handler) CheckChunkHashesHandler(c *gin.Context) {
 }
 
 // @Summary Download file metadata
-// @Description Get file metadata including ordered chunk hashes for download
+// @Description Get file metadata including ordered chunk hashes and their Merkle inclusion proofs for download
 // @Tags files
 // @Accept json
 // @Produce json
@@ -356,50 +631,110 @@ func (h *Handler) DownloadFileHandler(c *gin.Context) {
 
 	log.Println("Downloading file with hash: " + fileHash)
 	metadata, err := h.dbStorage.GetFileMetadata(fileHash)
-
 	if err != nil {
-		// If file metadata not found, check if it's a single chunk file
-		_, err := h.fileStorage.GetChunkData(fileHash)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// files the caller may not read are reported missing, so their hashes reveal nothing
+	if metadata != nil {
+		accessible, err := h.canAccessFile(c, fileHash)
 		if err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-
-		result := DownloadFileResponse{
-			FileHash:    fileHash,
-			ChunkHashes: []string{fileHash},
-			ChunksCount: 1,
+		if !accessible {
+			metadata = nil
 		}
-		c.JSON(http.StatusOK, result)
+	}
 
+	if metadata == nil || len(metadata.Chunks) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File metadata not found"})
 		return
 	}
 
-    if metadata == nil || len(metadata.Chunks) == 0 {
-        c.JSON(http.StatusNotFound, gin.H{"error": "File metadata not found"})
-        return
-    }
-
 	sort.Slice(metadata.Chunks, func(i, j int) bool {
 		return metadata.Chunks[i].ChunkOrder < metadata.Chunks[j].ChunkOrder
 	})
 
-    orderedHashes := make([]string, len(metadata.Chunks))
-    for i, chunk := range metadata.Chunks {
-        orderedHashes[i] = chunk.ChunkHash
-    }
+	orderedHashes := make([]string, len(metadata.Chunks))
+	chunks := make([]ChunkInfo, len(metadata.Chunks))
+	var offset int64
+	for i, chunk := range metadata.Chunks {
+		orderedHashes[i] = chunk.ChunkHash
+		chunks[i] = ChunkInfo{ChunkHash: chunk.ChunkHash, Size: chunk.Size, Offset: offset}
+		offset += chunk.Size
+	}
+
+	chunker, err := parseChunker(metadata.Chunker)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	// return chunks hashes ordered
 	result := DownloadFileResponse{
 		FileHash:    fileHash,
 		ChunkHashes: orderedHashes,
 		ChunksCount: len(orderedHashes),
+		Chunker:     chunker,
+		Damaged:     metadata.Damaged,
+		Size:        metadata.Size,
+		ContentType: metadata.ContentType,
+		Chunks:      chunks,
+	}
+	if h.admins[c.GetString("username")] || isUploader(metadata, c.GetString("username")) {
+		result.Name = metadata.Name
+		result.Uploader = metadata.Uploader
+	}
+	if !metadata.CreatedAt.IsZero() {
+		result.CreatedAt = &metadata.CreatedAt
+	}
+	if hasher.EqualHashes(hasher.FileHashFromChunkHashes(orderedHashes), fileHash) {
+		result.Proofs = hasher.MerkleProofs(orderedHashes)
 	}
 
 	c.JSON(http.StatusOK, result)
 
 }
 
+// @Summary Delete a file
+// @Description Remove a file from the files of the caller. The file and its chunk metadata are deleted with its last owner, and chunks no other file references are reclaimed by garbage collection. Administrators delete files they do not own outright.
+// @Tags files
+// @Produce json
+// @Param hash path string true "File hash"
+// @Success 200 {object} DeleteFileResponse "File deleted"
+// @Failure 404 {object} map[string]interface{} "File not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /files/{hash} [delete]
+func (h *Handler) DeleteFileHandler(c *gin.Context) {
+	fileHash := c.Param("hash")
+
+	deleted, err := h.dbStorage.RemoveFileOwner(fileHash, c.GetUint("userID"))
+	if errors.Is(err, storage.ErrFileNotFound) && h.admins[c.GetString("username")] {
+		err = h.dbStorage.DeleteFileMetadata(fileHash)
+		deleted = true
+	}
+	if err != nil {
+		if errors.Is(err, storage.ErrFileNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete file"})
+		return
+	}
+
+	response := DeleteFileResponse{
+		Message:  "File deleted successfully",
+		FileHash: fileHash,
+	}
+	if !deleted {
+		response.Message = "File removed from your files, other owners keep it"
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
 // @Summary Get chunk content
 // @Description Download the content of a specific chunk
 // @Tags files
@@ -407,10 +742,26 @@ func (h *Handler) DownloadFileHandler(c *gin.Context) {
 // @Produce octet-stream
 // @Param hash path string true "Chunk hash"
 // @Success 200 {file} binary "Chunk content"
+// @Failure 404 {object} map[string]interface{} "Chunk not found"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /chunk/{hash} [get]
 func (h *Handler) GetChunkContent(c *gin.Context) {
 	chunkHash := c.Param("hash")
+
+	// chunks are only served as part of a file the caller may read
+	accessible := h.admins[c.GetString("username")]
+	if !accessible {
+		var err error
+		if accessible, err = h.dbStorage.CheckChunkAccess(chunkHash, c.GetUint("userID")); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if !accessible {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chunk not found"})
+		return
+	}
+
 	content, err := h.fileStorage.GetChunkData(chunkHash)
 	if err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
@@ -420,3 +771,1031 @@ func (h *Handler) GetChunkContent(c *gin.Context) {
 	c.Header("Content-Type", "application/octet-stream")
 	c.Data(http.StatusOK, "application/octet-stream", content)
 }
+
+// @Summary Get scrub status
+// @Description Get the progress of the running block store scrub, the report of the last one and all files marked damaged. Only for administrators.
+// @Tags scrub
+// @Produce json
+// @Success 200 {object} ScrubStatusResponse "Scrub status"
+// @Failure 403 {object} map[string]interface{} "Administrator access required"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /scrub [get]
+func (h *Handler) ScrubStatusHandler(c *gin.Context) {
+	response, err := h.scrubStatus()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary Start a scrub
+// @Description Start verifying every stored block against its hash in the background. Corrupt blocks are quarantined and the files referencing them marked damaged. Only for administrators.
+// @Tags scrub
+// @Produce json
+// @Success 202 {object} ScrubStatusResponse "Scrub started"
+// @Failure 403 {object} map[string]interface{} "Administrator access required"
+// @Failure 409 {object} map[string]interface{} "A scrub is already running"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /scrub [post]
+func (h *Handler) StartScrubHandler(c *gin.Context) {
+	if err := h.scrubber.Start(); err != nil {
+		if errors.Is(err, scrub.ErrRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := h.scrubStatus()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, response)
+}
+
+// @Summary Get your usage
+// @Description Get the storage accounted to the caller and their quota. Logical bytes are the sizes of the files they own, unique bytes the sizes of the chunks no other user's files reference.
+// @Tags users
+// @Produce json
+// @Success 200 {object} UsageResponse "Usage and quota"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /usage [get]
+func (h *Handler) UsageHandler(c *gin.Context) {
+	response, err := h.usage(c.GetString("username"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary Get the usage of a user
+// @Description Get the storage accounted to a user and their quota. Only for administrators.
+// @Tags users
+// @Produce json
+// @Param username path string true "Username"
+// @Success 200 {object} UsageResponse "Usage and quota"
+// @Failure 403 {object} map[string]interface{} "Administrator access required"
+// @Failure 404 {object} map[string]interface{} "User not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /users/{username}/usage [get]
+func (h *Handler) UserUsageHandler(c *gin.Context) {
+	response, err := h.usage(c.Param("username"))
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary Set the quota of a user
+// @Description Set the quota of a user in bytes. A limit of 0 falls back to the server default, a negative limit is unlimited. Only for administrators.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param username path string true "Username"
+// @Param request body model.Quota true "Quota"
+// @Success 200 {object} UsageResponse "Usage and new quota"
+// @Failure 400 {object} map[string]interface{} "Invalid request format"
+// @Failure 403 {object} map[string]interface{} "Administrator access required"
+// @Failure 404 {object} map[string]interface{} "User not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /users/{username}/quota [put]
+func (h *Handler) SetQuotaHandler(c *gin.Context) {
+	var quota model.Quota
+	if err := c.ShouldBindJSON(&quota); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	username := c.Param("username")
+	if err := h.dbStorage.SetUserQuota(username, quota); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := h.usage(username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary Get deduplication statistics
+// @Description Get the number of files and distinct chunks, the chunk and logical bytes, the dedup ratio and the most shared chunks of the caller's files. Administrators also get them for all files, with the block and cache stats of the chunk store.
+// @Tags files
+// @Produce json
+// @Param top query int false "Number of most shared chunks to list, at most 100" default(10)
+// @Success 200 {object} StatsResponse "Deduplication statistics"
+// @Failure 400 {object} map[string]interface{} "Invalid number of chunks"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /stats [get]
+func (h *Handler) StatsHandler(c *gin.Context) {
+	top, err := strconv.Atoi(c.DefaultQuery("top", "10"))
+	if err != nil || top < 0 || top > maxTopChunks {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("top must be a number between 0 and %d", maxTopChunks)})
+		return
+	}
+
+	username := c.GetString("username")
+	userID := c.GetUint("userID")
+	usage, err := h.dbStorage.GetUsage(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	response := StatsResponse{
+		Username: username,
+		User: model.Stats{
+			Files:        usage.Files,
+			Chunks:       usage.Chunks,
+			ChunkBytes:   usage.ChunkBytes,
+			LogicalBytes: usage.LogicalBytes,
+			UniqueBytes:  usage.UniqueBytes,
+		},
+	}
+	if response.User.TopChunks, err = h.dbStorage.ListSharedChunks(userID, top); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	response.User.DedupRatio = dedupRatio(response.User)
+
+	if h.admins[username] {
+		stats, err := h.dbStorage.GetStats()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if stats.TopChunks, err = h.dbStorage.ListSharedChunks(0, top); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		stats.DedupRatio = dedupRatio(*stats)
+
+		response.Global = &GlobalStats{Stats: *stats}
+		if h.blocks != nil {
+			blockStats := h.blocks.Stats()
+			response.Global.Blocks = &blockStats
+		}
+		if h.cache != nil {
+			cacheStats := h.cache.Stats()
+			response.Global.Cache = &cacheStats
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// usage returns the usage and quota of a user
+func (h *Handler) usage(username string) (UsageResponse, error) {
+	user, err := h.dbStorage.GetUserByUsername(username)
+	if err != nil {
+		return UsageResponse{}, err
+	}
+	usage, err := h.dbStorage.GetUsage(user.ID)
+	if err != nil {
+		return UsageResponse{}, err
+	}
+	return UsageResponse{Username: user.Username, Usage: *usage, Quota: h.quota(user)}, nil
+}
+
+// quota returns the quota that applies to a user: their own limits, the server's for the limits
+// they have none of, and no limit where the result is negative
+func (h *Handler) quota(user *model.User) model.Quota {
+	limit := func(own, server int64) int64 {
+		if own == 0 {
+			own = server
+		}
+		return max(own, 0)
+	}
+	return model.Quota{
+		LogicalBytes: limit(user.Quota.LogicalBytes, h.defaultQuota.LogicalBytes),
+		UniqueBytes:  limit(user.Quota.UniqueBytes, h.defaultQuota.UniqueBytes),
+	}
+}
+
+// reserveQuota reserves the bytes saving a chunk of a file adds to a user's usage, so that
+// chunks uploaded concurrently cannot together take the user over their quota. It describes
+// how the chunk would exceed the quota instead, or returns a release func to call once the
+// chunk is saved. Owning the file accounts all its chunks to the user, and the chunk only adds
+// unique bytes while no other user references it.
+func (h *Handler) reserveQuota(username string, userID uint, fileHash, chunkHash string, chunkOrder int, chunkSize int64) (func(), string, error) {
+	release := func() {}
+	if userID == 0 {
+		return release, "", nil
+	}
+	user, err := h.dbStorage.GetUserByUsername(username)
+	if err != nil {
+		return nil, "", err
+	}
+	quota := h.quota(user)
+	if quota == (model.Quota{}) {
+		return release, "", nil
+	}
+
+	owned, err := h.dbStorage.CheckFileOwner(fileHash, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	metadata, err := h.dbStorage.GetFileMetadata(fileHash)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var reservation model.Usage
+	reservation.LogicalBytes = chunkSize
+	if metadata != nil {
+		for _, chunk := range metadata.Chunks {
+			if chunk.ChunkOrder == chunkOrder && hasher.EqualHashes(chunk.ChunkHash, chunkHash) {
+				// a retried upload of a chunk the file already has
+				reservation.LogicalBytes = 0
+			}
+			if !owned {
+				reservation.LogicalBytes += chunk.Size
+			}
+		}
+	}
+
+	ref, err := h.dbStorage.GetChunkRef(chunkHash)
+	if err != nil {
+		return nil, "", err
+	}
+	if ref == nil || ref.Users == 0 {
+		reservation.UniqueBytes = chunkSize
+	}
+
+	h.reservedMu.Lock()
+	defer h.reservedMu.Unlock()
+
+	usage, err := h.dbStorage.GetUsage(userID)
+	if err != nil {
+		return nil, "", err
+	}
+	logicalBytes := usage.LogicalBytes + h.reserved[userID].LogicalBytes + reservation.LogicalBytes
+	if quota.LogicalBytes > 0 && reservation.LogicalBytes > 0 && logicalBytes > quota.LogicalBytes {
+		return nil, fmt.Sprintf("the file would take %d of %d logical bytes", logicalBytes, quota.LogicalBytes), nil
+	}
+	uniqueBytes := usage.UniqueBytes + h.reserved[userID].UniqueBytes + reservation.UniqueBytes
+	if quota.UniqueBytes > 0 && reservation.UniqueBytes > 0 && uniqueBytes > quota.UniqueBytes {
+		return nil, fmt.Sprintf("the chunk would take %d of %d unique bytes", uniqueBytes, quota.UniqueBytes), nil
+	}
+
+	h.addReservation(userID, reservation, 1)
+	return func() {
+		h.reservedMu.Lock()
+		defer h.reservedMu.Unlock()
+		h.addReservation(userID, reservation, -1)
+	}, "", nil
+}
+
+// addReservation adds or removes the reservation of a chunk, with reservedMu held
+func (h *Handler) addReservation(userID uint, reservation model.Usage, sign int64) {
+	if h.reserved == nil {
+		h.reserved = make(map[uint]model.Usage)
+	}
+	reserved := h.reserved[userID]
+	reserved.LogicalBytes += sign * reservation.LogicalBytes
+	reserved.UniqueBytes += sign * reservation.UniqueBytes
+	if reserved.LogicalBytes == 0 && reserved.UniqueBytes == 0 {
+		delete(h.reserved, userID)
+		return
+	}
+	h.reserved[userID] = reserved
+}
+
+// dedupRatio returns the logical bytes of files per byte of their distinct chunks, or 0 without chunks
+func dedupRatio(stats model.Stats) float64 {
+	if stats.ChunkBytes == 0 {
+		return 0
+	}
+	return float64(stats.LogicalBytes) / float64(stats.ChunkBytes)
+}
+
+// storedChunkSize returns the size of a stored chunk, reading it when no size is recorded
+func (h *Handler) storedChunkSize(chunkHash string) (int64, error) {
+	ref, err := h.dbStorage.GetChunkRef(chunkHash)
+	if err != nil {
+		return 0, err
+	}
+	if ref != nil && ref.Size > 0 {
+		return ref.Size, nil
+	}
+	content, err := h.fileStorage.GetChunkData(chunkHash)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(content)), nil
+}
+
+// scrubStatus returns the scrub status with all files marked damaged
+func (h *Handler) scrubStatus() (ScrubStatusResponse, error) {
+	damaged, err := h.dbStorage.ListDamagedFiles()
+	if err != nil {
+		return ScrubStatusResponse{}, err
+	}
+	if damaged == nil {
+		damaged = []string{}
+	}
+	return ScrubStatusResponse{Status: h.scrubber.Status(), DamagedFiles: damaged}, nil
+}
+
+// fileName returns the last element of a file name sent by a client, or an empty name if it
+// has none, so that a name never points outside the directory a file is downloaded to
+func fileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == ".." || name == "/" {
+		return ""
+	}
+	return name
+}
+
+// @Summary Grant access to a file
+// @Description Give another user read access to a file the caller owns. The user may then check, download and read the chunks of the file, but it does not count towards their usage.
+// @Tags shares
+// @Accept json
+// @Produce json
+// @Param hash path string true "File hash"
+// @Param request body GrantRequest true "User to grant access to"
+// @Success 200 {object} GrantResponse "Access granted"
+// @Failure 400 {object} map[string]interface{} "Invalid request format"
+// @Failure 404 {object} map[string]interface{} "File or user not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /files/{hash}/grants [post]
+func (h *Handler) GrantAccessHandler(c *gin.Context) {
+	fileHash := c.Param("hash")
+
+	var request GrantRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+	if !h.checkOwner(c, fileHash) {
+		return
+	}
+
+	user, err := h.dbStorage.GetUserByUsername(request.Username)
+	if errors.Is(err, storage.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.dbStorage.GrantFileAccess(fileHash, user.ID, c.GetUint("userID")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to grant access"})
+		return
+	}
+
+	grants, err := h.dbStorage.ListFileGrants(fileHash)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	response := GrantResponse{Username: user.Username}
+	for _, grant := range grants {
+		if grant.UserID == user.ID {
+			response.GrantedAt = grant.CreatedAt
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary Revoke access to a file
+// @Description Take back the read access granted to a user on a file the caller owns
+// @Tags shares
+// @Produce json
+// @Param hash path string true "File hash"
+// @Param username path string true "Username"
+// @Success 200 {object} map[string]interface{} "Access revoked"
+// @Failure 404 {object} map[string]interface{} "File, user or grant not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /files/{hash}/grants/{username} [delete]
+func (h *Handler) RevokeAccessHandler(c *gin.Context) {
+	fileHash := c.Param("hash")
+	if !h.checkOwner(c, fileHash) {
+		return
+	}
+
+	user, err := h.dbStorage.GetUserByUsername(c.Param("username"))
+	if errors.Is(err, storage.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.dbStorage.RevokeFileAccess(fileHash, user.ID); err != nil {
+		if errors.Is(err, storage.ErrGrantNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Grant not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke access"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Access revoked"})
+}
+
+// @Summary List the shares of a file
+// @Description List the users granted access to a file the caller owns and the share links to it
+// @Tags shares
+// @Produce json
+// @Param hash path string true "File hash"
+// @Success 200 {object} SharesResponse "Grants and share links"
+// @Failure 404 {object} map[string]interface{} "File not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /files/{hash}/shares [get]
+func (h *Handler) ListSharesHandler(c *gin.Context) {
+	fileHash := c.Param("hash")
+	if !h.checkOwner(c, fileHash) {
+		return
+	}
+
+	grants, err := h.dbStorage.ListFileGrants(fileHash)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	links, err := h.dbStorage.ListShareLinks(fileHash)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := SharesResponse{
+		FileHash: fileHash,
+		Grants:   make([]GrantResponse, len(grants)),
+		Links:    make([]ShareLinkResponse, len(links)),
+	}
+	for i, grant := range grants {
+		response.Grants[i] = GrantResponse{Username: grant.Username, GrantedAt: grant.CreatedAt}
+	}
+	for i, link := range links {
+		response.Links[i] = shareLinkResponse(link)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary Create a share link
+// @Description Create a link that serves a file the caller owns to anyone who has it, without authentication, until it expires. A password can be required on top of the link.
+// @Tags shares
+// @Accept json
+// @Produce json
+// @Param hash path string true "File hash"
+// @Param request body ShareLinkRequest false "Expiry and password of the link"
+// @Success 201 {object} ShareLinkResponse "Share link created"
+// @Failure 400 {object} map[string]interface{} "Invalid request format or expiry"
+// @Failure 404 {object} map[string]interface{} "File not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /files/{hash}/links [post]
+func (h *Handler) CreateShareLinkHandler(c *gin.Context) {
+	fileHash := c.Param("hash")
+
+	var request ShareLinkRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+			return
+		}
+	}
+
+	expiry := defaultShareLinkExpiry
+	if request.ExpiresIn != "" {
+		var err error
+		if expiry, err = time.ParseDuration(request.ExpiresIn); err != nil || expiry <= 0 || expiry > maxShareLinkExpiry {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid expiry %q, it must be a positive duration of at most %s", request.ExpiresIn, maxShareLinkExpiry)})
+			return
+		}
+	}
+
+	if !h.checkOwner(c, fileHash) {
+		return
+	}
+
+	token, err := newShareToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create share link"})
+		return
+	}
+	link := model.ShareLink{
+		Token:     token,
+		CreatedBy: c.GetUint("userID"),
+		ExpiresAt: time.Now().Add(expiry),
+	}
+	if request.Password != "" {
+		if link.Password, err = auth.HashAndSaltPassword([]byte(request.Password)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create share link"})
+			return
+		}
+	}
+
+	if err := h.dbStorage.CreateShareLink(fileHash, &link); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create share link"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, shareLinkResponse(link))
+}
+
+// @Summary Delete a share link
+// @Description Revoke a share link to a file the caller owns
+// @Tags shares
+// @Produce json
+// @Param hash path string true "File hash"
+// @Param token path string true "Share link token"
+// @Success 200 {object} map[string]interface{} "Share link deleted"
+// @Failure 404 {object} map[string]interface{} "File or share link not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /files/{hash}/links/{token} [delete]
+func (h *Handler) DeleteShareLinkHandler(c *gin.Context) {
+	fileHash := c.Param("hash")
+	if !h.checkOwner(c, fileHash) {
+		return
+	}
+
+	if err := h.dbStorage.DeleteShareLink(fileHash, c.Param("token")); err != nil {
+		if errors.Is(err, storage.ErrShareLinkNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete share link"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Share link deleted"})
+}
+
+// @Summary Download a shared file
+// @Description Download the content of a file through a share link, without authentication. Links protected by a password need it in the X-Share-Password header.
+// @Tags shares
+// @Produce octet-stream
+// @Param token path string true "Share link token"
+// @Param X-Share-Password header string false "Password of the share link"
+// @Success 200 {file} binary "File content"
+// @Failure 401 {object} map[string]interface{} "Wrong or missing password"
+// @Failure 404 {object} map[string]interface{} "Share link not found"
+// @Failure 410 {object} map[string]interface{} "Share link expired"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /shared/{token} [get]
+func (h *Handler) SharedFileHandler(c *gin.Context) {
+	link, err := h.dbStorage.GetShareLink(c.Param("token"))
+	if errors.Is(err, storage.ErrShareLinkNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if time.Now().After(link.ExpiresAt) {
+		c.JSON(http.StatusGone, gin.H{"error": "Share link expired"})
+		return
+	}
+	if len(link.Password) > 0 {
+		password := c.GetHeader("X-Share-Password")
+		if password == "" || !auth.VerifyPassword(link.Password, password) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Wrong or missing share link password"})
+			return
+		}
+	}
+
+	metadata, err := h.dbStorage.GetFileMetadata(link.FileHash)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if metadata == nil || len(metadata.Chunks) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found"})
+		return
+	}
+	sort.Slice(metadata.Chunks, func(i, j int) bool {
+		return metadata.Chunks[i].ChunkOrder < metadata.Chunks[j].ChunkOrder
+	})
+
+	// the name given by the first uploader only goes out through the links they created
+	name := ""
+	if metadata.Name != "" && metadata.Uploader != "" {
+		uploader, err := h.dbStorage.GetUserByUsername(metadata.Uploader)
+		if err != nil && !errors.Is(err, storage.ErrUserNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err == nil && uploader.ID == link.CreatedBy {
+			name = metadata.Name
+		}
+	}
+
+	contentType := metadata.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Type", contentType)
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": name})
+	if name == "" || disposition == "" {
+		disposition = "attachment"
+	}
+	c.Header("Content-Disposition", disposition)
+	if metadata.Size > 0 {
+		c.Header("Content-Length", strconv.FormatInt(metadata.Size, 10))
+	}
+	c.Status(http.StatusOK)
+
+	// the file is streamed chunk by chunk; a chunk that cannot be read or no longer matches its hash
+	// cuts the response short, which the client sees as a truncated download
+	for _, chunk := range metadata.Chunks {
+		content, err := h.fileStorage.GetChunkData(chunk.ChunkHash)
+		if err != nil {
+			log.Printf("Failed to read chunk %s of shared file %s: %v\n", chunk.ChunkHash, link.FileHash, err)
+			c.Abort()
+			return
+		}
+		if ok, _ := hasher.VerifyChunkHash(content, chunk.ChunkHash); !ok {
+			log.Printf("Chunk %s of shared file %s does not match its hash\n", chunk.ChunkHash, link.FileHash)
+			c.Abort()
+			return
+		}
+		if _, err := c.Writer.Write(content); err != nil {
+			c.Abort()
+			return
+		}
+	}
+}
+
+// @Summary Create a directory
+// @Description Create a directory in the namespace of the caller. With parents set, missing parent directories are created too and a directory that exists is not an error.
+// @Tags namespace
+// @Accept json
+// @Produce json
+// @Param request body MkdirRequest true "Directory to create"
+// @Success 200 {object} PathEntryResponse "Directory exists"
+// @Success 201 {object} PathEntryResponse "Directory created"
+// @Failure 400 {object} map[string]interface{} "Invalid request format or path"
+// @Failure 404 {object} map[string]interface{} "Parent directory not found"
+// @Failure 409 {object} map[string]interface{} "Path already exists"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /fs/mkdir [post]
+func (h *Handler) MkdirHandler(c *gin.Context) {
+	var request MkdirRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+	dirPath, ok := cleanPath(request.Path)
+	if !ok || dirPath == "/" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid path"})
+		return
+	}
+
+	userID := c.GetUint("userID")
+	if !request.Parents {
+		entry, err := h.dbStorage.CreateDirectory(userID, dirPath)
+		if err != nil {
+			pathError(c, err, "Failed to create directory")
+			return
+		}
+		c.JSON(http.StatusCreated, pathEntryResponse(*entry))
+		return
+	}
+
+	// create each missing directory from the root down, keeping those that exist
+	var entry *model.PathEntry
+	created := false
+	for i := 1; i <= len(dirPath); i++ {
+		if i < len(dirPath) && dirPath[i] != '/' {
+			continue
+		}
+		var err error
+		entry, err = h.dbStorage.CreateDirectory(userID, dirPath[:i])
+		if errors.Is(err, storage.ErrPathExists) {
+			if entry, err = h.dbStorage.GetPathEntry(userID, dirPath[:i]); err == nil && !entry.IsDir {
+				err = storage.ErrPathExists
+			}
+			created = false
+		} else {
+			created = true
+		}
+		if err != nil {
+			pathError(c, err, "Failed to create directory")
+			return
+		}
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, pathEntryResponse(*entry))
+}
+
+// @Summary List a directory
+// @Description List the directories and files of a directory in the namespace of the caller, directories first. Listing a file returns the file alone.
+// @Tags namespace
+// @Produce json
+// @Param path query string false "Directory to list, the root by default"
+// @Success 200 {object} ListDirectoryResponse "Directory entries"
+// @Failure 400 {object} map[string]interface{} "Invalid path"
+// @Failure 404 {object} map[string]interface{} "Path not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /fs/ls [get]
+func (h *Handler) ListDirectoryHandler(c *gin.Context) {
+	dirPath, ok := cleanPath(c.DefaultQuery("path", "/"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid path"})
+		return
+	}
+
+	userID := c.GetUint("userID")
+	entries, err := h.dbStorage.ListDirectory(userID, dirPath)
+	if errors.Is(err, storage.ErrNotDirectory) {
+		var entry *model.PathEntry
+		if entry, err = h.dbStorage.GetPathEntry(userID, dirPath); err == nil {
+			entries = []model.PathEntry{*entry}
+		}
+	}
+	if err != nil {
+		pathError(c, err, "Failed to list directory")
+		return
+	}
+
+	response := ListDirectoryResponse{
+		Path:    dirPath,
+		Entries: make([]PathEntryResponse, len(entries)),
+	}
+	for i, entry := range entries {
+		response.Entries[i] = pathEntryResponse(entry)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary Describe a path
+// @Description Describe the directory or file at a path in the namespace of the caller
+// @Tags namespace
+// @Produce json
+// @Param path query string true "Path to describe"
+// @Success 200 {object} PathEntryResponse "Directory or file"
+// @Failure 400 {object} map[string]interface{} "Invalid path"
+// @Failure 404 {object} map[string]interface{} "Path not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /fs/stat [get]
+func (h *Handler) StatPathHandler(c *gin.Context) {
+	entryPath, ok := cleanPath(c.Query("path"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid path"})
+		return
+	}
+	if entryPath == "/" {
+		c.JSON(http.StatusOK, PathEntryResponse{Path: "/", Name: "/", Type: "dir"})
+		return
+	}
+
+	entry, err := h.dbStorage.GetPathEntry(c.GetUint("userID"), entryPath)
+	if err != nil {
+		pathError(c, err, "Failed to get path")
+		return
+	}
+
+	c.JSON(http.StatusOK, pathEntryResponse(*entry))
+}
+
+// @Summary Move a path
+// @Description Move or rename a file or directory in the namespace of the caller, with everything below a directory. Moving to a directory moves the entry into it.
+// @Tags namespace
+// @Accept json
+// @Produce json
+// @Param request body MoveRequest true "Paths to move from and to"
+// @Success 200 {object} PathEntryResponse "Moved entry"
+// @Failure 400 {object} map[string]interface{} "Invalid request format or path"
+// @Failure 404 {object} map[string]interface{} "Path or parent directory not found"
+// @Failure 409 {object} map[string]interface{} "Path already exists"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /fs/mv [post]
+func (h *Handler) MovePathHandler(c *gin.Context) {
+	var request MoveRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+	fromPath, fromOK := cleanPath(request.From)
+	toPath, toOK := cleanPath(request.To)
+	if !fromOK || !toOK || fromPath == "/" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid path"})
+		return
+	}
+
+	userID := c.GetUint("userID")
+	target, err := h.dbStorage.GetPathEntry(userID, toPath)
+	if toPath == "/" || err == nil && target.IsDir {
+		toPath = path.Join(toPath, path.Base(fromPath))
+	} else if err != nil && !errors.Is(err, storage.ErrPathNotFound) {
+		pathError(c, err, "Failed to move path")
+		return
+	}
+
+	entry, err := h.dbStorage.MovePath(userID, fromPath, toPath)
+	if err != nil {
+		pathError(c, err, "Failed to move path")
+		return
+	}
+
+	c.JSON(http.StatusOK, pathEntryResponse(*entry))
+}
+
+// @Summary Remove a path
+// @Description Remove a file or an empty directory from the namespace of the caller, or a directory with everything below it when recursive. The files stay among the files of the caller, deleting a file by its hash removes it from them.
+// @Tags namespace
+// @Produce json
+// @Param path query string true "Path to remove"
+// @Param recursive query bool false "Remove everything below a directory too"
+// @Success 200 {object} RemovePathResponse "Path removed"
+// @Failure 400 {object} map[string]interface{} "Invalid path"
+// @Failure 404 {object} map[string]interface{} "Path not found"
+// @Failure 409 {object} map[string]interface{} "Directory not empty"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /fs/rm [delete]
+func (h *Handler) RemovePathHandler(c *gin.Context) {
+	entryPath, ok := cleanPath(c.Query("path"))
+	if !ok || entryPath == "/" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid path"})
+		return
+	}
+	recursive, _ := strconv.ParseBool(c.Query("recursive"))
+
+	removed, err := h.dbStorage.DeletePath(c.GetUint("userID"), entryPath, recursive)
+	if err != nil {
+		pathError(c, err, "Failed to remove path")
+		return
+	}
+
+	c.JSON(http.StatusOK, RemovePathResponse{
+		Message: "Path removed successfully",
+		Path:    entryPath,
+		Removed: removed,
+	})
+}
+
+// @Summary Save a file at a path
+// @Description Save a file the caller owns at a path of their namespace, replacing the file saved there before. The parent directory must exist.
+// @Tags namespace
+// @Accept json
+// @Produce json
+// @Param request body SaveFileRequest true "Path and file hash"
+// @Success 200 {object} PathEntryResponse "File saved at the path"
+// @Failure 400 {object} map[string]interface{} "Invalid request format or path"
+// @Failure 404 {object} map[string]interface{} "File or parent directory not found"
+// @Failure 409 {object} map[string]interface{} "Path is a directory"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /fs/files [put]
+func (h *Handler) SaveFilePathHandler(c *gin.Context) {
+	var request SaveFileRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+	filePath, ok := cleanPath(request.Path)
+	if !ok || filePath == "/" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid path"})
+		return
+	}
+	if !h.checkOwner(c, request.FileHash) {
+		return
+	}
+
+	entry, err := h.dbStorage.SaveFilePath(c.GetUint("userID"), filePath, request.FileHash)
+	if err != nil {
+		pathError(c, err, "Failed to save file path")
+		return
+	}
+
+	c.JSON(http.StatusOK, pathEntryResponse(*entry))
+}
+
+// checkOwner checks that the caller owns a file, and answers 404 Not Found when they do not,
+// so the files of other users are indistinguishable from missing ones
+func (h *Handler) checkOwner(c *gin.Context, fileHash string) bool {
+	owned, err := h.dbStorage.CheckFileOwner(fileHash, c.GetUint("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if !owned {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return false
+	}
+	return true
+}
+
+// newShareToken returns a random, URL-safe share link token
+func newShareToken() (string, error) {
+	token := make([]byte, 24)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// shareLinkResponse describes a share link to its owner
+func shareLinkResponse(link model.ShareLink) ShareLinkResponse {
+	return ShareLinkResponse{
+		Token:     link.Token,
+		Path:      "/shared/" + link.Token,
+		Protected: len(link.Password) > 0,
+		ExpiresAt: link.ExpiresAt,
+		Expired:   time.Now().After(link.ExpiresAt),
+		CreatedAt: link.CreatedAt,
+	}
+}
+
+// canAccessFile checks if the caller may read a file. Administrators may read every file,
+// including those stored before owners were recorded.
+func (h *Handler) canAccessFile(c *gin.Context, fileHash string) (bool, error) {
+	if h.admins[c.GetString("username")] {
+		return true, nil
+	}
+	return h.dbStorage.CheckFileAccess(fileHash, c.GetUint("userID"))
+}
+
+// isUploader reports whether username first uploaded a file, whose name is theirs to see
+func isUploader(metadata *model.FileMetadata, username string) bool {
+	return metadata.Uploader != "" && metadata.Uploader == username
+}
+
+// parseChunker validates a chunker config string, files recorded without one used the default fixed-size chunker
+func parseChunker(chunker string) (string, error) {
+	if chunker == "" {
+		return hasher.DefaultChunkerConfig().String(), nil
+	}
+
+	config, err := hasher.ParseChunkerConfig(chunker)
+	if err != nil {
+		return "", err
+	}
+	return config.String(), nil
+}
+
+// cleanPath cleans a path of the namespace of a user, which must be absolute
+func cleanPath(entryPath string) (string, bool) {
+	if !strings.HasPrefix(entryPath, "/") || len(entryPath) > maxPathLength || strings.ContainsRune(entryPath, 0) {
+		return "", false
+	}
+	return path.Clean(entryPath), true
+}
+
+// pathEntryResponse describes a path entry
+func pathEntryResponse(entry model.PathEntry) PathEntryResponse {
+	response := PathEntryResponse{
+		Path:      entry.Path,
+		Name:      path.Base(entry.Path),
+		Type:      "file",
+		CreatedAt: &entry.CreatedAt,
+		UpdatedAt: &entry.UpdatedAt,
+	}
+	if entry.IsDir {
+		response.Type = "dir"
+		return response
+	}
+	response.FileHash = entry.FileHash
+	response.Size = entry.Size
+	response.ContentType = entry.ContentType
+	return response
+}
+
+// pathError answers a failed namespace operation, with message for unexpected errors
+func pathError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, storage.ErrPathNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Path not found"})
+	case errors.Is(err, storage.ErrParentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Parent directory not found"})
+	case errors.Is(err, storage.ErrFileNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+	case errors.Is(err, storage.ErrPathExists):
+		c.JSON(http.StatusConflict, gin.H{"error": "Path already exists"})
+	case errors.Is(err, storage.ErrDirectoryNotEmpty):
+		c.JSON(http.StatusConflict, gin.H{"error": "Directory not empty"})
+	case errors.Is(err, storage.ErrInvalidMove):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot move a directory into itself"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -1,746 +1,2183 @@
 package api
 
-// import (
-// 	"bytes"
-// 	"encoding/json"
-// 	"errors"
-// 	"io/ioutil"
-// 	"net/http"
-// 	"net/http/httptest"
-// 	"testing"
-// 	"time"
-// 	"zerodupe/internal/server/auth"
-// 	"zerodupe/internal/server/model"
-// 	"zerodupe/pkg/hasher"
-
-// 	"github.com/gin-gonic/gin"
-// 	"github.com/golang-jwt/jwt"
-// 	"github.com/stretchr/testify/assert"
-// 	"github.com/stretchr/testify/mock"
-// 	"github.com/stretchr/testify/require"
-// 	"gorm.io/gorm"
-// )
-
-// // setupTestEnv sets up a test environment for the API handlers
-// func setupTestEnv() (*gin.Engine, *Handler, *MockFileStorage, *MockUserStorage, *MockTokenHandler) {
-// 	gin.SetMode(gin.TestMode)
-// 	router := gin.New()
-
-// 	fileStorage := new(MockFileStorage)
-// 	userStorage := new(MockUserStorage)
-// 	tokenHandler := new(MockTokenHandler)
-
-// 	handler := NewHandler(fileStorage, userStorage, tokenHandler)
-
-// 	return router, handler, fileStorage, userStorage, tokenHandler
-// }
-
-// // create a new HTTP request with a JSON body and set Content-Type
-// func newRequest(t *testing.T, method, url string, body interface{}) *http.Request {
-// 	var buf bytes.Buffer
-// 	if body != nil {
-// 		err := json.NewEncoder(&buf).Encode(body)
-// 		require.NoError(t, err)
-// 	}
-// 	req, err := http.NewRequest(method, url, &buf)
-// 	require.NoError(t, err)
-// 	req.Header.Set("Content-Type", "application/json")
-// 	return req
-// }
-
-// // perform a request and return the response
-// func applyRequest(router *gin.Engine, req *http.Request) *httptest.ResponseRecorder {
-// 	w := httptest.NewRecorder()
-// 	router.ServeHTTP(w, req)
-// 	return w
-// }
-
-// func Test_SignUpHandler(t *testing.T) {
-// 	t.Run("Test_SignUpHandler_Creates_A_New_User", func(t *testing.T) {
-// 		router, handler, _, userStorage, _ := setupTestEnv()
-// 		router.POST("/auth/signup", handler.SignUpHandler)
-
-// 		username := "username"
-
-// 		reqBody := SignUpRequest{
-// 			Username:        username,
-// 			Password:        "test",
-// 			ConfirmPassword: "test",
-// 		}
-
-// 		userStorage.On("GetUserByUsername", username).Return(nil, gorm.ErrRecordNotFound).Once()
-
-// 		userStorage.On("CreateUser", mock.AnythingOfType("*model.User")).Return(nil).Run(func(args mock.Arguments) {
-// 			user := args.Get(0).(*model.User)
-// 			assert.Equal(t, username, user.Username)
-// 		})
-
-// 		req := newRequest(t, "POST", "/auth/signup", reqBody)
-// 		w := applyRequest(router, req)
-
-// 		assert.Equal(t, http.StatusOK, w.Code)
-// 		assert.JSONEq(t, `"user registered successfully"`, w.Body.String())
-// 		userStorage.AssertExpectations(t)
-// 	})
-
-// 	t.Run("Test_SignUpHandler_With_Invalid_Request_Format", func(t *testing.T) {
-// 		router, handler, _, _, _ := setupTestEnv()
-// 		router.POST("/auth/signup", handler.SignUpHandler)
-
-// 		req := newRequest(t, "POST", "/auth/signup", nil)
-// 		req.Body = ioutil.NopCloser(bytes.NewBuffer([]byte("invalid"))) // override with invalid body
-// 		w := applyRequest(router, req)
-
-// 		assert.Equal(t, http.StatusBadRequest, w.Code)
-// 		assert.Contains(t, w.Body.String(), "Invalid request format")
-// 	})
-
-// 	t.Run("Test_SignUpHandler_With_Username_Already_Exists", func(t *testing.T) {
-// 		router, handler, _, userStorage, _ := setupTestEnv()
-// 		router.POST("/auth/signup", handler.SignUpHandler)
-// 		username := "username"
-
-// 		reqBody := SignUpRequest{
-// 			Username:        username,
-// 			Password:        "test",
-// 			ConfirmPassword: "test",
-// 		}
-
-// 		userStorage.On("GetUserByUsername", username).
-// 			Return(&model.User{Username: username}, nil).
-// 			Once()
-
-// 		req := newRequest(t, "POST", "/auth/signup", reqBody)
-// 		w := applyRequest(router, req)
-
-// 		assert.Equal(t, http.StatusConflict, w.Code)
-// 		assert.Contains(t, w.Body.String(), "user already exists")
-
-// 		userStorage.AssertExpectations(t)
-
-// 	})
-
-// 	t.Run("Test_SignUpHandler_With_Failed_To_Create_User", func(t *testing.T) {
-// 		router, handler, _, userStorage, _ := setupTestEnv()
-// 		router.POST("/auth/signup", handler.SignUpHandler)
-
-// 		reqBody := SignUpRequest{
-// 			Username:        "test",
-// 			Password:        "test",
-// 			ConfirmPassword: "test",
-// 		}
-
-// 		userStorage.On("GetUserByUsername", "test").Return(nil, gorm.ErrRecordNotFound).Once()
-
-// 		userStorage.On("CreateUser", mock.AnythingOfType("*model.User")).Return(gorm.ErrDuplicatedKey).Once()
-
-// 		req := newRequest(t, "POST", "/auth/signup", reqBody)
-// 		w := applyRequest(router, req)
-
-// 		assert.Equal(t, http.StatusInternalServerError, w.Code)
-// 		assert.Contains(t, w.Body.String(), "internal server error")
-
-// 		userStorage.AssertExpectations(t)
-
-// 	})
-// }
-
-// func Test_LoginHandler(t *testing.T) {
-
-// 	t.Run("Test_LoginHandler_With_Valid_Credentials", func(t *testing.T) {
-// 		router, handler, _, userStorage, tokenHandler := setupTestEnv()
-// 		router.POST("/auth/login", handler.LoginHandler)
-
-// 		reqBody := LoginRequest{
-// 			Username: "test",
-// 			Password: "test",
-// 		}
-
-// 		user := &model.User{
-// 			ID:       1,
-// 			Username: "test",
-// 			Password: []byte("hashed"),
-// 		}
-
-// 		userStorage.On("GetUserByUsername", "test").Return(user, nil).Once()
-
-// 		tokenHandler.On("CreateTokenPair", uint(1), user.Username).Return(&auth.TokenPair{
-// 			AccessToken:  "access-token",
-// 			RefreshToken: "refresh-token",
-// 		}, nil).Once()
-
-// 		req := newRequest(t, "POST", "/auth/login", reqBody)
-// 		w := applyRequest(router, req)
-// 		assert.Equal(t, http.StatusOK, w.Code)
-
-// 		var response auth.TokenPair
-// 		err := json.Unmarshal(w.Body.Bytes(), &response)
-// 		assert.NoError(t, err)
-
-// 		assert.Equal(t, "access-token", response.AccessToken)
-// 		assert.Equal(t, "refresh-token", response.RefreshToken)
-
-// 		userStorage.AssertExpectations(t)
-// 		tokenHandler.AssertExpectations(t)
-
-// 	})
-
-// 	t.Run("Test_LoginHandler_With_Invalid_Request_Format", func(t *testing.T) {
-// 		router, handler, _, userStorage, _ := setupTestEnv()
-// 		router.POST("/auth/login", handler.LoginHandler)
-
-// 		req := newRequest(t, "POST", "/auth/login", nil)
-// 		req.Body = ioutil.NopCloser(bytes.NewBuffer([]byte("invalid"))) // override with invalid body
-// 		w := applyRequest(router, req)
-
-// 		assert.Equal(t, http.StatusBadRequest, w.Code)
-// 		assert.Contains(t, w.Body.String(), "Invalid request format")
-
-// 		userStorage.AssertExpectations(t)
-
-// 	})
-
-// 	t.Run("Test_LoginHandler_With_Non_Existing_User", func(t *testing.T) {
-// 		router, handler, _, userStorage, _ := setupTestEnv()
-// 		router.POST("/auth/login", handler.LoginHandler)
-
-// 		reqBody := LoginRequest{
-// 			Username: "test",
-// 			Password: "test",
-// 		}
-
-// 		userStorage.On("GetUserByUsername", "test").Return(nil, gorm.ErrRecordNotFound).Once()
-
-// 		req := newRequest(t, "POST", "/auth/login", reqBody)
-// 		w := applyRequest(router, req)
-
-// 		assert.Equal(t, http.StatusNotFound, w.Code)
-// 		assert.Contains(t, w.Body.String(), "user does not exist")
-
-// 		userStorage.AssertExpectations(t)
-
-// 	})
-
-// }
-
-// func Test_RefreshTokenHandler(t *testing.T) {
-
-// 	t.Run("Test_RefreshTokenHandler_With_Valid_Refresh_Token", func(t *testing.T) {
-// 		router, handler, _, _, tokenHandler := setupTestEnv()
-// 		router.POST("/auth/refresh", handler.RefreshTokenHandler)
-
-// 		claims := auth.TokenClaims{
-// 			Username: "test",
-// 			UserID:   1,
-// 			StandardClaims: jwt.StandardClaims{
-// 				ExpiresAt: time.Now().Add(24 * time.Hour).Unix(),
-// 				IssuedAt:  time.Now().Unix(),
-// 			},
-// 		}
-// 		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-// 		tokenString, err := token.SignedString([]byte("test-secret"))
-// 		assert.NoError(t, err)
-
-// 		tokenHandler.On("RefreshAccessToken", tokenString).Return("new-access-token", nil).Once()
-
-// 		reqBody := map[string]string{
-// 			"refresh_token": tokenString,
-// 		}
-
-// 		req := newRequest(t, "POST", "/auth/refresh", reqBody)
-// 		w := applyRequest(router, req)
-
-// 		assert.Equal(t, http.StatusOK, w.Code)
-
-// 		var response struct {
-// 			AccessToken string `json:"access_token"`
-// 		}
-// 		err = json.Unmarshal(w.Body.Bytes(), &response)
-// 		assert.NoError(t, err)
-
-// 		assert.NotEmpty(t, response.AccessToken)
-
-// 	})
-
-// 	t.Run("Test_RefreshTokenHandler_With_Invalid_Request_Format", func(t *testing.T) {
-// 		router, handler, _, _, _ := setupTestEnv()
-// 		router.POST("/auth/refresh", handler.RefreshTokenHandler)
-
-// 		req := newRequest(t, "POST", "/auth/refresh", nil)
-// 		req.Body = ioutil.NopCloser(bytes.NewBuffer([]byte("invalid"))) // override with invalid body
-// 		w := applyRequest(router, req)
-
-// 		assert.Equal(t, http.StatusBadRequest, w.Code)
-// 		assert.Contains(t, w.Body.String(), "Invalid request format")
-
-// 	})
-
-// 	t.Run("Test_RefreshTokenHandler_With_Invalid_Refresh_Token", func(t *testing.T) {
-// 		router, handler, _, _, tokenHandler := setupTestEnv()
-// 		router.POST("/auth/refresh", handler.RefreshTokenHandler)
-
-// 		reqBody := map[string]string{
-// 			"refresh_token": "invalid",
-// 		}
-// 		tokenHandler.On("RefreshAccessToken", "invalid").Return("", errors.New("invalid token")).Once()
-// 		req := newRequest(t, "POST", "/auth/refresh", reqBody)
-// 		w := applyRequest(router, req)
-
-// 		assert.Equal(t, http.StatusUnauthorized, w.Code)
-// 		assert.Contains(t, w.Body.String(), "Invalid refresh token")
-
-// 	})
-
-// }
-
-// func Test_UploadFileHandler(t *testing.T) {
-// 	t.Run("Test_UploadFileHandler_With_Valid_Request_One_Chunk_File", func(t *testing.T) {
-// 		router, handler, fileStorage, _, _ := setupTestEnv()
-// 		router.POST("/upload", handler.UploadFileHandler)
-
-// 		chunkHash := hasher.CalculateChunkHash([]byte("Hello World!"))
-// 		content := []byte("Hello World!")
-
-// 		uploadRequest := UploadRequest{
-// 			FileHash:   chunkHash,
-// 			ChunkHash:  chunkHash,
-// 			ChunkOrder: 1,
-// 			Content:    content,
-// 		}
-
-// 		fileStorage.On("SaveChunkData", chunkHash, content).Return(chunkHash, nil).Once()
-
-// 		req := newRequest(t, "POST", "/upload", uploadRequest)
-// 		w := applyRequest(router, req)
-
-// 		assert.Equal(t, http.StatusOK, w.Code)
-
-// 		var response UploadResponse
-// 		err := json.Unmarshal(w.Body.Bytes(), &response)
-// 		require.NoError(t, err)
-
-// 		assert.Equal(t, "File uploaded successfully", response.Message)
-// 		assert.Equal(t, chunkHash, response.FileHash)
-// 		assert.False(t, response.HashMismatch)
-
-// 		fileStorage.AssertExpectations(t)
-
-// 	})
-
-// 	t.Run("Test_UploadFileHandler_With_Valid_Request_Multi_Chunk_File", func(t *testing.T) {
-// 		router, handler, fileStorage, _, _ := setupTestEnv()
-// 		router.POST("/upload", handler.UploadFileHandler)
-
-// 		fileHash := "fileHash756456"
-// 		chunkHash := hasher.CalculateChunkHash([]byte("Hello World!"))
-// 		content := []byte("Hello World!")
-
-// 		uploadRequest := UploadRequest{
-// 			FileHash:   fileHash,
-// 			ChunkHash:  chunkHash,
-// 			ChunkOrder: 1,
-// 			Content:    content,
-// 		}
-
-// 		fileStorage.On("SaveChunkMetadata", fileHash, chunkHash, 1).Return(nil).Once()
-// 		fileStorage.On("SaveChunkData", chunkHash, content).Return(chunkHash, nil).Once()
-
-// 		req := newRequest(t, "POST", "/upload", uploadRequest)
-// 		w := applyRequest(router, req)
-
-// 		assert.Equal(t, http.StatusOK, w.Code)
-
-// 		var response UploadResponse
-// 		err := json.Unmarshal(w.Body.Bytes(), &response)
-// 		require.NoError(t, err)
-
-// 		assert.Equal(t, "File uploaded successfully", response.Message)
-// 		assert.Equal(t, fileHash, response.FileHash)
-// 		assert.False(t, response.HashMismatch)
-
-// 		fileStorage.AssertExpectations(t)
-
-// 	})
-
-// 	t.Run("Test_UploadFileHandler_With_Invalid_Request_Format", func(t *testing.T) {
-// 		router, handler, _, _, _ := setupTestEnv()
-// 		router.POST("/upload", handler.UploadFileHandler)
-
-// 		req := newRequest(t, "POST", "/upload", nil)
-// 		req.Body = ioutil.NopCloser(bytes.NewBuffer([]byte("invalid"))) // override with invalid body
-// 		w := applyRequest(router, req)
-
-// 		assert.Equal(t, http.StatusBadRequest, w.Code)
-// 		assert.Contains(t, w.Body.String(), "Invalid request format")
-
-// 	})
-
-// 	t.Run("Test_UploadFileHandler_With_Internal_Server_Error", func(t *testing.T) {
-// 		router, handler, fileStorage, _, _ := setupTestEnv()
-// 		router.POST("/upload", handler.UploadFileHandler)
-
-// 		chunkHash := hasher.CalculateChunkHash([]byte("Hello World!"))
-// 		content := []byte("Hello World!")
-
-// 		uploadRequest := UploadRequest{
-// 			FileHash:   chunkHash,
-// 			ChunkHash:  chunkHash,
-// 			ChunkOrder: 1,
-// 			Content:    content,
-// 		}
-
-// 		fileStorage.On("SaveChunkData", chunkHash, content).Return("", errors.New("test error")).Once()
-
-// 		req := newRequest(t, "POST", "/upload", uploadRequest)
-// 		w := applyRequest(router, req)
-
-// 		assert.Equal(t, http.StatusInternalServerError, w.Code)
-// 		assert.Contains(t, w.Body.String(), "Failed to save chunk data")
-
-// 		fileStorage.AssertExpectations(t)
-// 	})
-
-// }
-
-// func Test_CheckFileHashHandler(t *testing.T) {
-// 	t.Run("Test_CheckFileHashHandler_With_Valid_Request", func(t *testing.T) {
-// 		router, handler, fileStorage, _, _ := setupTestEnv()
-// 		router.GET("/check/:filehash", handler.CheckFileHashHandler)
-
-// 		fileHash := "fileHash756456"
-
-// 		fileStorage.On("CheckFileExists", fileHash).Return(true, nil).Once()
-
-// 		req := newRequest(t, "GET", "/check/"+fileHash, nil)
-// 		w := applyRequest(router, req)
-
-// 		assert.Equal(t, http.StatusOK, w.Code)
-
-// 		var response CheckFileResponse
-// 		err := json.Unmarshal(w.Body.Bytes(), &response)
-// 		require.NoError(t, err)
-
-// 		assert.True(t, response.Exists)
-// 		assert.Equal(t, fileHash, response.Hash)
-
-// 		fileStorage.AssertExpectations(t)
-// 	})
-
-// 	t.Run("Test_CheckFileHashHandler_With_Invalid_File_Hash", func(t *testing.T) {
-// 		router, handler, _, _, _ := setupTestEnv()
-// 		router.GET("/check/:filehash", handler.CheckFileHashHandler)
-
-// 		fileHash := "fi"
-// 		req := newRequest(t, "GET", "/check/"+fileHash, nil)
-// 		w := applyRequest(router, req)
-
-// 		assert.Equal(t, http.StatusBadRequest, w.Code)
-// 		assert.Contains(t, w.Body.String(), "Invalid file hash")
-
-// 	})
-
-// 	t.Run("Test_CheckFileHashHandler_With_Internal_Server_Error", func(t *testing.T) {
-// 		router, handler, fileStorage, _, _ := setupTestEnv()
-// 		router.GET("/check/:filehash", handler.CheckFileHashHandler)
-
-// 		fileHash := "fileHash756456"
-
-// 		fileStorage.On("CheckFileExists", fileHash).Return(false, errors.New("test error")).Once()
-
-// 		req := newRequest(t, "GET", "/check/"+fileHash, nil)
-// 		w := applyRequest(router, req)
-
-// 		assert.Equal(t, http.StatusInternalServerError, w.Code)
-// 		assert.Contains(t, w.Body.String(), "test error")
-
-// 		fileStorage.AssertExpectations(t)
-// 	})
-
-// }
-
-// func Test_CheckChunkHashesHandler(t *testing.T) {
-// 	t.Run("Test_CheckChunkHashesHandler_With_Valid_Request", func(t *testing.T) {
-// 		router, handler, fileStorage, _, _ := setupTestEnv()
-// 		router.POST("/check", handler.CheckChunkHashesHandler)
-
-// 		hashes := []string{"hash1", "hash2", "hash3"}
-// 		missing := []string{"hash2", "hash3"}
-
-// 		fileStorage.On("CheckChunkExists", hashes).Return([]string{}, missing, nil).Once()
-
-// 		reqBody := map[string][]string{
-// 			"hashes": hashes,
-// 		}
-
-// 		req := newRequest(t, "POST", "/check", reqBody)
-// 		w := applyRequest(router, req)
-
-// 		assert.Equal(t, http.StatusOK, w.Code)
-
-// 		var response CheckChunksResponse
-// 		err := json.Unmarshal(w.Body.Bytes(), &response)
-// 		require.NoError(t, err)
-
-// 		assert.Equal(t, missing, response.Missing)
-
-// 		fileStorage.AssertExpectations(t)
-// 	})
-
-// 	t.Run("Test_CheckChunkHashesHandler_With_Invalid_Request_Format", func(t *testing.T) {
-// 		router, handler, _, _, _ := setupTestEnv()
-// 		router.POST("/check", handler.CheckChunkHashesHandler)
-
-// 		req := newRequest(t, "POST", "/check", nil)
-// 		req.Body = ioutil.NopCloser(bytes.NewBuffer([]byte("invalid"))) // override with invalid body
-// 		w := applyRequest(router, req)
-
-// 		assert.Equal(t, http.StatusBadRequest, w.Code)
-
-// 	})
-
-// 	t.Run("Test_CheckChunkHashesHandler_With_Internal_Server_Error", func(t *testing.T) {
-// 		router, handler, fileStorage, _, _ := setupTestEnv()
-// 		router.POST("/check", handler.CheckChunkHashesHandler)
-
-// 		hashes := []string{"hash1", "hash2", "hash3"}
-
-// 		fileStorage.On("CheckChunkExists", hashes).Return([]string{}, []string{}, errors.New("test error")).Once()
-
-// 		reqBody := map[string][]string{
-// 			"hashes": hashes,
-// 		}
-
-// 		req := newRequest(t, "POST", "/check", reqBody)
-// 		w := applyRequest(router, req)
-
-// 		assert.Equal(t, http.StatusInternalServerError, w.Code)
-// 		assert.Contains(t, w.Body.String(), "test error")
-
-// 		fileStorage.AssertExpectations(t)
-// 	})
-// }
-
-// func Test_DownloadFileHandler(t *testing.T) {
-// 	t.Run("Test_DownloadFileHandler_With_Valid_Request", func(t *testing.T) {
-// 		router, handler, fileStorage, _, _ := setupTestEnv()
-// 		router.GET("/download/:hash", handler.DownloadFileHandler)
-
-// 		fileHash := "fileHash756456"
-// 		fileStorage.On("GetFileMetadata", fileHash).Return(&model.FileMetadata{
-// 			Chunks: []model.ChunkMetadata{
-// 				{
-// 					ChunkOrder: 1,
-// 					ChunkHash:  "chunkhash123456789",
-// 				},
-// 			},
-// 		}, nil).Once()
-
-// 		req := newRequest(t, "GET", "/download/"+fileHash, nil)
-// 		w := applyRequest(router, req)
-
-// 		assert.Equal(t, http.StatusOK, w.Code)
-
-// 		var response DownloadFileResponse
-// 		err := json.Unmarshal(w.Body.Bytes(), &response)
-// 		require.NoError(t, err)
-
-// 		assert.Equal(t, response.ChunkHashes, []string{"chunkhash123456789"})
-// 		assert.Equal(t, response.ChunksCount, 1)
-// 		assert.Equal(t, response.FileHash, fileHash)
-
-// 	})
-
-// 	t.Run("Test_DownloadFileHandler_With_Non_Existing_Request", func(t *testing.T) {
-// 		router, handler, _, _, _ := setupTestEnv()
-// 		router.GET("/download/:hash", handler.DownloadFileHandler)
-
-// 		req := newRequest(t, "GET", "/download", nil)
-// 		w := applyRequest(router, req)
-
-// 		assert.Equal(t, http.StatusNotFound, w.Code)
-
-// 	})
-
-// 	t.Run("Test_DownloadFileHandler_With_Internal_Server_Error", func(t *testing.T) {
-// 		router, handler, fileStorage, _, _ := setupTestEnv()
-// 		router.GET("/download/:hash", handler.DownloadFileHandler)
-
-// 		fileHash := "fileHash756456"
-
-// 		fileStorage.On("GetFileMetadata", fileHash).
-// 			Return(&model.FileMetadata{}, errors.New("test metadata error")).Once()
-
-// 		fileStorage.On("GetChunkData", fileHash).
-// 			Return([]byte{}, errors.New("test chunk error")).Once()
-
-// 		req := newRequest(t, "GET", "/download/"+fileHash, nil)
-// 		w := applyRequest(router, req)
-
-// 		assert.Equal(t, http.StatusInternalServerError, w.Code)
-// 		assert.Contains(t, w.Body.String(), "test chunk error")
-// 	})
-
-// 	t.Run("Test_DownloadFileHandler_With_Single_Chunk_File", func(t *testing.T) {
-// 		router, handler, fileStorage, _, _ := setupTestEnv()
-// 		router.GET("/download/:hash", handler.DownloadFileHandler)
-
-// 		fileHash := "fileHash756456"
-// 		fileStorage.On("GetFileMetadata", fileHash).Return(&model.FileMetadata{}, errors.New("test error")).Once()
-// 		fileStorage.On("GetChunkData", fileHash).
-// 			Return([]byte("Hello World !"), nil).Once()
-
-// 		req := newRequest(t, "GET", "/download/"+fileHash, nil)
-// 		w := applyRequest(router, req)
-
-// 		assert.Equal(t, http.StatusOK, w.Code)
-
-// 		var response DownloadFileResponse
-// 		err := json.Unmarshal(w.Body.Bytes(), &response)
-// 		require.NoError(t, err)
-
-// 		assert.Equal(t, response.ChunkHashes, []string{fileHash})
-// 		assert.Equal(t, response.ChunksCount, 1)
-// 		assert.Equal(t, response.FileHash, fileHash)
-
-// 	})
-
-// }
-
-// func Test_GetChunkContent(t *testing.T) {
-
-// 	t.Run("Test_GetChunkContent_With_Valid_Request", func(t *testing.T) {
-// 		router, handler, fileStorage, _, _ := setupTestEnv()
-// 		router.GET("/chunk/:hash", handler.GetChunkContent)
-
-// 		chunkHash := "chunkHash1235487"
-// 		fileStorage.On("GetChunkData", chunkHash).Return([]byte("Hello World!"), nil).Once()
-
-// 		req := newRequest(t, "GET", "/chunk/"+chunkHash, nil)
-// 		w := applyRequest(router, req)
-
-// 		assert.Equal(t, http.StatusOK, w.Code)
-
-// 	})
-
-// 	t.Run("Test_GetChunkContent_With_Invalid_Request", func(t *testing.T) {
-// 		router, handler, _, _, _ := setupTestEnv()
-// 		router.GET("/chunk/:hash", handler.GetChunkContent)
-
-// 		req := newRequest(t, "GET", "/chunk/", nil)
-// 		req.Body = ioutil.NopCloser(bytes.NewBuffer([]byte("invalid"))) // override with invalid body
-// 		w := applyRequest(router, req)
-
-// 		assert.Equal(t, http.StatusNotFound, w.Code)
-
-// 	})
-// 	t.Run("Test_GetChunkContent_With_Internal_Server_Error", func(t *testing.T) {
-// 		router, handler, fileStorage, _, _ := setupTestEnv()
-// 		router.GET("/chunk/:hash", handler.GetChunkContent)
-
-// 		chunkHash := "chunkHash1235487"
-// 		fileStorage.On("GetChunkData", chunkHash).Return([]byte(nil), errors.New("test error")).Once()
-
-// 		req := newRequest(t, "GET", "/chunk/"+chunkHash, nil)
-// 		w := applyRequest(router, req)
-
-// 		assert.Equal(t, http.StatusInternalServerError, w.Code)
-
-// 	})
-
-// }
-
-// func Test_AuthMiddleware(t *testing.T) {
-
-// 	t.Run("Test_AuthMiddleware_With_Valid_Request", func(t *testing.T) {
-// 		router, _, _, _, tokenHandler := setupTestEnv()
-// 		accessToken := "testaccesstoken123456789"
-// 		refreshToken := "testrefreshtoken123456789"
-// 		tokenHandler.On("CreateTokenPair", 0, "test").Return(&auth.TokenPair{
-// 			AccessToken:  accessToken,
-// 			RefreshToken: refreshToken,
-// 		}, nil).Once()
-
-// 		router.Use(AuthMiddleware(tokenHandler))
-
-// 		tokenHandler.On("VerifyToken", accessToken).Return(&auth.TokenClaims{
-// 			Username: "test",
-// 			UserID:   0,
-// 		}, nil).Once()
-
-// 		router.GET("/protected", func(c *gin.Context) {
-// 			userID := c.GetInt("userID")
-// 			username := c.GetString("username")
-// 			c.JSON(200, gin.H{
-// 				"msg":      "authorized",
-// 				"userID":   userID,
-// 				"username": username,
-// 			})
-// 		})
-
-// 		req := newRequest(t, "GET", "/protected", nil)
-// 		req.Header.Set("Authorization", "Bearer "+accessToken)
-// 		w := applyRequest(router, req)
-
-// 		assert.Equal(t, http.StatusOK, w.Code)
-// 		assert.JSONEq(t, `{
-// 			"msg": "authorized",
-// 			"userID": 0,
-// 			"username": "test"
-// 		}`, w.Body.String())
-
-// 	})
-
-// 	t.Run("Test_AuthMiddleware_With_No_Authorization_Header", func(t *testing.T) {
-// 		router, _, _, _, tokenHandler := setupTestEnv()
-
-// 		router.Use(AuthMiddleware(tokenHandler))
-
-// 		router.GET("/protected", func(c *gin.Context) {
-// 			userID := c.GetInt("userID")
-// 			username := c.GetString("username")
-// 			c.JSON(200, gin.H{
-// 				"msg":      "authorized",
-// 				"userID":   userID,
-// 				"username": username,
-// 			})
-// 		})
-
-// 		req := newRequest(t, "GET", "/protected", nil)
-// 		w := applyRequest(router, req)
-
-// 		assert.Equal(t, http.StatusUnauthorized, w.Code)
-
-// 	})
-
-// 	t.Run("Test_AuthMiddleware_With_Invalid_Token", func(t *testing.T) {
-// 		router, _, _, _, tokenHandler := setupTestEnv()
-// 		accessToken := "testaccesstoken123456789"
-// 		refreshToken := "testrefreshtoken123456789"
-// 		tokenHandler.On("CreateTokenPair", 0, "test").Return(&auth.TokenPair{
-// 			AccessToken:  accessToken,
-// 			RefreshToken: refreshToken,
-// 		}, nil).Once()
-
-// 		router.Use(AuthMiddleware(tokenHandler))
-
-// 		tokenHandler.On("VerifyToken", accessToken).Return(&auth.TokenClaims{}, errors.New("test error")).Once()
-
-// 		router.GET("/protected", func(c *gin.Context) {
-// 			userID := c.GetInt("userID")
-// 			username := c.GetString("username")
-// 			c.JSON(200, gin.H{
-// 				"msg":      "authorized",
-// 				"userID":   userID,
-// 				"username": username,
-// 			})
-// 		})
-
-// 		req := newRequest(t, "GET", "/protected", nil)
-// 		req.Header.Set("Authorization", "Bearer "+accessToken)
-// 		w := applyRequest(router, req)
-
-// 		assert.Equal(t, http.StatusUnauthorized, w.Code)
-
-// 	})
-
-// }
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+	"zerodupe/internal/server/auth"
+	"zerodupe/internal/server/config"
+	"zerodupe/internal/server/model"
+	"zerodupe/internal/server/scrub"
+	"zerodupe/internal/server/storage"
+	"zerodupe/internal/server/storage/memory"
+	"zerodupe/pkg/hasher"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errTest = errors.New("test error")
+
+// testChunker splits test files into several chunks
+var testChunker = hasher.FixedChunkerConfig(64)
+
+// testFile is the content of the files uploaded by uploadFile
+var testFile = bytes.Repeat([]byte("Hello World! "), 20)
+
+// failingFileSystem is a file system whose chunk operations all fail
+type failingFileSystem struct {
+	storage.FileSystem
+}
+
+func (failingFileSystem) CheckChunkExists(hashes []string) ([]string, []string, error) {
+	return nil, nil, errTest
+}
+
+func (failingFileSystem) SaveChunkData(chunkHash string, content []byte) (string, error) {
+	return "", errTest
+}
+
+func (failingFileSystem) GetChunkData(chunkHash string) ([]byte, error) {
+	return nil, errTest
+}
+
+// failingDB is a database whose user and file operations all fail
+type failingDB struct {
+	storage.DB
+}
+
+func (failingDB) CreateUser(user *model.User) error {
+	return errTest
+}
+
+func (failingDB) GetUserByUsername(username string) (*model.User, error) {
+	return nil, errTest
+}
+
+func (failingDB) SaveChunkMetadata(fileHash, chunkHash string, chunkOrder int, chunkSize int64, chunker string) error {
+	return errTest
+}
+
+func (failingDB) GetUsage(userID uint) (*model.Usage, error) {
+	return nil, errTest
+}
+
+func (failingDB) GetFileMetadata(fileHash string) (*model.FileMetadata, error) {
+	return nil, errTest
+}
+
+func (failingDB) CheckFileExists(fileHash string) (bool, error) {
+	return false, errTest
+}
+
+func (failingDB) DeleteFileMetadata(fileHash string) error {
+	return errTest
+}
+
+func (failingDB) CheckFileOwner(fileHash string, userID uint) (bool, error) {
+	return false, errTest
+}
+
+func (failingDB) RemoveFileOwner(fileHash string, userID uint) (bool, error) {
+	return false, errTest
+}
+
+func (failingDB) CheckChunkAccess(chunkHash string, userID uint) (bool, error) {
+	return false, errTest
+}
+
+func (failingDB) ListDamagedFiles() ([]string, error) {
+	return nil, errTest
+}
+
+func (failingDB) CreateDirectory(userID uint, dirPath string) (*model.PathEntry, error) {
+	return nil, errTest
+}
+
+func (failingDB) ListDirectory(userID uint, dirPath string) ([]model.PathEntry, error) {
+	return nil, errTest
+}
+
+// setupTestEnv sets up a test environment for the API handlers on in-memory storage
+func setupTestEnv() (*gin.Engine, *Handler, *memory.MemoryStorage, *memory.MemoryDB, *auth.TokenHandler) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	fileStorage := memory.NewMemoryStorage()
+	dbStorage := memory.NewMemoryDB()
+	tokenHandler := auth.NewTokenHandler("test-secret", time.Minute, time.Hour)
+
+	handler := NewHandler(fileStorage, dbStorage, tokenHandler)
+	handler.scrubber = scrub.NewScrubber(fileStorage, dbStorage, 0)
+
+	return router, handler, fileStorage, dbStorage, tokenHandler
+}
+
+// setupFailingTestEnv sets up a test environment whose storage operations fail
+func setupFailingTestEnv() (*gin.Engine, *Handler) {
+	router, _, fileStorage, dbStorage, tokenHandler := setupTestEnv()
+	handler := NewHandler(failingFileSystem{fileStorage}, failingDB{dbStorage}, tokenHandler)
+	handler.scrubber = scrub.NewScrubber(handler.fileStorage, handler.dbStorage, 0)
+	return router, handler
+}
+
+// create a new HTTP request with a JSON body and set Content-Type
+func newRequest(t *testing.T, method, url string, body interface{}) *http.Request {
+	var buf bytes.Buffer
+	if body != nil {
+		err := json.NewEncoder(&buf).Encode(body)
+		require.NoError(t, err)
+	}
+	req, err := http.NewRequest(method, url, &buf)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+// create a new HTTP request with a body that is not valid JSON
+func newInvalidRequest(t *testing.T, method, url string) *http.Request {
+	req := newRequest(t, method, url, nil)
+	req.Body = io.NopCloser(bytes.NewBufferString("invalid"))
+	return req
+}
+
+// perform a request and return the response
+func applyRequest(router *gin.Engine, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// createUser registers a user with a hashed password
+func createUser(t *testing.T, dbStorage storage.DB, username, password string) *model.User {
+	t.Helper()
+
+	hashed, err := auth.HashAndSaltPassword([]byte(password))
+	require.NoError(t, err)
+	user := &model.User{Username: username, Password: hashed}
+	require.NoError(t, dbStorage.CreateUser(user))
+	return user
+}
+
+// uploadFile stores the chunks of data and the metadata of the file, returning the file hash and chunk hashes
+func uploadFile(t *testing.T, fileStorage storage.FileSystem, dbStorage storage.DB, data []byte) (string, []string) {
+	t.Helper()
+
+	chunks, fileHash, err := hasher.SplitDataIntoChunksWithConfig(data, testChunker)
+	require.NoError(t, err)
+
+	chunkHashes := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		_, err := fileStorage.SaveChunkData(chunk.ChunkHash, chunk.Data)
+		require.NoError(t, err)
+		require.NoError(t, dbStorage.SaveChunkMetadata(fileHash, chunk.ChunkHash, i+1, int64(len(chunk.Data)), testChunker.String()))
+		chunkHashes[i] = chunk.ChunkHash
+	}
+	complete, err := dbStorage.CompleteFile(fileHash, len(chunks))
+	require.NoError(t, err)
+	require.True(t, complete)
+	return fileHash, chunkHashes
+}
+
+// authenticateAs stands in for the auth middleware, authenticating every request as user
+func authenticateAs(user *model.User) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("userID", user.ID)
+		c.Set("username", user.Username)
+		c.Next()
+	}
+}
+
+// uploadRequests returns the requests uploading the chunks of data with their content
+func uploadRequests(t *testing.T, data []byte) []UploadRequest {
+	t.Helper()
+
+	chunks, fileHash, err := hasher.SplitDataIntoChunksWithConfig(data, testChunker)
+	require.NoError(t, err)
+
+	requests := make([]UploadRequest, len(chunks))
+	for i, chunk := range chunks {
+		requests[i] = UploadRequest{
+			FileHash:    fileHash,
+			ChunkHash:   chunk.ChunkHash,
+			ChunkOrder:  i + 1,
+			Chunker:     testChunker.String(),
+			Content:     chunk.Data,
+			TotalChunks: len(chunks),
+		}
+	}
+	return requests
+}
+
+func Test_SignUpHandler(t *testing.T) {
+	t.Run("Test_SignUpHandler_Creates_A_New_User", func(t *testing.T) {
+		router, handler, _, dbStorage, _ := setupTestEnv()
+		router.POST("/auth/signup", handler.SignUpHandler)
+
+		reqBody := SignUpRequest{
+			Username:        "username",
+			Password:        "test",
+			ConfirmPassword: "test",
+		}
+
+		req := newRequest(t, "POST", "/auth/signup", reqBody)
+		w := applyRequest(router, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `"user registered successfully"`, w.Body.String())
+
+		user, err := dbStorage.GetUserByUsername("username")
+		require.NoError(t, err)
+		assert.True(t, auth.VerifyPassword(user.Password, "test"))
+	})
+
+	t.Run("Test_SignUpHandler_With_A_Reserved_Admin_Name", func(t *testing.T) {
+		router, handler, _, dbStorage, _ := setupTestEnv()
+		router.POST("/auth/signup", handler.SignUpHandler)
+		handler.admins = map[string]bool{"admin": true}
+
+		req := newRequest(t, "POST", "/auth/signup", SignUpRequest{Username: "admin", Password: "test", ConfirmPassword: "test"})
+		w := applyRequest(router, req)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), "reserved")
+		_, err := dbStorage.GetUserByUsername("admin")
+		assert.Error(t, err)
+	})
+
+	t.Run("Test_SignUpHandler_With_Invalid_Request_Format", func(t *testing.T) {
+		router, handler, _, _, _ := setupTestEnv()
+		router.POST("/auth/signup", handler.SignUpHandler)
+
+		w := applyRequest(router, newInvalidRequest(t, "POST", "/auth/signup"))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "Invalid request format")
+	})
+
+	t.Run("Test_SignUpHandler_With_Password_Mismatch", func(t *testing.T) {
+		router, handler, _, _, _ := setupTestEnv()
+		router.POST("/auth/signup", handler.SignUpHandler)
+
+		reqBody := map[string]string{
+			"username":         "username",
+			"password":         "test",
+			"confirm_password": "other",
+		}
+
+		req := newRequest(t, "POST", "/auth/signup", reqBody)
+		w := applyRequest(router, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Test_SignUpHandler_With_Username_Already_Exists", func(t *testing.T) {
+		router, handler, _, dbStorage, _ := setupTestEnv()
+		router.POST("/auth/signup", handler.SignUpHandler)
+		createUser(t, dbStorage, "username", "test")
+
+		reqBody := SignUpRequest{
+			Username:        "username",
+			Password:        "test",
+			ConfirmPassword: "test",
+		}
+
+		req := newRequest(t, "POST", "/auth/signup", reqBody)
+		w := applyRequest(router, req)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), "user already exists")
+	})
+
+	t.Run("Test_SignUpHandler_With_Failed_To_Create_User", func(t *testing.T) {
+		router, handler := setupFailingTestEnv()
+		router.POST("/auth/signup", handler.SignUpHandler)
+
+		reqBody := SignUpRequest{
+			Username:        "test",
+			Password:        "test",
+			ConfirmPassword: "test",
+		}
+
+		req := newRequest(t, "POST", "/auth/signup", reqBody)
+		w := applyRequest(router, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Contains(t, w.Body.String(), "internal server error")
+	})
+}
+
+func Test_LoginHandler(t *testing.T) {
+	t.Run("Test_LoginHandler_With_Valid_Credentials", func(t *testing.T) {
+		router, handler, _, dbStorage, tokenHandler := setupTestEnv()
+		router.POST("/auth/login", handler.LoginHandler)
+		user := createUser(t, dbStorage, "test", "test")
+
+		reqBody := LoginRequest{
+			Username: "test",
+			Password: "test",
+		}
+
+		req := newRequest(t, "POST", "/auth/login", reqBody)
+		w := applyRequest(router, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response auth.TokenPair
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		require.NoError(t, err)
+
+		claims, err := tokenHandler.VerifyToken(response.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, claims.UserID)
+		assert.Equal(t, "test", claims.Username)
+		assert.NotEmpty(t, response.RefreshToken)
+	})
+
+	t.Run("Test_LoginHandler_With_Invalid_Request_Format", func(t *testing.T) {
+		router, handler, _, _, _ := setupTestEnv()
+		router.POST("/auth/login", handler.LoginHandler)
+
+		w := applyRequest(router, newInvalidRequest(t, "POST", "/auth/login"))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "Invalid request format")
+	})
+
+	t.Run("Test_LoginHandler_With_Non_Existing_User", func(t *testing.T) {
+		router, handler, _, _, _ := setupTestEnv()
+		router.POST("/auth/login", handler.LoginHandler)
+
+		reqBody := LoginRequest{
+			Username: "test",
+			Password: "test",
+		}
+
+		req := newRequest(t, "POST", "/auth/login", reqBody)
+		w := applyRequest(router, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "user does not exist")
+	})
+
+	t.Run("Test_LoginHandler_With_Wrong_Password", func(t *testing.T) {
+		router, handler, _, dbStorage, _ := setupTestEnv()
+		router.POST("/auth/login", handler.LoginHandler)
+		createUser(t, dbStorage, "test", "test")
+
+		reqBody := LoginRequest{
+			Username: "test",
+			Password: "wrong",
+		}
+
+		req := newRequest(t, "POST", "/auth/login", reqBody)
+		w := applyRequest(router, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "invalid username or password")
+	})
+
+	t.Run("Test_LoginHandler_With_Internal_Server_Error", func(t *testing.T) {
+		router, handler := setupFailingTestEnv()
+		router.POST("/auth/login", handler.LoginHandler)
+
+		reqBody := LoginRequest{
+			Username: "test",
+			Password: "test",
+		}
+
+		req := newRequest(t, "POST", "/auth/login", reqBody)
+		w := applyRequest(router, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
+
+func Test_RefreshTokenHandler(t *testing.T) {
+	t.Run("Test_RefreshTokenHandler_With_Valid_Refresh_Token", func(t *testing.T) {
+		router, handler, _, _, tokenHandler := setupTestEnv()
+		router.POST("/auth/refresh", handler.RefreshTokenHandler)
+
+		tokenPair, err := tokenHandler.CreateTokenPair(1, "test")
+		require.NoError(t, err)
+
+		reqBody := RefreshTokenRequest{
+			RefreshToken: tokenPair.RefreshToken,
+		}
+
+		req := newRequest(t, "POST", "/auth/refresh", reqBody)
+		w := applyRequest(router, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			AccessToken string `json:"access_token"`
+		}
+		err = json.Unmarshal(w.Body.Bytes(), &response)
+		require.NoError(t, err)
+
+		claims, err := tokenHandler.VerifyToken(response.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, uint(1), claims.UserID)
+	})
+
+	t.Run("Test_RefreshTokenHandler_With_Invalid_Request_Format", func(t *testing.T) {
+		router, handler, _, _, _ := setupTestEnv()
+		router.POST("/auth/refresh", handler.RefreshTokenHandler)
+
+		w := applyRequest(router, newInvalidRequest(t, "POST", "/auth/refresh"))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "Invalid request format")
+	})
+
+	t.Run("Test_RefreshTokenHandler_With_Invalid_Refresh_Token", func(t *testing.T) {
+		router, handler, _, _, _ := setupTestEnv()
+		router.POST("/auth/refresh", handler.RefreshTokenHandler)
+
+		reqBody := RefreshTokenRequest{
+			RefreshToken: "invalid",
+		}
+
+		req := newRequest(t, "POST", "/auth/refresh", reqBody)
+		w := applyRequest(router, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "Invalid refresh token")
+	})
+}
+
+func Test_UploadFileHandler(t *testing.T) {
+	t.Run("Test_UploadFileHandler_With_Valid_Request", func(t *testing.T) {
+		router, handler, fileStorage, dbStorage, _ := setupTestEnv()
+		router.POST("/upload", handler.UploadFileHandler)
+
+		content := []byte("Hello World!")
+		chunkHash := hasher.CalculateChunkHash(content)
+		fileHash := hasher.FileHashFromChunkHashes([]string{chunkHash})
+
+		uploadRequest := UploadRequest{
+			FileHash:   fileHash,
+			ChunkHash:  chunkHash,
+			ChunkOrder: 1,
+			Content:    content,
+		}
+
+		req := newRequest(t, "POST", "/upload", uploadRequest)
+		w := applyRequest(router, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response UploadResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		require.NoError(t, err)
+
+		assert.Equal(t, "File uploaded successfully", response.Message)
+		assert.Equal(t, fileHash, response.FileHash)
+
+		stored, err := fileStorage.GetChunkData(chunkHash)
+		require.NoError(t, err)
+		assert.Equal(t, content, stored)
+
+		metadata, err := dbStorage.GetFileMetadata(fileHash)
+		require.NoError(t, err)
+		require.NotNil(t, metadata)
+		require.Len(t, metadata.Chunks, 1)
+		assert.Equal(t, chunkHash, metadata.Chunks[0].ChunkHash)
+		assert.Equal(t, hasher.DefaultChunkerConfig().String(), metadata.Chunker)
+	})
+
+	t.Run("Test_UploadFileHandler_With_Existing_Chunk", func(t *testing.T) {
+		router, handler, fileStorage, dbStorage, _ := setupTestEnv()
+		router.POST("/upload", handler.UploadFileHandler)
+
+		content := []byte("Hello World!")
+		chunkHash := hasher.CalculateChunkHash(content)
+		_, err := fileStorage.SaveChunkData(chunkHash, content)
+		require.NoError(t, err)
+
+		// chunks already on the server are referenced without their content
+		uploadRequest := UploadRequest{
+			FileHash:   "fileHash756456",
+			ChunkHash:  chunkHash,
+			ChunkOrder: 1,
+		}
+
+		req := newRequest(t, "POST", "/upload", uploadRequest)
+		w := applyRequest(router, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		exists, err := dbStorage.CheckFileExists("fileHash756456")
+		require.NoError(t, err)
+		assert.True(t, exists)
+	})
+
+	t.Run("Test_UploadFileHandler_With_Missing_Chunk", func(t *testing.T) {
+		router, handler, _, _, _ := setupTestEnv()
+		router.POST("/upload", handler.UploadFileHandler)
+
+		uploadRequest := UploadRequest{
+			FileHash:   "fileHash756456",
+			ChunkHash:  hasher.CalculateChunkHash([]byte("Hello World!")),
+			ChunkOrder: 1,
+		}
+
+		req := newRequest(t, "POST", "/upload", uploadRequest)
+		w := applyRequest(router, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "Chunk does not exist")
+	})
+
+	t.Run("Test_UploadFileHandler_With_Hash_Mismatch", func(t *testing.T) {
+		router, handler, fileStorage, _, _ := setupTestEnv()
+		router.POST("/upload", handler.UploadFileHandler)
+
+		chunkHash := hasher.CalculateChunkHash([]byte("Hello World!"))
+		uploadRequest := UploadRequest{
+			FileHash:   chunkHash,
+			ChunkHash:  chunkHash,
+			ChunkOrder: 1,
+			Content:    []byte("forged"),
+		}
+
+		req := newRequest(t, "POST", "/upload", uploadRequest)
+		w := applyRequest(router, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		hashes, err := fileStorage.ListChunks()
+		require.NoError(t, err)
+		assert.Empty(t, hashes)
+	})
+
+	t.Run("Test_UploadFileHandler_With_Invalid_Chunker", func(t *testing.T) {
+		router, handler, _, _, _ := setupTestEnv()
+		router.POST("/upload", handler.UploadFileHandler)
+
+		content := []byte("Hello World!")
+		chunkHash := hasher.CalculateChunkHash(content)
+		uploadRequest := UploadRequest{
+			FileHash:   chunkHash,
+			ChunkHash:  chunkHash,
+			ChunkOrder: 1,
+			Chunker:    "invalid",
+			Content:    content,
+		}
+
+		req := newRequest(t, "POST", "/upload", uploadRequest)
+		w := applyRequest(router, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		// chunk sizes are bounded
+		uploadRequest.Chunker = "fastcdc:64:1024:99999999999"
+		w = applyRequest(router, newRequest(t, "POST", "/upload", uploadRequest))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Test_UploadFileHandler_With_Invalid_Request_Format", func(t *testing.T) {
+		router, handler, _, _, _ := setupTestEnv()
+		router.POST("/upload", handler.UploadFileHandler)
+
+		w := applyRequest(router, newInvalidRequest(t, "POST", "/upload"))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "Invalid request format")
+	})
+
+	t.Run("Test_UploadFileHandler_With_Repeated_Chunks", func(t *testing.T) {
+		router, handler, _, dbStorage, _ := setupTestEnv()
+		router.POST("/upload", handler.UploadFileHandler)
+
+		// a file of zero blocks repeats its only chunk
+		requests := uploadRequests(t, make([]byte, 3*64))
+		require.Len(t, requests, 3)
+		for _, request := range requests {
+			w := applyRequest(router, newRequest(t, "POST", "/upload", request))
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		}
+
+		ref, err := dbStorage.GetChunkRef(requests[0].ChunkHash)
+		require.NoError(t, err)
+		require.NotNil(t, ref)
+		assert.Equal(t, 3, ref.RefCount)
+	})
+
+	t.Run("Test_UploadFileHandler_With_Conflicting_Chunk", func(t *testing.T) {
+		router, handler, _, _, _ := setupTestEnv()
+		router.POST("/upload", handler.UploadFileHandler)
+
+		requests := uploadRequests(t, testFile)
+		w := applyRequest(router, newRequest(t, "POST", "/upload", requests[0]))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		conflicting := requests[1]
+		conflicting.ChunkOrder = requests[0].ChunkOrder
+		w = applyRequest(router, newRequest(t, "POST", "/upload", conflicting))
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), "Another chunk is stored at this position")
+	})
+
+	t.Run("Test_UploadFileHandler_With_A_Squatted_File", func(t *testing.T) {
+		router, handler, _, dbStorage, _ := setupTestEnv()
+		alice := createUser(t, dbStorage, "alice", "password")
+		bob := createUser(t, dbStorage, "bob", "password")
+		router.POST("/alice/upload", authenticateAs(alice), handler.UploadFileHandler)
+		router.POST("/bob/upload", authenticateAs(bob), handler.UploadFileHandler)
+
+		// alice only knows the file hash and stores junk at its first position and past its end
+		requests := uploadRequests(t, testFile)
+		junk := []byte("junk")
+		for _, chunkOrder := range []int{1, len(requests) + 1} {
+			w := applyRequest(router, newRequest(t, "POST", "/alice/upload", UploadRequest{
+				FileHash:   requests[0].FileHash,
+				ChunkHash:  hasher.CalculateChunkHash(junk),
+				ChunkOrder: chunkOrder,
+				Chunker:    testChunker.String(),
+				Content:    junk,
+				FileName:   "junk.txt",
+			}))
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		}
+
+		// bob still uploads the file and owns it
+		for _, request := range requests {
+			request.FileName = "test.txt"
+			w := applyRequest(router, newRequest(t, "POST", "/bob/upload", request))
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		}
+
+		metadata, err := dbStorage.GetFileMetadata(requests[0].FileHash)
+		require.NoError(t, err)
+		require.NotNil(t, metadata)
+		assert.True(t, metadata.Complete)
+		assert.Len(t, metadata.Chunks, len(requests))
+		assert.Equal(t, int64(len(testFile)), metadata.Size)
+		assert.Equal(t, "test.txt", metadata.Name)
+		assert.Equal(t, "bob", metadata.Uploader)
+		owned, err := dbStorage.CheckFileOwner(requests[0].FileHash, bob.ID)
+		require.NoError(t, err)
+		assert.True(t, owned)
+		owned, err = dbStorage.CheckFileOwner(requests[0].FileHash, alice.ID)
+		require.NoError(t, err)
+		assert.False(t, owned)
+		referenced, err := dbStorage.CheckChunkReferenced(hasher.CalculateChunkHash(junk))
+		require.NoError(t, err)
+		assert.False(t, referenced)
+	})
+
+	t.Run("Test_UploadFileHandler_Records_The_Uploader_As_Owner", func(t *testing.T) {
+		router, handler, _, dbStorage, _ := setupTestEnv()
+		alice := createUser(t, dbStorage, "alice", "password")
+		router.POST("/upload", authenticateAs(alice), handler.UploadFileHandler)
+
+		requests := uploadRequests(t, testFile)
+		for _, request := range requests {
+			w := applyRequest(router, newRequest(t, "POST", "/upload", request))
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		}
+
+		owned, err := dbStorage.CheckFileOwner(requests[0].FileHash, alice.ID)
+		require.NoError(t, err)
+		assert.True(t, owned)
+
+		usage, err := dbStorage.GetUsage(alice.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), usage.Files)
+		assert.Equal(t, int64(len(requests)), usage.Chunks)
+		assert.Equal(t, int64(len(testFile)), usage.LogicalBytes)
+		assert.Equal(t, int64(len(testFile)), usage.UniqueBytes)
+	})
+
+	t.Run("Test_UploadFileHandler_With_A_Foreign_File_Hash", func(t *testing.T) {
+		router, handler, _, dbStorage, _ := setupTestEnv()
+		alice := createUser(t, dbStorage, "alice", "password")
+		bob := createUser(t, dbStorage, "bob", "password")
+		router.POST("/alice/upload", authenticateAs(alice), handler.UploadFileHandler)
+		router.POST("/bob/upload", authenticateAs(bob), handler.UploadFileHandler)
+
+		requests := uploadRequests(t, testFile)
+		for _, request := range requests {
+			w := applyRequest(router, newRequest(t, "POST", "/alice/upload", request))
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		}
+
+		// knowing the file hash is not enough to append to the file or to own it
+		junk := []byte("junk")
+		w := applyRequest(router, newRequest(t, "POST", "/bob/upload", UploadRequest{
+			FileHash:   requests[0].FileHash,
+			ChunkHash:  hasher.CalculateChunkHash(junk),
+			ChunkOrder: 9999,
+			Chunker:    testChunker.String(),
+			Content:    junk,
+		}))
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), "File is complete")
+
+		// neither is sending some of its chunks
+		partial := requests[0]
+		partial.Content = nil
+		w = applyRequest(router, newRequest(t, "POST", "/bob/upload", partial))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		metadata, err := dbStorage.GetFileMetadata(requests[0].FileHash)
+		require.NoError(t, err)
+		require.NotNil(t, metadata)
+		assert.Len(t, metadata.Chunks, len(requests))
+		assert.Equal(t, int64(len(testFile)), metadata.Size)
+		owned, err := dbStorage.CheckFileOwner(requests[0].FileHash, alice.ID)
+		require.NoError(t, err)
+		assert.True(t, owned)
+		owned, err = dbStorage.CheckFileOwner(requests[0].FileHash, bob.ID)
+		require.NoError(t, err)
+		assert.False(t, owned)
+
+		// sending every chunk is
+		for _, request := range requests {
+			request.Content = nil
+			w := applyRequest(router, newRequest(t, "POST", "/bob/upload", request))
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		}
+		owned, err = dbStorage.CheckFileOwner(requests[0].FileHash, bob.ID)
+		require.NoError(t, err)
+		assert.True(t, owned)
+	})
+
+	t.Run("Test_UploadFileHandler_Records_The_File_Info", func(t *testing.T) {
+		router, handler, _, dbStorage, _ := setupTestEnv()
+		alice := createUser(t, dbStorage, "alice", "password")
+		bob := createUser(t, dbStorage, "bob", "password")
+		router.POST("/upload/alice", authenticateAs(alice), handler.UploadFileHandler)
+		router.POST("/upload/bob", authenticateAs(bob), handler.UploadFileHandler)
+
+		requests := uploadRequests(t, testFile)
+		for _, request := range requests {
+			request.FileName = "../docs/hello.txt"
+			w := applyRequest(router, newRequest(t, "POST", "/upload/alice", request))
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		}
+		// uploading the file again keeps the info of the first upload
+		for _, request := range requests {
+			request.FileName = "other.txt"
+			request.ContentType = "application/octet-stream"
+			w := applyRequest(router, newRequest(t, "POST", "/upload/bob", request))
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		}
+
+		metadata, err := dbStorage.GetFileMetadata(requests[0].FileHash)
+		require.NoError(t, err)
+		require.NotNil(t, metadata)
+		assert.Equal(t, "hello.txt", metadata.Name)
+		assert.Equal(t, "text/plain; charset=utf-8", metadata.ContentType)
+		assert.Equal(t, "alice", metadata.Uploader)
+		assert.Equal(t, int64(len(testFile)), metadata.Size)
+	})
+
+	t.Run("Test_UploadFileHandler_With_Exceeded_Quota", func(t *testing.T) {
+		router, handler, fileStorage, dbStorage, _ := setupTestEnv()
+		alice := createUser(t, dbStorage, "alice", "password")
+		router.POST("/upload", authenticateAs(alice), handler.UploadFileHandler)
+		handler.defaultQuota = model.Quota{LogicalBytes: 100}
+
+		requests := uploadRequests(t, testFile)
+		w := applyRequest(router, newRequest(t, "POST", "/upload", requests[0]))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = applyRequest(router, newRequest(t, "POST", "/upload", requests[1]))
+		assert.Equal(t, http.StatusInsufficientStorage, w.Code)
+		assert.Contains(t, w.Body.String(), "would take 128 of 100 logical bytes")
+
+		_, missing, err := fileStorage.CheckChunkExists([]string{requests[1].ChunkHash})
+		require.NoError(t, err)
+		assert.Equal(t, []string{requests[1].ChunkHash}, missing)
+
+		// a quota of the user's own overrides the server's
+		require.NoError(t, dbStorage.SetUserQuota("alice", model.Quota{LogicalBytes: -1}))
+		w = applyRequest(router, newRequest(t, "POST", "/upload", requests[1]))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Test_UploadFileHandler_With_Concurrent_Chunks_Over_Quota", func(t *testing.T) {
+		router, handler, _, dbStorage, _ := setupTestEnv()
+		alice := createUser(t, dbStorage, "alice", "password")
+		router.POST("/upload", authenticateAs(alice), handler.UploadFileHandler)
+		handler.defaultQuota = model.Quota{LogicalBytes: int64(len(testFile)) - 1}
+
+		requests := uploadRequests(t, testFile)
+		codes := make([]int, len(requests))
+		var wg sync.WaitGroup
+		for i, request := range requests {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				codes[i] = applyRequest(router, newRequest(t, "POST", "/upload", request)).Code
+			}()
+		}
+		wg.Wait()
+
+		assert.Contains(t, codes, http.StatusInsufficientStorage)
+		usage, err := dbStorage.GetUsage(alice.ID)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, usage.LogicalBytes, handler.defaultQuota.LogicalBytes)
+	})
+
+	t.Run("Test_UploadFileHandler_With_Shared_Chunks_Under_Unique_Quota", func(t *testing.T) {
+		router, handler, _, dbStorage, _ := setupTestEnv()
+		alice := createUser(t, dbStorage, "alice", "password")
+		bob := createUser(t, dbStorage, "bob", "password")
+		router.POST("/alice/upload", authenticateAs(alice), handler.UploadFileHandler)
+		router.POST("/bob/upload", authenticateAs(bob), handler.UploadFileHandler)
+		handler.defaultQuota = model.Quota{UniqueBytes: 1}
+		require.NoError(t, dbStorage.SetUserQuota("alice", model.Quota{UniqueBytes: -1}))
+
+		requests := uploadRequests(t, testFile)
+		for _, request := range requests {
+			w := applyRequest(router, newRequest(t, "POST", "/alice/upload", request))
+			require.Equal(t, http.StatusOK, w.Code)
+		}
+
+		// chunks another user already stores take none of bob's unique bytes
+		for _, request := range requests {
+			request.Content = nil
+			w := applyRequest(router, newRequest(t, "POST", "/bob/upload", request))
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		}
+		usage, err := dbStorage.GetUsage(bob.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(testFile)), usage.LogicalBytes)
+		assert.Zero(t, usage.UniqueBytes)
+
+		// new chunks do
+		w := applyRequest(router, newRequest(t, "POST", "/bob/upload", uploadRequests(t, []byte("other"))[0]))
+		assert.Equal(t, http.StatusInsufficientStorage, w.Code)
+	})
+
+	t.Run("Test_UploadFileHandler_With_Internal_Server_Error", func(t *testing.T) {
+		router, handler := setupFailingTestEnv()
+		router.POST("/upload", handler.UploadFileHandler)
+
+		content := []byte("Hello World!")
+		chunkHash := hasher.CalculateChunkHash(content)
+
+		uploadRequest := UploadRequest{
+			FileHash:   chunkHash,
+			ChunkHash:  chunkHash,
+			ChunkOrder: 1,
+			Content:    content,
+		}
+
+		req := newRequest(t, "POST", "/upload", uploadRequest)
+		w := applyRequest(router, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Contains(t, w.Body.String(), "Failed to save chunk data")
+	})
+}
+
+func Test_CheckFileHashHandler(t *testing.T) {
+	t.Run("Test_CheckFileHashHandler_With_Valid_Request", func(t *testing.T) {
+		router, handler, fileStorage, dbStorage, _ := setupTestEnv()
+		alice := createUser(t, dbStorage, "alice", "password")
+		router.GET("/check/:filehash", authenticateAs(alice), handler.CheckFileHashHandler)
+
+		fileHash, _ := uploadFile(t, fileStorage, dbStorage, testFile)
+		require.NoError(t, dbStorage.AddFileOwner(fileHash, alice.ID))
+		missingHash := hasher.CalculateChunkHash([]byte("missing"))
+
+		for hash, exists := range map[string]bool{fileHash: true, missingHash: false} {
+			req := newRequest(t, "GET", "/check/"+hash, nil)
+			w := applyRequest(router, req)
+			require.Equal(t, http.StatusOK, w.Code)
+
+			var response CheckFileResponse
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			require.NoError(t, err)
+
+			assert.Equal(t, exists, response.Exists)
+			assert.Equal(t, hash, response.Hash)
+		}
+	})
+
+	t.Run("Test_CheckFileHashHandler_Reports_Ownership", func(t *testing.T) {
+		router, handler, fileStorage, dbStorage, _ := setupTestEnv()
+		alice := createUser(t, dbStorage, "alice", "password")
+		router.GET("/check/:filehash", authenticateAs(alice), handler.CheckFileHashHandler)
+
+		fileHash, _ := uploadFile(t, fileStorage, dbStorage, testFile)
+		for _, owned := range []bool{false, true} {
+			if owned {
+				require.NoError(t, dbStorage.AddFileOwner(fileHash, alice.ID))
+			}
+
+			w := applyRequest(router, newRequest(t, "GET", "/check/"+fileHash, nil))
+			require.Equal(t, http.StatusOK, w.Code)
+
+			// files the caller may not read are reported missing
+			var response CheckFileResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, owned, response.Exists)
+			assert.Equal(t, owned, response.Owned)
+		}
+	})
+
+	t.Run("Test_CheckFileHashHandler_With_Administrator", func(t *testing.T) {
+		router, handler, fileStorage, dbStorage, _ := setupTestEnv()
+		admin := createUser(t, dbStorage, "admin", "password")
+		handler.admins = map[string]bool{"admin": true}
+		router.GET("/check/:filehash", authenticateAs(admin), handler.CheckFileHashHandler)
+
+		fileHash, _ := uploadFile(t, fileStorage, dbStorage, testFile)
+
+		w := applyRequest(router, newRequest(t, "GET", "/check/"+fileHash, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response CheckFileResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.True(t, response.Exists)
+		assert.False(t, response.Owned)
+	})
+
+	t.Run("Test_CheckFileHashHandler_With_Invalid_File_Hash", func(t *testing.T) {
+		router, handler, _, _, _ := setupTestEnv()
+		router.GET("/check/:filehash", handler.CheckFileHashHandler)
+
+		req := newRequest(t, "GET", "/check/fi", nil)
+		w := applyRequest(router, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "Invalid file hash")
+	})
+
+	t.Run("Test_CheckFileHashHandler_With_Internal_Server_Error", func(t *testing.T) {
+		router, handler := setupFailingTestEnv()
+		router.GET("/check/:filehash", handler.CheckFileHashHandler)
+
+		req := newRequest(t, "GET", "/check/fileHash756456", nil)
+		w := applyRequest(router, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Contains(t, w.Body.String(), "test error")
+	})
+}
+
+func Test_CheckChunkHashesHandler(t *testing.T) {
+	t.Run("Test_CheckChunkHashesHandler_With_Valid_Request", func(t *testing.T) {
+		router, handler, fileStorage, _, _ := setupTestEnv()
+		router.POST("/check", handler.CheckChunkHashesHandler)
+
+		content := []byte("Hello World!")
+		existing := hasher.CalculateChunkHash(content)
+		_, err := fileStorage.SaveChunkData(existing, content)
+		require.NoError(t, err)
+		missing := []string{hasher.CalculateChunkHash([]byte("hash2")), hasher.CalculateChunkHash([]byte("hash3"))}
+
+		reqBody := CheckChunksRequest{
+			Hashes: append([]string{existing}, missing...),
+		}
+
+		req := newRequest(t, "POST", "/check", reqBody)
+		w := applyRequest(router, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response CheckChunksResponse
+		err = json.Unmarshal(w.Body.Bytes(), &response)
+		require.NoError(t, err)
+
+		assert.Equal(t, missing, response.Missing)
+	})
+
+	t.Run("Test_CheckChunkHashesHandler_With_Invalid_Request_Format", func(t *testing.T) {
+		router, handler, _, _, _ := setupTestEnv()
+		router.POST("/check", handler.CheckChunkHashesHandler)
+
+		w := applyRequest(router, newInvalidRequest(t, "POST", "/check"))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Test_CheckChunkHashesHandler_With_Internal_Server_Error", func(t *testing.T) {
+		router, handler := setupFailingTestEnv()
+		router.POST("/check", handler.CheckChunkHashesHandler)
+
+		reqBody := CheckChunksRequest{
+			Hashes: []string{"hash1", "hash2", "hash3"},
+		}
+
+		req := newRequest(t, "POST", "/check", reqBody)
+		w := applyRequest(router, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Contains(t, w.Body.String(), "test error")
+	})
+}
+
+func Test_DownloadFileHandler(t *testing.T) {
+	t.Run("Test_DownloadFileHandler_With_Valid_Request", func(t *testing.T) {
+		router, handler, fileStorage, dbStorage, _ := setupTestEnv()
+		alice := createUser(t, dbStorage, "alice", "password")
+		router.GET("/download/:hash", authenticateAs(alice), handler.DownloadFileHandler)
+
+		fileHash, chunkHashes := uploadFile(t, fileStorage, dbStorage, testFile)
+		require.NoError(t, dbStorage.AddFileOwner(fileHash, alice.ID))
+
+		req := newRequest(t, "GET", "/download/"+fileHash, nil)
+		w := applyRequest(router, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response DownloadFileResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		require.NoError(t, err)
+
+		assert.Equal(t, chunkHashes, response.ChunkHashes)
+		assert.Equal(t, len(chunkHashes), response.ChunksCount)
+		assert.Equal(t, fileHash, response.FileHash)
+		assert.Equal(t, testChunker.String(), response.Chunker)
+
+		require.Len(t, response.Proofs, len(chunkHashes))
+		for i, chunkHash := range chunkHashes {
+			assert.True(t, hasher.VerifyMerkleProof(fileHash, chunkHash, response.Proofs[i]))
+		}
+
+		assert.Equal(t, int64(len(testFile)), response.Size)
+		assert.NotNil(t, response.CreatedAt)
+		require.Len(t, response.Chunks, len(chunkHashes))
+		var offset int64
+		for i, chunk := range response.Chunks {
+			assert.Equal(t, chunkHashes[i], chunk.ChunkHash)
+			assert.Equal(t, offset, chunk.Offset)
+			offset += chunk.Size
+		}
+		assert.Equal(t, response.Size, offset)
+	})
+
+	t.Run("Test_DownloadFileHandler_With_The_Old_Hash_Of_A_Migrated_File", func(t *testing.T) {
+		router, handler, fileStorage, dbStorage, _ := setupTestEnv()
+		alice := createUser(t, dbStorage, "alice", "password")
+		router.GET("/download/:hash", authenticateAs(alice), handler.DownloadFileHandler)
+		router.GET("/check/:filehash", authenticateAs(alice), handler.CheckFileHashHandler)
+
+		// single chunk files used to be a bare chunk whose hash was the file hash
+		content := []byte("single chunk file")
+		oldHash := hasher.CalculateChunkHash(content)
+		_, err := fileStorage.SaveChunkData(oldHash, content)
+		require.NoError(t, err)
+		require.NoError(t, storage.Migrate(fileStorage, dbStorage))
+		require.NoError(t, dbStorage.AddFileOwner(oldHash, alice.ID))
+
+		w := applyRequest(router, newRequest(t, "GET", "/download/"+oldHash, nil))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var response DownloadFileResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, oldHash, response.FileHash)
+		assert.Equal(t, []string{oldHash}, response.ChunkHashes)
+		assert.Equal(t, int64(len(content)), response.Size)
+		assert.True(t, hasher.VerifyFileHash(response.FileHash, response.ChunkHashes))
+
+		w = applyRequest(router, newRequest(t, "GET", "/check/"+oldHash, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"exists":true`)
+	})
+
+	t.Run("Test_DownloadFileHandler_With_File_Info", func(t *testing.T) {
+		router, handler, fileStorage, dbStorage, _ := setupTestEnv()
+		alice := createUser(t, dbStorage, "alice", "password")
+		router.GET("/download/:hash", authenticateAs(alice), handler.DownloadFileHandler)
+
+		fileHash, _ := uploadFile(t, fileStorage, dbStorage, testFile)
+		require.NoError(t, dbStorage.AddFileOwner(fileHash, alice.ID))
+		require.NoError(t, dbStorage.SetFileInfo(fileHash, "hello.txt", "text/plain", "alice"))
+
+		w := applyRequest(router, newRequest(t, "GET", "/download/"+fileHash, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response DownloadFileResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "hello.txt", response.Name)
+		assert.Equal(t, "text/plain", response.ContentType)
+		assert.Equal(t, "alice", response.Uploader)
+	})
+
+	t.Run("Test_DownloadFileHandler_With_File_Info_Of_Another_Owner", func(t *testing.T) {
+		router, handler, fileStorage, dbStorage, _ := setupTestEnv()
+		alice := createUser(t, dbStorage, "alice", "password")
+		bob := createUser(t, dbStorage, "bob", "password")
+		router.GET("/download/:hash", authenticateAs(bob), handler.DownloadFileHandler)
+
+		fileHash, _ := uploadFile(t, fileStorage, dbStorage, testFile)
+		require.NoError(t, dbStorage.AddFileOwner(fileHash, alice.ID))
+		require.NoError(t, dbStorage.AddFileOwner(fileHash, bob.ID))
+		require.NoError(t, dbStorage.SetFileInfo(fileHash, "alice-private.txt", "text/plain", "alice"))
+
+		w := applyRequest(router, newRequest(t, "GET", "/download/"+fileHash, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response DownloadFileResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Empty(t, response.Name)
+		assert.Empty(t, response.Uploader)
+		assert.Equal(t, "text/plain", response.ContentType)
+		assert.NotContains(t, w.Body.String(), "alice")
+	})
+
+	t.Run("Test_DownloadFileHandler_With_Damaged_File", func(t *testing.T) {
+		router, handler, fileStorage, dbStorage, _ := setupTestEnv()
+		alice := createUser(t, dbStorage, "alice", "password")
+		router.GET("/download/:hash", authenticateAs(alice), handler.DownloadFileHandler)
+
+		fileHash, chunkHashes := uploadFile(t, fileStorage, dbStorage, testFile)
+		require.NoError(t, dbStorage.AddFileOwner(fileHash, alice.ID))
+		_, err := dbStorage.MarkChunkDamaged(chunkHashes[0])
+		require.NoError(t, err)
+
+		req := newRequest(t, "GET", "/download/"+fileHash, nil)
+		w := applyRequest(router, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response DownloadFileResponse
+		err = json.Unmarshal(w.Body.Bytes(), &response)
+		require.NoError(t, err)
+		assert.True(t, response.Damaged)
+	})
+
+	t.Run("Test_DownloadFileHandler_With_File_Of_Another_User", func(t *testing.T) {
+		router, handler, fileStorage, dbStorage, _ := setupTestEnv()
+		alice := createUser(t, dbStorage, "alice", "password")
+		bob := createUser(t, dbStorage, "bob", "password")
+		router.GET("/download/:hash", authenticateAs(bob), handler.DownloadFileHandler)
+
+		fileHash, _ := uploadFile(t, fileStorage, dbStorage, testFile)
+		require.NoError(t, dbStorage.AddFileOwner(fileHash, alice.ID))
+
+		w := applyRequest(router, newRequest(t, "GET", "/download/"+fileHash, nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "File metadata not found")
+	})
+
+	t.Run("Test_DownloadFileHandler_With_Non_Existing_File", func(t *testing.T) {
+		router, handler, _, _, _ := setupTestEnv()
+		router.GET("/download/:hash", handler.DownloadFileHandler)
+
+		req := newRequest(t, "GET", "/download/fileHash756456", nil)
+		w := applyRequest(router, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "File metadata not found")
+	})
+
+	t.Run("Test_DownloadFileHandler_With_Non_Existing_Request", func(t *testing.T) {
+		router, handler, _, _, _ := setupTestEnv()
+		router.GET("/download/:hash", handler.DownloadFileHandler)
+
+		req := newRequest(t, "GET", "/download", nil)
+		w := applyRequest(router, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Test_DownloadFileHandler_With_Internal_Server_Error", func(t *testing.T) {
+		router, handler := setupFailingTestEnv()
+		router.GET("/download/:hash", handler.DownloadFileHandler)
+
+		req := newRequest(t, "GET", "/download/fileHash756456", nil)
+		w := applyRequest(router, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Contains(t, w.Body.String(), "test error")
+	})
+}
+
+func Test_DeleteFileHandler(t *testing.T) {
+	t.Run("Test_DeleteFileHandler_With_Valid_Request", func(t *testing.T) {
+		router, handler, fileStorage, dbStorage, _ := setupTestEnv()
+		alice := createUser(t, dbStorage, "alice", "password")
+		router.DELETE("/files/:hash", authenticateAs(alice), handler.DeleteFileHandler)
+
+		fileHash, chunkHashes := uploadFile(t, fileStorage, dbStorage, testFile)
+		require.NoError(t, dbStorage.AddFileOwner(fileHash, alice.ID))
+
+		req := newRequest(t, "DELETE", "/files/"+fileHash, nil)
+		w := applyRequest(router, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response DeleteFileResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		require.NoError(t, err)
+		assert.Equal(t, fileHash, response.FileHash)
+
+		exists, err := dbStorage.CheckFileExists(fileHash)
+		require.NoError(t, err)
+		assert.False(t, exists)
+		referenced, err := dbStorage.CheckChunkReferenced(chunkHashes[0])
+		require.NoError(t, err)
+		assert.False(t, referenced)
+	})
+
+	t.Run("Test_DeleteFileHandler_With_Other_Owners", func(t *testing.T) {
+		router, handler, fileStorage, dbStorage, _ := setupTestEnv()
+		alice := createUser(t, dbStorage, "alice", "password")
+		bob := createUser(t, dbStorage, "bob", "password")
+		router.DELETE("/files/:hash", authenticateAs(alice), handler.DeleteFileHandler)
+
+		fileHash, _ := uploadFile(t, fileStorage, dbStorage, testFile)
+		require.NoError(t, dbStorage.AddFileOwner(fileHash, alice.ID))
+		require.NoError(t, dbStorage.AddFileOwner(fileHash, bob.ID))
+
+		w := applyRequest(router, newRequest(t, "DELETE", "/files/"+fileHash, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "other owners keep it")
+
+		owned, err := dbStorage.CheckFileOwner(fileHash, alice.ID)
+		require.NoError(t, err)
+		assert.False(t, owned)
+		owned, err = dbStorage.CheckFileOwner(fileHash, bob.ID)
+		require.NoError(t, err)
+		assert.True(t, owned)
+	})
+
+	t.Run("Test_DeleteFileHandler_With_File_Of_Another_User", func(t *testing.T) {
+		router, handler, fileStorage, dbStorage, _ := setupTestEnv()
+		alice := createUser(t, dbStorage, "alice", "password")
+		bob := createUser(t, dbStorage, "bob", "password")
+		router.DELETE("/files/:hash", authenticateAs(bob), handler.DeleteFileHandler)
+
+		fileHash, _ := uploadFile(t, fileStorage, dbStorage, testFile)
+		require.NoError(t, dbStorage.AddFileOwner(fileHash, alice.ID))
+
+		w := applyRequest(router, newRequest(t, "DELETE", "/files/"+fileHash, nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		exists, err := dbStorage.CheckFileExists(fileHash)
+		require.NoError(t, err)
+		assert.True(t, exists)
+	})
+
+	t.Run("Test_DeleteFileHandler_With_Administrator", func(t *testing.T) {
+		router, handler, fileStorage, dbStorage, _ := setupTestEnv()
+		admin := createUser(t, dbStorage, "admin", "password")
+		handler.admins = map[string]bool{"admin": true}
+		router.DELETE("/files/:hash", authenticateAs(admin), handler.DeleteFileHandler)
+
+		fileHash, _ := uploadFile(t, fileStorage, dbStorage, testFile)
+
+		w := applyRequest(router, newRequest(t, "DELETE", "/files/"+fileHash, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		exists, err := dbStorage.CheckFileExists(fileHash)
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("Test_DeleteFileHandler_With_Non_Existing_File", func(t *testing.T) {
+		router, handler, _, _, _ := setupTestEnv()
+		router.DELETE("/files/:hash", handler.DeleteFileHandler)
+
+		req := newRequest(t, "DELETE", "/files/fileHash756456", nil)
+		w := applyRequest(router, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "File not found")
+	})
+
+	t.Run("Test_DeleteFileHandler_With_Internal_Server_Error", func(t *testing.T) {
+		router, handler := setupFailingTestEnv()
+		router.DELETE("/files/:hash", handler.DeleteFileHandler)
+
+		req := newRequest(t, "DELETE", "/files/fileHash756456", nil)
+		w := applyRequest(router, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Contains(t, w.Body.String(), "Failed to delete file")
+	})
+}
+
+func Test_GetChunkContent(t *testing.T) {
+	t.Run("Test_GetChunkContent_With_Valid_Request", func(t *testing.T) {
+		router, handler, fileStorage, dbStorage, _ := setupTestEnv()
+		alice := createUser(t, dbStorage, "alice", "password")
+		router.GET("/chunk/:hash", authenticateAs(alice), handler.GetChunkContent)
+
+		content := []byte("Hello World!")
+		fileHash, chunkHashes := uploadFile(t, fileStorage, dbStorage, content)
+		require.NoError(t, dbStorage.AddFileOwner(fileHash, alice.ID))
+
+		req := newRequest(t, "GET", "/chunk/"+chunkHashes[0], nil)
+		w := applyRequest(router, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/octet-stream", w.Header().Get("Content-Type"))
+		assert.Equal(t, content, w.Body.Bytes())
+	})
+
+	t.Run("Test_GetChunkContent_With_Chunk_Of_Another_User", func(t *testing.T) {
+		router, handler, fileStorage, dbStorage, _ := setupTestEnv()
+		alice := createUser(t, dbStorage, "alice", "password")
+		bob := createUser(t, dbStorage, "bob", "password")
+		router.GET("/chunk/:hash", authenticateAs(bob), handler.GetChunkContent)
+
+		fileHash, chunkHashes := uploadFile(t, fileStorage, dbStorage, testFile)
+		require.NoError(t, dbStorage.AddFileOwner(fileHash, alice.ID))
+
+		w := applyRequest(router, newRequest(t, "GET", "/chunk/"+chunkHashes[0], nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "Chunk not found")
+	})
+
+	t.Run("Test_GetChunkContent_With_Invalid_Request", func(t *testing.T) {
+		router, handler, _, _, _ := setupTestEnv()
+		router.GET("/chunk/:hash", handler.GetChunkContent)
+
+		w := applyRequest(router, newInvalidRequest(t, "GET", "/chunk/"))
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Test_GetChunkContent_With_Internal_Server_Error", func(t *testing.T) {
+		router, handler := setupFailingTestEnv()
+		router.GET("/chunk/:hash", handler.GetChunkContent)
+
+		req := newRequest(t, "GET", "/chunk/chunkHash1235487", nil)
+		w := applyRequest(router, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
+
+func Test_ScrubHandlers(t *testing.T) {
+	t.Run("Test_ScrubHandlers_With_Valid_Request", func(t *testing.T) {
+		router, handler, fileStorage, dbStorage, _ := setupTestEnv()
+		router.GET("/scrub", handler.ScrubStatusHandler)
+		router.POST("/scrub", handler.StartScrubHandler)
+
+		_, chunkHashes := uploadFile(t, fileStorage, dbStorage, testFile)
+		damaged, err := dbStorage.MarkChunkDamaged(chunkHashes[0])
+		require.NoError(t, err)
+
+		w := applyRequest(router, newRequest(t, "POST", "/scrub", nil))
+		require.Equal(t, http.StatusAccepted, w.Code)
+
+		var response ScrubStatusResponse
+		require.Eventually(t, func() bool {
+			w := applyRequest(router, newRequest(t, "GET", "/scrub", nil))
+			require.Equal(t, http.StatusOK, w.Code)
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			return response.Last != nil
+		}, time.Second, 10*time.Millisecond)
+
+		assert.False(t, response.Running)
+		assert.Equal(t, len(chunkHashes), response.Last.Verified)
+		assert.Empty(t, response.Last.Corrupt)
+		assert.Equal(t, damaged, response.DamagedFiles)
+	})
+
+	t.Run("Test_ScrubHandlers_Are_Only_For_Administrators", func(t *testing.T) {
+		router, handler, _, dbStorage, tokenHandler := setupTestEnv()
+		handler.admins = map[string]bool{"admin": true}
+		server := &Server{router: router, handler: handler}
+		server.registerHandlers()
+
+		scrub := func(method, username string) int {
+			user := createUser(t, dbStorage, username, "password")
+			tokens, err := tokenHandler.CreateTokenPair(user.ID, user.Username)
+			require.NoError(t, err)
+			req := newRequest(t, method, "/scrub", nil)
+			req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+			return applyRequest(router, req).Code
+		}
+
+		assert.Equal(t, http.StatusForbidden, scrub("GET", "alice"))
+		assert.Equal(t, http.StatusForbidden, scrub("POST", "bob"))
+		assert.Equal(t, http.StatusOK, scrub("GET", "admin"))
+	})
+
+	t.Run("Test_ScrubHandlers_With_Running_Scrub", func(t *testing.T) {
+		router, handler, fileStorage, dbStorage, _ := setupTestEnv()
+		router.POST("/scrub", handler.StartScrubHandler)
+
+		uploadFile(t, fileStorage, dbStorage, testFile)
+		handler.scrubber = scrub.NewScrubber(fileStorage, dbStorage, 1)
+		defer handler.scrubber.Stop()
+
+		w := applyRequest(router, newRequest(t, "POST", "/scrub", nil))
+		require.Equal(t, http.StatusAccepted, w.Code)
+
+		w = applyRequest(router, newRequest(t, "POST", "/scrub", nil))
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), "already running")
+	})
+
+	t.Run("Test_ScrubHandlers_With_Internal_Server_Error", func(t *testing.T) {
+		router, handler := setupFailingTestEnv()
+		router.GET("/scrub", handler.ScrubStatusHandler)
+
+		w := applyRequest(router, newRequest(t, "GET", "/scrub", nil))
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Contains(t, w.Body.String(), "test error")
+	})
+}
+
+func Test_UsageHandlers(t *testing.T) {
+	t.Run("Test_UsageHandlers_With_Valid_Request", func(t *testing.T) {
+		router, handler, fileStorage, dbStorage, _ := setupTestEnv()
+		alice := createUser(t, dbStorage, "alice", "password")
+		router.GET("/usage", authenticateAs(alice), handler.UsageHandler)
+		router.GET("/users/:username/usage", handler.UserUsageHandler)
+		handler.defaultQuota = model.Quota{LogicalBytes: 1 << 20, UniqueBytes: 1 << 10}
+		require.NoError(t, dbStorage.SetUserQuota("alice", model.Quota{UniqueBytes: -1}))
+
+		fileHash, _ := uploadFile(t, fileStorage, dbStorage, testFile)
+		require.NoError(t, dbStorage.AddFileOwner(fileHash, alice.ID))
+
+		for _, path := range []string{"/usage", "/users/alice/usage"} {
+			w := applyRequest(router, newRequest(t, "GET", path, nil))
+			require.Equal(t, http.StatusOK, w.Code)
+
+			var response UsageResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, "alice", response.Username)
+			assert.Equal(t, int64(1), response.Usage.Files)
+			assert.Equal(t, int64(len(testFile)), response.Usage.LogicalBytes)
+			// the user's own unlimited unique quota overrides the server's
+			assert.Equal(t, model.Quota{LogicalBytes: 1 << 20}, response.Quota)
+		}
+	})
+
+	t.Run("Test_UsageHandlers_With_Non_Existing_User", func(t *testing.T) {
+		router, handler, _, _, _ := setupTestEnv()
+		router.GET("/users/:username/usage", handler.UserUsageHandler)
+		router.PUT("/users/:username/quota", handler.SetQuotaHandler)
+
+		w := applyRequest(router, newRequest(t, "GET", "/users/alice/usage", nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = applyRequest(router, newRequest(t, "PUT", "/users/alice/quota", model.Quota{LogicalBytes: 1}))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Test_SetQuotaHandler_With_Valid_Request", func(t *testing.T) {
+		router, handler, _, dbStorage, _ := setupTestEnv()
+		createUser(t, dbStorage, "alice", "password")
+		router.PUT("/users/:username/quota", handler.SetQuotaHandler)
+
+		quota := model.Quota{LogicalBytes: 1 << 30, UniqueBytes: 1 << 20}
+		w := applyRequest(router, newRequest(t, "PUT", "/users/alice/quota", quota))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response UsageResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, quota, response.Quota)
+
+		user, err := dbStorage.GetUserByUsername("alice")
+		require.NoError(t, err)
+		assert.Equal(t, quota, user.Quota)
+	})
+
+	t.Run("Test_SetQuotaHandler_With_Invalid_Request_Format", func(t *testing.T) {
+		router, handler, _, _, _ := setupTestEnv()
+		router.PUT("/users/:username/quota", handler.SetQuotaHandler)
+
+		w := applyRequest(router, newInvalidRequest(t, "PUT", "/users/alice/quota"))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "Invalid request format")
+	})
+
+	t.Run("Test_UsageHandlers_With_Internal_Server_Error", func(t *testing.T) {
+		router, handler := setupFailingTestEnv()
+		router.GET("/usage", authenticateAs(&model.User{ID: 1, Username: "alice"}), handler.UsageHandler)
+
+		w := applyRequest(router, newRequest(t, "GET", "/usage", nil))
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Contains(t, w.Body.String(), "test error")
+	})
+}
+
+func Test_AdminMiddleware(t *testing.T) {
+	// adminRouter serves a route for administrators, authenticated as user
+	adminRouter := func(user *model.User) *gin.Engine {
+		gin.SetMode(gin.TestMode)
+		router := gin.New()
+		router.Use(authenticateAs(user), AdminMiddleware(map[string]bool{"admin": true}))
+		router.GET("/admin", func(c *gin.Context) {
+			c.JSON(200, gin.H{"msg": "authorized"})
+		})
+		return router
+	}
+
+	t.Run("Test_AdminMiddleware_With_Administrator", func(t *testing.T) {
+		router := adminRouter(&model.User{ID: 1, Username: "admin"})
+
+		w := applyRequest(router, newRequest(t, "GET", "/admin", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Test_AdminMiddleware_With_Other_User", func(t *testing.T) {
+		router := adminRouter(&model.User{ID: 2, Username: "alice"})
+
+		w := applyRequest(router, newRequest(t, "GET", "/admin", nil))
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "Administrator access required")
+	})
+}
+
+func Test_AuthMiddleware(t *testing.T) {
+	// protectedRouter serves a route behind the auth middleware that echoes the authenticated user
+	protectedRouter := func(tokenHandler auth.TokenManager) *gin.Engine {
+		gin.SetMode(gin.TestMode)
+		router := gin.New()
+		router.Use(AuthMiddleware(tokenHandler))
+		router.GET("/protected", func(c *gin.Context) {
+			c.JSON(200, gin.H{
+				"msg":      "authorized",
+				"userID":   c.GetUint("userID"),
+				"username": c.GetString("username"),
+			})
+		})
+		return router
+	}
+
+	t.Run("Test_AuthMiddleware_With_Valid_Request", func(t *testing.T) {
+		_, _, _, _, tokenHandler := setupTestEnv()
+		router := protectedRouter(tokenHandler)
+
+		tokenPair, err := tokenHandler.CreateTokenPair(7, "test")
+		require.NoError(t, err)
+
+		req := newRequest(t, "GET", "/protected", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenPair.AccessToken)
+		w := applyRequest(router, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{
+			"msg": "authorized",
+			"userID": 7,
+			"username": "test"
+		}`, w.Body.String())
+	})
+
+	t.Run("Test_AuthMiddleware_With_No_Authorization_Header", func(t *testing.T) {
+		_, _, _, _, tokenHandler := setupTestEnv()
+		router := protectedRouter(tokenHandler)
+
+		req := newRequest(t, "GET", "/protected", nil)
+		w := applyRequest(router, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Test_AuthMiddleware_With_Malformed_Authorization_Header", func(t *testing.T) {
+		_, _, _, _, tokenHandler := setupTestEnv()
+		router := protectedRouter(tokenHandler)
+
+		req := newRequest(t, "GET", "/protected", nil)
+		req.Header.Set("Authorization", "Token abc")
+		w := applyRequest(router, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Test_AuthMiddleware_With_Invalid_Token", func(t *testing.T) {
+		_, _, _, _, tokenHandler := setupTestEnv()
+		router := protectedRouter(tokenHandler)
+
+		// tokens signed with another secret are rejected
+		other := auth.NewTokenHandler("other-secret", time.Minute, time.Hour)
+		tokenPair, err := other.CreateTokenPair(7, "test")
+		require.NoError(t, err)
+
+		req := newRequest(t, "GET", "/protected", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenPair.AccessToken)
+		w := applyRequest(router, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
+
+func Test_StatsHandler(t *testing.T) {
+	t.Run("Test_StatsHandler_With_Valid_Request", func(t *testing.T) {
+		router, handler, fileStorage, dbStorage, _ := setupTestEnv()
+		alice := createUser(t, dbStorage, "alice", "password")
+		router.GET("/stats", authenticateAs(alice), handler.StatsHandler)
+
+		// the second file shares all but its last chunk with the first
+		for _, data := range [][]byte{testFile, append(bytes.Clone(testFile), '!')} {
+			fileHash, _ := uploadFile(t, fileStorage, dbStorage, data)
+			require.NoError(t, dbStorage.AddFileOwner(fileHash, alice.ID))
+		}
+		uploadFile(t, fileStorage, dbStorage, []byte("nobody's"))
+
+		w := applyRequest(router, newRequest(t, "GET", "/stats?top=2", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response StatsResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "alice", response.Username)
+		assert.Equal(t, int64(2), response.User.Files)
+		assert.Equal(t, int64(6), response.User.Chunks)
+		assert.Equal(t, int64(len(testFile)+5), response.User.ChunkBytes)
+		assert.Equal(t, int64(2*len(testFile)+1), response.User.LogicalBytes)
+		assert.InDelta(t, float64(2*len(testFile)+1)/float64(len(testFile)+5), response.User.DedupRatio, 1e-9)
+		require.Len(t, response.User.TopChunks, 2)
+		assert.Equal(t, 2, response.User.TopChunks[0].RefCount)
+		assert.Nil(t, response.Global)
+	})
+
+	t.Run("Test_StatsHandler_With_Administrator", func(t *testing.T) {
+		router, handler, fileStorage, dbStorage, _ := setupTestEnv()
+		alice := createUser(t, dbStorage, "alice", "password")
+		router.GET("/stats", authenticateAs(alice), handler.StatsHandler)
+		handler.admins = map[string]bool{"alice": true}
+
+		uploadFile(t, fileStorage, dbStorage, testFile)
+
+		w := applyRequest(router, newRequest(t, "GET", "/stats", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response StatsResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Zero(t, response.User.Files)
+		require.NotNil(t, response.Global)
+		assert.Equal(t, int64(1), response.Global.Files)
+		assert.Equal(t, int64(len(testFile)), response.Global.LogicalBytes)
+		assert.Equal(t, 1.0, response.Global.DedupRatio)
+		// the in-memory chunk store has no block stats, and there is no cache
+		assert.Nil(t, response.Global.Blocks)
+		assert.Nil(t, response.Global.Cache)
+	})
+
+	t.Run("Test_StatsHandler_With_Invalid_Top", func(t *testing.T) {
+		router, handler, _, _, _ := setupTestEnv()
+		router.GET("/stats", handler.StatsHandler)
+
+		for _, top := range []string{"many", "-1", "101"} {
+			w := applyRequest(router, newRequest(t, "GET", "/stats?top="+top, nil))
+			assert.Equal(t, http.StatusBadRequest, w.Code, top)
+		}
+	})
+
+	t.Run("Test_StatsHandler_With_Internal_Server_Error", func(t *testing.T) {
+		router, handler := setupFailingTestEnv()
+		router.GET("/stats", authenticateAs(&model.User{ID: 1, Username: "alice"}), handler.StatsHandler)
+
+		w := applyRequest(router, newRequest(t, "GET", "/stats", nil))
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Contains(t, w.Body.String(), "test error")
+	})
+}
+
+// setupUsersTestEnv sets up routes for alice and bob under their usernames, registered by register
+// for each of them, and the public share link route. Alice owns testFile, named hello.txt, and
+// returns its hash.
+func setupUsersTestEnv(t *testing.T, register func(group *gin.RouterGroup, handler *Handler)) (*gin.Engine, *memory.MemoryDB, string) {
+	t.Helper()
+
+	router, handler, fileStorage, dbStorage, _ := setupTestEnv()
+	alice := createUser(t, dbStorage, "alice", "password")
+	bob := createUser(t, dbStorage, "bob", "password")
+	for _, user := range []*model.User{alice, bob} {
+		register(router.Group("/"+user.Username, authenticateAs(user)), handler)
+	}
+	router.GET("/shared/:token", handler.SharedFileHandler)
+
+	fileHash, _ := uploadFile(t, fileStorage, dbStorage, testFile)
+	require.NoError(t, dbStorage.AddFileOwner(fileHash, alice.ID))
+	require.NoError(t, dbStorage.SetFileInfo(fileHash, "hello.txt", "text/plain", "alice"))
+	return router, dbStorage, fileHash
+}
+
+// registerSharingRoutes registers the download and sharing routes
+func registerSharingRoutes(group *gin.RouterGroup, handler *Handler) {
+	group.GET("/download/:hash", handler.DownloadFileHandler)
+	group.GET("/chunk/:hash", handler.GetChunkContent)
+	group.GET("/files/:hash/shares", handler.ListSharesHandler)
+	group.POST("/files/:hash/grants", handler.GrantAccessHandler)
+	group.DELETE("/files/:hash/grants/:username", handler.RevokeAccessHandler)
+	group.POST("/files/:hash/links", handler.CreateShareLinkHandler)
+	group.DELETE("/files/:hash/links/:token", handler.DeleteShareLinkHandler)
+}
+
+// createShareLink creates a share link to a file as alice
+func createShareLink(t *testing.T, router *gin.Engine, fileHash string, request *ShareLinkRequest) ShareLinkResponse {
+	t.Helper()
+
+	var body interface{}
+	if request != nil {
+		body = request
+	}
+	w := applyRequest(router, newRequest(t, "POST", "/alice/files/"+fileHash+"/links", body))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var response ShareLinkResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response
+}
+
+func Test_GrantHandlers(t *testing.T) {
+	t.Run("Test_GrantAccessHandler_With_Valid_Request", func(t *testing.T) {
+		router, _, fileHash := setupUsersTestEnv(t, registerSharingRoutes)
+
+		w := applyRequest(router, newRequest(t, "GET", "/bob/download/"+fileHash, nil))
+		require.Equal(t, http.StatusNotFound, w.Code)
+
+		w = applyRequest(router, newRequest(t, "POST", "/alice/files/"+fileHash+"/grants", GrantRequest{Username: "bob"}))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var grant GrantResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &grant))
+		assert.Equal(t, "bob", grant.Username)
+		assert.False(t, grant.GrantedAt.IsZero())
+
+		w = applyRequest(router, newRequest(t, "GET", "/bob/download/"+fileHash, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		var download DownloadFileResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &download))
+		w = applyRequest(router, newRequest(t, "GET", "/bob/chunk/"+download.ChunkHashes[0], nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Test_GrantAccessHandler_With_File_Of_Another_User", func(t *testing.T) {
+		router, _, fileHash := setupUsersTestEnv(t, registerSharingRoutes)
+
+		w := applyRequest(router, newRequest(t, "POST", "/bob/files/"+fileHash+"/grants", GrantRequest{Username: "bob"}))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "File not found")
+	})
+
+	t.Run("Test_GrantAccessHandler_With_Non_Existing_User", func(t *testing.T) {
+		router, _, fileHash := setupUsersTestEnv(t, registerSharingRoutes)
+
+		w := applyRequest(router, newRequest(t, "POST", "/alice/files/"+fileHash+"/grants", GrantRequest{Username: "carol"}))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "User not found")
+	})
+
+	t.Run("Test_GrantAccessHandler_With_Invalid_Request_Format", func(t *testing.T) {
+		router, _, fileHash := setupUsersTestEnv(t, registerSharingRoutes)
+
+		w := applyRequest(router, newInvalidRequest(t, "POST", "/alice/files/"+fileHash+"/grants"))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Test_RevokeAccessHandler_With_Valid_Request", func(t *testing.T) {
+		router, _, fileHash := setupUsersTestEnv(t, registerSharingRoutes)
+
+		w := applyRequest(router, newRequest(t, "POST", "/alice/files/"+fileHash+"/grants", GrantRequest{Username: "bob"}))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = applyRequest(router, newRequest(t, "DELETE", "/alice/files/"+fileHash+"/grants/bob", nil))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		w = applyRequest(router, newRequest(t, "GET", "/bob/download/"+fileHash, nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = applyRequest(router, newRequest(t, "DELETE", "/alice/files/"+fileHash+"/grants/bob", nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "Grant not found")
+	})
+
+	t.Run("Test_ListSharesHandler_With_Valid_Request", func(t *testing.T) {
+		router, _, fileHash := setupUsersTestEnv(t, registerSharingRoutes)
+
+		w := applyRequest(router, newRequest(t, "POST", "/alice/files/"+fileHash+"/grants", GrantRequest{Username: "bob"}))
+		require.Equal(t, http.StatusOK, w.Code)
+		link := createShareLink(t, router, fileHash, &ShareLinkRequest{Password: "secret"})
+
+		w = applyRequest(router, newRequest(t, "GET", "/alice/files/"+fileHash+"/shares", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		var response SharesResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Grants, 1)
+		assert.Equal(t, "bob", response.Grants[0].Username)
+		require.Len(t, response.Links, 1)
+		assert.Equal(t, link.Token, response.Links[0].Token)
+		assert.True(t, response.Links[0].Protected)
+		assert.False(t, response.Links[0].Expired)
+
+		// grantees may read the file, but not manage its shares
+		w = applyRequest(router, newRequest(t, "GET", "/bob/files/"+fileHash+"/shares", nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Test_GrantHandlers_With_Internal_Server_Error", func(t *testing.T) {
+		router, handler := setupFailingTestEnv()
+		router.POST("/files/:hash/grants", authenticateAs(&model.User{ID: 1, Username: "alice"}), handler.GrantAccessHandler)
+
+		w := applyRequest(router, newRequest(t, "POST", "/files/fileHash756456/grants", GrantRequest{Username: "bob"}))
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
+
+func Test_ShareLinkHandlers(t *testing.T) {
+	t.Run("Test_SharedFileHandler_With_Valid_Request", func(t *testing.T) {
+		router, _, fileHash := setupUsersTestEnv(t, registerSharingRoutes)
+
+		link := createShareLink(t, router, fileHash, nil)
+		assert.Equal(t, "/shared/"+link.Token, link.Path)
+		assert.False(t, link.Protected)
+		assert.WithinDuration(t, time.Now().Add(defaultShareLinkExpiry), link.ExpiresAt, time.Minute)
+
+		// share links need no authentication
+		w := applyRequest(router, newRequest(t, "GET", link.Path, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, testFile, w.Body.Bytes())
+		assert.Equal(t, "text/plain", w.Header().Get("Content-Type"))
+		assert.Equal(t, `attachment; filename=hello.txt`, w.Header().Get("Content-Disposition"))
+	})
+
+	t.Run("Test_SharedFileHandler_With_Link_Of_Another_Owner", func(t *testing.T) {
+		router, dbStorage, fileHash := setupUsersTestEnv(t, registerSharingRoutes)
+		bob, err := dbStorage.GetUserByUsername("bob")
+		require.NoError(t, err)
+		require.NoError(t, dbStorage.AddFileOwner(fileHash, bob.ID))
+
+		w := applyRequest(router, newRequest(t, "POST", "/bob/files/"+fileHash+"/links", nil))
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var link ShareLinkResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &link))
+
+		// the name alice gave the file stays hers
+		w = applyRequest(router, newRequest(t, "GET", link.Path, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "attachment", w.Header().Get("Content-Disposition"))
+	})
+
+	t.Run("Test_SharedFileHandler_With_Password", func(t *testing.T) {
+		router, _, fileHash := setupUsersTestEnv(t, registerSharingRoutes)
+
+		link := createShareLink(t, router, fileHash, &ShareLinkRequest{ExpiresIn: "1h", Password: "secret"})
+		assert.True(t, link.Protected)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), link.ExpiresAt, time.Minute)
+
+		for _, password := range []string{"", "wrong"} {
+			req := newRequest(t, "GET", link.Path, nil)
+			req.Header.Set("X-Share-Password", password)
+			w := applyRequest(router, req)
+			assert.Equal(t, http.StatusUnauthorized, w.Code, password)
+		}
+
+		req := newRequest(t, "GET", link.Path, nil)
+		req.Header.Set("X-Share-Password", "secret")
+		w := applyRequest(router, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, testFile, w.Body.Bytes())
+
+		// the password is never taken from the URL
+		w = applyRequest(router, newRequest(t, "GET", link.Path+"?password=secret", nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Test_SharedFileHandler_With_Expired_Link", func(t *testing.T) {
+		router, dbStorage, fileHash := setupUsersTestEnv(t, registerSharingRoutes)
+
+		link := &model.ShareLink{Token: "expired", CreatedBy: 1, ExpiresAt: time.Now().Add(-time.Minute)}
+		require.NoError(t, dbStorage.CreateShareLink(fileHash, link))
+
+		w := applyRequest(router, newRequest(t, "GET", "/shared/expired", nil))
+		assert.Equal(t, http.StatusGone, w.Code)
+		w = applyRequest(router, newRequest(t, "GET", "/shared/missing", nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Test_CreateShareLinkHandler_With_Invalid_Expiry", func(t *testing.T) {
+		router, _, fileHash := setupUsersTestEnv(t, registerSharingRoutes)
+
+		for _, expiresIn := range []string{"soon", "-1h", "0s", "721h"} {
+			w := applyRequest(router, newRequest(t, "POST", "/alice/files/"+fileHash+"/links", ShareLinkRequest{ExpiresIn: expiresIn}))
+			assert.Equal(t, http.StatusBadRequest, w.Code, expiresIn)
+		}
+	})
+
+	t.Run("Test_CreateShareLinkHandler_With_File_Of_Another_User", func(t *testing.T) {
+		router, _, fileHash := setupUsersTestEnv(t, registerSharingRoutes)
+
+		w := applyRequest(router, newRequest(t, "POST", "/bob/files/"+fileHash+"/links", nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Test_DeleteShareLinkHandler_With_Valid_Request", func(t *testing.T) {
+		router, _, fileHash := setupUsersTestEnv(t, registerSharingRoutes)
+
+		link := createShareLink(t, router, fileHash, nil)
+		w := applyRequest(router, newRequest(t, "DELETE", "/bob/files/"+fileHash+"/links/"+link.Token, nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = applyRequest(router, newRequest(t, "DELETE", "/alice/files/"+fileHash+"/links/"+link.Token, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		w = applyRequest(router, newRequest(t, "GET", link.Path, nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = applyRequest(router, newRequest(t, "DELETE", "/alice/files/"+fileHash+"/links/"+link.Token, nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "Share link not found")
+	})
+}
+
+// registerNamespaceRoutes registers the namespace routes
+func registerNamespaceRoutes(group *gin.RouterGroup, handler *Handler) {
+	group.POST("/fs/mkdir", handler.MkdirHandler)
+	group.GET("/fs/ls", handler.ListDirectoryHandler)
+	group.GET("/fs/stat", handler.StatPathHandler)
+	group.POST("/fs/mv", handler.MovePathHandler)
+	group.DELETE("/fs/rm", handler.RemovePathHandler)
+	group.PUT("/fs/files", handler.SaveFilePathHandler)
+	group.DELETE("/files/:hash", handler.DeleteFileHandler)
+}
+
+// listDirectory lists a directory of alice
+func listDirectory(t *testing.T, router *gin.Engine, dirPath string) []PathEntryResponse {
+	t.Helper()
+
+	w := applyRequest(router, newRequest(t, "GET", "/alice/fs/ls?path="+url.QueryEscape(dirPath), nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var response ListDirectoryResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response.Entries
+}
+
+func Test_NamespaceHandlers(t *testing.T) {
+	t.Run("Test_MkdirHandler_With_Valid_Request", func(t *testing.T) {
+		router, _, _ := setupUsersTestEnv(t, registerNamespaceRoutes)
+
+		w := applyRequest(router, newRequest(t, "POST", "/alice/fs/mkdir", MkdirRequest{Path: "/docs/"}))
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var entry PathEntryResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entry))
+		assert.Equal(t, "/docs", entry.Path)
+		assert.Equal(t, "docs", entry.Name)
+		assert.Equal(t, "dir", entry.Type)
+
+		w = applyRequest(router, newRequest(t, "POST", "/alice/fs/mkdir", MkdirRequest{Path: "/docs"}))
+		assert.Equal(t, http.StatusConflict, w.Code)
+		w = applyRequest(router, newRequest(t, "POST", "/alice/fs/mkdir", MkdirRequest{Path: "/a/b"}))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "Parent directory not found")
+	})
+
+	t.Run("Test_MkdirHandler_With_Parents", func(t *testing.T) {
+		router, _, _ := setupUsersTestEnv(t, registerNamespaceRoutes)
+
+		w := applyRequest(router, newRequest(t, "POST", "/alice/fs/mkdir", MkdirRequest{Path: "/a/b/c", Parents: true}))
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		entries := listDirectory(t, router, "/a/b")
+		require.Len(t, entries, 1)
+		assert.Equal(t, "/a/b/c", entries[0].Path)
+
+		w = applyRequest(router, newRequest(t, "POST", "/alice/fs/mkdir", MkdirRequest{Path: "/a/b", Parents: true}))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Test_MkdirHandler_With_Invalid_Path", func(t *testing.T) {
+		router, _, _ := setupUsersTestEnv(t, registerNamespaceRoutes)
+
+		for _, dirPath := range []string{"docs", "/", "/..", "/docs/\x00"} {
+			w := applyRequest(router, newRequest(t, "POST", "/alice/fs/mkdir", MkdirRequest{Path: dirPath}))
+			assert.Equal(t, http.StatusBadRequest, w.Code, dirPath)
+		}
+		w := applyRequest(router, newInvalidRequest(t, "POST", "/alice/fs/mkdir"))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Test_SaveFilePathHandler_With_Valid_Request", func(t *testing.T) {
+		router, _, fileHash := setupUsersTestEnv(t, registerNamespaceRoutes)
+
+		w := applyRequest(router, newRequest(t, "PUT", "/alice/fs/files", SaveFileRequest{Path: "/hello.txt", FileHash: fileHash}))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var entry PathEntryResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entry))
+		assert.Equal(t, "file", entry.Type)
+		assert.Equal(t, fileHash, entry.FileHash)
+		assert.Equal(t, int64(len(testFile)), entry.Size)
+		assert.Equal(t, "text/plain", entry.ContentType)
+
+		w = applyRequest(router, newRequest(t, "GET", "/alice/fs/stat?path=/hello.txt", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entry))
+		assert.Equal(t, fileHash, entry.FileHash)
+
+		// paths are private to every user
+		w = applyRequest(router, newRequest(t, "GET", "/bob/fs/stat?path=/hello.txt", nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "Path not found")
+	})
+
+	t.Run("Test_SaveFilePathHandler_With_File_Of_Another_User", func(t *testing.T) {
+		router, _, fileHash := setupUsersTestEnv(t, registerNamespaceRoutes)
+
+		w := applyRequest(router, newRequest(t, "PUT", "/bob/fs/files", SaveFileRequest{Path: "/hello.txt", FileHash: fileHash}))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "File not found")
+	})
+
+	t.Run("Test_SaveFilePathHandler_With_Directory_Path", func(t *testing.T) {
+		router, _, fileHash := setupUsersTestEnv(t, registerNamespaceRoutes)
+
+		w := applyRequest(router, newRequest(t, "POST", "/alice/fs/mkdir", MkdirRequest{Path: "/docs"}))
+		require.Equal(t, http.StatusCreated, w.Code)
+		w = applyRequest(router, newRequest(t, "PUT", "/alice/fs/files", SaveFileRequest{Path: "/docs", FileHash: fileHash}))
+		assert.Equal(t, http.StatusConflict, w.Code)
+		w = applyRequest(router, newRequest(t, "PUT", "/alice/fs/files", SaveFileRequest{Path: "/missing/hello.txt", FileHash: fileHash}))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "Parent directory not found")
+	})
+
+	t.Run("Test_ListDirectoryHandler_With_Valid_Request", func(t *testing.T) {
+		router, _, fileHash := setupUsersTestEnv(t, registerNamespaceRoutes)
+
+		w := applyRequest(router, newRequest(t, "POST", "/alice/fs/mkdir", MkdirRequest{Path: "/docs"}))
+		require.Equal(t, http.StatusCreated, w.Code)
+		w = applyRequest(router, newRequest(t, "PUT", "/alice/fs/files", SaveFileRequest{Path: "/a.txt", FileHash: fileHash}))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		entries := listDirectory(t, router, "/")
+		require.Len(t, entries, 2)
+		assert.Equal(t, "dir", entries[0].Type)
+		assert.Equal(t, "/docs", entries[0].Path)
+		assert.Equal(t, "a.txt", entries[1].Name)
+		assert.Empty(t, listDirectory(t, router, "/docs"))
+
+		// listing a file returns the file alone
+		entries = listDirectory(t, router, "/a.txt")
+		require.Len(t, entries, 1)
+		assert.Equal(t, fileHash, entries[0].FileHash)
+
+		w = applyRequest(router, newRequest(t, "GET", "/alice/fs/ls?path=/missing", nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w = applyRequest(router, newRequest(t, "GET", "/alice/fs/ls?path=docs", nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Test_StatPathHandler_With_Root", func(t *testing.T) {
+		router, _, _ := setupUsersTestEnv(t, registerNamespaceRoutes)
+
+		w := applyRequest(router, newRequest(t, "GET", "/alice/fs/stat?path=/", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		var entry PathEntryResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entry))
+		assert.Equal(t, "dir", entry.Type)
+
+		w = applyRequest(router, newRequest(t, "GET", "/alice/fs/stat", nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Test_MovePathHandler_With_Valid_Request", func(t *testing.T) {
+		router, _, fileHash := setupUsersTestEnv(t, registerNamespaceRoutes)
+
+		w := applyRequest(router, newRequest(t, "POST", "/alice/fs/mkdir", MkdirRequest{Path: "/docs/sub", Parents: true}))
+		require.Equal(t, http.StatusCreated, w.Code)
+		w = applyRequest(router, newRequest(t, "PUT", "/alice/fs/files", SaveFileRequest{Path: "/docs/sub/a.txt", FileHash: fileHash}))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = applyRequest(router, newRequest(t, "POST", "/alice/fs/mv", MoveRequest{From: "/docs", To: "/papers"}))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		w = applyRequest(router, newRequest(t, "GET", "/alice/fs/stat?path=/papers/sub/a.txt", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		// moving to a directory moves the entry into it
+		w = applyRequest(router, newRequest(t, "POST", "/alice/fs/mv", MoveRequest{From: "/papers/sub/a.txt", To: "/"}))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var entry PathEntryResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entry))
+		assert.Equal(t, "/a.txt", entry.Path)
+		assert.Equal(t, fileHash, entry.FileHash)
+	})
+
+	t.Run("Test_MovePathHandler_With_Invalid_Move", func(t *testing.T) {
+		router, _, fileHash := setupUsersTestEnv(t, registerNamespaceRoutes)
+
+		w := applyRequest(router, newRequest(t, "POST", "/alice/fs/mkdir", MkdirRequest{Path: "/docs"}))
+		require.Equal(t, http.StatusCreated, w.Code)
+		w = applyRequest(router, newRequest(t, "PUT", "/alice/fs/files", SaveFileRequest{Path: "/a.txt", FileHash: fileHash}))
+		require.Equal(t, http.StatusOK, w.Code)
+		w = applyRequest(router, newRequest(t, "PUT", "/alice/fs/files", SaveFileRequest{Path: "/b.txt", FileHash: fileHash}))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = applyRequest(router, newRequest(t, "POST", "/alice/fs/mv", MoveRequest{From: "/docs", To: "/docs/inner"}))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w = applyRequest(router, newRequest(t, "POST", "/alice/fs/mv", MoveRequest{From: "/a.txt", To: "/b.txt"}))
+		assert.Equal(t, http.StatusConflict, w.Code)
+		w = applyRequest(router, newRequest(t, "POST", "/alice/fs/mv", MoveRequest{From: "/missing", To: "/c.txt"}))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w = applyRequest(router, newRequest(t, "POST", "/alice/fs/mv", MoveRequest{From: "/", To: "/docs"}))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Test_RemovePathHandler_With_Valid_Request", func(t *testing.T) {
+		router, _, fileHash := setupUsersTestEnv(t, registerNamespaceRoutes)
+
+		w := applyRequest(router, newRequest(t, "POST", "/alice/fs/mkdir", MkdirRequest{Path: "/docs"}))
+		require.Equal(t, http.StatusCreated, w.Code)
+		w = applyRequest(router, newRequest(t, "PUT", "/alice/fs/files", SaveFileRequest{Path: "/docs/a.txt", FileHash: fileHash}))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = applyRequest(router, newRequest(t, "DELETE", "/alice/fs/rm?path=/docs", nil))
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), "Directory not empty")
+
+		w = applyRequest(router, newRequest(t, "DELETE", "/alice/fs/rm?path=/docs&recursive=true", nil))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var response RemovePathResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, int64(2), response.Removed)
+		assert.Empty(t, listDirectory(t, router, "/"))
+
+		// the file stays among the files of alice
+		w = applyRequest(router, newRequest(t, "PUT", "/alice/fs/files", SaveFileRequest{Path: "/a.txt", FileHash: fileHash}))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = applyRequest(router, newRequest(t, "DELETE", "/alice/fs/rm?path=/docs", nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w = applyRequest(router, newRequest(t, "DELETE", "/alice/fs/rm?path=/", nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Test_DeleteFileHandler_Removes_File_Paths", func(t *testing.T) {
+		router, _, fileHash := setupUsersTestEnv(t, registerNamespaceRoutes)
+
+		w := applyRequest(router, newRequest(t, "PUT", "/alice/fs/files", SaveFileRequest{Path: "/a.txt", FileHash: fileHash}))
+		require.Equal(t, http.StatusOK, w.Code)
+		w = applyRequest(router, newRequest(t, "DELETE", "/alice/files/"+fileHash, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = applyRequest(router, newRequest(t, "GET", "/alice/fs/stat?path=/a.txt", nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Test_NamespaceHandlers_With_Internal_Server_Error", func(t *testing.T) {
+		router, handler := setupFailingTestEnv()
+		user := authenticateAs(&model.User{ID: 1, Username: "alice"})
+		router.POST("/fs/mkdir", user, handler.MkdirHandler)
+		router.GET("/fs/ls", user, handler.ListDirectoryHandler)
+
+		w := applyRequest(router, newRequest(t, "POST", "/fs/mkdir", MkdirRequest{Path: "/docs"}))
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		w = applyRequest(router, newRequest(t, "GET", "/fs/ls", nil))
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
+
+func Test_NewFileStorage(t *testing.T) {
+	t.Run("Test_NewFileStorage_Rejects_Filesystem_Options_For_Other_Stores", func(t *testing.T) {
+		for _, serverConfig := range []config.Config{
+			{ChunkStore: memory.StorageURL, Compression: "zstd"},
+			{ChunkStore: memory.StorageURL, Quarantine: true},
+			{ChunkStore: memory.StorageURL, Layout: "pack"},
+		} {
+			_, err := newFileStorage(serverConfig)
+			assert.Error(t, err, serverConfig)
+		}
+
+		_, err := newFileStorage(config.Config{ChunkStore: memory.StorageURL, Compression: "none", Layout: "loose"})
+		assert.NoError(t, err)
+		_, err = newFileStorage(config.Config{StorageDir: t.TempDir(), Compression: "zstd", Quarantine: true, Layout: "pack"})
+		assert.NoError(t, err)
+	})
+}
@@ -41,3 +41,16 @@ func AuthMiddleware(tokenHandler auth.TokenManager) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// AdminMiddleware creates a middleware that only lets administrators through. It must run after AuthMiddleware.
+func AdminMiddleware(admins map[string]bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !admins[c.GetString("username")] {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Administrator access required"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -4,11 +4,20 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 	"zerodupe/internal/server/auth"
 	"zerodupe/internal/server/config"
+	"zerodupe/internal/server/gc"
+	"zerodupe/internal/server/model"
+	"zerodupe/internal/server/scrub"
 	"zerodupe/internal/server/storage"
+	"zerodupe/internal/server/storage/cache"
 	"zerodupe/internal/server/storage/filesystem"
+	"zerodupe/internal/server/storage/memory"
+	"zerodupe/internal/server/storage/redundant"
+	_ "zerodupe/internal/server/storage/s3" // registers the s3:// chunk store
 
 	_ "zerodupe/internal/server/docs" // This is the generated docs package
 
@@ -25,22 +34,38 @@ type Server struct {
 	config     config.Config
 	storage    storage.FileSystem
 	handler    *Handler
+	cache      *cache.CachedStorage // nil without a chunk cache
+	collector  *gc.Collector
+	scrubber   *scrub.Scrubber
+	stopJobs   context.CancelFunc // stops the scheduled garbage collections and scrubs
 }
 
 // NewServer creates a new server with all configurations
 func NewServer(config config.Config) (*Server, error) {
-	fileStorage, err := filesystem.NewFilesystemStorage(config.StorageDir)
+	fileStorage, err := newFileStorage(config)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to create storage")
-		return nil, fmt.Errorf("failed to create storage: %w", err)
+		return nil, err
 	}
 
-	userStorage, err := storage.NewSqliteStorage(config.StorageDir + "/users.db")
+	userStorage, err := newDB(config)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to create user storage")
 		return nil, fmt.Errorf("failed to create user storage: %w", err)
 	}
 
+	if err := storage.Migrate(fileStorage, userStorage); err != nil {
+		log.Error().Err(err).Msg("Failed to migrate storage")
+		return nil, fmt.Errorf("failed to migrate storage: %w", err)
+	}
+
+	blocks, _ := fileStorage.(*filesystem.FilesystemStorage)
+	var chunkCache *cache.CachedStorage
+	if _, inMemory := fileStorage.(*memory.MemoryStorage); config.CacheSizeMB > 0 && !inMemory {
+		chunkCache = cache.NewCachedStorage(fileStorage, int64(config.CacheSizeMB)<<20)
+		fileStorage = chunkCache
+		log.Info().Int("size_mb", config.CacheSizeMB).Msg("Chunk cache")
+	}
+
 	tokenHandler := auth.NewTokenHandler(
 		config.JWTSecret,
 		time.Duration(config.AccessTokenExpiryMin)*time.Minute,
@@ -48,13 +73,34 @@ func NewServer(config config.Config) (*Server, error) {
 	)
 
 	handler := NewHandler(fileStorage, userStorage, tokenHandler)
+	handler.scrubber = scrub.NewScrubber(fileStorage, userStorage, int64(config.ScrubRateMB)<<20)
+	handler.collector = gc.NewCollector(fileStorage, userStorage, config.GCGracePeriod)
+	handler.blocks = blocks
+	handler.cache = chunkCache
+	handler.admins = make(map[string]bool)
+	for _, admin := range config.Admins {
+		handler.admins[admin] = true
+		if _, err := userStorage.GetUserByUsername(admin); err != nil {
+			log.Warn().Str("admin", admin).Msg("Administrator is not registered, sign-up refuses the name until it is unlisted")
+		}
+	}
+	handler.defaultQuota = model.Quota{
+		LogicalBytes: int64(config.QuotaLogicalMB) << 20,
+		UniqueBytes:  int64(config.QuotaUniqueMB) << 20,
+	}
+	if len(config.Admins) > 0 || handler.defaultQuota != (model.Quota{}) {
+		log.Info().Strs("admins", config.Admins).Int("logical_mb", config.QuotaLogicalMB).Int("unique_mb", config.QuotaUniqueMB).Msg("Quotas")
+	}
 	router := gin.Default()
 
 	server := &Server{
-		router:  router,
-		config:  config,
-		handler: handler,
-		storage: fileStorage,
+		router:    router,
+		config:    config,
+		handler:   handler,
+		storage:   fileStorage,
+		cache:     chunkCache,
+		collector: handler.collector,
+		scrubber:  handler.scrubber,
 	}
 
 	// Register routes
@@ -63,6 +109,96 @@ func NewServer(config config.Config) (*Server, error) {
 	return server, nil
 }
 
+// newFileStorage opens the chunk store at the configured backend URL
+func newFileStorage(serverConfig config.Config) (storage.FileSystem, error) {
+	storeURL, err := serverConfig.ChunkStoreURL()
+	if err != nil {
+		return nil, err
+	}
+
+	fileStorage, err := storage.OpenFileSystem(storeURL)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create storage")
+		return nil, fmt.Errorf("failed to create storage: %w", err)
+	}
+	log.Info().Str("url", redactURL(storeURL)).Msg("Chunk store")
+
+	if _, ok := fileStorage.(*filesystem.FilesystemStorage); !ok {
+		if options := blockStoreOptions(serverConfig); len(options) > 0 {
+			log.Error().Strs("options", options).Msg("Options only supported by the filesystem block store")
+			return nil, fmt.Errorf("%s only supported by the filesystem block store", strings.Join(options, ", "))
+		}
+	}
+
+	switch fileStorage := fileStorage.(type) {
+	case *memory.MemoryStorage:
+		log.Warn().Msg("Block storage in memory, chunks are lost on shutdown")
+	case *redundant.RedundantStorage:
+		log.Info().
+			Str("mode", fileStorage.Mode()).
+			Strs("dirs", fileStorage.Dirs()).
+			Int("min_shards", fileStorage.MinShards()).
+			Msg("Redundant block storage")
+	case *filesystem.FilesystemStorage:
+		if err := fileStorage.SetCompression(serverConfig.Compression); err != nil {
+			log.Error().Err(err).Msg("Invalid compression")
+			return nil, fmt.Errorf("invalid compression: %w", err)
+		}
+
+		fileStorage.SetQuarantine(serverConfig.Quarantine)
+
+		if err := fileStorage.SetLayout(serverConfig.Layout); err != nil {
+			log.Error().Err(err).Msg("Invalid layout")
+			return nil, fmt.Errorf("invalid layout: %w", err)
+		}
+
+		stats := fileStorage.Stats()
+		log.Info().
+			Int64("blocks", stats.Blocks).
+			Int64("compressed_blocks", stats.CompressedBlocks).
+			Int64("stored_bytes", stats.StoredBytes).
+			Int64("saved_bytes", stats.SavedBytes()).
+			Msg("Block storage")
+	}
+
+	return fileStorage, nil
+}
+
+// blockStoreOptions returns the options set in the config that only the filesystem block store supports
+func blockStoreOptions(serverConfig config.Config) []string {
+	var options []string
+	if serverConfig.Compression != "" && serverConfig.Compression != filesystem.CompressionNone {
+		options = append(options, "--compression")
+	}
+	if serverConfig.Quarantine {
+		options = append(options, "--quarantine")
+	}
+	if serverConfig.Layout != "" && serverConfig.Layout != filesystem.LayoutLoose {
+		options = append(options, "--layout")
+	}
+	return options
+}
+
+// newDB opens the user and metadata database at the configured backend URL
+func newDB(serverConfig config.Config) (storage.DB, error) {
+	storeURL := serverConfig.MetadataStoreURL()
+	log.Info().Str("url", redactURL(storeURL)).Msg("Metadata store")
+	return storage.OpenDB(storeURL)
+}
+
+// redactURL hides the password and session token of a backend URL for logging
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "<invalid>"
+	}
+	if query := u.Query(); query.Has("session_token") {
+		query.Set("session_token", "xxxxx")
+		u.RawQuery = query.Encode()
+	}
+	return u.Redacted()
+}
+
 // registerHandlers registers all routes
 func (server *Server) registerHandlers() {
 	server.router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
@@ -70,6 +206,7 @@ func (server *Server) registerHandlers() {
 	server.router.POST("/auth/signup", server.handler.SignUpHandler)
 	server.router.POST("/auth/login", server.handler.LoginHandler)
 	server.router.POST("/auth/refresh", server.handler.RefreshTokenHandler)
+	server.router.GET("/shared/:token", server.handler.SharedFileHandler)
 
 	authMiddleware := AuthMiddleware(server.handler.tokenHandler)
 	authorized := server.router.Group("/")
@@ -80,6 +217,27 @@ func (server *Server) registerHandlers() {
 		authorized.POST("/check", server.handler.CheckChunkHashesHandler)
 		authorized.GET("/download/:hash", server.handler.DownloadFileHandler)
 		authorized.GET("/chunk/:hash", server.handler.GetChunkContent)
+		authorized.POST("/fs/mkdir", server.handler.MkdirHandler)
+		authorized.GET("/fs/ls", server.handler.ListDirectoryHandler)
+		authorized.GET("/fs/stat", server.handler.StatPathHandler)
+		authorized.POST("/fs/mv", server.handler.MovePathHandler)
+		authorized.DELETE("/fs/rm", server.handler.RemovePathHandler)
+		authorized.PUT("/fs/files", server.handler.SaveFilePathHandler)
+		authorized.DELETE("/files/:hash", server.handler.DeleteFileHandler)
+		authorized.GET("/files/:hash/shares", server.handler.ListSharesHandler)
+		authorized.POST("/files/:hash/grants", server.handler.GrantAccessHandler)
+		authorized.DELETE("/files/:hash/grants/:username", server.handler.RevokeAccessHandler)
+		authorized.POST("/files/:hash/links", server.handler.CreateShareLinkHandler)
+		authorized.DELETE("/files/:hash/links/:token", server.handler.DeleteShareLinkHandler)
+		authorized.GET("/usage", server.handler.UsageHandler)
+		authorized.GET("/stats", server.handler.StatsHandler)
+
+		admin := authorized.Group("/")
+		admin.Use(AdminMiddleware(server.handler.admins))
+		admin.GET("/scrub", server.handler.ScrubStatusHandler)
+		admin.POST("/scrub", server.handler.StartScrubHandler)
+		admin.GET("/users/:username/usage", server.handler.UserUsageHandler)
+		admin.PUT("/users/:username/quota", server.handler.SetQuotaHandler)
 	}
 }
 
@@ -91,6 +249,19 @@ func (server *Server) Run() error {
 		Handler: server.router,
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	server.stopJobs = cancel
+
+	if server.config.GCInterval > 0 {
+		go server.collector.Run(ctx, server.config.GCInterval)
+		log.Info().Dur("interval", server.config.GCInterval).Msg("Scheduled garbage collection")
+	}
+
+	if server.config.ScrubInterval > 0 {
+		go server.scrubber.Run(ctx, server.config.ScrubInterval)
+		log.Info().Dur("interval", server.config.ScrubInterval).Int("rate_mb", server.config.ScrubRateMB).Msg("Scheduled scrub")
+	}
+
 	if err := server.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Error().Err(err).Msg("Failed to start server")
 	}
@@ -100,8 +271,27 @@ func (server *Server) Run() error {
 
 // Shutdown gracefully shuts down the server
 func (server *Server) Shutdown(ctx context.Context) error {
+	if server.stopJobs != nil {
+		server.stopJobs()
+	}
+	server.scrubber.Stop()
+	if server.cache != nil {
+		stats := server.cache.Stats()
+		log.Info().
+			Int64("hits", stats.Hits).
+			Int64("misses", stats.Misses).
+			Int64("evictions", stats.Evictions).
+			Float64("hit_ratio", stats.HitRatio()).
+			Msg("Chunk cache")
+	}
 	if server.httpServer != nil {
-		return server.httpServer.Shutdown(ctx)
+		if err := server.httpServer.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+	// no request writes to the storage anymore
+	if err := storage.Flush(server.storage); err != nil {
+		return fmt.Errorf("failed to flush storage: %w", err)
 	}
 	return nil
 }
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+	"zerodupe/internal/server/config"
+	"zerodupe/internal/server/gc"
+	"zerodupe/internal/server/storage"
+	_ "zerodupe/internal/server/storage/filesystem" // registers the file:// chunk store
+	_ "zerodupe/internal/server/storage/redundant"  // registers the mirror:// and erasure:// chunk stores
+	_ "zerodupe/internal/server/storage/s3"         // registers the s3:// chunk store
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	gcStorageDir    string
+	gcChunkStore    string
+	gcMetadataStore string
+	gcGracePeriod   time.Duration
+	gcDryRun        bool
+)
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Delete stored blocks that no file references",
+	Long: `Run a mark-and-sweep garbage collection over the block store. Blocks that no file
+references are deleted once they are older than the grace period, which protects
+chunks of uploads in progress. With --dry-run nothing is deleted.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !cmd.Flags().Changed("storage") {
+			if storageDir := os.Getenv("STORAGE_DIR"); storageDir != "" {
+				gcStorageDir = storageDir
+			}
+		}
+
+		if !cmd.Flags().Changed("chunk-store") {
+			gcChunkStore = os.Getenv("CHUNK_STORE")
+		}
+		if !cmd.Flags().Changed("metadata-store") {
+			gcMetadataStore = os.Getenv("METADATA_STORE")
+		}
+		storeConfig := config.Config{StorageDir: gcStorageDir, ChunkStore: gcChunkStore, MetadataStore: gcMetadataStore}
+
+		chunkStoreURL, err := storeConfig.ChunkStoreURL()
+		if err != nil {
+			return err
+		}
+		fileStorage, err := storage.OpenFileSystem(chunkStoreURL)
+		if err != nil {
+			return fmt.Errorf("failed to open storage: %w", err)
+		}
+
+		dbStorage, err := storage.OpenDB(storeConfig.MetadataStoreURL())
+		if err != nil {
+			return fmt.Errorf("failed to open database: %w", err)
+		}
+
+		if err := storage.Migrate(fileStorage, dbStorage); err != nil {
+			return fmt.Errorf("failed to migrate storage: %w", err)
+		}
+
+		report, err := gc.NewCollector(fileStorage, dbStorage, gcGracePeriod).Collect(gcDryRun)
+		if err != nil {
+			return err
+		}
+
+		action := "Deleted"
+		if report.DryRun {
+			action = "Would delete"
+		}
+		for _, fileHash := range report.Expired {
+			fmt.Printf("%s incomplete file %s\n", action, fileHash)
+		}
+		for _, chunkHash := range report.Deleted {
+			fmt.Printf("%s %s\n", action, chunkHash)
+		}
+		fmt.Printf("Scanned %d blocks: %d referenced, %d within the grace period, %d failed\n",
+			report.Scanned, report.Referenced, report.Young, report.Failed)
+		fmt.Printf("%s %d blocks (%d bytes) in %s\n",
+			action, len(report.Deleted), report.DeletedBytes, report.Duration)
+		if report.Compacted > 0 {
+			fmt.Printf("Compacted packs, reclaimed %d bytes\n", report.Compacted)
+		}
+		return storage.Flush(fileStorage)
+	},
+}
+
+func init() {
+	gcCmd.Flags().StringVarP(&gcStorageDir, "storage", "s", "data/storage", "Storage directory")
+	gcCmd.Flags().StringVar(&gcChunkStore, "chunk-store", "", "Chunk store URL (default the blocks of --storage)")
+	gcCmd.Flags().StringVar(&gcMetadataStore, "metadata-store", "", "Metadata store URL (default the database of --storage)")
+	gcCmd.Flags().DurationVar(&gcGracePeriod, "grace-period", gc.DefaultGracePeriod, "Age before an unreferenced block is deleted")
+	gcCmd.Flags().BoolVar(&gcDryRun, "dry-run", false, "Report the blocks that would be deleted without deleting them")
+	rootCmd.AddCommand(gcCmd)
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"zerodupe/internal/server/storage/filesystem"
+
+	"github.com/spf13/cobra"
+)
+
+var layoutStorageDir string
+
+var layoutCmd = &cobra.Command{
+	Use:   "layout <" + filesystem.LayoutLoose + "|" + filesystem.LayoutPack + ">",
+	Short: "Migrate stored blocks to the loose or pack layout",
+	Long: `Move every stored block to the given layout: one file per block (loose) or
+append-only pack files with an index (pack). Start the server with the matching
+--layout afterwards so new blocks are written the same way. The server must not
+be running during the migration.`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{filesystem.LayoutLoose, filesystem.LayoutPack},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !cmd.Flags().Changed("storage") {
+			if storageDir := os.Getenv("STORAGE_DIR"); storageDir != "" {
+				layoutStorageDir = storageDir
+			}
+		}
+
+		fileStorage, err := filesystem.NewFilesystemStorage(layoutStorageDir)
+		if err != nil {
+			return fmt.Errorf("failed to open storage: %w", err)
+		}
+
+		var moved int
+		switch args[0] {
+		case filesystem.LayoutPack:
+			moved, err = fileStorage.PackBlocks()
+		case filesystem.LayoutLoose:
+			moved, err = fileStorage.UnpackBlocks()
+		default:
+			return fmt.Errorf("unknown layout %q", args[0])
+		}
+		if err != nil {
+			return fmt.Errorf("migrated %d blocks before failing: %w", moved, err)
+		}
+
+		fmt.Printf("Moved %d blocks to the %s layout\n", moved, args[0])
+		return fileStorage.Flush()
+	},
+}
+
+func init() {
+	layoutCmd.Flags().StringVarP(&layoutStorageDir, "storage", "s", "data/storage", "Storage directory")
+	rootCmd.AddCommand(layoutCmd)
+}
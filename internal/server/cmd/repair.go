@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"zerodupe/internal/server/config"
+	"zerodupe/internal/server/storage"
+	"zerodupe/internal/server/storage/redundant"
+
+	"github.com/spf13/cobra"
+)
+
+var repairChunkStore string
+
+var repairCmd = &cobra.Command{
+	Use:   "repair",
+	Short: "Rebuild the lost shards of a redundant chunk store",
+	Long: `Check the shards of every chunk of a mirror:// or erasure:// chunk store and write the
+missing and corrupt ones again from the intact ones, for example after replacing a disk.
+Chunks with too few intact shards left are reported as unrecoverable.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !cmd.Flags().Changed("chunk-store") {
+			repairChunkStore = os.Getenv("CHUNK_STORE")
+		}
+		storeConfig := config.Config{ChunkStore: repairChunkStore}
+
+		chunkStoreURL, err := storeConfig.ChunkStoreURL()
+		if err != nil {
+			return err
+		}
+		fileStorage, err := storage.OpenFileSystem(chunkStoreURL)
+		if err != nil {
+			return fmt.Errorf("failed to open storage: %w", err)
+		}
+		redundantStorage, ok := fileStorage.(*redundant.RedundantStorage)
+		if !ok {
+			return fmt.Errorf("chunk store %s is not redundant, use a mirror:// or erasure:// URL", chunkStoreURL)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		report, err := redundantStorage.Repair(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, chunkHash := range report.Unrecoverable {
+			fmt.Printf("Unrecoverable chunk %s\n", chunkHash)
+		}
+		fmt.Printf("Scanned %d chunks: %d healthy, %d repaired (%d shards written), %d unrecoverable, %d failed in %s\n",
+			report.Scanned, report.Healthy, report.Repaired, report.ShardsWritten, len(report.Unrecoverable), report.Failed, report.Duration)
+		if len(report.Unrecoverable) > 0 || report.Failed > 0 {
+			return fmt.Errorf("%d chunks could not be repaired", len(report.Unrecoverable)+report.Failed)
+		}
+		return nil
+	},
+}
+
+func init() {
+	repairCmd.Flags().StringVar(&repairChunkStore, "chunk-store", "", "Chunk store URL, mirror://?dir=...&dir=... or erasure://?data=k&parity=m&dir=...")
+	rootCmd.AddCommand(repairCmd)
+}
@@ -5,12 +5,16 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 	"zerodupe/internal/server/api"
 	"zerodupe/internal/server/config"
+	"zerodupe/internal/server/gc"
+	"zerodupe/internal/server/scrub"
+	"zerodupe/internal/server/storage/filesystem"
+	"zerodupe/internal/server/storage/memory"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -78,9 +82,131 @@ var rootCmd = &cobra.Command{
 			}
 		}
 
-		if err := os.MkdirAll(serverConfig.StorageDir, 0755); err != nil {
-			log.Error().Err(err).Msg("Failed to create storage directory")
-			return err
+		// Chunk cache size (megabytes)
+		if serverConfig.CacheSizeMB == 0 {
+			if sizeStr := os.Getenv("CACHE_SIZE_MB"); sizeStr != "" {
+				if size, err := strconv.Atoi(sizeStr); err == nil {
+					serverConfig.CacheSizeMB = size
+				}
+			}
+		}
+
+		// Block compression
+		if serverConfig.Compression == "" {
+			serverConfig.Compression = os.Getenv("COMPRESSION")
+			if serverConfig.Compression == "" {
+				serverConfig.Compression = filesystem.CompressionNone
+			}
+		}
+
+		// Quarantine of rejected chunks
+		if !serverConfig.Quarantine {
+			if quarantine, err := strconv.ParseBool(os.Getenv("QUARANTINE")); err == nil {
+				serverConfig.Quarantine = quarantine
+			}
+		}
+
+		// Block layout
+		if serverConfig.Layout == "" {
+			serverConfig.Layout = os.Getenv("LAYOUT")
+			if serverConfig.Layout == "" {
+				serverConfig.Layout = filesystem.LayoutLoose
+			}
+		}
+
+		// Garbage collection
+		if serverConfig.GCInterval == 0 {
+			if interval, err := time.ParseDuration(os.Getenv("GC_INTERVAL")); err == nil {
+				serverConfig.GCInterval = interval
+			}
+		}
+		if serverConfig.GCGracePeriod == 0 {
+			if gracePeriod, err := time.ParseDuration(os.Getenv("GC_GRACE_PERIOD")); err == nil {
+				serverConfig.GCGracePeriod = gracePeriod
+			}
+			if serverConfig.GCGracePeriod == 0 {
+				serverConfig.GCGracePeriod = gc.DefaultGracePeriod
+			}
+		}
+
+		// Scrubbing
+		if serverConfig.ScrubInterval == 0 {
+			if interval, err := time.ParseDuration(os.Getenv("SCRUB_INTERVAL")); err == nil {
+				serverConfig.ScrubInterval = interval
+			}
+		}
+		if serverConfig.ScrubRateMB == 0 {
+			if rateStr := os.Getenv("SCRUB_RATE_MB"); rateStr != "" {
+				if rate, err := strconv.Atoi(rateStr); err == nil {
+					serverConfig.ScrubRateMB = rate
+				}
+			}
+			if serverConfig.ScrubRateMB == 0 {
+				serverConfig.ScrubRateMB = scrub.DefaultRate >> 20
+			}
+		}
+
+		// Administrators and quotas
+		if len(serverConfig.Admins) == 0 {
+			for _, admin := range strings.Split(os.Getenv("ADMINS"), ",") {
+				if admin = strings.TrimSpace(admin); admin != "" {
+					serverConfig.Admins = append(serverConfig.Admins, admin)
+				}
+			}
+		}
+		if serverConfig.QuotaLogicalMB == 0 {
+			if quotaStr := os.Getenv("QUOTA_LOGICAL_MB"); quotaStr != "" {
+				if quota, err := strconv.Atoi(quotaStr); err == nil {
+					serverConfig.QuotaLogicalMB = quota
+				}
+			}
+		}
+		if serverConfig.QuotaUniqueMB == 0 {
+			if quotaStr := os.Getenv("QUOTA_UNIQUE_MB"); quotaStr != "" {
+				if quota, err := strconv.Atoi(quotaStr); err == nil {
+					serverConfig.QuotaUniqueMB = quota
+				}
+			}
+		}
+
+		// Chunk storage backend
+		if serverConfig.Backend == "" {
+			serverConfig.Backend = os.Getenv("BACKEND")
+			if serverConfig.Backend == "" {
+				serverConfig.Backend = config.BackendFilesystem
+			}
+		}
+
+		// S3 backend
+		if serverConfig.S3Endpoint == "" {
+			serverConfig.S3Endpoint = os.Getenv("S3_ENDPOINT")
+		}
+		if serverConfig.S3Region == "" {
+			serverConfig.S3Region = os.Getenv("S3_REGION")
+			if serverConfig.S3Region == "" {
+				serverConfig.S3Region = "us-east-1"
+			}
+		}
+		if serverConfig.S3Bucket == "" {
+			serverConfig.S3Bucket = os.Getenv("S3_BUCKET")
+		}
+		if serverConfig.S3Prefix == "" {
+			serverConfig.S3Prefix = os.Getenv("S3_PREFIX")
+		}
+		if serverConfig.S3AccessKeyID == "" {
+			serverConfig.S3AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		}
+		if serverConfig.S3SecretAccessKey == "" {
+			serverConfig.S3SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		}
+		if serverConfig.S3SessionToken == "" {
+			serverConfig.S3SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+		}
+		if serverConfig.ChunkStore == "" {
+			serverConfig.ChunkStore = os.Getenv("CHUNK_STORE")
+		}
+		if serverConfig.MetadataStore == "" {
+			serverConfig.MetadataStore = os.Getenv("METADATA_STORE")
 		}
 
 		server, err := api.NewServer(serverConfig)
@@ -100,7 +226,6 @@ func gracefulShutdown(server *api.Server) error {
 
 	go func() {
 		log.Info().Int("port", serverConfig.Port).Msg("Starting ZeroDupe server")
-		log.Info().Str("path", filepath.Clean(serverConfig.StorageDir)).Msg("Storage directory")
 
 		if err := server.Run(); err != nil && err != http.ErrServerClosed {
 			log.Error().Err(err).Msg("Failed to start server")
@@ -125,10 +250,30 @@ func gracefulShutdown(server *api.Server) error {
 
 func init() {
 	rootCmd.Flags().IntVarP(&serverConfig.Port, "port", "p", 8080, "Server port")
-	rootCmd.Flags().StringVarP(&serverConfig.StorageDir, "storage", "s", "data/storage", "Storage directory")
+	rootCmd.Flags().StringVarP(&serverConfig.StorageDir, "storage", "s", "data/storage", "Storage directory, or "+memory.StorageURL+" for an ephemeral in-memory storage")
 	rootCmd.Flags().StringVarP(&serverConfig.JWTSecret, "secret", "", "", "JWT Secret")
 	rootCmd.Flags().IntVar(&serverConfig.AccessTokenExpiryMin, "access-token-expiry-min", 30, "Access token expiry in minutes")
 	rootCmd.Flags().IntVar(&serverConfig.RefreshTokenExpiryHour, "refresh-token-expiry-hour", 24, "Refresh token expiry in hours")
+	rootCmd.Flags().BoolVar(&serverConfig.Quarantine, "quarantine", false, "Keep chunks rejected for a hash mismatch in the quarantine directory")
+	rootCmd.Flags().StringVar(&serverConfig.Compression, "compression", "", "Block compression codecs tried in order, e.g. "+filesystem.DefaultCompression+" (default none)")
+	rootCmd.Flags().StringVar(&serverConfig.Layout, "layout", "", "Layout new blocks are written in, "+filesystem.LayoutLoose+" or "+filesystem.LayoutPack+" (default "+filesystem.LayoutLoose+")")
+	rootCmd.Flags().IntVar(&serverConfig.CacheSizeMB, "cache-size-mb", 0, "Size of the in-memory cache of recently read chunks in megabytes (default disabled)")
+	rootCmd.Flags().DurationVar(&serverConfig.GCInterval, "gc-interval", 0, "Time between garbage collections of unreferenced blocks, e.g. 6h (default disabled)")
+	rootCmd.Flags().DurationVar(&serverConfig.GCGracePeriod, "gc-grace-period", 0, "Age before an unreferenced block is garbage collected (default 24h)")
+	rootCmd.Flags().DurationVar(&serverConfig.ScrubInterval, "scrub-interval", 0, "Time between scrubs verifying every stored block, e.g. 168h (default disabled)")
+	rootCmd.Flags().IntVar(&serverConfig.ScrubRateMB, "scrub-rate-mb", 0, "Megabytes verified per second by a scrub (default 16)")
+	rootCmd.Flags().StringSliceVar(&serverConfig.Admins, "admins", nil, "Usernames allowed to read the usage of and set quotas for any user, e.g. alice,bob")
+	rootCmd.Flags().IntVar(&serverConfig.QuotaLogicalMB, "quota-logical-mb", 0, "Default limit of the total size of the files a user owns in megabytes (default unlimited)")
+	rootCmd.Flags().IntVar(&serverConfig.QuotaUniqueMB, "quota-unique-mb", 0, "Default limit of the size of the chunks only a user references in megabytes (default unlimited)")
+	rootCmd.Flags().StringVar(&serverConfig.Backend, "backend", "", "Chunk storage backend, "+config.BackendFilesystem+" or "+config.BackendS3+" (default "+config.BackendFilesystem+")")
+	rootCmd.Flags().StringVar(&serverConfig.S3Endpoint, "s3-endpoint", "", "Base URL of the S3 API, e.g. https://s3.eu-west-1.amazonaws.com")
+	rootCmd.Flags().StringVar(&serverConfig.S3Region, "s3-region", "", "S3 region (default us-east-1)")
+	rootCmd.Flags().StringVar(&serverConfig.S3Bucket, "s3-bucket", "", "S3 bucket chunks are stored in")
+	rootCmd.Flags().StringVar(&serverConfig.S3Prefix, "s3-prefix", "", "Prefix of the S3 object keys, e.g. zerodupe/")
+	rootCmd.Flags().StringVar(&serverConfig.S3AccessKeyID, "s3-access-key-id", "", "S3 access key id (default $AWS_ACCESS_KEY_ID)")
+	rootCmd.Flags().StringVar(&serverConfig.S3SecretAccessKey, "s3-secret-access-key", "", "S3 secret access key (default $AWS_SECRET_ACCESS_KEY)")
+	rootCmd.Flags().StringVar(&serverConfig.ChunkStore, "chunk-store", "", "Chunk store URL, e.g. file:///data/blocks or s3://bucket/prefix?endpoint=... (default derived from --storage and --backend)")
+	rootCmd.Flags().StringVar(&serverConfig.MetadataStore, "metadata-store", "", "Metadata store URL, e.g. sqlite:///data/meta.db (default sqlite in the storage directory)")
 }
 
 func Execute() error {
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"zerodupe/internal/server/config"
+	"zerodupe/internal/server/scrub"
+	"zerodupe/internal/server/storage"
+	_ "zerodupe/internal/server/storage/filesystem" // registers the file:// chunk store
+	_ "zerodupe/internal/server/storage/redundant"  // registers the mirror:// and erasure:// chunk stores
+	_ "zerodupe/internal/server/storage/s3"         // registers the s3:// chunk store
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	scrubStorageDir    string
+	scrubChunkStore    string
+	scrubMetadataStore string
+	scrubRateMB        int
+)
+
+var scrubCmd = &cobra.Command{
+	Use:   "scrub",
+	Short: "Verify every stored block against its hash",
+	Long: `Re-hash every block of the block store. Blocks that no longer match their hash are
+moved to the quarantine directory and the files referencing them are marked damaged.
+Reads are limited to --rate-mb megabytes per second, 0 removes the limit.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !cmd.Flags().Changed("storage") {
+			if storageDir := os.Getenv("STORAGE_DIR"); storageDir != "" {
+				scrubStorageDir = storageDir
+			}
+		}
+		if !cmd.Flags().Changed("chunk-store") {
+			scrubChunkStore = os.Getenv("CHUNK_STORE")
+		}
+		if !cmd.Flags().Changed("metadata-store") {
+			scrubMetadataStore = os.Getenv("METADATA_STORE")
+		}
+		storeConfig := config.Config{StorageDir: scrubStorageDir, ChunkStore: scrubChunkStore, MetadataStore: scrubMetadataStore}
+
+		chunkStoreURL, err := storeConfig.ChunkStoreURL()
+		if err != nil {
+			return err
+		}
+		fileStorage, err := storage.OpenFileSystem(chunkStoreURL)
+		if err != nil {
+			return fmt.Errorf("failed to open storage: %w", err)
+		}
+
+		dbStorage, err := storage.OpenDB(storeConfig.MetadataStoreURL())
+		if err != nil {
+			return fmt.Errorf("failed to open database: %w", err)
+		}
+
+		if err := storage.Migrate(fileStorage, dbStorage); err != nil {
+			return fmt.Errorf("failed to migrate storage: %w", err)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		report, err := scrub.NewScrubber(fileStorage, dbStorage, int64(scrubRateMB)<<20).Scrub(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, corrupt := range report.Corrupt {
+			action := "Quarantined"
+			if !corrupt.Quarantined {
+				action = "Kept"
+			}
+			fmt.Printf("%s corrupt block %s\n", action, corrupt.ChunkHash)
+		}
+		for _, fileHash := range report.DamagedFiles {
+			fmt.Printf("Damaged file %s\n", fileHash)
+		}
+		fmt.Printf("Scanned %d blocks (%d bytes): %d verified, %d corrupt, %d failed in %s\n",
+			report.Scanned, report.Bytes, report.Verified, len(report.Corrupt), report.Failed, report.Duration)
+		return storage.Flush(fileStorage)
+	},
+}
+
+func init() {
+	scrubCmd.Flags().StringVarP(&scrubStorageDir, "storage", "s", "data/storage", "Storage directory")
+	scrubCmd.Flags().StringVar(&scrubChunkStore, "chunk-store", "", "Chunk store URL (default the blocks of --storage)")
+	scrubCmd.Flags().StringVar(&scrubMetadataStore, "metadata-store", "", "Metadata store URL (default the database of --storage)")
+	scrubCmd.Flags().IntVar(&scrubRateMB, "rate-mb", 0, "Megabytes verified per second (default unlimited)")
+	rootCmd.AddCommand(scrubCmd)
+}
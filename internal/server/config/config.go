@@ -1,12 +1,47 @@
 package config
 
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	"zerodupe/internal/server/storage/memory"
+)
+
+// Chunk storage backends
+const (
+	BackendFilesystem = "filesystem"
+	BackendS3         = "s3"
+)
+
 // Config holds server configuration
 type Config struct {
-	Port                   int    `json:"port"`
-	StorageDir             string `json:"storage_dir"`
-	JWTSecret              string `json:"jwt_secret"`
-	AccessTokenExpiryMin   int    `json:"access_token_expiry"`  // in minutes
-	RefreshTokenExpiryHour int    `json:"refresh_token_expiry"` // in hours
+	Port                   int           `json:"port"`
+	StorageDir             string        `json:"storage_dir"`
+	JWTSecret              string        `json:"jwt_secret"`
+	AccessTokenExpiryMin   int           `json:"access_token_expiry"`  // in minutes
+	RefreshTokenExpiryHour int           `json:"refresh_token_expiry"` // in hours
+	Compression            string        `json:"compression"`          // block codecs in order of preference, e.g. "zstd,gzip"
+	Quarantine             bool          `json:"quarantine"`           // keep chunks rejected for a hash mismatch
+	Layout                 string        `json:"layout"`               // layout new blocks are written in, "loose" or "pack"
+	GCInterval             time.Duration `json:"gc_interval"`          // time between garbage collections, 0 disables them
+	GCGracePeriod          time.Duration `json:"gc_grace_period"`      // age before an unreferenced block is collected
+	Backend                string        `json:"backend"`              // chunk storage backend, "filesystem" or "s3"
+	S3Endpoint             string        `json:"s3_endpoint"`          // base URL of the S3 API
+	S3Region               string        `json:"s3_region"`
+	S3Bucket               string        `json:"s3_bucket"`
+	S3Prefix               string        `json:"s3_prefix"` // prefix of all object keys
+	S3AccessKeyID          string        `json:"s3_access_key_id"`
+	S3SecretAccessKey      string        `json:"s3_secret_access_key"`
+	S3SessionToken         string        `json:"s3_session_token"` // for temporary credentials
+	ChunkStore             string        `json:"chunk_store"`      // chunk store URL, e.g. file:///data/blocks, overrides the storage dir and backend
+	MetadataStore          string        `json:"metadata_store"`   // metadata store URL, e.g. sqlite:///data/meta.db
+	CacheSizeMB            int           `json:"cache_size_mb"`    // size of the chunk cache in megabytes, 0 disables it
+	ScrubInterval          time.Duration `json:"scrub_interval"`   // time between scrubs of the block store, 0 disables them
+	ScrubRateMB            int           `json:"scrub_rate_mb"`    // megabytes verified per second by a scrub
+	Admins                 []string      `json:"admins"`           // usernames allowed to read the usage of and set quotas for any user
+	QuotaLogicalMB         int           `json:"quota_logical_mb"` // default limit of the file sizes a user owns in megabytes, 0 is unlimited
+	QuotaUniqueMB          int           `json:"quota_unique_mb"`  // default limit of the chunks only a user references in megabytes, 0 is unlimited
 }
 
 func NewConfig(port int, storageDir string, jwtSecret string, accessTokenExpiryMin int, refreshTokenExpiryHour int) Config {
@@ -18,3 +53,50 @@ func NewConfig(port int, storageDir string, jwtSecret string, accessTokenExpiryM
 		RefreshTokenExpiryHour: refreshTokenExpiryHour,
 	}
 }
+
+// ChunkStoreURL returns the URL of the chunk store. Unless set explicitly it is derived from the
+// storage directory, or from the S3 settings for the s3 backend.
+func (c Config) ChunkStoreURL() (string, error) {
+	if c.ChunkStore != "" {
+		return c.ChunkStore, nil
+	}
+
+	switch c.Backend {
+	case "", BackendFilesystem:
+		if c.StorageDir == memory.StorageURL {
+			return memory.StorageURL, nil
+		}
+		return "file://" + c.StorageDir, nil
+	case BackendS3:
+		u := url.URL{Scheme: "s3", Host: c.S3Bucket, Path: "/" + strings.TrimPrefix(c.S3Prefix, "/")}
+		if c.S3AccessKeyID != "" {
+			u.User = url.UserPassword(c.S3AccessKeyID, c.S3SecretAccessKey)
+		}
+		query := url.Values{}
+		if c.S3Endpoint != "" {
+			query.Set("endpoint", c.S3Endpoint)
+		}
+		if c.S3Region != "" {
+			query.Set("region", c.S3Region)
+		}
+		if c.S3SessionToken != "" {
+			query.Set("session_token", c.S3SessionToken)
+		}
+		u.RawQuery = query.Encode()
+		return u.String(), nil
+	default:
+		return "", fmt.Errorf("unknown storage backend %q", c.Backend)
+	}
+}
+
+// MetadataStoreURL returns the URL of the metadata store. Unless set explicitly it is the
+// users.db SQLite database in the storage directory.
+func (c Config) MetadataStoreURL() string {
+	if c.MetadataStore != "" {
+		return c.MetadataStore
+	}
+	if c.StorageDir == memory.StorageURL {
+		return memory.StorageURL
+	}
+	return "sqlite://" + c.StorageDir + "/users.db"
+}
@@ -160,7 +160,7 @@ const docTemplate = `{
                         }
                     },
                     "409": {
-                        "description": "User already exists",
+                        "description": "User already exists or the username is reserved for an administrator",
                         "schema": {
                             "type": "object",
                             "additionalProperties": true
@@ -299,6 +299,13 @@ const docTemplate = `{
                             "type": "file"
                         }
                     },
+                    "404": {
+                        "description": "Chunk not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
@@ -311,7 +318,7 @@ const docTemplate = `{
         },
         "/download/{hash}": {
             "get": {
-                "description": "Get file metadata including ordered chunk hashes for download",
+                "description": "Get file metadata including ordered chunk hashes and their Merkle inclusion proofs for download",
                 "consumes": [
                     "application/json"
                 ],
@@ -355,9 +362,52 @@ const docTemplate = `{
                 }
             }
         },
-        "/upload": {
+        "/files/{hash}": {
+            "delete": {
+                "description": "Remove a file from the files of the caller. The file and its chunk metadata are deleted with its last owner, and chunks no other file references are reclaimed by garbage collection. Administrators delete files they do not own outright.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "Delete a file",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "File hash",
+                        "name": "hash",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "File deleted",
+                        "schema": {
+                            "$ref": "#/definitions/api.DeleteFileResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "File not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/files/{hash}/grants": {
             "post": {
-                "description": "Upload a file chunk for deduplication storage",
+                "description": "Give another user read access to a file the caller owns. The user may then check, download and read the chunks of the file, but it does not count towards their usage.",
                 "consumes": [
                     "application/json"
                 ],
@@ -365,25 +415,32 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "files"
+                    "shares"
                 ],
-                "summary": "Upload file chunk",
+                "summary": "Grant access to a file",
                 "parameters": [
                     {
-                        "description": "File chunk data",
+                        "type": "string",
+                        "description": "File hash",
+                        "name": "hash",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "User to grant access to",
                         "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/api.UploadRequest"
+                            "$ref": "#/definitions/api.GrantRequest"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "File uploaded successfully",
+                        "description": "Access granted",
                         "schema": {
-                            "$ref": "#/definitions/api.UploadResponse"
+                            "$ref": "#/definitions/api.GrantResponse"
                         }
                     },
                     "400": {
@@ -394,14 +451,220 @@ const docTemplate = `{
                         }
                     },
                     "404": {
-                        "description": "Chunk does not exist",
+                        "description": "File or user not found",
                         "schema": {
                             "type": "object",
                             "additionalProperties": true
                         }
                     },
                     "500": {
-                        "description": "Failed to save chunk data",
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/files/{hash}/grants/{username}": {
+            "delete": {
+                "description": "Take back the read access granted to a user on a file the caller owns",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "shares"
+                ],
+                "summary": "Revoke access to a file",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "File hash",
+                        "name": "hash",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Username",
+                        "name": "username",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Access revoked",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "File, user or grant not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/files/{hash}/links": {
+            "post": {
+                "description": "Create a link that serves a file the caller owns to anyone who has it, without authentication, until it expires. A password can be required on top of the link.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "shares"
+                ],
+                "summary": "Create a share link",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "File hash",
+                        "name": "hash",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Expiry and password of the link",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/api.ShareLinkRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Share link created",
+                        "schema": {
+                            "$ref": "#/definitions/api.ShareLinkResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request format or expiry",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "File not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/files/{hash}/links/{token}": {
+            "delete": {
+                "description": "Revoke a share link to a file the caller owns",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "shares"
+                ],
+                "summary": "Delete a share link",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "File hash",
+                        "name": "hash",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Share link token",
+                        "name": "token",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Share link deleted",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "File or share link not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/files/{hash}/shares": {
+            "get": {
+                "description": "List the users granted access to a file the caller owns and the share links to it",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "shares"
+                ],
+                "summary": "List the shares of a file",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "File hash",
+                        "name": "hash",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Grants and share links",
+                        "schema": {
+                            "$ref": "#/definitions/api.SharesResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "File not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
                         "schema": {
                             "type": "object",
                             "additionalProperties": true
@@ -409,90 +672,1198 @@ const docTemplate = `{
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "api.CheckChunksRequest": {
+        },
+        "/fs/files": {
+            "put": {
+                "description": "Save a file the caller owns at a path of their namespace, replacing the file saved there before. The parent directory must exist.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "namespace"
+                ],
+                "summary": "Save a file at a path",
+                "parameters": [
+                    {
+                        "description": "Path and file hash",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.SaveFileRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "File saved at the path",
+                        "schema": {
+                            "$ref": "#/definitions/api.PathEntryResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request format or path",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "File or parent directory not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "409": {
+                        "description": "Path is a directory",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/fs/ls": {
+            "get": {
+                "description": "List the directories and files of a directory in the namespace of the caller, directories first. Listing a file returns the file alone.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "namespace"
+                ],
+                "summary": "List a directory",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Directory to list, the root by default",
+                        "name": "path",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Directory entries",
+                        "schema": {
+                            "$ref": "#/definitions/api.ListDirectoryResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid path",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "Path not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/fs/mkdir": {
+            "post": {
+                "description": "Create a directory in the namespace of the caller. With parents set, missing parent directories are created too and a directory that exists is not an error.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "namespace"
+                ],
+                "summary": "Create a directory",
+                "parameters": [
+                    {
+                        "description": "Directory to create",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.MkdirRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Directory exists",
+                        "schema": {
+                            "$ref": "#/definitions/api.PathEntryResponse"
+                        }
+                    },
+                    "201": {
+                        "description": "Directory created",
+                        "schema": {
+                            "$ref": "#/definitions/api.PathEntryResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request format or path",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "Parent directory not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "409": {
+                        "description": "Path already exists",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/fs/mv": {
+            "post": {
+                "description": "Move or rename a file or directory in the namespace of the caller, with everything below a directory. Moving to a directory moves the entry into it.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "namespace"
+                ],
+                "summary": "Move a path",
+                "parameters": [
+                    {
+                        "description": "Paths to move from and to",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.MoveRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Moved entry",
+                        "schema": {
+                            "$ref": "#/definitions/api.PathEntryResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request format or path",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "Path or parent directory not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "409": {
+                        "description": "Path already exists",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/fs/rm": {
+            "delete": {
+                "description": "Remove a file or an empty directory from the namespace of the caller, or a directory with everything below it when recursive. The files stay among the files of the caller, deleting a file by its hash removes it from them.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "namespace"
+                ],
+                "summary": "Remove a path",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Path to remove",
+                        "name": "path",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Remove everything below a directory too",
+                        "name": "recursive",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Path removed",
+                        "schema": {
+                            "$ref": "#/definitions/api.RemovePathResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid path",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "Path not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "409": {
+                        "description": "Directory not empty",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/fs/stat": {
+            "get": {
+                "description": "Describe the directory or file at a path in the namespace of the caller",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "namespace"
+                ],
+                "summary": "Describe a path",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Path to describe",
+                        "name": "path",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Directory or file",
+                        "schema": {
+                            "$ref": "#/definitions/api.PathEntryResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid path",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "Path not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/scrub": {
+            "get": {
+                "description": "Get the progress of the running block store scrub, the report of the last one and all files marked damaged. Only for administrators.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "scrub"
+                ],
+                "summary": "Get scrub status",
+                "responses": {
+                    "200": {
+                        "description": "Scrub status",
+                        "schema": {
+                            "$ref": "#/definitions/api.ScrubStatusResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Administrator access required",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Start verifying every stored block against its hash in the background. Corrupt blocks are quarantined and the files referencing them marked damaged. Only for administrators.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "scrub"
+                ],
+                "summary": "Start a scrub",
+                "responses": {
+                    "202": {
+                        "description": "Scrub started",
+                        "schema": {
+                            "$ref": "#/definitions/api.ScrubStatusResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Administrator access required",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "409": {
+                        "description": "A scrub is already running",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/shared/{token}": {
+            "get": {
+                "description": "Download the content of a file through a share link, without authentication. Links protected by a password need it in the X-Share-Password header.",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "tags": [
+                    "shares"
+                ],
+                "summary": "Download a shared file",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Share link token",
+                        "name": "token",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Password of the share link",
+                        "name": "X-Share-Password",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "File content",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "401": {
+                        "description": "Wrong or missing password",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "Share link not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "410": {
+                        "description": "Share link expired",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/stats": {
+            "get": {
+                "description": "Get the number of files and distinct chunks, the chunk and logical bytes, the dedup ratio and the most shared chunks of the caller's files. Administrators also get them for all files, with the block and cache stats of the chunk store.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "Get deduplication statistics",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "default": 10,
+                        "description": "Number of most shared chunks to list, at most 100",
+                        "name": "top",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Deduplication statistics",
+                        "schema": {
+                            "$ref": "#/definitions/api.StatsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid number of chunks",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/upload": {
+            "post": {
+                "description": "Upload a file chunk for deduplication storage",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "Upload file chunk",
+                "parameters": [
+                    {
+                        "description": "File chunk data",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.UploadRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "File uploaded successfully",
+                        "schema": {
+                            "$ref": "#/definitions/api.UploadResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request format",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "Chunk does not exist",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "409": {
+                        "description": "Another chunk is stored at this position of the file, or the file is complete",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "422": {
+                        "description": "Chunk content does not match its hash",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to save chunk data",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "507": {
+                        "description": "Quota exceeded",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/usage": {
+            "get": {
+                "description": "Get the storage accounted to the caller and their quota. Logical bytes are the sizes of the files they own, unique bytes the sizes of the chunks no other user's files reference.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Get your usage",
+                "responses": {
+                    "200": {
+                        "description": "Usage and quota",
+                        "schema": {
+                            "$ref": "#/definitions/api.UsageResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{username}/quota": {
+            "put": {
+                "description": "Set the quota of a user in bytes. A limit of 0 falls back to the server default, a negative limit is unlimited. Only for administrators.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Set the quota of a user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Username",
+                        "name": "username",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Quota",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.Quota"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Usage and new quota",
+                        "schema": {
+                            "$ref": "#/definitions/api.UsageResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request format",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "403": {
+                        "description": "Administrator access required",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{username}/usage": {
+            "get": {
+                "description": "Get the storage accounted to a user and their quota. Only for administrators.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Get the usage of a user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Username",
+                        "name": "username",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Usage and quota",
+                        "schema": {
+                            "$ref": "#/definitions/api.UsageResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Administrator access required",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "api.CheckChunksRequest": {
+            "type": "object",
+            "required": [
+                "hashes"
+            ],
+            "properties": {
+                "hashes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "api.CheckChunksResponse": {
+            "type": "object",
+            "properties": {
+                "missing": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "api.CheckFileResponse": {
+            "type": "object",
+            "properties": {
+                "exists": {
+                    "type": "boolean"
+                },
+                "hash": {
+                    "type": "string"
+                },
+                "owned": {
+                    "description": "the caller owns the file, others upload it again to own it without sending chunk content",
+                    "type": "boolean"
+                }
+            }
+        },
+        "api.ChunkInfo": {
+            "type": "object",
+            "properties": {
+                "chunk_hash": {
+                    "type": "string"
+                },
+                "offset": {
+                    "type": "integer"
+                },
+                "size": {
+                    "type": "integer"
+                }
+            }
+        },
+        "api.DeleteFileResponse": {
+            "type": "object",
+            "properties": {
+                "file_hash": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.DownloadFileResponse": {
+            "type": "object",
+            "required": [
+                "file_hash"
+            ],
+            "properties": {
+                "chunk_hashes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "chunker": {
+                    "type": "string"
+                },
+                "chunks": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.ChunkInfo"
+                    }
+                },
+                "chunks_count": {
+                    "type": "integer"
+                },
+                "content_type": {
+                    "type": "string",
+                    "example": "application/pdf"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "damaged": {
+                    "description": "Damaged is set when a chunk of the file was found corrupt by a scrub and quarantined",
+                    "type": "boolean"
+                },
+                "file_hash": {
+                    "type": "string"
+                },
+                "name": {
+                    "description": "Name, ContentType, CreatedAt and Uploader are empty for files stored before they were recorded.\nName and Uploader are those of the first upload, only shown to its uploader and to administrators.",
+                    "type": "string",
+                    "example": "report.pdf"
+                },
+                "proofs": {
+                    "description": "Proofs holds the Merkle inclusion proof of each chunk, in chunk order.\nIt is omitted for files uploaded before file hashes were Merkle roots.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/hasher.MerkleProof"
+                    }
+                },
+                "size": {
+                    "description": "Size is the size of the file in bytes",
+                    "type": "integer"
+                },
+                "uploader": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.GlobalStats": {
+            "type": "object",
+            "properties": {
+                "blocks": {
+                    "description": "with the filesystem chunk store only",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/filesystem.BlockStats"
+                        }
+                    ]
+                },
+                "cache": {
+                    "description": "with a chunk cache only",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/cache.Stats"
+                        }
+                    ]
+                },
+                "chunk_bytes": {
+                    "description": "size of the distinct chunks, each stored once",
+                    "type": "integer"
+                },
+                "chunks": {
+                    "description": "distinct chunks of the files",
+                    "type": "integer"
+                },
+                "dedup_ratio": {
+                    "description": "logical bytes per chunk byte",
+                    "type": "number"
+                },
+                "files": {
+                    "type": "integer"
+                },
+                "logical_bytes": {
+                    "description": "sum of the sizes of the files",
+                    "type": "integer"
+                },
+                "top_chunks": {
+                    "description": "the most referenced shared chunks",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.ChunkRef"
+                    }
+                },
+                "unique_bytes": {
+                    "description": "size of the chunks only the user references",
+                    "type": "integer"
+                }
+            }
+        },
+        "api.GrantRequest": {
+            "type": "object",
+            "required": [
+                "username"
+            ],
+            "properties": {
+                "username": {
+                    "type": "string",
+                    "example": "jane_doe"
+                }
+            }
+        },
+        "api.GrantResponse": {
+            "type": "object",
+            "properties": {
+                "granted_at": {
+                    "type": "string"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.ListDirectoryResponse": {
+            "type": "object",
+            "properties": {
+                "entries": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.PathEntryResponse"
+                    }
+                },
+                "path": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.LoginRequest": {
+            "type": "object",
+            "required": [
+                "password",
+                "username"
+            ],
+            "properties": {
+                "password": {
+                    "type": "string",
+                    "example": "password123"
+                },
+                "username": {
+                    "type": "string",
+                    "example": "john_doe"
+                }
+            }
+        },
+        "api.MkdirRequest": {
+            "type": "object",
+            "required": [
+                "path"
+            ],
+            "properties": {
+                "parents": {
+                    "description": "Parents creates the missing parents of the directory too, and accepts a directory that exists",
+                    "type": "boolean"
+                },
+                "path": {
+                    "type": "string",
+                    "example": "/docs/reports"
+                }
+            }
+        },
+        "api.MoveRequest": {
+            "type": "object",
+            "required": [
+                "from",
+                "to"
+            ],
+            "properties": {
+                "from": {
+                    "type": "string",
+                    "example": "/docs/report.pdf"
+                },
+                "to": {
+                    "description": "To is the new path, or a directory to move the entry into keeping its name",
+                    "type": "string",
+                    "example": "/archive"
+                }
+            }
+        },
+        "api.PathEntryResponse": {
+            "type": "object",
+            "properties": {
+                "content_type": {
+                    "type": "string",
+                    "example": "application/pdf"
+                },
+                "created_at": {
+                    "description": "nil for the root directory",
+                    "type": "string"
+                },
+                "file_hash": {
+                    "description": "FileHash, Size and ContentType describe the file saved at the path, for files",
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "report.pdf"
+                },
+                "path": {
+                    "type": "string",
+                    "example": "/docs/report.pdf"
+                },
+                "size": {
+                    "type": "integer"
+                },
+                "type": {
+                    "type": "string",
+                    "enum": [
+                        "dir",
+                        "file"
+                    ]
+                },
+                "updated_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.RefreshTokenRequest": {
             "type": "object",
             "required": [
-                "hashes"
+                "refresh_token"
             ],
             "properties": {
-                "hashes": {
-                    "type": "array",
-                    "items": {
-                        "type": "string"
-                    }
+                "refresh_token": {
+                    "type": "string"
                 }
             }
         },
-        "api.CheckChunksResponse": {
+        "api.RemovePathResponse": {
             "type": "object",
             "properties": {
-                "missing": {
-                    "type": "array",
-                    "items": {
-                        "type": "string"
-                    }
+                "message": {
+                    "type": "string"
+                },
+                "path": {
+                    "type": "string"
+                },
+                "removed": {
+                    "description": "entries removed, with those below a directory",
+                    "type": "integer"
                 }
             }
         },
-        "api.CheckFileResponse": {
+        "api.SaveFileRequest": {
             "type": "object",
+            "required": [
+                "file_hash",
+                "path"
+            ],
             "properties": {
-                "exists": {
-                    "type": "boolean"
-                },
-                "hash": {
+                "file_hash": {
                     "type": "string"
+                },
+                "path": {
+                    "type": "string",
+                    "example": "/docs/report.pdf"
                 }
             }
         },
-        "api.DownloadFileResponse": {
+        "api.ScrubStatusResponse": {
             "type": "object",
-            "required": [
-                "file_hash"
-            ],
             "properties": {
-                "chunk_hashes": {
+                "corrupt": {
+                    "description": "corrupt blocks found so far",
+                    "type": "integer"
+                },
+                "damaged_files": {
+                    "description": "all files marked damaged, by any scrub",
                     "type": "array",
                     "items": {
                         "type": "string"
                     }
                 },
-                "chunks_count": {
+                "last": {
+                    "$ref": "#/definitions/scrub.Report"
+                },
+                "running": {
+                    "type": "boolean"
+                },
+                "scanned": {
+                    "description": "blocks scanned so far",
                     "type": "integer"
                 },
-                "file_hash": {
+                "started_at": {
                     "type": "string"
+                },
+                "total": {
+                    "description": "blocks to scan in the running scrub",
+                    "type": "integer"
                 }
             }
         },
-        "api.LoginRequest": {
+        "api.ShareLinkRequest": {
             "type": "object",
-            "required": [
-                "password",
-                "username"
-            ],
             "properties": {
+                "expires_in": {
+                    "description": "ExpiresIn is how long the link is valid, 24h if empty and at most 720h",
+                    "type": "string",
+                    "example": "72h"
+                },
                 "password": {
+                    "description": "Password must be given to download the file through the link, if set",
                     "type": "string",
-                    "example": "password123"
+                    "example": "secret"
+                }
+            }
+        },
+        "api.ShareLinkResponse": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
                 },
-                "username": {
+                "expired": {
+                    "type": "boolean"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "path": {
+                    "description": "Path serves the file without authentication, relative to the server URL",
                     "type": "string",
-                    "example": "john_doe"
+                    "example": "/shared/3q2-7wE..."
+                },
+                "protected": {
+                    "description": "a password is needed to download the file",
+                    "type": "boolean"
+                },
+                "token": {
+                    "type": "string"
                 }
             }
         },
-        "api.RefreshTokenRequest": {
+        "api.SharesResponse": {
             "type": "object",
-            "required": [
-                "refresh_token"
-            ],
             "properties": {
-                "refresh_token": {
+                "file_hash": {
                     "type": "string"
+                },
+                "grants": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.GrantResponse"
+                    }
+                },
+                "links": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.ShareLinkResponse"
+                    }
                 }
             }
         },
@@ -518,6 +1889,20 @@ const docTemplate = `{
                 }
             }
         },
+        "api.StatsResponse": {
+            "type": "object",
+            "properties": {
+                "global": {
+                    "$ref": "#/definitions/api.GlobalStats"
+                },
+                "user": {
+                    "$ref": "#/definitions/model.Stats"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
         "api.UploadRequest": {
             "type": "object",
             "required": [
@@ -532,14 +1917,32 @@ const docTemplate = `{
                 "chunk_order": {
                     "type": "integer"
                 },
+                "chunker": {
+                    "type": "string",
+                    "example": "fastcdc:262144:1048576:4194304"
+                },
                 "content": {
                     "type": "array",
                     "items": {
                         "type": "integer"
                     }
                 },
+                "content_type": {
+                    "type": "string",
+                    "example": "application/pdf"
+                },
                 "file_hash": {
                     "type": "string"
+                },
+                "file_name": {
+                    "description": "FileName and ContentType describe the file; the first upload of a file records them",
+                    "type": "string",
+                    "example": "report.pdf"
+                },
+                "total_chunks": {
+                    "description": "TotalChunks is the number of chunks of the file, so the server verifies it once it has them all",
+                    "type": "integer",
+                    "example": 4
                 }
             }
         },
@@ -549,14 +1952,30 @@ const docTemplate = `{
                 "file_hash": {
                     "type": "string"
                 },
-                "hash_mismatch": {
-                    "type": "boolean"
-                },
                 "message": {
                     "type": "string"
                 }
             }
         },
+        "api.UsageResponse": {
+            "type": "object",
+            "properties": {
+                "quota": {
+                    "description": "the limits that apply in bytes: the user's own, the server default where those are 0, and 0 where there is no limit",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/model.Quota"
+                        }
+                    ]
+                },
+                "usage": {
+                    "$ref": "#/definitions/model.Usage"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
         "auth.TokenPair": {
             "type": "object",
             "properties": {
@@ -567,6 +1986,217 @@ const docTemplate = `{
                     "type": "string"
                 }
             }
+        },
+        "cache.Stats": {
+            "type": "object",
+            "properties": {
+                "bytes": {
+                    "description": "size of the cached chunks",
+                    "type": "integer"
+                },
+                "entries": {
+                    "type": "integer"
+                },
+                "evictions": {
+                    "type": "integer"
+                },
+                "hits": {
+                    "type": "integer"
+                },
+                "max_bytes": {
+                    "description": "capacity of the cache",
+                    "type": "integer"
+                },
+                "misses": {
+                    "type": "integer"
+                }
+            }
+        },
+        "filesystem.BlockStats": {
+            "type": "object",
+            "properties": {
+                "blocks": {
+                    "type": "integer"
+                },
+                "compressed_blocks": {
+                    "type": "integer"
+                },
+                "logical_bytes": {
+                    "description": "size of the chunks before compression",
+                    "type": "integer"
+                },
+                "stored_bytes": {
+                    "description": "size of the blocks on disk",
+                    "type": "integer"
+                }
+            }
+        },
+        "hasher.MerkleProof": {
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer"
+                },
+                "index": {
+                    "type": "integer"
+                },
+                "siblings": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "model.ChunkRef": {
+            "type": "object",
+            "properties": {
+                "chunk_hash": {
+                    "type": "string"
+                },
+                "ref_count": {
+                    "type": "integer"
+                },
+                "size": {
+                    "description": "content bytes of the chunk, 0 if not recorded yet",
+                    "type": "integer"
+                },
+                "users": {
+                    "description": "users owning a file that references the chunk",
+                    "type": "integer"
+                }
+            }
+        },
+        "model.Quota": {
+            "type": "object",
+            "properties": {
+                "logical_bytes": {
+                    "type": "integer"
+                },
+                "unique_bytes": {
+                    "type": "integer"
+                }
+            }
+        },
+        "model.Stats": {
+            "type": "object",
+            "properties": {
+                "chunk_bytes": {
+                    "description": "size of the distinct chunks, each stored once",
+                    "type": "integer"
+                },
+                "chunks": {
+                    "description": "distinct chunks of the files",
+                    "type": "integer"
+                },
+                "dedup_ratio": {
+                    "description": "logical bytes per chunk byte",
+                    "type": "number"
+                },
+                "files": {
+                    "type": "integer"
+                },
+                "logical_bytes": {
+                    "description": "sum of the sizes of the files",
+                    "type": "integer"
+                },
+                "top_chunks": {
+                    "description": "the most referenced shared chunks",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.ChunkRef"
+                    }
+                },
+                "unique_bytes": {
+                    "description": "size of the chunks only the user references",
+                    "type": "integer"
+                }
+            }
+        },
+        "model.Usage": {
+            "type": "object",
+            "properties": {
+                "chunk_bytes": {
+                    "description": "size of the distinct chunks of the user's files",
+                    "type": "integer"
+                },
+                "chunks": {
+                    "description": "distinct chunks of the user's files",
+                    "type": "integer"
+                },
+                "files": {
+                    "type": "integer"
+                },
+                "logical_bytes": {
+                    "description": "sum of the sizes of the user's files",
+                    "type": "integer"
+                },
+                "unique_bytes": {
+                    "description": "size of the chunks no other user's files reference",
+                    "type": "integer"
+                }
+            }
+        },
+        "scrub.CorruptChunk": {
+            "type": "object",
+            "properties": {
+                "actual_hash": {
+                    "description": "empty when the block could not be decoded",
+                    "type": "string"
+                },
+                "chunk_hash": {
+                    "type": "string"
+                },
+                "quarantined": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "scrub.Report": {
+            "type": "object",
+            "properties": {
+                "bytes": {
+                    "description": "bytes verified",
+                    "type": "integer"
+                },
+                "corrupt": {
+                    "description": "blocks that no longer match their hash",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/scrub.CorruptChunk"
+                    }
+                },
+                "damaged_files": {
+                    "description": "files marked damaged by this scrub",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "duration": {
+                    "description": "in nanoseconds",
+                    "type": "integer"
+                },
+                "failed": {
+                    "description": "blocks that could not be read",
+                    "type": "integer"
+                },
+                "scanned": {
+                    "description": "blocks in the block store",
+                    "type": "integer"
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "vanished": {
+                    "description": "blocks deleted while the scrub ran",
+                    "type": "integer"
+                },
+                "verified": {
+                    "description": "blocks that match their hash",
+                    "type": "integer"
+                }
+            }
         }
     }
 }`
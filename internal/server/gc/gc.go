@@ -0,0 +1,196 @@
+// Package gc removes blocks that no file references from the block store.
+package gc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"zerodupe/internal/server/storage"
+	"zerodupe/pkg/hasher"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultGracePeriod is how long an unreferenced block is kept. Uploads store a chunk before
+// the file that references it, so young unreferenced blocks may belong to an upload in progress.
+const DefaultGracePeriod = 24 * time.Hour
+
+// Report summarizes a garbage collection run
+type Report struct {
+	DryRun       bool          `json:"dry_run"`
+	Expired      []string      `json:"expired"`       // abandoned incomplete files deleted, or that would be deleted in a dry run
+	Scanned      int           `json:"scanned"`       // blocks in the block store
+	Referenced   int           `json:"referenced"`    // blocks referenced by a file
+	Young        int           `json:"young"`         // unreferenced blocks still within the grace period
+	Deleted      []string      `json:"deleted"`       // unreferenced blocks deleted, or that would be deleted in a dry run
+	DeletedBytes int64         `json:"deleted_bytes"` // bytes on disk used by the deleted blocks
+	Failed       int           `json:"failed"`        // blocks that could not be deleted
+	Compacted    int64         `json:"compacted"`     // bytes reclaimed by compacting the storage after deleting
+	Duration     time.Duration `json:"duration"`
+}
+
+// Collector runs mark-and-sweep garbage collection over the block store
+type Collector struct {
+	fileSystem  storage.FileSystem
+	db          storage.DB
+	gracePeriod time.Duration
+
+	// only one collection runs at a time
+	mu sync.Mutex
+	// uploads hold a read lock from storing a chunk until a file references it, and sweeping a
+	// block takes the write lock, so no block is deleted between an upload renewing it and
+	// referencing it
+	uploads sync.RWMutex
+}
+
+// errChunkRenewed is returned when sweeping a block that was renewed since it was found old
+var errChunkRenewed = errors.New("chunk was renewed during collection")
+
+// NewCollector creates a garbage collector that keeps unreferenced blocks for gracePeriod
+func NewCollector(fileSystem storage.FileSystem, db storage.DB, gracePeriod time.Duration) *Collector {
+	return &Collector{
+		fileSystem:  fileSystem,
+		db:          db,
+		gracePeriod: gracePeriod,
+	}
+}
+
+// Collect deletes the incomplete files nobody uploaded a chunk of within the grace period, marks
+// every block referenced by a file and sweeps the unreferenced blocks older than the grace period.
+// In a dry run nothing is deleted and the report lists what would be.
+func (c *Collector) Collect(dryRun bool) (*Report, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	start := time.Now()
+	report := &Report{DryRun: dryRun}
+	cutoff := start.Add(-c.gracePeriod)
+
+	// abandoned uploads would otherwise reference their chunks forever
+	expired, err := c.db.ExpireIncompleteFiles(cutoff, dryRun)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire incomplete files: %w", err)
+	}
+	report.Expired = expired
+
+	// mark
+	referencedHashes, err := c.db.ListReferencedChunks()
+	if err != nil {
+		return nil, err
+	}
+	referenced := make(map[string]bool, len(referencedHashes))
+	for _, chunkHash := range referencedHashes {
+		referenced[hasher.CanonicalHash(chunkHash)] = true
+	}
+
+	// sweep
+	chunkHashes, err := c.fileSystem.ListChunks()
+	if err != nil {
+		return nil, err
+	}
+	report.Scanned = len(chunkHashes)
+
+	for _, chunkHash := range chunkHashes {
+		if referenced[hasher.CanonicalHash(chunkHash)] {
+			report.Referenced++
+			continue
+		}
+
+		info, err := c.fileSystem.StatChunk(chunkHash)
+		if err != nil {
+			log.Warn().Err(err).Str("chunk", chunkHash).Msg("Failed to stat chunk")
+			report.Failed++
+			continue
+		}
+		if info.ModTime.After(cutoff) {
+			report.Young++
+			continue
+		}
+
+		if !dryRun {
+			if err := c.sweep(chunkHash, cutoff); errors.Is(err, errChunkRenewed) {
+				report.Young++
+				continue
+			} else if err != nil {
+				log.Warn().Err(err).Str("chunk", chunkHash).Msg("Failed to delete chunk")
+				report.Failed++
+				continue
+			}
+		}
+		report.Deleted = append(report.Deleted, chunkHash)
+		report.DeletedBytes += info.Size
+	}
+
+	// storages that only mark deleted blocks reclaim their space afterwards
+	if compactor, ok := c.fileSystem.(storage.Compactor); ok && !dryRun && len(report.Deleted) > 0 {
+		compacted, err := compactor.Compact()
+		if err != nil {
+			return nil, fmt.Errorf("failed to compact storage: %w", err)
+		}
+		report.Compacted = compacted
+	}
+
+	report.Duration = time.Since(start)
+	return report, nil
+}
+
+// HoldUpload keeps blocks from being swept while an upload stores a chunk and references it from
+// a file, and returns the func that ends the hold
+func (c *Collector) HoldUpload() func() {
+	c.uploads.RLock()
+	return c.uploads.RUnlock
+}
+
+// sweep deletes an unreferenced block after checking again, with no upload in progress, that it
+// was not renewed since the cutoff and that no file started referencing it since the mark phase
+func (c *Collector) sweep(chunkHash string, cutoff time.Time) error {
+	c.uploads.Lock()
+	defer c.uploads.Unlock()
+
+	info, err := c.fileSystem.StatChunk(chunkHash)
+	if err != nil {
+		return err
+	}
+	if info.ModTime.After(cutoff) {
+		return errChunkRenewed
+	}
+	referenced, err := c.db.CheckChunkReferenced(chunkHash)
+	if err != nil {
+		return err
+	}
+	if referenced {
+		return fmt.Errorf("chunk %s was referenced during collection", chunkHash)
+	}
+	return c.fileSystem.DeleteChunk(chunkHash)
+}
+
+// Run collects garbage every interval until ctx is canceled
+func (c *Collector) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := c.Collect(false)
+			if err != nil {
+				log.Error().Err(err).Msg("Garbage collection failed")
+				continue
+			}
+			log.Info().
+				Int("expired", len(report.Expired)).
+				Int("scanned", report.Scanned).
+				Int("deleted", len(report.Deleted)).
+				Int64("deleted_bytes", report.DeletedBytes).
+				Int("young", report.Young).
+				Int("failed", report.Failed).
+				Int64("compacted", report.Compacted).
+				Dur("duration", report.Duration).
+				Msg("Garbage collection finished")
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package gc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"zerodupe/internal/server/model"
+	"zerodupe/internal/server/storage"
+	"zerodupe/internal/server/storage/filesystem"
+	"zerodupe/pkg/hasher"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+)
+
+// setupCollector creates a collector over a temporary block store and an in-memory database
+func setupCollector(t *testing.T, gracePeriod time.Duration) (*Collector, *filesystem.FilesystemStorage, storage.DB, string) {
+	t.Helper()
+
+	tempDir := t.TempDir()
+	fileStorage, err := filesystem.NewFilesystemStorage(tempDir)
+	require.NoError(t, err)
+
+	db, err := storage.NewGormStorage(sqlite.Open(":memory:"))
+	require.NoError(t, err)
+
+	return NewCollector(fileStorage, db, gracePeriod), fileStorage, db, tempDir
+}
+
+// saveChunk stores content as a chunk and sets its modification time to age ago
+func saveChunk(t *testing.T, fileStorage *filesystem.FilesystemStorage, tempDir string, content []byte, age time.Duration) string {
+	t.Helper()
+
+	chunkHash := hasher.CalculateChunkHash(content)
+	_, err := fileStorage.SaveChunkData(chunkHash, content)
+	require.NoError(t, err)
+
+	modTime := time.Now().Add(-age)
+	blockPath := filepath.Join(tempDir, "blocks", chunkHash[:4], chunkHash)
+	require.NoError(t, os.Chtimes(blockPath, modTime, modTime))
+	return chunkHash
+}
+
+func TestCollect(t *testing.T) {
+	t.Run("Test Collect deletes old unreferenced chunks only", func(t *testing.T) {
+		collector, fileStorage, db, tempDir := setupCollector(t, time.Hour)
+
+		referenced := saveChunk(t, fileStorage, tempDir, []byte("referenced"), 2*time.Hour)
+		garbage := saveChunk(t, fileStorage, tempDir, []byte("garbage"), 2*time.Hour)
+		young := saveChunk(t, fileStorage, tempDir, []byte("young"), 0)
+
+		require.NoError(t, db.SaveFileMetadata(&model.FileMetadata{
+			FileHash: hasher.FileHashFromChunkHashes([]string{referenced}),
+			Chunker:  hasher.DefaultChunkerConfig().String(),
+			Chunks:   []model.ChunkMetadata{{ChunkOrder: 1, ChunkHash: referenced}},
+		}))
+
+		report, err := collector.Collect(false)
+		require.NoError(t, err)
+		assert.False(t, report.DryRun)
+		assert.Equal(t, 3, report.Scanned)
+		assert.Equal(t, 1, report.Referenced)
+		assert.Equal(t, 1, report.Young)
+		assert.Equal(t, []string{garbage}, report.Deleted)
+		assert.Equal(t, int64(len("garbage")), report.DeletedBytes)
+
+		exists, missing, err := fileStorage.CheckChunkExists([]string{referenced, garbage, young})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{referenced, young}, exists)
+		assert.Equal(t, []string{garbage}, missing)
+	})
+
+	t.Run("Test Collect dry run deletes nothing", func(t *testing.T) {
+		collector, fileStorage, _, tempDir := setupCollector(t, time.Hour)
+
+		garbage := saveChunk(t, fileStorage, tempDir, []byte("garbage"), 2*time.Hour)
+
+		report, err := collector.Collect(true)
+		require.NoError(t, err)
+		assert.True(t, report.DryRun)
+		assert.Equal(t, []string{garbage}, report.Deleted)
+
+		exists, _, err := fileStorage.CheckChunkExists([]string{garbage})
+		require.NoError(t, err)
+		assert.Equal(t, []string{garbage}, exists)
+	})
+
+	t.Run("Test Collect keeps reused chunks", func(t *testing.T) {
+		collector, fileStorage, _, tempDir := setupCollector(t, time.Hour)
+
+		content := []byte("reused")
+		chunkHash := saveChunk(t, fileStorage, tempDir, content, 2*time.Hour)
+
+		// an upload of the same chunk renews it
+		_, err := fileStorage.SaveChunkData(chunkHash, content)
+		require.NoError(t, err)
+
+		report, err := collector.Collect(false)
+		require.NoError(t, err)
+		assert.Empty(t, report.Deleted)
+		assert.Equal(t, 1, report.Young)
+	})
+
+	t.Run("Test Collect after deleting a file keeps the chunks of other files", func(t *testing.T) {
+		collector, fileStorage, db, tempDir := setupCollector(t, time.Hour)
+
+		kept := saveChunk(t, fileStorage, tempDir, []byte("kept"), 2*time.Hour)
+		released := saveChunk(t, fileStorage, tempDir, []byte("released"), 2*time.Hour)
+
+		deleted := hasher.FileHashFromChunkHashes([]string{released})
+		require.NoError(t, db.SaveFileMetadata(&model.FileMetadata{
+			FileHash: deleted,
+			Chunker:  hasher.DefaultChunkerConfig().String(),
+			Chunks:   []model.ChunkMetadata{{ChunkOrder: 1, ChunkHash: released}},
+		}))
+		require.NoError(t, db.SaveFileMetadata(&model.FileMetadata{
+			FileHash: hasher.FileHashFromChunkHashes([]string{kept}),
+			Chunker:  hasher.DefaultChunkerConfig().String(),
+			Chunks:   []model.ChunkMetadata{{ChunkOrder: 1, ChunkHash: kept}},
+		}))
+
+		require.NoError(t, db.DeleteFileMetadata(deleted))
+
+		report, err := collector.Collect(false)
+		require.NoError(t, err)
+		assert.Equal(t, []string{released}, report.Deleted)
+
+		content, err := fileStorage.GetChunkData(kept)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("kept"), content)
+	})
+	t.Run("Test Collect keeps chunks renewed while an upload holds it off", func(t *testing.T) {
+		collector, fileStorage, db, tempDir := setupCollector(t, time.Hour)
+
+		content := []byte("uploading")
+		chunkHash := saveChunk(t, fileStorage, tempDir, content, 2*time.Hour)
+
+		release := collector.HoldUpload()
+		reports := make(chan *Report, 1)
+		go func() {
+			report, err := collector.Collect(false)
+			assert.NoError(t, err)
+			reports <- report
+		}()
+
+		// the upload renews the chunk and references it before the sweep gets to it
+		time.Sleep(100 * time.Millisecond)
+		_, err := fileStorage.SaveChunkData(chunkHash, content)
+		require.NoError(t, err)
+		require.NoError(t, db.SaveChunkMetadata(hasher.FileHashFromChunkHashes([]string{chunkHash}), chunkHash, 1, int64(len(content)), ""))
+		release()
+
+		report := <-reports
+		assert.Empty(t, report.Deleted)
+		assert.Equal(t, 1, report.Young)
+		exists, _, err := fileStorage.CheckChunkExists([]string{chunkHash})
+		require.NoError(t, err)
+		assert.Equal(t, []string{chunkHash}, exists)
+	})
+
+	t.Run("Test Collect expires abandoned incomplete files", func(t *testing.T) {
+		collector, fileStorage, db, tempDir := setupCollector(t, 10*time.Millisecond)
+
+		abandoned := saveChunk(t, fileStorage, tempDir, []byte("abandoned"), 2*time.Hour)
+		fileHash := hasher.FileHashFromChunkHashes([]string{abandoned, hasher.CalculateChunkHash([]byte("never uploaded"))})
+		require.NoError(t, db.SaveChunkMetadata(fileHash, abandoned, 1, int64(len("abandoned")), ""))
+		time.Sleep(20 * time.Millisecond)
+
+		report, err := collector.Collect(false)
+		require.NoError(t, err)
+		assert.Equal(t, []string{fileHash}, report.Expired)
+		assert.Equal(t, []string{abandoned}, report.Deleted)
+
+		exists, err := db.CheckFileExists(fileHash)
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("Test Collect compacts packs after deleting packed chunks", func(t *testing.T) {
+		collector, fileStorage, _, _ := setupCollector(t, 0)
+		require.NoError(t, fileStorage.SetLayout(filesystem.LayoutPack))
+
+		content := []byte("packed garbage")
+		_, err := fileStorage.SaveChunkData(hasher.CalculateChunkHash(content), content)
+		require.NoError(t, err)
+
+		report, err := collector.Collect(false)
+		require.NoError(t, err)
+		assert.Len(t, report.Deleted, 1)
+		assert.Greater(t, report.Compacted, int64(len(content)))
+
+		chunkHashes, err := fileStorage.ListChunks()
+		require.NoError(t, err)
+		assert.Empty(t, chunkHashes)
+	})
+}
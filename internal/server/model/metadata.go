@@ -1,16 +1,43 @@
 package model
 
+import "time"
+
 // FileMetadata represents metadata for a complete file
 type FileMetadata struct {
-	ID       uint            `gorm:"primaryKey;autoIncrement" json:"id"`
-	FileHash string          `gorm:"index;unique;not null" json:"file_hash"`
-	Chunks   []ChunkMetadata `gorm:"foreignKey:FileMetadataID;constraint:OnDelete:CASCADE" json:"chunks"`
+	ID          uint            `gorm:"primaryKey;autoIncrement" json:"id"`
+	FileHash    string          `gorm:"index;unique;not null" json:"file_hash"`
+	Chunker     string          `json:"chunker"`                                 // chunker config that produced the chunks, see hasher.ChunkerConfig
+	Damaged     bool            `gorm:"not null;default:false" json:"damaged"`   // a chunk of the file was found corrupt and quarantined
+	Complete    bool            `gorm:"not null;default:false" json:"complete"`  // the chunks hash to the file hash, so no chunk can be added
+	Size        int64           `gorm:"not null;default:0" json:"size"`          // sum of the sizes of the chunks
+	Name        string          `gorm:"not null;default:''" json:"name"`         // original filename given by the first uploader
+	ContentType string          `gorm:"not null;default:''" json:"content_type"` // MIME type detected on upload
+	Uploader    string          `gorm:"not null;default:''" json:"uploader"`     // username of the first uploader, empty if unknown
+	CreatedAt   time.Time       `json:"created_at"`                              // zero for files stored before it was recorded
+	LastChunkAt time.Time       `gorm:"index" json:"last_chunk_at"`              // last upload of a chunk, abandoned incomplete files expire after it
+	Chunks      []ChunkMetadata `gorm:"foreignKey:FileMetadataID;constraint:OnDelete:CASCADE" json:"chunks"`
+}
+
+// FileAlias is another hash a file is known by, like the hash single chunk files had before every
+// file had a manifest
+type FileAlias struct {
+	AliasHash      string `gorm:"primaryKey" json:"alias_hash"` // canonical
+	FileMetadataID uint   `gorm:"index;not null" json:"file_metadata_id"`
 }
 
 // ChunkMetadata represents metadata for a single chunk
 type ChunkMetadata struct {
 	ID             uint   `gorm:"primaryKey;autoIncrement" json:"id"`
-	FileMetadataID uint   `gorm:"index" json:"file_metadata_id"` // foreign key
-	ChunkOrder     int    `json:"chunk_order"`
-	ChunkHash      string `gorm:"uniqueIndex:idx_file_chunk_order,priority:2" json:"chunk_hash"`
+	FileMetadataID uint   `gorm:"uniqueIndex:idx_chunk_metadata_file_order,priority:1" json:"file_metadata_id"` // foreign key
+	ChunkOrder     int    `gorm:"uniqueIndex:idx_chunk_metadata_file_order,priority:2" json:"chunk_order"`      // one chunk per position of a file
+	ChunkHash      string `gorm:"index" json:"chunk_hash"`                                                      // shared by every file and position with the same content
+	Size           int64  `gorm:"not null;default:0" json:"size"`                                               // content bytes of the chunk, 0 if not recorded yet
+}
+
+// ChunkRef counts the chunk metadata entries referencing a chunk, keyed by its canonical hash
+type ChunkRef struct {
+	ChunkHash string `gorm:"primaryKey" json:"chunk_hash"`
+	RefCount  int    `gorm:"not null;default:0;index" json:"ref_count"`
+	Size      int64  `gorm:"not null;default:0" json:"size"`  // content bytes of the chunk, 0 if not recorded yet
+	Users     int    `gorm:"not null;default:0" json:"users"` // users owning a file that references the chunk
 }
@@ -0,0 +1,9 @@
+package model
+
+import "time"
+
+// Migration records a data migration that has been applied to the storage
+type Migration struct {
+	Name      string    `gorm:"primaryKey" json:"name"`
+	AppliedAt time.Time `json:"applied_at"`
+}
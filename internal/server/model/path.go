@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// PathEntry is a directory, or a file saved at a path, in the namespace of a user. The root
+// directory "/" of every user is implicit.
+type PathEntry struct {
+	ID             uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID         uint      `gorm:"not null;uniqueIndex:idx_path_entries_user_path,priority:1;index:idx_path_entries_user_parent,priority:1" json:"user_id"`
+	Path           string    `gorm:"not null;uniqueIndex:idx_path_entries_user_path,priority:2" json:"path"` // absolute and clean, such as /docs/report.pdf
+	Parent         string    `gorm:"not null;index:idx_path_entries_user_parent,priority:2" json:"parent"`   // path of the directory holding the entry
+	IsDir          bool      `gorm:"not null;default:false" json:"is_dir"`
+	FileMetadataID uint      `gorm:"not null;default:0;index" json:"file_metadata_id"` // the file saved at the path, 0 for directories
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	FileHash       string    `gorm:"->;-:migration" json:"file_hash"`    // hash of the file, filled in when entries are read
+	Size           int64     `gorm:"->;-:migration" json:"size"`         // size of the file, filled in when entries are read
+	ContentType    string    `gorm:"->;-:migration" json:"content_type"` // content type of the file, filled in when entries are read
+}
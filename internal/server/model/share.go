@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// FileGrant gives a user read access to a file owned by others
+type FileGrant struct {
+	FileMetadataID uint      `gorm:"primaryKey" json:"file_metadata_id"`
+	UserID         uint      `gorm:"primaryKey;index" json:"user_id"`
+	GrantedBy      uint      `gorm:"not null" json:"granted_by"` // id of the owner who granted access
+	CreatedAt      time.Time `json:"created_at"`
+	Username       string    `gorm:"->;-:migration" json:"username"` // username of the grantee, filled in when grants are listed
+}
+
+// ShareLink serves a file to anyone who has its token, until it expires
+type ShareLink struct {
+	Token          string    `gorm:"primaryKey" json:"token"`
+	FileMetadataID uint      `gorm:"not null;index" json:"file_metadata_id"`
+	CreatedBy      uint      `gorm:"not null" json:"created_by"` // id of the owner who created the link
+	Password       []byte    `json:"-"`                          // bcrypt hash of the password, empty for links without one
+	ExpiresAt      time.Time `gorm:"not null" json:"expires_at"`
+	CreatedAt      time.Time `json:"created_at"`
+	FileHash       string    `gorm:"->;-:migration" json:"file_hash"` // hash of the shared file, filled in when links are read
+}
@@ -0,0 +1,66 @@
+package model
+
+import "time"
+
+// FileOwner records that a user owns a file. Many users can own one deduplicated file.
+type FileOwner struct {
+	FileMetadataID uint      `gorm:"primaryKey" json:"file_metadata_id"`
+	UserID         uint      `gorm:"primaryKey;index" json:"user_id"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// UploadedChunk records that a user uploaded the chunk at a position of a file they do not own yet.
+// Users own a complete file once they have uploaded every position of it, and the chunks of an
+// incomplete file are replaced by a user's once theirs hash to the file hash.
+type UploadedChunk struct {
+	FileMetadataID uint   `gorm:"primaryKey;autoIncrement:false" json:"file_metadata_id"`
+	UserID         uint   `gorm:"primaryKey;autoIncrement:false" json:"user_id"`
+	ChunkOrder     int    `gorm:"primaryKey;autoIncrement:false" json:"chunk_order"`
+	ChunkHash      string `gorm:"not null;default:''" json:"chunk_hash"` // empty for chunks recorded before it was
+	Size           int64  `gorm:"not null;default:0" json:"size"`
+}
+
+// UserChunkRef counts the chunk metadata entries of the files a user owns referencing a chunk,
+// keyed by the canonical chunk hash
+type UserChunkRef struct {
+	UserID    uint   `gorm:"primaryKey" json:"user_id"`
+	ChunkHash string `gorm:"primaryKey;index" json:"chunk_hash"`
+	RefCount  int    `gorm:"not null;default:0" json:"ref_count"`
+}
+
+// Usage is the storage accounted to a user, maintained as files are uploaded, owned and deleted
+type Usage struct {
+	UserID       uint  `gorm:"primaryKey" json:"-"`
+	Files        int64 `gorm:"not null;default:0" json:"files"`
+	Chunks       int64 `gorm:"not null;default:0" json:"chunks"`        // distinct chunks of the user's files
+	ChunkBytes   int64 `gorm:"not null;default:0" json:"chunk_bytes"`   // size of the distinct chunks of the user's files
+	LogicalBytes int64 `gorm:"not null;default:0" json:"logical_bytes"` // sum of the sizes of the user's files
+	UniqueBytes  int64 `gorm:"not null;default:0" json:"unique_bytes"`  // size of the chunks no other user's files reference
+}
+
+// Quota limits the storage accounted to a user in bytes. The meaning of 0 depends on where it is used, see User.Quota and UsageResponse.Quota.
+type Quota struct {
+	LogicalBytes int64 `json:"logical_bytes"`
+	UniqueBytes  int64 `json:"unique_bytes"`
+}
+
+// Totals are the statistics of all files, maintained as files are created and deleted and as
+// chunks are referenced and released. The table holds a single row.
+type Totals struct {
+	ID           uint  `gorm:"primaryKey" json:"-"`
+	Files        int64 `gorm:"not null;default:0" json:"files"`
+	Chunks       int64 `gorm:"not null;default:0" json:"chunks"`        // distinct referenced chunks
+	ChunkBytes   int64 `gorm:"not null;default:0" json:"chunk_bytes"`   // size of the distinct referenced chunks
+	LogicalBytes int64 `gorm:"not null;default:0" json:"logical_bytes"` // size of every reference to a chunk
+}
+
+// Stats are deduplication statistics of all files, or of the files of one user
+type Stats struct {
+	Files        int64      `json:"files"`
+	Chunks       int64      `json:"chunks"`                 // distinct chunks of the files
+	ChunkBytes   int64      `json:"chunk_bytes"`            // size of the distinct chunks, each stored once
+	LogicalBytes int64      `json:"logical_bytes"`          // sum of the sizes of the files
+	UniqueBytes  int64      `json:"unique_bytes,omitempty"` // size of the chunks only the user references
+	DedupRatio   float64    `json:"dedup_ratio"`            // logical bytes per chunk byte
+	TopChunks    []ChunkRef `json:"top_chunks"`             // the most referenced shared chunks
+}
@@ -5,4 +5,7 @@ type User struct {
 	ID       uint   `gorm:"primaryKey;autoIncrement" json:"id"`
 	Username string `gorm:"uniqueIndex;not null" json:"username"`
 	Password []byte `json:"password" binding:"required"`
+	// Quota overrides the server's default quota for each limit that is not 0, a negative limit is unlimited.
+	// A server default of 0 is unlimited too.
+	Quota Quota `gorm:"embedded;embeddedPrefix:quota_" json:"quota"`
 }
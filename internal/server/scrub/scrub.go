@@ -0,0 +1,279 @@
+// Package scrub verifies the blocks of the block store against their hashes in the background.
+package scrub
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"time"
+	"zerodupe/internal/server/storage"
+	"zerodupe/pkg/hasher"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultRate is the default number of bytes verified per second, which keeps a scrub from
+// starving uploads and downloads of disk bandwidth
+const DefaultRate = 16 << 20
+
+// ErrRunning is returned when a scrub is started while another one runs
+var ErrRunning = errors.New("a scrub is already running")
+
+// CorruptChunk describes a block whose content no longer matches its hash
+type CorruptChunk struct {
+	ChunkHash   string `json:"chunk_hash"`
+	ActualHash  string `json:"actual_hash,omitempty"` // empty when the block could not be decoded
+	Quarantined bool   `json:"quarantined"`
+}
+
+// Report summarizes a scrub
+type Report struct {
+	StartedAt    time.Time      `json:"started_at"`
+	Scanned      int            `json:"scanned"`                        // blocks in the block store
+	Verified     int            `json:"verified"`                       // blocks that match their hash
+	Corrupt      []CorruptChunk `json:"corrupt"`                        // blocks that no longer match their hash
+	Vanished     int            `json:"vanished"`                       // blocks deleted while the scrub ran
+	Failed       int            `json:"failed"`                         // blocks that could not be read
+	DamagedFiles []string       `json:"damaged_files"`                  // files marked damaged by this scrub
+	Bytes        int64          `json:"bytes"`                          // bytes verified
+	Duration     time.Duration  `json:"duration" swaggertype:"integer"` // in nanoseconds
+}
+
+// Status reports the progress of the running scrub and the result of the last one
+type Status struct {
+	Running   bool      `json:"running"`
+	StartedAt time.Time `json:"started_at,omitzero"`
+	Total     int       `json:"total"`   // blocks to scan in the running scrub
+	Scanned   int       `json:"scanned"` // blocks scanned so far
+	Corrupt   int       `json:"corrupt"` // corrupt blocks found so far
+	Last      *Report   `json:"last,omitempty"`
+}
+
+// Scrubber re-hashes every block of the block store, quarantines the blocks that no longer
+// match their hash and marks the files referencing them as damaged
+type Scrubber struct {
+	fileSystem storage.FileSystem
+	db         storage.DB
+	rate       int64
+
+	// only one scrub runs at a time
+	mu sync.Mutex
+
+	statusMu sync.Mutex
+	status   Status
+	cancel   context.CancelFunc // cancels the scrub started by Start, guarded by statusMu
+}
+
+// NewScrubber creates a scrubber that verifies at most rate bytes per second, or without a
+// limit if rate is not positive. Blocks are read from the innermost store of fileSystem, past
+// any cache, and quarantined through fileSystem.
+func NewScrubber(fileSystem storage.FileSystem, db storage.DB, rate int64) *Scrubber {
+	return &Scrubber{
+		fileSystem: fileSystem,
+		db:         db,
+		rate:       rate,
+	}
+}
+
+// Scrub verifies every block of the block store. It stops early with the context's error when
+// ctx is canceled.
+func (s *Scrubber) Scrub(ctx context.Context) (*Report, error) {
+	if !s.mu.TryLock() {
+		return nil, ErrRunning
+	}
+	defer s.mu.Unlock()
+
+	return s.scrub(ctx)
+}
+
+// Start starts a scrub in the background and returns ErrRunning if one is already running
+func (s *Scrubber) Start() error {
+	if !s.mu.TryLock() {
+		return ErrRunning
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.setCancel(cancel)
+
+	go func() {
+		defer s.mu.Unlock()
+		defer s.setCancel(nil)
+		defer cancel()
+		s.logReport(s.scrub(ctx))
+	}()
+	return nil
+}
+
+// Stop cancels the scrub started by Start, if it is still running
+func (s *Scrubber) Stop() {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
+
+// Status returns the progress of the running scrub and the result of the last one
+func (s *Scrubber) Status() Status {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+
+	return s.status
+}
+
+// Run scrubs the block store every interval until ctx is canceled
+func (s *Scrubber) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := s.Scrub(ctx)
+			if errors.Is(err, ErrRunning) {
+				continue
+			}
+			s.logReport(report, err)
+		}
+	}
+}
+
+// scrub verifies every block. The caller must hold mu.
+func (s *Scrubber) scrub(ctx context.Context) (*Report, error) {
+	report := &Report{StartedAt: time.Now()}
+
+	chunkHashes, err := s.fileSystem.ListChunks()
+	if err != nil {
+		return nil, err
+	}
+	report.Scanned = len(chunkHashes)
+
+	s.updateStatus(func(status *Status) {
+		status.Running = true
+		status.StartedAt = report.StartedAt
+		status.Total = len(chunkHashes)
+		status.Scanned = 0
+		status.Corrupt = 0
+	})
+	defer s.updateStatus(func(status *Status) { status.Running = false })
+
+	// blocks are verified as stored, not as a cache in front of the store remembers them
+	reader := storage.Unwrap(s.fileSystem)
+
+	for i, chunkHash := range chunkHashes {
+		if err := s.throttle(ctx, report); err != nil {
+			return nil, err
+		}
+
+		data, err := reader.GetChunkData(chunkHash)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			report.Vanished++
+		case errors.Is(err, storage.ErrCorruptChunk):
+			s.handleCorrupt(report, chunkHash, "")
+		case err != nil:
+			log.Warn().Err(err).Str("chunk", chunkHash).Msg("Failed to read chunk")
+			report.Failed++
+		default:
+			report.Bytes += int64(len(data))
+			if ok, actualHash := hasher.VerifyChunkHash(data, chunkHash); ok {
+				report.Verified++
+			} else {
+				s.handleCorrupt(report, chunkHash, actualHash)
+			}
+		}
+
+		s.updateStatus(func(status *Status) {
+			status.Scanned = i + 1
+			status.Corrupt = len(report.Corrupt)
+		})
+	}
+
+	report.Duration = time.Since(report.StartedAt)
+	s.updateStatus(func(status *Status) { status.Last = report })
+	return report, nil
+}
+
+// handleCorrupt quarantines a corrupt block and marks the files referencing it as damaged
+func (s *Scrubber) handleCorrupt(report *Report, chunkHash, actualHash string) {
+	log.Error().Str("chunk", chunkHash).Str("actual_hash", actualHash).Msg("Corrupt chunk")
+	corrupt := CorruptChunk{ChunkHash: chunkHash, ActualHash: actualHash}
+
+	if quarantiner, ok := s.fileSystem.(storage.Quarantiner); ok {
+		if err := quarantiner.QuarantineChunk(chunkHash, actualHash); err == nil {
+			corrupt.Quarantined = true
+		} else if !errors.Is(err, errors.ErrUnsupported) {
+			log.Error().Err(err).Str("chunk", chunkHash).Msg("Failed to quarantine chunk")
+		}
+	}
+	report.Corrupt = append(report.Corrupt, corrupt)
+
+	damaged, err := s.db.MarkChunkDamaged(chunkHash)
+	if err != nil {
+		log.Error().Err(err).Str("chunk", chunkHash).Msg("Failed to mark files damaged")
+		return
+	}
+	report.DamagedFiles = append(report.DamagedFiles, damaged...)
+}
+
+// throttle sleeps until the bytes verified so far are within the rate limit
+func (s *Scrubber) throttle(ctx context.Context, report *Report) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if s.rate <= 0 {
+		return nil
+	}
+
+	due := time.Duration(float64(report.Bytes) / float64(s.rate) * float64(time.Second))
+	wait := due - time.Since(report.StartedAt)
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// updateStatus changes the status under its lock
+func (s *Scrubber) updateStatus(update func(status *Status)) {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+
+	update(&s.status)
+}
+
+// setCancel records the cancel function of the scrub started by Start
+func (s *Scrubber) setCancel(cancel context.CancelFunc) {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+
+	s.cancel = cancel
+}
+
+// logReport logs the result of a scrub
+func (s *Scrubber) logReport(report *Report, err error) {
+	if err != nil {
+		log.Error().Err(err).Msg("Scrub failed")
+		return
+	}
+	log.Info().
+		Int("scanned", report.Scanned).
+		Int("verified", report.Verified).
+		Int("corrupt", len(report.Corrupt)).
+		Int("damaged_files", len(report.DamagedFiles)).
+		Int("failed", report.Failed).
+		Int64("bytes", report.Bytes).
+		Dur("duration", report.Duration).
+		Msg("Scrub finished")
+}
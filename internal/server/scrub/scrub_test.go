@@ -0,0 +1,242 @@
+package scrub
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"zerodupe/internal/server/storage"
+	"zerodupe/internal/server/storage/cache"
+	"zerodupe/internal/server/storage/filesystem"
+	"zerodupe/internal/server/storage/memory"
+	"zerodupe/pkg/hasher"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+)
+
+// setupScrubber creates an unthrottled scrubber over a temporary block store and an in-memory database
+func setupScrubber(t *testing.T) (*Scrubber, *filesystem.FilesystemStorage, storage.DB, string) {
+	t.Helper()
+
+	tempDir := t.TempDir()
+	fileStorage, err := filesystem.NewFilesystemStorage(tempDir)
+	require.NoError(t, err)
+
+	db, err := storage.NewGormStorage(sqlite.Open(":memory:"))
+	require.NoError(t, err)
+
+	return NewScrubber(fileStorage, db, 0), fileStorage, db, tempDir
+}
+
+// saveFile stores content as a single-chunk file and returns the chunk and file hashes
+func saveFile(t *testing.T, fileSystem storage.FileSystem, db storage.DB, content []byte) (string, string) {
+	t.Helper()
+
+	chunkHash := hasher.CalculateChunkHash(content)
+	_, err := fileSystem.SaveChunkData(chunkHash, content)
+	require.NoError(t, err)
+
+	fileHash := hasher.FileHashFromChunkHashes([]string{chunkHash})
+	require.NoError(t, db.SaveChunkMetadata(fileHash, chunkHash, 1, 0, ""))
+	return chunkHash, fileHash
+}
+
+// corruptBlock overwrites the stored block of a chunk
+func corruptBlock(t *testing.T, tempDir, chunkHash, extension string, data []byte) {
+	t.Helper()
+
+	blockPath := filepath.Join(tempDir, "blocks", chunkHash[:4], chunkHash+extension)
+	require.NoError(t, os.WriteFile(blockPath, data, 0644))
+}
+
+// quarantined returns the names of the files in the quarantine directory
+func quarantined(t *testing.T, tempDir string) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(filepath.Join(tempDir, "quarantine"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	require.NoError(t, err)
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestScrub(t *testing.T) {
+	t.Run("Test Scrub verifies intact blocks", func(t *testing.T) {
+		scrubber, fileStorage, db, tempDir := setupScrubber(t)
+
+		saveFile(t, fileStorage, db, []byte("first"))
+		saveFile(t, fileStorage, db, []byte("second"))
+
+		report, err := scrubber.Scrub(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 2, report.Scanned)
+		assert.Equal(t, 2, report.Verified)
+		assert.Empty(t, report.Corrupt)
+		assert.Empty(t, report.DamagedFiles)
+		assert.Equal(t, int64(len("first")+len("second")), report.Bytes)
+		assert.Empty(t, quarantined(t, tempDir))
+	})
+
+	t.Run("Test Scrub quarantines corrupt blocks and marks their files damaged", func(t *testing.T) {
+		scrubber, fileStorage, db, tempDir := setupScrubber(t)
+
+		intact, intactFile := saveFile(t, fileStorage, db, []byte("intact"))
+		corrupt, corruptFile := saveFile(t, fileStorage, db, []byte("corrupt"))
+		corruptBlock(t, tempDir, corrupt, "", []byte("tampered"))
+
+		report, err := scrubber.Scrub(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 2, report.Scanned)
+		assert.Equal(t, 1, report.Verified)
+		assert.Equal(t, []CorruptChunk{{
+			ChunkHash:   corrupt,
+			ActualHash:  hasher.CalculateChunkHash([]byte("tampered")),
+			Quarantined: true,
+		}}, report.Corrupt)
+		assert.Equal(t, []string{corruptFile}, report.DamagedFiles)
+
+		// the corrupt block is moved out of the block store into the quarantine directory
+		existing, missing, err := fileStorage.CheckChunkExists([]string{intact, corrupt})
+		require.NoError(t, err)
+		assert.Equal(t, []string{intact}, existing)
+		assert.Equal(t, []string{corrupt}, missing)
+		assert.Len(t, quarantined(t, tempDir), 2)
+
+		damaged, err := db.ListDamagedFiles()
+		require.NoError(t, err)
+		assert.Equal(t, []string{corruptFile}, damaged)
+		metadata, err := db.GetFileMetadata(intactFile)
+		require.NoError(t, err)
+		assert.False(t, metadata.Damaged)
+	})
+
+	t.Run("Test Scrub quarantines compressed blocks that fail to decompress", func(t *testing.T) {
+		scrubber, fileStorage, db, tempDir := setupScrubber(t)
+		require.NoError(t, fileStorage.SetCompression(filesystem.CompressionGzip))
+
+		chunkHash, fileHash := saveFile(t, fileStorage, db, bytes.Repeat([]byte("compressible "), 100))
+		corruptBlock(t, tempDir, chunkHash, ".gz", []byte("not gzip"))
+
+		report, err := scrubber.Scrub(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []CorruptChunk{{ChunkHash: chunkHash, Quarantined: true}}, report.Corrupt)
+		assert.Equal(t, []string{fileHash}, report.DamagedFiles)
+	})
+
+	t.Run("Test Scrub reads blocks past the cache and evicts quarantined ones", func(t *testing.T) {
+		_, fileStorage, db, tempDir := setupScrubber(t)
+		cachedStorage := cache.NewCachedStorage(fileStorage, 1<<20)
+		scrubber := NewScrubber(cachedStorage, db, 0)
+
+		chunkHash, _ := saveFile(t, cachedStorage, db, []byte("cached"))
+		_, err := cachedStorage.GetChunkData(chunkHash)
+		require.NoError(t, err)
+		corruptBlock(t, tempDir, chunkHash, "", []byte("tampered"))
+
+		report, err := scrubber.Scrub(context.Background())
+		require.NoError(t, err)
+		require.Len(t, report.Corrupt, 1)
+		assert.True(t, report.Corrupt[0].Quarantined)
+
+		_, err = cachedStorage.GetChunkData(chunkHash)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("Test Scrub without quarantine support keeps corrupt blocks", func(t *testing.T) {
+		db := memory.NewMemoryDB()
+		fileStorage := &tamperedStorage{FileSystem: memory.NewMemoryStorage()}
+		scrubber := NewScrubber(cache.NewCachedStorage(fileStorage, 1<<20), db, 0)
+
+		chunkHash, fileHash := saveFile(t, fileStorage, db, []byte("content"))
+		fileStorage.tampered = chunkHash
+
+		report, err := scrubber.Scrub(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []CorruptChunk{{ChunkHash: chunkHash, ActualHash: hasher.CalculateChunkHash([]byte("tampered"))}}, report.Corrupt)
+		assert.Equal(t, []string{fileHash}, report.DamagedFiles)
+	})
+
+	t.Run("Test Scrub is rate limited", func(t *testing.T) {
+		_, fileStorage, db, _ := setupScrubber(t)
+		scrubber := NewScrubber(fileStorage, db, 1000)
+
+		saveFile(t, fileStorage, db, bytes.Repeat([]byte("a"), 100))
+		saveFile(t, fileStorage, db, bytes.Repeat([]byte("b"), 100))
+
+		// the second block is read once the first 100 bytes are due at 1000 bytes per second
+		report, err := scrubber.Scrub(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 2, report.Verified)
+		assert.GreaterOrEqual(t, report.Duration, 100*time.Millisecond)
+	})
+
+	t.Run("Test Scrub stops when canceled", func(t *testing.T) {
+		_, fileStorage, db, _ := setupScrubber(t)
+		scrubber := NewScrubber(fileStorage, db, 1)
+
+		saveFile(t, fileStorage, db, []byte("first"))
+		saveFile(t, fileStorage, db, []byte("second"))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := scrubber.Scrub(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.False(t, scrubber.Status().Running)
+	})
+}
+
+func TestStart(t *testing.T) {
+	t.Run("Test Start scrubs in the background", func(t *testing.T) {
+		scrubber, fileStorage, db, _ := setupScrubber(t)
+
+		saveFile(t, fileStorage, db, []byte("content"))
+
+		require.NoError(t, scrubber.Start())
+		require.Eventually(t, func() bool { return scrubber.Status().Last != nil }, time.Second, 10*time.Millisecond)
+
+		status := scrubber.Status()
+		assert.Equal(t, 1, status.Total)
+		assert.Equal(t, 1, status.Scanned)
+		assert.Equal(t, 1, status.Last.Verified)
+	})
+
+	t.Run("Test only one scrub runs at a time", func(t *testing.T) {
+		_, fileStorage, db, _ := setupScrubber(t)
+		scrubber := NewScrubber(fileStorage, db, 1)
+
+		saveFile(t, fileStorage, db, []byte("first"))
+		saveFile(t, fileStorage, db, []byte("second"))
+
+		require.NoError(t, scrubber.Start())
+		assert.ErrorIs(t, scrubber.Start(), ErrRunning)
+		_, err := scrubber.Scrub(context.Background())
+		assert.ErrorIs(t, err, ErrRunning)
+
+		scrubber.Stop()
+		require.Eventually(t, func() bool { return scrubber.Start() == nil }, time.Second, 10*time.Millisecond)
+		scrubber.Stop()
+	})
+}
+
+// tamperedStorage returns other content for one chunk than was saved
+type tamperedStorage struct {
+	storage.FileSystem
+	tampered string
+}
+
+func (ts *tamperedStorage) GetChunkData(chunkHash string) ([]byte, error) {
+	if chunkHash == ts.tampered {
+		return []byte("tampered"), nil
+	}
+	return ts.FileSystem.GetChunkData(chunkHash)
+}
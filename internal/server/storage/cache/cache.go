@@ -0,0 +1,188 @@
+// Package cache keeps recently read chunks in memory in front of a slower chunk store.
+package cache
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"zerodupe/internal/server/storage"
+	"zerodupe/pkg/hasher"
+)
+
+// Stats are the counters of a chunk cache
+type Stats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	Entries   int   `json:"entries"`
+	Bytes     int64 `json:"bytes"`     // size of the cached chunks
+	MaxBytes  int64 `json:"max_bytes"` // capacity of the cache
+}
+
+// HitRatio returns the share of reads served from the cache
+func (s Stats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// entry is a cached chunk
+type entry struct {
+	key  string
+	data []byte
+}
+
+// CachedStorage is a read-through cache around a FileSystem. It keeps the content of the
+// most recently read chunks up to a total size in bytes and evicts the least recently used
+// ones beyond it. Chunks are content addressed, so a cached chunk only goes stale when it is
+// deleted, which evicts it. All other operations are passed through.
+type CachedStorage struct {
+	storage.FileSystem
+
+	mu       sync.Mutex
+	maxBytes int64
+	lru      *list.List // front is the most recently used
+	entries  map[string]*list.Element
+	stats    Stats
+	deletes  uint64 // number of deletions, so reads racing a deletion do not cache the deleted chunk
+}
+
+// NewCachedStorage wraps a FileSystem with a cache of at most maxBytes of chunk content
+func NewCachedStorage(fileSystem storage.FileSystem, maxBytes int64) *CachedStorage {
+	return &CachedStorage{
+		FileSystem: fileSystem,
+		maxBytes:   maxBytes,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// GetChunkData returns the content of a chunk from the cache, reading and caching it on a miss
+func (cs *CachedStorage) GetChunkData(chunkHash string) ([]byte, error) {
+	// every spelling of a hash shares one entry
+	key := hasher.CanonicalHash(chunkHash)
+
+	data, deletes, ok := cs.get(key)
+	if ok {
+		return data, nil
+	}
+
+	data, err := cs.FileSystem.GetChunkData(chunkHash)
+	if err != nil {
+		return nil, err
+	}
+	cs.add(key, data, deletes)
+	return data, nil
+}
+
+// DeleteChunk evicts a chunk from the cache and deletes it from the store
+func (cs *CachedStorage) DeleteChunk(chunkHash string) error {
+	cs.evict(chunkHash)
+	// a read that missed while the chunk was being deleted may have cached it meanwhile
+	defer cs.evict(chunkHash)
+	return cs.FileSystem.DeleteChunk(chunkHash)
+}
+
+// Compact compacts the wrapped store if it is a Compactor
+func (cs *CachedStorage) Compact() (int64, error) {
+	if compactor, ok := cs.FileSystem.(storage.Compactor); ok {
+		return compactor.Compact()
+	}
+	return 0, nil
+}
+
+// QuarantineChunk evicts a chunk from the cache and quarantines it in the wrapped store.
+// It returns errors.ErrUnsupported if the wrapped store cannot quarantine chunks.
+func (cs *CachedStorage) QuarantineChunk(chunkHash, actualHash string) error {
+	quarantiner, ok := cs.FileSystem.(storage.Quarantiner)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+
+	cs.evict(chunkHash)
+	defer cs.evict(chunkHash)
+	return quarantiner.QuarantineChunk(chunkHash, actualHash)
+}
+
+// Unwrap returns the wrapped FileSystem
+func (cs *CachedStorage) Unwrap() storage.FileSystem {
+	return cs.FileSystem
+}
+
+// Stats returns the counters of the cache
+func (cs *CachedStorage) Stats() Stats {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	stats := cs.stats
+	stats.Entries = cs.lru.Len()
+	stats.MaxBytes = cs.maxBytes
+	return stats
+}
+
+// get returns a copy of a cached chunk and marks it as most recently used. On a miss it
+// returns the number of deletions so far, to be passed to add.
+func (cs *CachedStorage) get(key string) ([]byte, uint64, bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	element, ok := cs.entries[key]
+	if !ok {
+		cs.stats.Misses++
+		return nil, cs.deletes, false
+	}
+	cs.stats.Hits++
+	cs.lru.MoveToFront(element)
+	// callers own the returned slice, the cached one must not change
+	return append([]byte(nil), element.Value.(*entry).data...), cs.deletes, true
+}
+
+// add caches a chunk read after the given number of deletions and evicts the least recently
+// used chunks beyond the capacity. Chunks larger than the whole cache, or read while a chunk
+// was deleted, are not cached.
+func (cs *CachedStorage) add(key string, data []byte, deletes uint64) {
+	size := int64(len(data))
+	if size > cs.maxBytes {
+		return
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if cs.deletes != deletes {
+		return
+	}
+
+	// a concurrent miss of the same chunk may have cached it already
+	if element, ok := cs.entries[key]; ok {
+		cs.lru.MoveToFront(element)
+		return
+	}
+
+	for cs.stats.Bytes+size > cs.maxBytes {
+		cs.remove(cs.lru.Back())
+		cs.stats.Evictions++
+	}
+
+	cs.entries[key] = cs.lru.PushFront(&entry{key: key, data: append([]byte(nil), data...)})
+	cs.stats.Bytes += size
+}
+
+// evict drops a chunk that is about to leave the store from the cache
+func (cs *CachedStorage) evict(chunkHash string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.deletes++
+	if element, ok := cs.entries[hasher.CanonicalHash(chunkHash)]; ok {
+		cs.remove(element)
+	}
+}
+
+// remove drops an entry from the cache. The caller must hold mu.
+func (cs *CachedStorage) remove(element *list.Element) {
+	e := cs.lru.Remove(element).(*entry)
+	delete(cs.entries, e.key)
+	cs.stats.Bytes -= int64(len(e.data))
+}
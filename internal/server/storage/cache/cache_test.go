@@ -0,0 +1,200 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"zerodupe/internal/server/storage"
+	"zerodupe/internal/server/storage/memory"
+	"zerodupe/internal/server/storage/storagetest"
+	"zerodupe/pkg/hasher"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingStorage counts the reads that reach the wrapped storage
+type countingStorage struct {
+	storage.FileSystem
+	reads atomic.Int64
+}
+
+func (cs *countingStorage) GetChunkData(chunkHash string) ([]byte, error) {
+	cs.reads.Add(1)
+	return cs.FileSystem.GetChunkData(chunkHash)
+}
+
+// deletingStorage runs beforeDelete while a chunk is being deleted
+type deletingStorage struct {
+	storage.FileSystem
+	beforeDelete func()
+}
+
+func (ds *deletingStorage) DeleteChunk(chunkHash string) error {
+	ds.beforeDelete()
+	return ds.FileSystem.DeleteChunk(chunkHash)
+}
+
+// setupCachedStorage creates a cache of maxBytes around an in-memory storage holding chunks
+func setupCachedStorage(t *testing.T, maxBytes int64, chunks ...[]byte) (*CachedStorage, *countingStorage, []string) {
+	t.Helper()
+
+	backing := &countingStorage{FileSystem: memory.NewMemoryStorage()}
+	hashes := make([]string, len(chunks))
+	for i, content := range chunks {
+		hashes[i] = hasher.CalculateChunkHash(content)
+		_, err := backing.SaveChunkData(hashes[i], content)
+		require.NoError(t, err)
+	}
+	return NewCachedStorage(backing, maxBytes), backing, hashes
+}
+
+// testChunks returns n distinct chunks of size bytes
+func testChunks(n, size int) [][]byte {
+	chunks := make([][]byte, n)
+	for i := range chunks {
+		chunks[i] = []byte(fmt.Sprintf("%0*d", size, i))
+	}
+	return chunks
+}
+
+func TestCachedStorageConformance(t *testing.T) {
+	storagetest.TestFileSystem(t, func(t *testing.T) storage.FileSystem {
+		return NewCachedStorage(memory.NewMemoryStorage(), 1<<20)
+	})
+}
+
+func TestGetChunkData(t *testing.T) {
+	t.Run("Test GetChunkData reads a chunk once", func(t *testing.T) {
+		cache, backing, hashes := setupCachedStorage(t, 1024, testChunks(1, 100)...)
+
+		for i := 0; i < 3; i++ {
+			data, err := cache.GetChunkData(hashes[0])
+			require.NoError(t, err)
+			assert.Equal(t, testChunks(1, 100)[0], data)
+		}
+		// the prefixed spelling of the hash hits the same entry
+		_, err := cache.GetChunkData(hasher.FormatHash(hasher.SHA256, hashes[0]))
+		require.NoError(t, err)
+
+		assert.Equal(t, int64(1), backing.reads.Load())
+		stats := cache.Stats()
+		assert.Equal(t, int64(3), stats.Hits)
+		assert.Equal(t, int64(1), stats.Misses)
+		assert.Equal(t, 1, stats.Entries)
+		assert.Equal(t, int64(100), stats.Bytes)
+		assert.Equal(t, int64(1024), stats.MaxBytes)
+		assert.Equal(t, 0.75, stats.HitRatio())
+	})
+
+	t.Run("Test GetChunkData returns a copy of the cached chunk", func(t *testing.T) {
+		cache, _, hashes := setupCachedStorage(t, 1024, testChunks(1, 100)...)
+
+		data, err := cache.GetChunkData(hashes[0])
+		require.NoError(t, err)
+		data[0] = 'x'
+
+		data, err = cache.GetChunkData(hashes[0])
+		require.NoError(t, err)
+		assert.Equal(t, testChunks(1, 100)[0], data)
+	})
+
+	t.Run("Test GetChunkData evicts the least recently used chunks", func(t *testing.T) {
+		cache, backing, hashes := setupCachedStorage(t, 300, testChunks(4, 100)...)
+
+		for _, hash := range hashes[:3] {
+			_, err := cache.GetChunkData(hash)
+			require.NoError(t, err)
+		}
+		// chunk 0 becomes the most recently used, so chunk 1 is evicted for chunk 3
+		_, err := cache.GetChunkData(hashes[0])
+		require.NoError(t, err)
+		_, err = cache.GetChunkData(hashes[3])
+		require.NoError(t, err)
+
+		stats := cache.Stats()
+		assert.Equal(t, int64(1), stats.Evictions)
+		assert.Equal(t, 3, stats.Entries)
+		assert.Equal(t, int64(300), stats.Bytes)
+
+		reads := backing.reads.Load()
+		for _, hash := range []string{hashes[0], hashes[2], hashes[3]} {
+			_, err := cache.GetChunkData(hash)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, reads, backing.reads.Load())
+
+		_, err = cache.GetChunkData(hashes[1])
+		require.NoError(t, err)
+		assert.Equal(t, reads+1, backing.reads.Load())
+	})
+
+	t.Run("Test GetChunkData does not cache chunks larger than the cache", func(t *testing.T) {
+		cache, backing, hashes := setupCachedStorage(t, 50, testChunks(1, 100)...)
+
+		for i := 0; i < 2; i++ {
+			_, err := cache.GetChunkData(hashes[0])
+			require.NoError(t, err)
+		}
+
+		assert.Equal(t, int64(2), backing.reads.Load())
+		assert.Zero(t, cache.Stats().Entries)
+	})
+
+	t.Run("Test GetChunkData does not cache missing chunks", func(t *testing.T) {
+		cache, _, _ := setupCachedStorage(t, 1024)
+
+		_, err := cache.GetChunkData(hasher.CalculateChunkHash([]byte("missing")))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		assert.Zero(t, cache.Stats().Entries)
+	})
+}
+
+func TestDeleteChunk(t *testing.T) {
+	t.Run("Test DeleteChunk evicts the chunk", func(t *testing.T) {
+		cache, _, hashes := setupCachedStorage(t, 1024, testChunks(2, 100)...)
+
+		for _, hash := range hashes {
+			_, err := cache.GetChunkData(hash)
+			require.NoError(t, err)
+		}
+		require.NoError(t, cache.DeleteChunk(hashes[0]))
+
+		_, err := cache.GetChunkData(hashes[0])
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		stats := cache.Stats()
+		assert.Equal(t, 1, stats.Entries)
+		assert.Equal(t, int64(100), stats.Bytes)
+	})
+
+	t.Run("Test reads started before a deletion are not cached", func(t *testing.T) {
+		cache, _, hashes := setupCachedStorage(t, 1024, testChunks(1, 100)...)
+
+		_, deletes, ok := cache.get(hashes[0])
+		require.False(t, ok)
+		data, err := cache.FileSystem.GetChunkData(hashes[0])
+		require.NoError(t, err)
+		require.NoError(t, cache.DeleteChunk(hashes[0]))
+		cache.add(hashes[0], data, deletes)
+
+		_, err = cache.GetChunkData(hashes[0])
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("Test reads during a deletion are not cached", func(t *testing.T) {
+		_, backing, hashes := setupCachedStorage(t, 1024, testChunks(1, 100)...)
+		deleting := &deletingStorage{FileSystem: backing}
+		cache := NewCachedStorage(deleting, 1024)
+		deleting.beforeDelete = func() {
+			_, err := cache.GetChunkData(hashes[0])
+			require.NoError(t, err)
+		}
+
+		require.NoError(t, cache.DeleteChunk(hashes[0]))
+
+		_, err := cache.GetChunkData(hashes[0])
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		assert.Zero(t, cache.Stats().Entries)
+	})
+}
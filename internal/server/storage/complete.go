@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"sort"
+	"zerodupe/internal/server/model"
+	"zerodupe/pkg/hasher"
+)
+
+// ChunksHashToFile reports whether chunks at positions 1 to n make up the file identified by fileHash,
+// see hasher.VerifyFileHash
+func ChunksHashToFile(fileHash string, chunks []model.ChunkMetadata) bool {
+	if len(chunks) == 0 {
+		return false
+	}
+
+	sorted := append([]model.ChunkMetadata(nil), chunks...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ChunkOrder < sorted[j].ChunkOrder })
+	chunkHashes := make([]string, len(sorted))
+	for i, chunk := range sorted {
+		if chunk.ChunkOrder != i+1 {
+			return false
+		}
+		chunkHashes[i] = chunk.ChunkHash
+	}
+
+	return hasher.VerifyFileHash(fileHash, chunkHashes)
+}
+
+// UploadedChunksOf returns the chunks a user uploaded to a file as the file's chunk metadata
+func UploadedChunksOf(uploads []model.UploadedChunk) []model.ChunkMetadata {
+	chunks := make([]model.ChunkMetadata, len(uploads))
+	for i, upload := range uploads {
+		chunks[i] = model.ChunkMetadata{FileMetadataID: upload.FileMetadataID, ChunkOrder: upload.ChunkOrder, ChunkHash: upload.ChunkHash, Size: upload.Size}
+	}
+	return chunks
+}
+
+// CheckUploadedChunk returns ErrChunkConflict unless a chunk uploaded to a complete file is the
+// chunk the file has at its position
+func CheckUploadedChunk(chunks []model.ChunkMetadata, upload model.UploadedChunk) error {
+	for _, chunk := range chunks {
+		if chunk.ChunkOrder == upload.ChunkOrder {
+			return sameChunk(chunk, upload.ChunkHash)
+		}
+	}
+	return ErrFileComplete
+}
+
+// UploadedChunksCover reports whether a user uploaded the chunk at every position of a file.
+// Uploads recorded before their chunk hash was count for their position.
+func UploadedChunksCover(chunks []model.ChunkMetadata, uploads []model.UploadedChunk) bool {
+	uploaded := make(map[int]string, len(uploads))
+	for _, upload := range uploads {
+		uploaded[upload.ChunkOrder] = upload.ChunkHash
+	}
+	for _, chunk := range chunks {
+		chunkHash, ok := uploaded[chunk.ChunkOrder]
+		if !ok || (chunkHash != "" && !hasher.EqualHashes(chunkHash, chunk.ChunkHash)) {
+			return false
+		}
+	}
+	return true
+}
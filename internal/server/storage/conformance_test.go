@@ -0,0 +1,18 @@
+package storage_test
+
+import (
+	"testing"
+	"zerodupe/internal/server/storage"
+	"zerodupe/internal/server/storage/storagetest"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+)
+
+func TestGormDBConformance(t *testing.T) {
+	storagetest.TestDB(t, func(t *testing.T) storage.DB {
+		db, err := storage.NewGormStorage(sqlite.Open(":memory:"))
+		require.NoError(t, err)
+		return db
+	})
+}
@@ -1,21 +1,181 @@
 package storage
 
-import "zerodupe/internal/server/model"
+import (
+	"time"
+	"zerodupe/internal/server/model"
+)
 
 // DB defines the interface for db storage operations
 type DB interface {
 	// CreateUser creates a new user
 	CreateUser(user *model.User) error
 
-	// GetUserByUsername gets a user by username
+	// GetUserByUsername gets a user by username. It returns ErrUserNotFound when there is no such user.
 	GetUserByUsername(username string) (*model.User, error)
 
-	// SaveChunkMetadata saves chunk metadata
-	SaveChunkMetadata(fileHash, chunkHash string, chunkOrder int) error
+	// SetUserQuota sets the quota of a user. It returns ErrUserNotFound when there is no such user.
+	SetUserQuota(username string, quota model.Quota) error
+
+	// SaveChunkMetadata saves the metadata of a chunk of chunkSize bytes, creating the file metadata with the
+	// given chunker if needed. The chunk is accounted to every owner of the file. It returns ErrChunkConflict
+	// when another chunk is stored at the position and ErrFileComplete when a complete file has no chunk there.
+	SaveChunkMetadata(fileHash, chunkHash string, chunkOrder int, chunkSize int64, chunker string) error
+
+	// CompleteFile marks a file complete once its chunks are at positions 1 to totalChunks and hash to its
+	// file hash, and reports whether it is complete. A totalChunks of 0 checks the chunks stored so far.
+	// It returns ErrFileNotFound when there is no such file.
+	CompleteFile(fileHash string, totalChunks int) (bool, error)
+
+	// RecordUploadedChunk records that a user uploaded a chunk of chunkSize bytes at a position of a file and
+	// makes the user an owner once the file is complete and the user has uploaded every chunk of it. The chunks
+	// of an incomplete file are replaced by the user's once those hash to the file hash, so chunks stored first
+	// by someone else cannot keep it from completing. It reports whether the user owns the file. It returns
+	// ErrFileNotFound when there is no such file, and ErrChunkConflict or ErrFileComplete when a complete file
+	// has another chunk or none at the position.
+	RecordUploadedChunk(fileHash string, userID uint, chunkOrder int, chunkHash string, chunkSize int64) (bool, error)
+
+	// ExpireIncompleteFiles deletes the incomplete files without owners that nobody uploaded a chunk of since
+	// before, releasing their chunk references, and returns their hashes. A dry run deletes nothing.
+	ExpireIncompleteFiles(before time.Time, dryRun bool) ([]string, error)
+
+	// AddFileAlias records alias as another hash of a file, which every lookup of a file by hash accepts.
+	// It returns ErrFileNotFound when there is no such file.
+	AddFileAlias(fileHash, alias string) error
 
 	// GetFileMetadata gets file metadata
 	GetFileMetadata(fileHash string) (*model.FileMetadata, error)
 
 	// CheckChunkExists checks if chunks exist in metadata
 	CheckFileExists(fileHash string) (bool, error)
+
+	// SaveFileMetadata saves the metadata of a complete file with its chunks. The size of the file
+	// is the sum of the sizes of its chunks, and it is marked complete when they hash to its file hash.
+	SaveFileMetadata(metadata *model.FileMetadata) error
+
+	// SetFileInfo records the original name, content type and uploader of a file, keeping those it
+	// already has. It returns ErrFileNotFound when there is no such file.
+	SetFileInfo(fileHash, name, contentType, uploader string) error
+
+	// DeleteFileMetadata deletes a file with its chunk metadata, owners, uploaded chunks, grants, share links, paths and aliases and releases its chunk references.
+	// It returns ErrFileNotFound when there is no such file.
+	DeleteFileMetadata(fileHash string) error
+
+	// AddFileOwner makes a user an owner of a file and accounts the file to the user. Adding an owner
+	// again does nothing. It returns ErrFileNotFound when there is no such file.
+	AddFileOwner(fileHash string, userID uint) error
+
+	// CheckFileOwner checks if a user owns a file
+	CheckFileOwner(fileHash string, userID uint) (bool, error)
+
+	// RemoveFileOwner removes a user from the owners of a file, with the paths they saved it at, and releases
+	// the file from their usage. The file is deleted with its last owner, which the returned flag reports. It returns
+	// ErrFileNotFound when there is no such file or the user does not own it.
+	RemoveFileOwner(fileHash string, userID uint) (bool, error)
+
+	// CheckFileAccess checks if a user may read a file, which its owners and the users granted access may
+	CheckFileAccess(fileHash string, userID uint) (bool, error)
+
+	// CheckChunkAccess checks if a user may read a chunk, which they may when it belongs to a file they may read
+	CheckChunkAccess(chunkHash string, userID uint) (bool, error)
+
+	// GrantFileAccess gives a user read access to a file. Granting access again does nothing.
+	// It returns ErrFileNotFound when there is no such file.
+	GrantFileAccess(fileHash string, userID, grantedBy uint) error
+
+	// RevokeFileAccess takes back the read access granted to a user. It returns ErrGrantNotFound
+	// when the user has not been granted access to the file.
+	RevokeFileAccess(fileHash string, userID uint) error
+
+	// ListFileGrants returns the users granted access to a file, in the order they were granted it
+	ListFileGrants(fileHash string) ([]model.FileGrant, error)
+
+	// CreateShareLink saves a share link to a file. It returns ErrFileNotFound when there is no such file.
+	CreateShareLink(fileHash string, link *model.ShareLink) error
+
+	// GetShareLink returns the share link with a token, expired or not. It returns ErrShareLinkNotFound
+	// when there is none.
+	GetShareLink(token string) (*model.ShareLink, error)
+
+	// ListShareLinks returns the share links to a file, in the order they were created
+	ListShareLinks(fileHash string) ([]model.ShareLink, error)
+
+	// DeleteShareLink deletes a share link to a file. It returns ErrShareLinkNotFound when the file
+	// has no share link with the token.
+	DeleteShareLink(fileHash, token string) error
+
+	// CreateDirectory creates a directory at a clean, absolute path in the namespace of a user. It returns
+	// ErrPathExists when the path is taken and ErrParentNotFound when its parent is not a directory.
+	CreateDirectory(userID uint, dirPath string) (*model.PathEntry, error)
+
+	// SaveFilePath saves a file at a clean, absolute path in the namespace of a user, replacing the file
+	// saved there before. It returns ErrFileNotFound when there is no such file, ErrPathExists when the
+	// path is a directory and ErrParentNotFound when its parent is not a directory.
+	SaveFilePath(userID uint, filePath, fileHash string) (*model.PathEntry, error)
+
+	// GetPathEntry returns the entry at a path in the namespace of a user. It returns ErrPathNotFound
+	// when there is none.
+	GetPathEntry(userID uint, entryPath string) (*model.PathEntry, error)
+
+	// ListDirectory returns the entries of a directory of a user, directories first and then by path,
+	// "/" being the root. It returns ErrPathNotFound when there is no such directory and
+	// ErrNotDirectory when the path is a file.
+	ListDirectory(userID uint, dirPath string) ([]model.PathEntry, error)
+
+	// MovePath moves an entry of the namespace of a user, with the entries of a directory, to a path
+	// that must be free. It returns ErrPathNotFound when there is no entry to move, ErrPathExists when
+	// the new path is taken, ErrParentNotFound when its parent is not a directory and ErrInvalidMove
+	// when a directory would move into itself.
+	MovePath(userID uint, fromPath, toPath string) (*model.PathEntry, error)
+
+	// DeletePath removes an entry of the namespace of a user, and the entries of a directory when
+	// recursive, and returns how many entries were removed. The files saved at the paths are kept.
+	// It returns ErrPathNotFound when there is no such entry and ErrDirectoryNotEmpty when a
+	// directory has entries and recursive is not set.
+	DeletePath(userID uint, entryPath string, recursive bool) (int64, error)
+
+	// GetUsage returns the storage accounted to a user
+	GetUsage(userID uint) (*model.Usage, error)
+
+	// GetChunkRef returns the reference count, size and users of a chunk, or nil when no file references it
+	GetChunkRef(chunkHash string) (*model.ChunkRef, error)
+
+	// SetChunkSize records the size of a chunk in all chunk metadata referencing it and updates
+	// the sizes of the files with it
+	SetChunkSize(chunkHash string, size int64) error
+
+	// CheckChunkReferenced checks if any file references a chunk
+	CheckChunkReferenced(chunkHash string) (bool, error)
+
+	// MarkChunkDamaged marks every file referencing a chunk as damaged and returns their hashes
+	MarkChunkDamaged(chunkHash string) ([]string, error)
+
+	// ListDamagedFiles returns the hashes of all files marked as damaged
+	ListDamagedFiles() ([]string, error)
+
+	// GetStats returns the number of files and the distinct chunks, chunk bytes and logical bytes of
+	// all files, from the chunk reference counts
+	GetStats() (*model.Stats, error)
+
+	// ListSharedChunks returns up to limit chunks referenced more than once, most referenced first,
+	// among the chunks of the files of a user or of all files when userID is 0
+	ListSharedChunks(userID uint, limit int) ([]model.ChunkRef, error)
+
+	// ListReferencedChunks returns the canonical hashes of all chunks with a positive reference count
+	ListReferencedChunks() ([]string, error)
+
+	// ListUnsizedChunks returns the canonical hashes of the chunks that chunk metadata records no size for
+	ListUnsizedChunks() ([]string, error)
+
+	// HasFiles reports whether any file is stored
+	HasFiles() (bool, error)
+
+	// RebuildChunkRefs recomputes all chunk reference counts, the sizes and completeness of all files
+	// and the usage of all users from the chunk metadata and the file owners
+	RebuildChunkRefs() error
+
+	// CheckMigrationApplied checks if a data migration has been applied
+	CheckMigrationApplied(name string) (bool, error)
+
+	// SaveMigration records a data migration as applied
+	SaveMigration(name string) error
 }
@@ -0,0 +1,45 @@
+package storage
+
+import "errors"
+
+// ErrHashMismatch is returned when chunk content does not match the hash it is saved under
+var ErrHashMismatch = errors.New("chunk content does not match its hash")
+
+// ErrUserNotFound is returned when no user exists with a username
+var ErrUserNotFound = errors.New("user not found")
+
+// ErrFileNotFound is returned when no file metadata exists for a file hash
+var ErrFileNotFound = errors.New("file not found")
+
+// ErrCorruptChunk is returned when a stored chunk can no longer be decoded
+var ErrCorruptChunk = errors.New("stored chunk is corrupt")
+
+// ErrChunkConflict is returned when another chunk is already stored at a position of a file
+var ErrChunkConflict = errors.New("another chunk is stored at this position of the file")
+
+// ErrFileComplete is returned when adding a chunk to a file whose chunks already hash to its file hash
+var ErrFileComplete = errors.New("file is complete")
+
+// ErrGrantNotFound is returned when a user has not been granted access to a file
+var ErrGrantNotFound = errors.New("grant not found")
+
+// ErrShareLinkNotFound is returned when no share link exists for a token
+var ErrShareLinkNotFound = errors.New("share link not found")
+
+// ErrPathNotFound is returned when nothing exists at a path of the namespace of a user
+var ErrPathNotFound = errors.New("path not found")
+
+// ErrPathExists is returned when a path of the namespace of a user is already taken
+var ErrPathExists = errors.New("path already exists")
+
+// ErrParentNotFound is returned when the parent of a path is not a directory
+var ErrParentNotFound = errors.New("parent directory not found")
+
+// ErrNotDirectory is returned when a path that must be a directory is a file
+var ErrNotDirectory = errors.New("not a directory")
+
+// ErrDirectoryNotEmpty is returned when removing a directory with entries without removing them too
+var ErrDirectoryNotEmpty = errors.New("directory not empty")
+
+// ErrInvalidMove is returned when moving a directory into itself
+var ErrInvalidMove = errors.New("cannot move a directory into itself")
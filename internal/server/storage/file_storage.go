@@ -13,7 +13,7 @@ type FileStorage interface {
 	CheckChunkExists(hashes []string) ([]string, []string, error)
 
 	// SaveChunkMetadata saves chunk metadata
-	SaveChunkMetadata(fileHash, chunkHash string, chunkOrder int) error
+	SaveChunkMetadata(fileHash, chunkHash string, chunkOrder int, chunkSize int64, chunker string) error
 
 	// SaveChunkData saves chunk data
 	SaveChunkData(chunkHash string, content []byte) (string, error)
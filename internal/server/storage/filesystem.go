@@ -1,10 +1,15 @@
 package storage
 
+import "time"
+
+// ChunkInfo describes a stored chunk
+type ChunkInfo struct {
+	Size    int64     // bytes used on disk
+	ModTime time.Time // last time the chunk was written or reused
+}
+
 // FileSystem defines the interface for storage operations
 type FileSystem interface {
-	// CheckFileExists checks if a file exists
-	CheckFileExists(fileHash string) (bool, error)
-
 	// CheckChunkExists checks if chunks exist
 	CheckChunkExists(hashes []string) ([]string, []string, error)
 
@@ -13,4 +18,59 @@ type FileSystem interface {
 
 	// GetChunkData gets chunk data
 	GetChunkData(chunkHash string) ([]byte, error)
+
+	// ListChunks returns the hashes of all stored chunks
+	ListChunks() ([]string, error)
+
+	// StatChunk returns information about a stored chunk
+	StatChunk(chunkHash string) (ChunkInfo, error)
+
+	// TouchChunk marks a stored chunk as just used, so garbage collection treats it as new
+	TouchChunk(chunkHash string) error
+
+	// DeleteChunk deletes a stored chunk
+	DeleteChunk(chunkHash string) error
+}
+
+// Compactor is implemented by file systems that reclaim the space of deleted chunks in a separate step
+type Compactor interface {
+	// Compact reclaims the space of deleted chunks and returns the number of bytes reclaimed
+	Compact() (int64, error)
+}
+
+// Quarantiner is implemented by file systems that can set corrupt chunks aside for inspection
+type Quarantiner interface {
+	// QuarantineChunk moves a stored chunk whose content hashes to actualHash out of the store
+	QuarantineChunk(chunkHash, actualHash string) error
+}
+
+// Flusher is implemented by file systems that keep state in memory until they are flushed
+type Flusher interface {
+	// Flush writes the state kept in memory to disk
+	Flush() error
+}
+
+// Flush flushes the innermost file system of a chain of decorators if it is a Flusher
+func Flush(fileSystem FileSystem) error {
+	if flusher, ok := Unwrap(fileSystem).(Flusher); ok {
+		return flusher.Flush()
+	}
+	return nil
+}
+
+// Wrapper is implemented by file systems that decorate another file system
+type Wrapper interface {
+	// Unwrap returns the decorated file system
+	Unwrap() FileSystem
+}
+
+// Unwrap returns the innermost file system of a chain of decorators
+func Unwrap(fileSystem FileSystem) FileSystem {
+	for {
+		wrapper, ok := fileSystem.(Wrapper)
+		if !ok {
+			return fileSystem
+		}
+		fileSystem = wrapper.Unwrap()
+	}
 }
@@ -0,0 +1,129 @@
+package filesystem
+
+import (
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// tempSuffix marks files that are still being written. Temp files are hidden (dot prefixed)
+// so they are never mistaken for blocks, and leftovers from a crash are removed on startup.
+const tempSuffix = ".tmp"
+
+// blockWrite is an in-flight block write that concurrent writers of the same block wait for
+type blockWrite struct {
+	done chan struct{}
+	err  error
+}
+
+// WriteFileAtomic writes data to path so that path either does not exist or holds all of data,
+// even after a crash: the data is written to a temp file in the same directory, synced, renamed
+// into place and the directory is synced so the rename itself is durable.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) (err error) {
+	dir := filepath.Dir(path)
+	tempFile, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*"+tempSuffix)
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tempFile.Close()
+			os.Remove(tempFile.Name())
+		}
+	}()
+
+	if _, err := tempFile.Write(data); err != nil {
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := tempFile.Chmod(perm); err != nil {
+		return fmt.Errorf("failed to set temp file permissions: %w", err)
+	}
+	if err := tempFile.Sync(); err != nil {
+		return fmt.Errorf("failed to sync temp file: %w", err)
+	}
+	if err := tempFile.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+	if err := os.Rename(tempFile.Name(), path); err != nil {
+		return fmt.Errorf("failed to rename temp file: %w", err)
+	}
+
+	return syncDir(dir)
+}
+
+// syncDir flushes directory entries, such as a rename, to disk
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open directory: %w", err)
+	}
+	defer d.Close()
+
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync directory: %w", err)
+	}
+	return nil
+}
+
+// IsTempFile reports whether a file name belongs to a write that has not completed
+func IsTempFile(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, tempSuffix)
+}
+
+// coalesceWrite runs write unless a write with the same key is already in flight,
+// in which case it waits for that write and returns its result
+func (fs *FilesystemStorage) coalesceWrite(key string, write func() error) error {
+	fs.writesMu.Lock()
+	if inflight, ok := fs.writes[key]; ok {
+		fs.writesMu.Unlock()
+		<-inflight.done
+		return inflight.err
+	}
+
+	inflight := &blockWrite{done: make(chan struct{})}
+	fs.writes[key] = inflight
+	fs.writesMu.Unlock()
+
+	inflight.err = write()
+
+	fs.writesMu.Lock()
+	delete(fs.writes, key)
+	fs.writesMu.Unlock()
+	close(inflight.done)
+
+	return inflight.err
+}
+
+// sweepTempFiles removes temp files left behind by writes interrupted by a crash, in the storage
+// directory itself, in the block store and in the packs directory. It must run before the
+// storage accepts writes.
+func (fs *FilesystemStorage) sweepTempFiles() (int, error) {
+	blocksDir := filepath.Join(fs.storageDir, "blocks")
+	packsDir := filepath.Join(fs.storageDir, packsDirName)
+	removed := 0
+	err := filepath.WalkDir(fs.storageDir, func(path string, entry iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path == fs.storageDir || strings.HasPrefix(path, blocksDir) || path == packsDir {
+				return nil
+			}
+			return filepath.SkipDir
+		}
+		if !IsTempFile(entry.Name()) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	if err != nil {
+		return removed, fmt.Errorf("failed to remove temp files: %w", err)
+	}
+	return removed, nil
+}
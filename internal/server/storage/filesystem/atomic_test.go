@@ -0,0 +1,129 @@
+package filesystem
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"zerodupe/pkg/hasher"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	t.Run("Test WriteFileAtomic writes the file without leaving temp files", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "block")
+
+		require.NoError(t, WriteFileAtomic(path, []byte("test"), 0644))
+
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("test"), content)
+
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+}
+
+func TestConcurrentSaveChunkData(t *testing.T) {
+	t.Run("Test concurrent writers of the same chunk store it once", func(t *testing.T) {
+		storage, tempDir := setupFileSystemStorage(t)
+		defer teardownFileSystemStorage(t, tempDir)
+		require.NoError(t, storage.SetCompression(CompressionZstd))
+
+		content := bytes.Repeat([]byte("zerodupe "), 100*1024)
+		chunkHash := hasher.CalculateChunkHash(content)
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 20)
+		for range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := storage.SaveChunkData(chunkHash, content)
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			require.NoError(t, err)
+		}
+
+		assert.Equal(t, int64(1), storage.Stats().Blocks)
+		entries, err := os.ReadDir(filepath.Join(tempDir, "blocks", chunkHash[:4]))
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+
+		retrieved, err := storage.GetChunkData(chunkHash)
+		require.NoError(t, err)
+		assert.Equal(t, content, retrieved)
+	})
+
+	t.Run("Test a mismatched writer does not affect a concurrent valid writer", func(t *testing.T) {
+		storage, tempDir := setupFileSystemStorage(t)
+		defer teardownFileSystemStorage(t, tempDir)
+
+		content := []byte("test")
+		chunkHash := hasher.CalculateChunkHash(content)
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		var validErr, invalidErr error
+		go func() {
+			defer wg.Done()
+			_, validErr = storage.SaveChunkData(chunkHash, content)
+		}()
+		go func() {
+			defer wg.Done()
+			_, invalidErr = storage.SaveChunkData(chunkHash, []byte("evil"))
+		}()
+		wg.Wait()
+
+		require.NoError(t, validErr)
+		assert.Error(t, invalidErr)
+
+		retrieved, err := storage.GetChunkData(chunkHash)
+		require.NoError(t, err)
+		assert.Equal(t, content, retrieved)
+	})
+}
+
+func TestSweepTempFiles(t *testing.T) {
+	t.Run("Test NewFilesystemStorage removes temp files of interrupted writes", func(t *testing.T) {
+		storage, tempDir := setupFileSystemStorage(t)
+		defer teardownFileSystemStorage(t, tempDir)
+
+		content := []byte("test")
+		chunkHash := hasher.CalculateChunkHash(content)
+		_, err := storage.SaveChunkData(chunkHash, content)
+		require.NoError(t, err)
+
+		// a crash during a write leaves a truncated temp file behind
+		missingHash := hasher.CalculateChunkHash([]byte("missing"))
+		blockDir := filepath.Join(tempDir, "blocks", chunkHash[:4])
+		tempBlock := filepath.Join(blockDir, "."+missingHash+".12345"+tempSuffix)
+		require.NoError(t, os.WriteFile(tempBlock, []byte("tr"), 0644))
+		tempStats := filepath.Join(tempDir, "."+statsFileName+".12345"+tempSuffix)
+		require.NoError(t, os.WriteFile(tempStats, []byte("{"), 0644))
+
+		hashes, err := storage.ListChunks()
+		require.NoError(t, err)
+		assert.Equal(t, []string{chunkHash}, hashes)
+
+		_, missing, err := storage.CheckChunkExists([]string{missingHash})
+		require.NoError(t, err)
+		assert.Equal(t, []string{missingHash}, missing)
+
+		_, err = NewFilesystemStorage(tempDir)
+		require.NoError(t, err)
+		assert.NoFileExists(t, tempBlock)
+		assert.NoFileExists(t, tempStats)
+		assert.FileExists(t, filepath.Join(blockDir, chunkHash))
+	})
+}
@@ -0,0 +1,153 @@
+package filesystem
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+	"zerodupe/internal/server/storage"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Supported block codecs
+const (
+	CompressionNone = "none"
+	CompressionZstd = "zstd"
+	CompressionGzip = "gzip"
+)
+
+// DefaultCompression tries zstd first and falls back to gzip for chunks zstd does not shrink
+const DefaultCompression = CompressionZstd + "," + CompressionGzip
+
+// codec compresses blocks. The codec of a block is recorded as the extension of its file,
+// so blocks written before compression existed are read as uncompressed.
+type codec struct {
+	name       string
+	extension  string
+	compress   func(data []byte) ([]byte, error)
+	decompress func(data []byte) ([]byte, error)
+}
+
+var (
+	// zstd encoders and decoders are safe for concurrent EncodeAll/DecodeAll calls
+	zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+)
+
+var codecs = []codec{
+	{
+		name:      CompressionZstd,
+		extension: ".zst",
+		compress: func(data []byte) ([]byte, error) {
+			return zstdEncoder.EncodeAll(data, nil), nil
+		},
+		decompress: func(data []byte) ([]byte, error) {
+			return zstdDecoder.DecodeAll(data, nil)
+		},
+	},
+	{
+		name:      CompressionGzip,
+		extension: ".gz",
+		compress: func(data []byte) ([]byte, error) {
+			var buffer bytes.Buffer
+			writer := gzip.NewWriter(&buffer)
+			if _, err := writer.Write(data); err != nil {
+				return nil, err
+			}
+			if err := writer.Close(); err != nil {
+				return nil, err
+			}
+			return buffer.Bytes(), nil
+		},
+		decompress: func(data []byte) ([]byte, error) {
+			reader, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			defer reader.Close()
+			return io.ReadAll(reader)
+		},
+	},
+}
+
+// lookupCodec returns the codec with the given name
+func lookupCodec(name string) (codec, bool) {
+	for _, c := range codecs {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return codec{}, false
+}
+
+// parseCompression parses a comma separated list of codecs in order of preference.
+// An empty string or "none" disables compression.
+func parseCompression(compression string) ([]codec, error) {
+	compression = strings.TrimSpace(compression)
+	if compression == "" || compression == CompressionNone {
+		return nil, nil
+	}
+
+	var selected []codec
+	for _, name := range strings.Split(compression, ",") {
+		c, ok := lookupCodec(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("unknown compression %q", name)
+		}
+		selected = append(selected, c)
+	}
+	return selected, nil
+}
+
+// compressBlock compresses content with the first codec that shrinks it.
+// It returns the content unchanged and an empty extension when no codec helps.
+func compressBlock(content []byte, preferred []codec) ([]byte, string, error) {
+	for _, c := range preferred {
+		compressed, err := c.compress(content)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to compress block with %s: %w", c.name, err)
+		}
+		if len(compressed) < len(content) {
+			return compressed, c.extension, nil
+		}
+	}
+	return content, "", nil
+}
+
+// decompressBlock decompresses a block stored with the codec of the given file extension
+func decompressBlock(data []byte, extension string) ([]byte, error) {
+	if extension == "" {
+		return data, nil
+	}
+	for _, c := range codecs {
+		if c.extension == extension {
+			content, err := c.decompress(data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decompress %s block: %w: %w", c.name, storage.ErrCorruptChunk, err)
+			}
+			return content, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown block extension %q", extension)
+}
+
+// blockExtensions lists the extensions a block file can have, uncompressed first
+func blockExtensions() []string {
+	extensions := []string{""}
+	for _, c := range codecs {
+		extensions = append(extensions, c.extension)
+	}
+	return extensions
+}
+
+// splitBlockName splits a block file name into the chunk hash and the codec extension
+func splitBlockName(name string) (string, string) {
+	for _, c := range codecs {
+		if hash, found := strings.CutSuffix(name, c.extension); found {
+			return hash, c.extension
+		}
+	}
+	return name, ""
+}
@@ -0,0 +1,109 @@
+package filesystem
+
+import (
+	"bytes"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"zerodupe/pkg/hasher"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetCompression(t *testing.T) {
+	t.Run("Test SetCompression accepts codec lists", func(t *testing.T) {
+		storage, tempDir := setupFileSystemStorage(t)
+		defer teardownFileSystemStorage(t, tempDir)
+
+		for _, compression := range []string{"", CompressionNone, CompressionZstd, CompressionGzip, DefaultCompression} {
+			assert.NoError(t, storage.SetCompression(compression), compression)
+		}
+	})
+
+	t.Run("Test SetCompression rejects unknown codecs", func(t *testing.T) {
+		storage, tempDir := setupFileSystemStorage(t)
+		defer teardownFileSystemStorage(t, tempDir)
+
+		assert.Error(t, storage.SetCompression("zstd,lz4"))
+	})
+}
+
+func TestCompressedChunks(t *testing.T) {
+	compressible := bytes.Repeat([]byte("zerodupe "), 10*1024)
+
+	for _, compression := range []struct {
+		name      string
+		extension string
+	}{
+		{CompressionZstd, ".zst"},
+		{CompressionGzip, ".gz"},
+	} {
+		t.Run("Test SaveChunkData compresses chunks with "+compression.name, func(t *testing.T) {
+			storage, tempDir := setupFileSystemStorage(t)
+			defer teardownFileSystemStorage(t, tempDir)
+			require.NoError(t, storage.SetCompression(compression.name))
+
+			chunkHash := hasher.CalculateChunkHash(compressible)
+			calculatedHash, err := storage.SaveChunkData(chunkHash, compressible)
+			require.NoError(t, err)
+			assert.Equal(t, chunkHash, calculatedHash)
+
+			blockPath := filepath.Join(tempDir, "blocks", chunkHash[:4], chunkHash+compression.extension)
+			info, err := os.Stat(blockPath)
+			require.NoError(t, err)
+			assert.Less(t, info.Size(), int64(len(compressible)))
+
+			existing, missing, err := storage.CheckChunkExists([]string{chunkHash})
+			require.NoError(t, err)
+			assert.Equal(t, []string{chunkHash}, existing)
+			assert.Empty(t, missing)
+
+			content, err := storage.GetChunkData(chunkHash)
+			require.NoError(t, err)
+			assert.Equal(t, compressible, content)
+
+			hashes, err := storage.ListChunks()
+			require.NoError(t, err)
+			assert.Equal(t, []string{chunkHash}, hashes)
+		})
+	}
+
+	t.Run("Test SaveChunkData stores incompressible chunks uncompressed", func(t *testing.T) {
+		storage, tempDir := setupFileSystemStorage(t)
+		defer teardownFileSystemStorage(t, tempDir)
+		require.NoError(t, storage.SetCompression(DefaultCompression))
+
+		random := make([]byte, 64*1024)
+		_, err := rand.Read(random)
+		require.NoError(t, err)
+
+		chunkHash := hasher.CalculateChunkHash(random)
+		_, err = storage.SaveChunkData(chunkHash, random)
+		require.NoError(t, err)
+		assert.FileExists(t, filepath.Join(tempDir, "blocks", chunkHash[:4], chunkHash))
+
+		content, err := storage.GetChunkData(chunkHash)
+		require.NoError(t, err)
+		assert.Equal(t, random, content)
+	})
+
+	t.Run("Test compressed chunks are not stored twice", func(t *testing.T) {
+		storage, tempDir := setupFileSystemStorage(t)
+		defer teardownFileSystemStorage(t, tempDir)
+		require.NoError(t, storage.SetCompression(CompressionGzip))
+
+		chunkHash := hasher.CalculateChunkHash(compressible)
+		_, err := storage.SaveChunkData(chunkHash, compressible)
+		require.NoError(t, err)
+
+		// a different codec must still find the existing block
+		require.NoError(t, storage.SetCompression(CompressionZstd))
+		_, err = storage.SaveChunkData(chunkHash, compressible)
+		require.NoError(t, err)
+
+		assert.NoFileExists(t, filepath.Join(tempDir, "blocks", chunkHash[:4], chunkHash+".zst"))
+		assert.Equal(t, int64(1), storage.Stats().Blocks)
+	})
+}
@@ -0,0 +1,31 @@
+package filesystem
+
+import (
+	"testing"
+	serverstorage "zerodupe/internal/server/storage"
+	"zerodupe/internal/server/storage/storagetest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilesystemStorageConformance(t *testing.T) {
+	for _, layout := range []string{LayoutLoose, LayoutPack} {
+		t.Run("Test "+layout+" layout", func(t *testing.T) {
+			storagetest.TestFileSystem(t, func(t *testing.T) serverstorage.FileSystem {
+				storage, err := NewFilesystemStorage(t.TempDir())
+				require.NoError(t, err)
+				require.NoError(t, storage.SetLayout(layout))
+				return storage
+			})
+		})
+	}
+
+	t.Run("Test compressed blocks", func(t *testing.T) {
+		storagetest.TestFileSystem(t, func(t *testing.T) serverstorage.FileSystem {
+			storage, err := NewFilesystemStorage(t.TempDir())
+			require.NoError(t, err)
+			require.NoError(t, storage.SetCompression(DefaultCompression))
+			return storage
+		})
+	})
+}
@@ -1,9 +1,13 @@
 package filesystem
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
+	"zerodupe/internal/server/storage"
 	"zerodupe/pkg/hasher"
 
 	"github.com/rs/zerolog/log"
@@ -11,7 +15,17 @@ import (
 
 // FilesystemStorage implements the Storage interface using the filesystem
 type FilesystemStorage struct {
-	storageDir string
+	storageDir  string
+	compression []codec
+	quarantine  bool
+	layout      string
+	packs       *packStore
+
+	statsMu sync.Mutex
+	stats   BlockStats
+
+	writesMu sync.Mutex
+	writes   map[string]*blockWrite
 }
 
 // NewFilesystemStorage creates a new filesystem storage
@@ -28,22 +42,98 @@ func NewFilesystemStorage(storageDir string) (*FilesystemStorage, error) {
 		}
 	}
 
-	return &FilesystemStorage{
+	fs := &FilesystemStorage{
 		storageDir: storageDir,
-	}, nil
+		layout:     LayoutLoose,
+		writes:     make(map[string]*blockWrite),
+	}
+
+	removed, err := fs.sweepTempFiles()
+	if err != nil {
+		return nil, err
+	}
+	if removed > 0 {
+		log.Info().Int("files", removed).Msg("Removed temp files of interrupted writes")
+	}
+
+	packs, err := openPackStore(filepath.Join(storageDir, packsDirName), DefaultMaxPackSize)
+	if err != nil {
+		return nil, err
+	}
+	fs.packs = packs
+
+	if err := fs.loadStats(); err != nil {
+		return nil, err
+	}
+
+	return fs, nil
 }
 
-// CheckFileExists checks if a file exists in meta or blocks directory
-func (fs *FilesystemStorage) CheckFileExists(fileHash string) (bool, error) {
-	// check if it's a single chunk file
-	blockPath := filepath.Join(fs.storageDir, "blocks", fileHash[:4], fileHash)
-	if _, err := os.Stat(blockPath); err == nil {
-		return true, nil
-	} else if !os.IsNotExist(err) {
-		return false, err
+// SetCompression sets the codecs tried, in order, when saving a chunk as a comma separated list
+// such as "zstd,gzip". Each chunk is stored with the first codec that shrinks it, or uncompressed.
+// An empty string or "none" disables compression.
+func (fs *FilesystemStorage) SetCompression(compression string) error {
+	selected, err := parseCompression(compression)
+	if err != nil {
+		return err
+	}
+	fs.compression = selected
+	return nil
+}
+
+// ListChunks returns the hashes of all stored chunks, loose or packed
+func (fs *FilesystemStorage) ListChunks() ([]string, error) {
+	hashes, err := fs.listLooseBlocks()
+	if err != nil {
+		return nil, err
+	}
+
+	loose := make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		loose[hash] = true
+	}
+	for _, key := range fs.packs.keys() {
+		if !loose[key] {
+			hashes = append(hashes, key)
+		}
+	}
+	return hashes, nil
+}
+
+// listLooseBlocks returns the hashes of the chunks stored as loose blocks
+func (fs *FilesystemStorage) listLooseBlocks() ([]string, error) {
+	blocksDir := filepath.Join(fs.storageDir, "blocks")
+	entries, err := os.ReadDir(blocksDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blocks: %w", err)
 	}
 
-	return false, nil
+	var hashes []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		// blocks of algorithms other than SHA-256 are nested one level deeper
+		if _, err := hasher.LookupAlgorithm(entry.Name()); err == nil {
+			algorithmHashes, err := listBlocks(filepath.Join(blocksDir, entry.Name()))
+			if err != nil {
+				return nil, err
+			}
+			for _, digest := range algorithmHashes {
+				hashes = append(hashes, hasher.FormatHash(entry.Name(), digest))
+			}
+			continue
+		}
+
+		prefixHashes, err := listBlockDir(filepath.Join(blocksDir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, prefixHashes...)
+	}
+
+	return hashes, nil
 }
 
 // CheckChunkExists checks if chunks exist
@@ -52,66 +142,398 @@ func (fs *FilesystemStorage) CheckChunkExists(hashes []string) ([]string, []stri
 	var missingChunks []string
 
 	for _, hash := range hashes {
-		blockPath := filepath.Join(fs.storageDir, "blocks", hash[:4], hash)
-
-		_, err := os.Stat(blockPath)
+		exists, err := fs.chunkExists(hash)
 		if err != nil {
-			if os.IsNotExist(err) {
-				missingChunks = append(missingChunks, hash)
-			} else {
-				return nil, nil, err
-			}
-		} else {
+			return nil, nil, err
+		}
+		if exists {
 			existingChunks = append(existingChunks, hash)
+		} else {
+			missingChunks = append(missingChunks, hash)
 		}
 	}
 
 	return existingChunks, missingChunks, nil
 }
 
-// SaveChunkData saves chunk data
+// SaveChunkData saves chunk data, compressed with the configured codecs when that saves space.
+// The chunk is identified by the hash of its uncompressed content; content that does not match
+// chunkHash is rejected with storage.ErrHashMismatch.
 func (fs *FilesystemStorage) SaveChunkData(chunkHash string, content []byte) (string, error) {
-	// Ensure directory exists
-	blockDir := filepath.Join(fs.storageDir, "blocks", chunkHash[:4])
-	if err := os.MkdirAll(blockDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create block directory: %w", err)
-	}
-
-	blockPath := filepath.Join(blockDir, chunkHash)
-
-	// Check if chunk already exists
-	if _, err := os.Stat(blockPath); err == nil {
-		return chunkHash, nil
-	} else if !os.IsNotExist(err) {
-		return "", fmt.Errorf("failed to check if chunk exists: %w", err)
+	blockPath, err := fs.blockPath(chunkHash)
+	if err != nil {
+		return "", err
 	}
 
-	// Verify chunk hash
+	// Verify chunk hash, content that does not match is never stored under the claimed hash
 	isValid, calculatedHash := hasher.VerifyChunkHash(content, chunkHash)
 	if !isValid {
 		log.Warn().Msgf("Hash mismatch. Expected: %s, Got: %s", chunkHash, calculatedHash)
+		if fs.quarantine {
+			if err := fs.quarantineChunk(QuarantineRecord{ClaimedHash: chunkHash, ActualHash: calculatedHash, Reason: QuarantineUpload}, content); err != nil {
+				log.Error().Err(err).Msg("Failed to quarantine chunk")
+			}
+		}
+		return calculatedHash, fmt.Errorf("%w: expected %s, got %s", storage.ErrHashMismatch, chunkHash, calculatedHash)
 	}
 
-	// Write chunk data
-	if err := os.WriteFile(blockPath, content, 0644); err != nil {
-		return calculatedHash, fmt.Errorf("failed to write chunk data: %w", err)
+	// Check if chunk already exists, reusing it renews it for garbage collection
+	if exists, err := fs.chunkExists(chunkHash); err != nil {
+		return "", fmt.Errorf("failed to check if chunk exists: %w", err)
+	} else if exists {
+		if err := fs.TouchChunk(chunkHash); err != nil {
+			return "", err
+		}
+		return chunkHash, nil
+	}
+
+	// concurrent uploads of the same chunk share a single write
+	if fs.layout == LayoutPack {
+		key, err := fs.packKey(chunkHash)
+		if err != nil {
+			return "", err
+		}
+		err = fs.coalesceWrite(fs.packWriteKey(key), func() error {
+			return fs.writePackedBlock(key, content)
+		})
+	} else {
+		err = fs.coalesceWrite(blockPath, func() error {
+			return fs.writeBlock(chunkHash, blockPath, content)
+		})
+	}
+	if err != nil {
+		return calculatedHash, err
 	}
 
 	return calculatedHash, nil
 }
 
-// GetChunkData gets chunk data
-func (fs *FilesystemStorage) GetChunkData(chunkHash string) ([]byte, error) {
-	blockPath := filepath.Join(fs.storageDir, "blocks", chunkHash[:4], chunkHash)
+// writeBlock compresses and atomically writes a verified chunk, unless it was written meanwhile
+func (fs *FilesystemStorage) writeBlock(chunkHash, blockPath string, content []byte) error {
+	if exists, err := fs.chunkExists(chunkHash); err != nil {
+		return fmt.Errorf("failed to check if chunk exists: %w", err)
+	} else if exists {
+		return nil
+	}
 
-	if _, err := os.Stat(blockPath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("chunk not found: %w", err)
+	data, extension, err := compressBlock(content, fs.compression)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(blockPath), 0755); err != nil {
+		return fmt.Errorf("failed to create block directory: %w", err)
+	}
+	if err := WriteFileAtomic(blockPath+extension, data, 0644); err != nil {
+		return fmt.Errorf("failed to write chunk data: %w", err)
+	}
+
+	fs.updateBlockStats(1, len(content), len(data), extension != "")
+	return nil
+}
+
+// writePackedBlock compresses and packs a verified chunk, unless it was packed meanwhile
+func (fs *FilesystemStorage) writePackedBlock(key string, content []byte) error {
+	if _, ok := fs.packs.lookup(key); ok {
+		return nil
 	}
 
-	content, err := os.ReadFile(blockPath)
+	data, extension, err := compressBlock(content, fs.compression)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read chunk data: %w", err)
+		return err
+	}
+
+	if err := fs.packs.append(key, extension, data, int64(len(content)), time.Now()); err != nil {
+		return fmt.Errorf("failed to write chunk data: %w", err)
+	}
+
+	fs.updateBlockStats(1, len(content), len(data), extension != "")
+	return nil
+}
+
+// GetChunkData gets chunk data, decompressing it if it was stored compressed
+func (fs *FilesystemStorage) GetChunkData(chunkHash string) ([]byte, error) {
+	data, extension, err := fs.readBlock(chunkHash)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := decompressBlock(data, extension)
+	if err != nil {
+		return nil, err
 	}
 	log.Debug().Msgf("Read chunk %s, size: %d bytes", chunkHash, len(content))
 	return content, nil
 }
+
+// readBlock reads the block of a chunk as stored, from its pack or its loose file, and
+// returns it with the extension of its codec
+func (fs *FilesystemStorage) readBlock(chunkHash string) ([]byte, string, error) {
+	key, err := fs.packKey(chunkHash)
+	if err != nil {
+		return nil, "", err
+	}
+
+	data, entry, packed, err := fs.packs.read(key)
+	if err != nil {
+		return nil, "", err
+	}
+	if packed {
+		return data, entry.Extension, nil
+	}
+
+	blockPath, extension, err := fs.findBlock(chunkHash)
+	if os.IsNotExist(err) {
+		return nil, "", fmt.Errorf("chunk not found: %w", err)
+	} else if err != nil {
+		return nil, "", err
+	}
+
+	data, err = os.ReadFile(blockPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read chunk data: %w", err)
+	}
+	return data, extension, nil
+}
+
+// StatChunk returns the size on disk and modification time of a stored chunk
+func (fs *FilesystemStorage) StatChunk(chunkHash string) (storage.ChunkInfo, error) {
+	key, err := fs.packKey(chunkHash)
+	if err != nil {
+		return storage.ChunkInfo{}, err
+	}
+	if entry, ok := fs.packs.lookup(key); ok {
+		return storage.ChunkInfo{Size: entry.Length, ModTime: entry.ModTime}, nil
+	}
+
+	blockPath, _, err := fs.findBlock(chunkHash)
+	if err != nil {
+		return storage.ChunkInfo{}, err
+	}
+
+	info, err := os.Stat(blockPath)
+	if err != nil {
+		return storage.ChunkInfo{}, err
+	}
+	return storage.ChunkInfo{Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// TouchChunk sets the modification time of a stored chunk to now
+func (fs *FilesystemStorage) TouchChunk(chunkHash string) error {
+	key, err := fs.packKey(chunkHash)
+	if err != nil {
+		return err
+	}
+	if packed, err := fs.packs.touch(key); packed {
+		return err
+	}
+
+	blockPath, _, err := fs.findBlock(chunkHash)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := os.Chtimes(blockPath, now, now); err != nil {
+		return fmt.Errorf("failed to touch chunk: %w", err)
+	}
+	return nil
+}
+
+// DeleteChunk deletes a stored chunk. Chunks that are being written cannot be deleted.
+// The space of packed chunks is reclaimed by Compact.
+func (fs *FilesystemStorage) DeleteChunk(chunkHash string) error {
+	key, err := fs.packKey(chunkHash)
+	if err != nil {
+		return err
+	}
+	blockPath, err := fs.blockPath(chunkHash)
+	if err != nil {
+		return err
+	}
+
+	fs.writesMu.Lock()
+	defer fs.writesMu.Unlock()
+	if _, ok := fs.writes[blockPath]; ok {
+		return fmt.Errorf("chunk %s is being written", chunkHash)
+	}
+	if _, ok := fs.writes[fs.packWriteKey(key)]; ok {
+		return fmt.Errorf("chunk %s is being written", chunkHash)
+	}
+
+	entry, packed, err := fs.packs.remove(key)
+	if err != nil {
+		return fmt.Errorf("failed to delete chunk: %w", err)
+	}
+	if packed {
+		fs.updateBlockStats(-1, int(entry.Size), int(entry.Length), entry.Extension != "")
+	}
+
+	// a chunk being migrated between layouts can be both packed and loose
+	err = fs.deleteLooseBlock(chunkHash)
+	if packed && os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// deleteLooseBlock deletes the loose block of a chunk. The caller must hold writesMu.
+func (fs *FilesystemStorage) deleteLooseBlock(chunkHash string) error {
+	blockPath, extension, err := fs.findBlock(chunkHash)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(blockPath)
+	if err != nil {
+		return fmt.Errorf("failed to read chunk data: %w", err)
+	}
+	// the stats count the uncompressed size, which a corrupt block being quarantined no longer has
+	size := len(data)
+	if content, err := decompressBlock(data, extension); err == nil {
+		size = len(content)
+	} else if !errors.Is(err, storage.ErrCorruptChunk) {
+		return err
+	}
+
+	if err := os.Remove(blockPath); err != nil {
+		return fmt.Errorf("failed to delete chunk: %w", err)
+	}
+	if err := syncDir(filepath.Dir(blockPath)); err != nil {
+		return err
+	}
+
+	fs.updateBlockStats(-1, size, len(data), extension != "")
+	return nil
+}
+
+// chunkExists reports whether a chunk is stored, loose or packed
+func (fs *FilesystemStorage) chunkExists(hash string) (bool, error) {
+	key, err := fs.packKey(hash)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := fs.packs.lookup(key); ok {
+		return true, nil
+	}
+
+	if _, _, err := fs.findBlock(hash); err == nil {
+		return true, nil
+	} else if os.IsNotExist(err) {
+		return false, nil
+	} else {
+		return false, err
+	}
+}
+
+// findBlock returns the path and codec extension of the block stored under hash.
+// It returns the not exist error of the uncompressed path when there is no such block.
+func (fs *FilesystemStorage) findBlock(hash string) (string, string, error) {
+	blockPath, err := fs.blockPath(hash)
+	if err != nil {
+		return "", "", err
+	}
+
+	var notExist error
+	for _, extension := range blockExtensions() {
+		_, err := os.Stat(blockPath + extension)
+		if err == nil {
+			return blockPath + extension, extension, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", "", err
+		}
+		if notExist == nil {
+			notExist = err
+		}
+	}
+	return "", "", notExist
+}
+
+// blockPath returns the path of the block stored under hash.
+// SHA-256 blocks keep the legacy layout blocks/<digest[:4]>/<digest> whether or not the hash
+// carries its algorithm prefix; other algorithms live under blocks/<algorithm>/.
+func (fs *FilesystemStorage) blockPath(hash string) (string, error) {
+	name, err := BlockName(hash)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(fs.storageDir, "blocks", name), nil
+}
+
+// BlockName returns the path of the block stored under hash relative to the block store, laid
+// out as described for blockPath. Stores reusing the layout, such as shard directories, name
+// their files with it.
+func BlockName(hash string) (string, error) {
+	algorithm, digest, err := hasher.ParseHash(hash)
+	if err != nil {
+		return "", err
+	}
+	if algorithm == hasher.SHA256 {
+		return filepath.Join(digest[:4], digest), nil
+	}
+	return filepath.Join(algorithm, digest[:4], digest), nil
+}
+
+// packKey returns the key of a chunk in the pack index, which is the name ListChunks reports
+// for it: the bare digest for SHA-256 chunks and the prefixed hash for other algorithms
+func (fs *FilesystemStorage) packKey(hash string) (string, error) {
+	if _, err := fs.blockPath(hash); err != nil {
+		return "", err
+	}
+	if hasher.IsLegacyHash(hash) {
+		return hash, nil
+	}
+
+	algorithm, digest, err := hasher.ParseHash(hash)
+	if err != nil {
+		return "", err
+	}
+	if algorithm == hasher.SHA256 {
+		return digest, nil
+	}
+	return hasher.FormatHash(algorithm, digest), nil
+}
+
+// packWriteKey returns the key that coalesces concurrent writes of a packed chunk
+func (fs *FilesystemStorage) packWriteKey(key string) string {
+	return filepath.Join(fs.packs.dir, key)
+}
+
+// listBlocks returns the names of the blocks in all prefix directories of dir
+func listBlocks(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blocks: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		prefixNames, err := listBlockDir(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, prefixNames...)
+	}
+	return names, nil
+}
+
+// listBlockDir returns the names of the blocks in a single prefix directory
+func listBlockDir(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blocks: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && !IsTempFile(entry.Name()) {
+			name, _ := splitBlockName(entry.Name())
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
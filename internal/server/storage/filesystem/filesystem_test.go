@@ -1,9 +1,13 @@
 package filesystem
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+	serverstorage "zerodupe/internal/server/storage"
 	"zerodupe/pkg/hasher"
 
 	"github.com/stretchr/testify/assert"
@@ -60,37 +64,33 @@ func TestNewFilesystemStorage(t *testing.T) {
 	})
 }
 
-func TestCheckFileExists(t *testing.T) {
+func TestListChunks(t *testing.T) {
 
-	t.Run("Test CheckFileExists for existing file in blocks directory", func(t *testing.T) {
+	t.Run("Test ListChunks returns chunks of all algorithms", func(t *testing.T) {
 		storage, tempDir := setupFileSystemStorage(t)
 		defer teardownFileSystemStorage(t, tempDir)
 
-		fileHash := "abcdtest567890"
-		blockDir := filepath.Join(tempDir, "blocks", fileHash[:4])
-		err := os.MkdirAll(blockDir, 0755)
+		legacyHash := hasher.CalculateChunkHash([]byte("legacy"))
+		_, err := storage.SaveChunkData(legacyHash, []byte("legacy"))
 		require.NoError(t, err)
 
-		blockPath := filepath.Join(blockDir, fileHash)
-		err = os.WriteFile(blockPath, []byte("test"), 0644)
+		blake3Hash, err := hasher.Sum(hasher.BLAKE3, []byte("blake3"))
 		require.NoError(t, err)
-
-		exists, err := storage.CheckFileExists(fileHash)
+		_, err = storage.SaveChunkData(blake3Hash, []byte("blake3"))
 		require.NoError(t, err)
-		assert.True(t, exists)
-		assert.Equal(t, fileHash, fileHash)
 
+		hashes, err := storage.ListChunks()
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{legacyHash, blake3Hash}, hashes)
 	})
 
-	t.Run("Test CheckFileExists for non-existing file in blocks directory", func(t *testing.T) {
+	t.Run("Test ListChunks for empty storage", func(t *testing.T) {
 		storage, tempDir := setupFileSystemStorage(t)
 		defer teardownFileSystemStorage(t, tempDir)
 
-		fileHash := "abcdtest567890"
-		exists, err := storage.CheckFileExists(fileHash)
+		hashes, err := storage.ListChunks()
 		require.NoError(t, err)
-		assert.False(t, exists)
-
+		assert.Empty(t, hashes)
 	})
 
 }
@@ -101,7 +101,7 @@ func TestCheckChunkExists(t *testing.T) {
 		storage, tempDir := setupFileSystemStorage(t)
 		defer teardownFileSystemStorage(t, tempDir)
 
-		chunkHash := "abcdtest567890"
+		chunkHash := hasher.CalculateChunkHash([]byte("missing"))
 		blockDir := filepath.Join(tempDir, "blocks", chunkHash[:4])
 		err := os.MkdirAll(blockDir, 0755)
 		require.NoError(t, err)
@@ -121,7 +121,7 @@ func TestCheckChunkExists(t *testing.T) {
 		storage, tempDir := setupFileSystemStorage(t)
 		defer teardownFileSystemStorage(t, tempDir)
 
-		chunkHash := "abcdtest567890"
+		chunkHash := hasher.CalculateChunkHash([]byte("missing"))
 		existing, missing, err := storage.CheckChunkExists([]string{chunkHash})
 		require.NoError(t, err)
 		assert.Equal(t, 0, len(existing))
@@ -132,9 +132,9 @@ func TestCheckChunkExists(t *testing.T) {
 		storage, tempDir := setupFileSystemStorage(t)
 		defer teardownFileSystemStorage(t, tempDir)
 
-		chunkHash1 := "abcdtest567890"
-		chunkHash2 := "efghijklmnop"
-		chunkHash3 := "qrstuvwxyz12"
+		chunkHash1 := hasher.CalculateChunkHash([]byte("first"))
+		chunkHash2 := hasher.CalculateChunkHash([]byte("second"))
+		chunkHash3 := hasher.CalculateChunkHash([]byte("third"))
 
 		blockDir1 := filepath.Join(tempDir, "blocks", chunkHash1[:4])
 		err := os.MkdirAll(blockDir1, 0755)
@@ -210,20 +210,95 @@ func TestSaveChunkData(t *testing.T) {
 		defer teardownFileSystemStorage(t, tempDir)
 
 		content := []byte("test")
-		incorrectHash := "incorrectHash"
+		incorrectHash := hasher.CalculateChunkHash([]byte("other"))
 
 		calculatedHash, err := storage.SaveChunkData(incorrectHash, content)
 
-		require.NoError(t, err)
-		assert.NotEqual(t, incorrectHash, calculatedHash)
+		require.ErrorIs(t, err, serverstorage.ErrHashMismatch)
+		assert.Equal(t, hasher.CalculateChunkHash(content), calculatedHash)
 
 		blockPath := filepath.Join(tempDir, "blocks", incorrectHash[:4], incorrectHash)
-		assert.FileExists(t, blockPath)
+		assert.NoFileExists(t, blockPath)
+		assert.NoDirExists(t, filepath.Join(tempDir, quarantineDirName))
 
-		content, err = os.ReadFile(blockPath)
+	})
+
+	t.Run("Test SaveChunkData quarantines mismatched chunks", func(t *testing.T) {
+		storage, tempDir := setupFileSystemStorage(t)
+		defer teardownFileSystemStorage(t, tempDir)
+		storage.SetQuarantine(true)
+
+		content := []byte("test")
+		claimedHash := hasher.CalculateChunkHash([]byte("other"))
+
+		_, err := storage.SaveChunkData(claimedHash, content)
+		require.ErrorIs(t, err, serverstorage.ErrHashMismatch)
+
+		_, err = storage.GetChunkData(claimedHash)
+		assert.Error(t, err)
+
+		payloads, err := filepath.Glob(filepath.Join(tempDir, quarantineDirName, "*.bin"))
 		require.NoError(t, err)
-		assert.Equal(t, content, []byte("test"))
+		require.Len(t, payloads, 1)
+		quarantined, err := os.ReadFile(payloads[0])
+		require.NoError(t, err)
+		assert.Equal(t, content, quarantined)
+
+		data, err := os.ReadFile(strings.TrimSuffix(payloads[0], ".bin") + ".json")
+		require.NoError(t, err)
+		var record QuarantineRecord
+		require.NoError(t, json.Unmarshal(data, &record))
+		assert.Equal(t, claimedHash, record.ClaimedHash)
+		assert.Equal(t, hasher.CalculateChunkHash(content), record.ActualHash)
+		assert.Equal(t, len(content), record.Size)
+	})
+
+	t.Run("Test SaveChunkData stores prefixed SHA-256 hashes in the legacy layout", func(t *testing.T) {
+		storage, tempDir := setupFileSystemStorage(t)
+		defer teardownFileSystemStorage(t, tempDir)
+
+		content := []byte("test")
+		legacyHash := hasher.CalculateChunkHash(content)
+		chunkHash := "sha256:" + legacyHash
+
+		calculatedHash, err := storage.SaveChunkData(chunkHash, content)
+		require.NoError(t, err)
+		assert.Equal(t, chunkHash, calculatedHash)
+		assert.FileExists(t, filepath.Join(tempDir, "blocks", legacyHash[:4], legacyHash))
+
+		existing, _, err := storage.CheckChunkExists([]string{legacyHash})
+		require.NoError(t, err)
+		assert.Equal(t, []string{legacyHash}, existing)
+	})
+
+	t.Run("Test SaveChunkData stores other algorithms under their own directory", func(t *testing.T) {
+		storage, tempDir := setupFileSystemStorage(t)
+		defer teardownFileSystemStorage(t, tempDir)
+
+		content := []byte("test")
+		chunkHash, err := hasher.Sum(hasher.BLAKE3, content)
+		require.NoError(t, err)
+		_, digest, err := hasher.ParseHash(chunkHash)
+		require.NoError(t, err)
+
+		calculatedHash, err := storage.SaveChunkData(chunkHash, content)
+		require.NoError(t, err)
+		assert.Equal(t, chunkHash, calculatedHash)
+		assert.FileExists(t, filepath.Join(tempDir, "blocks", hasher.BLAKE3, digest[:4], digest))
+
+		retrievedContent, err := storage.GetChunkData(chunkHash)
+		require.NoError(t, err)
+		assert.Equal(t, content, retrievedContent)
+	})
+
+	t.Run("Test SaveChunkData rejects malformed hashes", func(t *testing.T) {
+		storage, tempDir := setupFileSystemStorage(t)
+		defer teardownFileSystemStorage(t, tempDir)
 
+		for _, chunkHash := range []string{"abc", "../../etc", "blake3:abcd", "md4:abcd"} {
+			_, err := storage.SaveChunkData(chunkHash, []byte("test"))
+			assert.Error(t, err, chunkHash)
+		}
 	})
 }
 
@@ -248,10 +323,74 @@ func TestGetChunkData(t *testing.T) {
 		storage, tempDir := setupFileSystemStorage(t)
 		defer teardownFileSystemStorage(t, tempDir)
 
-		chunkHash := "abcdtest567890"
+		chunkHash := hasher.CalculateChunkHash([]byte("missing"))
 
 		_, err := storage.GetChunkData(chunkHash)
 		assert.Error(t, err)
 		assert.Equal(t, "chunk not found: stat "+filepath.Join(tempDir, "blocks", chunkHash[:4], chunkHash)+": no such file or directory", err.Error())
 	})
 }
+
+func TestStatChunk(t *testing.T) {
+	t.Run("Test StatChunk and TouchChunk report and renew the chunk", func(t *testing.T) {
+		storage, tempDir := setupFileSystemStorage(t)
+		defer teardownFileSystemStorage(t, tempDir)
+
+		content := []byte("test")
+		chunkHash := hasher.CalculateChunkHash(content)
+		_, err := storage.SaveChunkData(chunkHash, content)
+		require.NoError(t, err)
+
+		old := time.Now().Add(-48 * time.Hour)
+		blockPath := filepath.Join(tempDir, "blocks", chunkHash[:4], chunkHash)
+		require.NoError(t, os.Chtimes(blockPath, old, old))
+
+		info, err := storage.StatChunk(chunkHash)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(content)), info.Size)
+		assert.True(t, info.ModTime.Before(time.Now().Add(-time.Hour)))
+
+		require.NoError(t, storage.TouchChunk(chunkHash))
+
+		info, err = storage.StatChunk(chunkHash)
+		require.NoError(t, err)
+		assert.True(t, info.ModTime.After(time.Now().Add(-time.Hour)))
+	})
+
+	t.Run("Test StatChunk for non-existing chunk", func(t *testing.T) {
+		storage, tempDir := setupFileSystemStorage(t)
+		defer teardownFileSystemStorage(t, tempDir)
+
+		_, err := storage.StatChunk(hasher.CalculateChunkHash([]byte("missing")))
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
+func TestDeleteChunk(t *testing.T) {
+	t.Run("Test DeleteChunk removes the chunk and updates stats", func(t *testing.T) {
+		storage, tempDir := setupFileSystemStorage(t)
+		defer teardownFileSystemStorage(t, tempDir)
+		require.NoError(t, storage.SetCompression(DefaultCompression))
+
+		content := []byte(strings.Repeat("compressible ", 100))
+		chunkHash := hasher.CalculateChunkHash(content)
+		_, err := storage.SaveChunkData(chunkHash, content)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), storage.Stats().Blocks)
+
+		require.NoError(t, storage.DeleteChunk(chunkHash))
+
+		exists, _, err := storage.CheckChunkExists([]string{chunkHash})
+		require.NoError(t, err)
+		assert.Empty(t, exists)
+		assert.Equal(t, BlockStats{}, storage.Stats())
+	})
+
+	t.Run("Test DeleteChunk for non-existing chunk", func(t *testing.T) {
+		storage, tempDir := setupFileSystemStorage(t)
+		defer teardownFileSystemStorage(t, tempDir)
+
+		err := storage.DeleteChunk(hasher.CalculateChunkHash([]byte("missing")))
+		assert.Error(t, err)
+	})
+}
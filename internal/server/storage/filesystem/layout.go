@@ -0,0 +1,152 @@
+package filesystem
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SetLayout sets the layout new chunks are written in, LayoutLoose or LayoutPack.
+// Chunks already stored stay readable in either layout.
+func (fs *FilesystemStorage) SetLayout(layout string) error {
+	switch layout {
+	case "", LayoutLoose:
+		fs.layout = LayoutLoose
+	case LayoutPack:
+		fs.layout = LayoutPack
+	default:
+		return fmt.Errorf("unknown layout %q", layout)
+	}
+	return nil
+}
+
+// Compact rewrites the packs in which deleted chunks take a significant share of the space,
+// and returns the number of bytes reclaimed
+func (fs *FilesystemStorage) Compact() (int64, error) {
+	return fs.packs.compact(compactGarbageRatio)
+}
+
+// PackBlocks moves all loose blocks into packs and returns the number of blocks moved.
+// Blocks keep their codec and modification time. It must not run while the storage serves requests.
+func (fs *FilesystemStorage) PackBlocks() (int, error) {
+	hashes, err := fs.listLooseBlocks()
+	if err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	dirs := make(map[string]bool)
+	for _, hash := range hashes {
+		blockPath, extension, err := fs.findBlock(hash)
+		if err != nil {
+			return moved, err
+		}
+		info, err := os.Stat(blockPath)
+		if err != nil {
+			return moved, fmt.Errorf("failed to stat block: %w", err)
+		}
+		data, err := os.ReadFile(blockPath)
+		if err != nil {
+			return moved, fmt.Errorf("failed to read chunk data: %w", err)
+		}
+		content, err := decompressBlock(data, extension)
+		if err != nil {
+			return moved, err
+		}
+
+		key, err := fs.packKey(hash)
+		if err != nil {
+			return moved, err
+		}
+		if _, ok := fs.packs.lookup(key); !ok {
+			if err := fs.packs.append(key, extension, data, int64(len(content)), info.ModTime()); err != nil {
+				return moved, err
+			}
+		}
+
+		// the block is only removed once it is packed and indexed
+		if err := os.Remove(blockPath); err != nil {
+			return moved, fmt.Errorf("failed to remove loose block: %w", err)
+		}
+		dirs[filepath.Dir(blockPath)] = true
+		moved++
+	}
+
+	return moved, removeEmptyDirs(dirs, filepath.Join(fs.storageDir, "blocks"))
+}
+
+// UnpackBlocks moves all packed blocks back to loose blocks, removes the emptied packs and
+// returns the number of blocks moved. It must not run while the storage serves requests.
+func (fs *FilesystemStorage) UnpackBlocks() (int, error) {
+	moved := 0
+	for _, key := range fs.packs.keys() {
+		data, entry, ok, err := fs.packs.read(key)
+		if err != nil {
+			return moved, err
+		}
+		if !ok {
+			continue
+		}
+
+		blockPath, err := fs.blockPath(key)
+		if err != nil {
+			return moved, err
+		}
+		if err := os.MkdirAll(filepath.Dir(blockPath), 0755); err != nil {
+			return moved, fmt.Errorf("failed to create block directory: %w", err)
+		}
+		if err := WriteFileAtomic(blockPath+entry.Extension, data, 0644); err != nil {
+			return moved, fmt.Errorf("failed to write chunk data: %w", err)
+		}
+		if err := os.Chtimes(blockPath+entry.Extension, entry.ModTime, entry.ModTime); err != nil {
+			return moved, fmt.Errorf("failed to set block time: %w", err)
+		}
+
+		// the block is only removed from the index once it is written loose
+		if _, _, err := fs.packs.remove(key); err != nil {
+			return moved, err
+		}
+		moved++
+	}
+
+	if _, err := fs.Compact(); err != nil {
+		return moved, err
+	}
+	return moved, nil
+}
+
+// removeEmptyDirs removes the directories below root that are left empty, and their parents
+// once they are empty too, and syncs the directories that changed
+func removeEmptyDirs(dirs map[string]bool, root string) error {
+	for len(dirs) > 0 {
+		parents := make(map[string]bool)
+		for dir := range dirs {
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				return fmt.Errorf("failed to list blocks: %w", err)
+			}
+			if len(entries) > 0 {
+				if err := syncDir(dir); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := os.Remove(dir); err != nil {
+				return fmt.Errorf("failed to remove block directory: %w", err)
+			}
+			parents[filepath.Dir(dir)] = true
+		}
+
+		dirs = make(map[string]bool)
+		for parent := range parents {
+			if parent == root {
+				if err := syncDir(root); err != nil {
+					return err
+				}
+				continue
+			}
+			dirs[parent] = true
+		}
+	}
+	return nil
+}
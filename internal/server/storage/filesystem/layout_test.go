@@ -0,0 +1,105 @@
+package filesystem
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"zerodupe/pkg/hasher"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetLayout(t *testing.T) {
+	t.Run("Test SetLayout accepts known layouts", func(t *testing.T) {
+		storage, tempDir := setupFileSystemStorage(t)
+		defer teardownFileSystemStorage(t, tempDir)
+
+		assert.Equal(t, LayoutLoose, storage.layout)
+		require.NoError(t, storage.SetLayout(LayoutPack))
+		assert.Equal(t, LayoutPack, storage.layout)
+		require.NoError(t, storage.SetLayout(""))
+		assert.Equal(t, LayoutLoose, storage.layout)
+	})
+
+	t.Run("Test SetLayout rejects unknown layouts", func(t *testing.T) {
+		storage, tempDir := setupFileSystemStorage(t)
+		defer teardownFileSystemStorage(t, tempDir)
+
+		assert.Error(t, storage.SetLayout("tar"))
+	})
+}
+
+func TestLayoutMigration(t *testing.T) {
+	t.Run("Test PackBlocks and UnpackBlocks move blocks between layouts", func(t *testing.T) {
+		storage, tempDir := setupFileSystemStorage(t)
+		defer teardownFileSystemStorage(t, tempDir)
+		require.NoError(t, storage.SetCompression(DefaultCompression))
+
+		contents := map[string][]byte{}
+		for _, content := range [][]byte{[]byte("loose"), []byte(strings.Repeat("compressible ", 100))} {
+			chunkHash := hasher.CalculateChunkHash(content)
+			_, err := storage.SaveChunkData(chunkHash, content)
+			require.NoError(t, err)
+			contents[chunkHash] = content
+		}
+		blake3Content := []byte("blake3")
+		blake3Hash, err := hasher.Sum(hasher.BLAKE3, blake3Content)
+		require.NoError(t, err)
+		_, err = storage.SaveChunkData(blake3Hash, blake3Content)
+		require.NoError(t, err)
+		contents[blake3Hash] = blake3Content
+
+		old := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+		for chunkHash := range contents {
+			blockPath, _, err := storage.findBlock(chunkHash)
+			require.NoError(t, err)
+			require.NoError(t, os.Chtimes(blockPath, old, old))
+		}
+		stats := storage.Stats()
+
+		moved, err := storage.PackBlocks()
+		require.NoError(t, err)
+		assert.Equal(t, 3, moved)
+
+		loose, err := storage.listLooseBlocks()
+		require.NoError(t, err)
+		assert.Empty(t, loose)
+		entries, err := os.ReadDir(filepath.Join(tempDir, "blocks"))
+		require.NoError(t, err)
+		assert.Empty(t, entries, "emptied block directories are removed")
+
+		for chunkHash, content := range contents {
+			got, err := storage.GetChunkData(chunkHash)
+			require.NoError(t, err)
+			assert.Equal(t, content, got)
+
+			info, err := storage.StatChunk(chunkHash)
+			require.NoError(t, err)
+			assert.True(t, info.ModTime.Equal(old), "modification time is kept")
+		}
+		assert.Equal(t, stats, storage.Stats())
+
+		moved, err = storage.UnpackBlocks()
+		require.NoError(t, err)
+		assert.Equal(t, 3, moved)
+
+		ids, err := storage.packs.listPacks()
+		require.NoError(t, err)
+		assert.Empty(t, ids)
+		for chunkHash, content := range contents {
+			blockPath, _, err := storage.findBlock(chunkHash)
+			require.NoError(t, err)
+			got, err := storage.GetChunkData(chunkHash)
+			require.NoError(t, err)
+			assert.Equal(t, content, got)
+
+			info, err := os.Stat(blockPath)
+			require.NoError(t, err)
+			assert.True(t, info.ModTime().Equal(old), "modification time is kept")
+		}
+		assert.Equal(t, stats, storage.Stats())
+	})
+}
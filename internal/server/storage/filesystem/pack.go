@@ -0,0 +1,772 @@
+package filesystem
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Block store layouts. Loose blocks are one file per chunk under blocks/, packed blocks are
+// appended to pack files under packs/. Chunks are read from either layout whatever the layout
+// new chunks are written in, so a store keeps working while it is migrated.
+const (
+	LayoutLoose = "loose"
+	LayoutPack  = "pack"
+)
+
+const (
+	packsDirName  = "packs"
+	packIndexName = "index.log"
+	packPrefix    = "pack-"
+	packExtension = ".pack"
+
+	// DefaultMaxPackSize is the size after which a new pack is started
+	DefaultMaxPackSize = 64 << 20
+
+	// compactGarbageRatio is the share of a pack taken by deleted or unindexed records
+	// from which compaction rewrites the pack
+	compactGarbageRatio = 0.25
+
+	// touchPersistInterval limits how often touching a packed chunk is written to the index
+	touchPersistInterval = time.Minute
+)
+
+// packMagic starts every record in a pack. A record is the magic, the chunk key (uint16 length),
+// the codec extension (uint8 length), the block data (uint32 length) and the block data itself,
+// so the index can be rebuilt from the packs when it is lost.
+var packMagic = []byte("ZDCK")
+
+// packEntry locates a packed block
+type packEntry struct {
+	Pack      int
+	Offset    int64 // offset of the block data in the pack
+	Length    int64 // length of the block data
+	Extension string
+	Size      int64 // length of the chunk before compression
+	ModTime   time.Time
+}
+
+// recordSize returns the size of the pack record holding the block
+func (e *packEntry) recordSize(key string) int64 {
+	return packHeaderSize(key, e.Extension) + e.Length
+}
+
+// packIndexRecord is a line of the index log. The index log is append-only and replayed on
+// startup; it is rewritten as a snapshot on startup and after compaction.
+type packIndexRecord struct {
+	Op        string `json:"op"` // put, touch or delete
+	Key       string `json:"key"`
+	Pack      int    `json:"pack,omitempty"`
+	Offset    int64  `json:"offset,omitempty"`
+	Length    int64  `json:"length,omitempty"`
+	Extension string `json:"ext,omitempty"`
+	Size      int64  `json:"size,omitempty"`
+	ModTime   int64  `json:"mtime,omitempty"` // unix nanoseconds
+}
+
+const (
+	packOpPut    = "put"
+	packOpTouch  = "touch"
+	packOpDelete = "delete"
+)
+
+// packStore keeps blocks in append-only pack files
+type packStore struct {
+	dir         string
+	maxPackSize int64
+
+	compactMu sync.Mutex // serializes compactions
+
+	mu        sync.RWMutex
+	index     map[string]*packEntry
+	packSizes map[int]int64 // bytes written to each pack
+	activeID  int           // pack new blocks are appended to
+	active    *os.File      // opened on the first append
+	indexLog  *os.File      // opened on the first index write
+}
+
+// openPackStore loads the index of the packs in dir. Packs without any indexed block, left
+// behind by a crash during compaction, are removed. The directory is only created once a
+// block is packed.
+func openPackStore(dir string, maxPackSize int64) (*packStore, error) {
+	ps := &packStore{
+		dir:         dir,
+		maxPackSize: maxPackSize,
+		index:       make(map[string]*packEntry),
+		packSizes:   make(map[int]int64),
+		activeID:    1,
+	}
+
+	packIDs, err := ps.listPacks()
+	if err != nil {
+		return nil, err
+	}
+	if len(packIDs) == 0 {
+		return ps, nil
+	}
+
+	for _, id := range packIDs {
+		info, err := os.Stat(ps.packPath(id))
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat pack: %w", err)
+		}
+		ps.packSizes[id] = info.Size()
+		if id >= ps.activeID {
+			ps.activeID = id + 1
+		}
+	}
+
+	if err := ps.replayIndex(); errors.Is(err, os.ErrNotExist) {
+		if err := ps.rebuildIndex(packIDs); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	live := ps.liveBytes()
+	for _, id := range packIDs {
+		if live[id] == 0 {
+			if err := os.Remove(ps.packPath(id)); err != nil {
+				return nil, fmt.Errorf("failed to remove unused pack: %w", err)
+			}
+			delete(ps.packSizes, id)
+		}
+	}
+
+	if err := ps.writeSnapshot(ps.index); err != nil {
+		return nil, err
+	}
+	return ps, nil
+}
+
+// listPacks returns the ids of the pack files in ascending order
+func (ps *packStore) listPacks() ([]int, error) {
+	entries, err := os.ReadDir(ps.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to list packs: %w", err)
+	}
+
+	var ids []int
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || !strings.HasPrefix(name, packPrefix) || !strings.HasSuffix(name, packExtension) {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, packPrefix), packExtension))
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// packPath returns the path of a pack file
+func (ps *packStore) packPath(id int) string {
+	return filepath.Join(ps.dir, fmt.Sprintf("%s%06d%s", packPrefix, id, packExtension))
+}
+
+// replayIndex loads the index log. A torn last line, from a crash while appending, is ignored.
+func (ps *packStore) replayIndex() error {
+	file, err := os.Open(filepath.Join(ps.dir, packIndexName))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record packIndexRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			break
+		}
+
+		switch record.Op {
+		case packOpPut:
+			ps.index[record.Key] = &packEntry{
+				Pack:      record.Pack,
+				Offset:    record.Offset,
+				Length:    record.Length,
+				Extension: record.Extension,
+				Size:      record.Size,
+				ModTime:   time.Unix(0, record.ModTime),
+			}
+		case packOpTouch:
+			if entry, ok := ps.index[record.Key]; ok {
+				entry.ModTime = time.Unix(0, record.ModTime)
+			}
+		case packOpDelete:
+			delete(ps.index, record.Key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read pack index: %w", err)
+	}
+	return nil
+}
+
+// rebuildIndex recovers the index from the records in the packs. Deletions are not recorded in
+// packs, so deleted chunks come back; they are unreferenced and garbage collection removes them again.
+func (ps *packStore) rebuildIndex(packIDs []int) error {
+	for _, id := range packIDs {
+		if err := ps.scanPack(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanPack indexes the records of a pack up to the first incomplete or corrupt record
+func (ps *packStore) scanPack(id int) error {
+	file, err := os.Open(ps.packPath(id))
+	if err != nil {
+		return fmt.Errorf("failed to open pack: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat pack: %w", err)
+	}
+
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		key, extension, data, err := readPackRecord(reader)
+		if err != nil {
+			// io.EOF at a record boundary is the end of the pack, anything else a torn record
+			return nil
+		}
+
+		content, err := decompressBlock(data, extension)
+		if err != nil {
+			return nil
+		}
+
+		headerSize := packHeaderSize(key, extension)
+		ps.index[key] = &packEntry{
+			Pack:      id,
+			Offset:    offset + headerSize,
+			Length:    int64(len(data)),
+			Extension: extension,
+			Size:      int64(len(content)),
+			ModTime:   info.ModTime(),
+		}
+		offset += headerSize + int64(len(data))
+	}
+}
+
+// packHeaderSize returns the size of the record header of a block
+func packHeaderSize(key, extension string) int64 {
+	return int64(len(packMagic) + 2 + len(key) + 1 + len(extension) + 4)
+}
+
+// encodePackRecord returns the pack record of a block
+func encodePackRecord(key, extension string, data []byte) []byte {
+	record := make([]byte, 0, packHeaderSize(key, extension)+int64(len(data)))
+	record = append(record, packMagic...)
+	record = binary.BigEndian.AppendUint16(record, uint16(len(key)))
+	record = append(record, key...)
+	record = append(record, byte(len(extension)))
+	record = append(record, extension...)
+	record = binary.BigEndian.AppendUint32(record, uint32(len(data)))
+	return append(record, data...)
+}
+
+// readPackRecord reads the next record of a pack
+func readPackRecord(reader io.Reader) (string, string, []byte, error) {
+	magic := make([]byte, len(packMagic))
+	if _, err := io.ReadFull(reader, magic); err != nil {
+		return "", "", nil, err
+	}
+	if string(magic) != string(packMagic) {
+		return "", "", nil, fmt.Errorf("invalid pack record")
+	}
+
+	var keyLength uint16
+	if err := binary.Read(reader, binary.BigEndian, &keyLength); err != nil {
+		return "", "", nil, err
+	}
+	key := make([]byte, keyLength)
+	if _, err := io.ReadFull(reader, key); err != nil {
+		return "", "", nil, err
+	}
+
+	var extensionLength uint8
+	if err := binary.Read(reader, binary.BigEndian, &extensionLength); err != nil {
+		return "", "", nil, err
+	}
+	extension := make([]byte, extensionLength)
+	if _, err := io.ReadFull(reader, extension); err != nil {
+		return "", "", nil, err
+	}
+
+	var dataLength uint32
+	if err := binary.Read(reader, binary.BigEndian, &dataLength); err != nil {
+		return "", "", nil, err
+	}
+	data := make([]byte, dataLength)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return "", "", nil, err
+	}
+
+	return string(key), string(extension), data, nil
+}
+
+// lookup returns the entry of a packed block
+func (ps *packStore) lookup(key string) (packEntry, bool) {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	entry, ok := ps.index[key]
+	if !ok {
+		return packEntry{}, false
+	}
+	return *entry, true
+}
+
+// keys returns the keys of all packed blocks
+func (ps *packStore) keys() []string {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	keys := make([]string, 0, len(ps.index))
+	for key := range ps.index {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// read returns the stored data of a packed block
+func (ps *packStore) read(key string) ([]byte, packEntry, bool, error) {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	entry, ok := ps.index[key]
+	if !ok {
+		return nil, packEntry{}, false, nil
+	}
+
+	data, err := ps.readData(entry)
+	if err != nil {
+		return nil, packEntry{}, true, err
+	}
+	return data, *entry, true, nil
+}
+
+// readData reads the block data of an entry. The caller must hold mu, or compactMu to read
+// from a pack being compacted.
+func (ps *packStore) readData(entry *packEntry) ([]byte, error) {
+	file, err := os.Open(ps.packPath(entry.Pack))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pack: %w", err)
+	}
+	defer file.Close()
+
+	data := make([]byte, entry.Length)
+	if _, err := file.ReadAt(data, entry.Offset); err != nil {
+		return nil, fmt.Errorf("failed to read packed block: %w", err)
+	}
+	return data, nil
+}
+
+// append packs a block and records it in the index
+func (ps *packStore) append(key, extension string, data []byte, size int64, modTime time.Time) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	entry, err := ps.appendRecord(key, extension, data)
+	if err != nil {
+		return err
+	}
+	if err := ps.active.Sync(); err != nil {
+		return fmt.Errorf("failed to sync pack: %w", err)
+	}
+	entry.Size = size
+	entry.ModTime = modTime
+
+	if err := ps.writeIndexRecord(putRecord(key, entry)); err != nil {
+		return err
+	}
+	ps.index[key] = entry
+	return nil
+}
+
+// appendRecord appends a block to the active pack, starting a new pack when it is full.
+// The caller must hold mu and sync the pack.
+func (ps *packStore) appendRecord(key, extension string, data []byte) (*packEntry, error) {
+	if ps.active != nil && ps.packSizes[ps.activeID] >= ps.maxPackSize {
+		if err := ps.rollover(); err != nil {
+			return nil, err
+		}
+	}
+	if ps.active == nil {
+		if err := os.MkdirAll(ps.dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create packs directory: %w", err)
+		}
+		file, err := os.OpenFile(ps.packPath(ps.activeID), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open pack: %w", err)
+		}
+		if err := syncDir(ps.dir); err != nil {
+			file.Close()
+			return nil, err
+		}
+		ps.active = file
+	}
+
+	record := encodePackRecord(key, extension, data)
+	offset := ps.packSizes[ps.activeID]
+	if _, err := ps.active.Write(record); err != nil {
+		return nil, fmt.Errorf("failed to write pack: %w", err)
+	}
+	ps.packSizes[ps.activeID] = offset + int64(len(record))
+
+	return &packEntry{
+		Pack:      ps.activeID,
+		Offset:    offset + packHeaderSize(key, extension),
+		Length:    int64(len(data)),
+		Extension: extension,
+	}, nil
+}
+
+// rollover closes the active pack so the next block starts a new one. The caller must hold mu.
+func (ps *packStore) rollover() error {
+	if ps.active == nil {
+		return nil
+	}
+	if err := ps.active.Close(); err != nil {
+		return fmt.Errorf("failed to close pack: %w", err)
+	}
+	ps.active = nil
+	ps.activeID++
+	return nil
+}
+
+// touch sets the modification time of a packed block to now. It returns false if there is no such block.
+func (ps *packStore) touch(key string) (bool, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	entry, ok := ps.index[key]
+	if !ok {
+		return false, nil
+	}
+
+	now := time.Now()
+	if now.Sub(entry.ModTime) < touchPersistInterval {
+		return true, nil
+	}
+	if err := ps.writeIndexRecord(packIndexRecord{Op: packOpTouch, Key: key, ModTime: now.UnixNano()}); err != nil {
+		return true, err
+	}
+	entry.ModTime = now
+	return true, nil
+}
+
+// remove deletes a packed block from the index. Its space is reclaimed by compaction.
+func (ps *packStore) remove(key string) (packEntry, bool, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	entry, ok := ps.index[key]
+	if !ok {
+		return packEntry{}, false, nil
+	}
+	if err := ps.writeIndexRecord(packIndexRecord{Op: packOpDelete, Key: key}); err != nil {
+		return packEntry{}, true, err
+	}
+	delete(ps.index, key)
+	return *entry, true, nil
+}
+
+// liveBytes returns the bytes of indexed records in each pack. The caller must hold mu.
+func (ps *packStore) liveBytes() map[int]int64 {
+	live := make(map[int]int64)
+	for key, entry := range ps.index {
+		live[entry.Pack] += entry.recordSize(key)
+	}
+	return live
+}
+
+// compactCopy is a live record copied by compaction
+type compactCopy struct {
+	key      string
+	old      *packEntry // the indexed entry when compaction started
+	location packEntry  // where the record was, read without holding mu
+}
+
+// compact rewrites the packs in which deleted or unindexed records take at least garbageRatio
+// of the space, and returns the number of bytes reclaimed. The live records are copied to new
+// packs without holding mu, so the store keeps serving reads and writes meanwhile, and mu is
+// only held to pick the packs and to swap in the new index. The new index is written before the
+// old packs are removed, so a crash leaves either the old or the new packs in use.
+func (ps *packStore) compact(garbageRatio float64) (int64, error) {
+	ps.compactMu.Lock()
+	defer ps.compactMu.Unlock()
+
+	selected, oldBytes, copies, err := ps.selectCompaction(garbageRatio)
+	if err != nil || len(selected) == 0 {
+		return 0, err
+	}
+
+	written, newSizes, err := ps.copyRecords(copies)
+	if err != nil {
+		for id := range newSizes {
+			os.Remove(ps.packPath(id))
+		}
+		return 0, err
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	index := make(map[string]*packEntry, len(ps.index))
+	for key, entry := range ps.index {
+		index[key] = entry
+	}
+	for _, record := range copies {
+		// a block deleted or written again meanwhile leaves its copy as garbage
+		current, ok := ps.index[record.key]
+		if !ok || current != record.old {
+			continue
+		}
+		entry := written[record.key]
+		entry.Size = current.Size
+		entry.ModTime = current.ModTime
+		index[record.key] = entry
+	}
+
+	var newBytes int64
+	for id, size := range newSizes {
+		ps.packSizes[id] = size
+		newBytes += size
+	}
+	if err := ps.writeSnapshot(index); err != nil {
+		return 0, err
+	}
+	ps.index = index
+
+	for id := range selected {
+		if err := os.Remove(ps.packPath(id)); err != nil {
+			return 0, fmt.Errorf("failed to remove compacted pack: %w", err)
+		}
+		delete(ps.packSizes, id)
+	}
+	if err := syncDir(ps.dir); err != nil {
+		return 0, err
+	}
+
+	return oldBytes - newBytes, nil
+}
+
+// selectCompaction picks the packs to compact and returns them with their size and the live
+// records they hold, in pack order. New blocks are appended to a new pack from then on, never
+// to one being compacted.
+func (ps *packStore) selectCompaction(garbageRatio float64) (map[int]bool, int64, []compactCopy, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	live := ps.liveBytes()
+	selected := make(map[int]bool)
+	var oldBytes int64
+	for id, size := range ps.packSizes {
+		if size == 0 || float64(size-live[id])/float64(size) < garbageRatio {
+			continue
+		}
+		selected[id] = true
+		oldBytes += size
+	}
+	if len(selected) == 0 {
+		return nil, 0, nil, nil
+	}
+	if selected[ps.activeID] {
+		if err := ps.rollover(); err != nil {
+			return nil, 0, nil, err
+		}
+	}
+
+	var copies []compactCopy
+	for key, entry := range ps.index {
+		if selected[entry.Pack] {
+			copies = append(copies, compactCopy{key: key, old: entry, location: *entry})
+		}
+	}
+	sort.Slice(copies, func(i, j int) bool {
+		a, b := copies[i].location, copies[j].location
+		if a.Pack != b.Pack {
+			return a.Pack < b.Pack
+		}
+		return a.Offset < b.Offset
+	})
+	return selected, oldBytes, copies, nil
+}
+
+// copyRecords copies records to new packs, which only compaction writes to, and returns their
+// new entries by key and the size of each new pack. Only compaction removes packs, so the
+// records are read without holding mu.
+func (ps *packStore) copyRecords(copies []compactCopy) (map[string]*packEntry, map[int]int64, error) {
+	written := make(map[string]*packEntry, len(copies))
+	sizes := make(map[int]int64)
+	var file *os.File
+	id := 0
+
+	closePack := func() error {
+		if file == nil {
+			return nil
+		}
+		defer func() { file = nil }()
+		if err := file.Sync(); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to sync pack: %w", err)
+		}
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("failed to close pack: %w", err)
+		}
+		return nil
+	}
+
+	for _, record := range copies {
+		data, err := ps.readData(&record.location)
+		if err != nil {
+			closePack()
+			return nil, sizes, err
+		}
+
+		if file != nil && sizes[id] >= ps.maxPackSize {
+			if err := closePack(); err != nil {
+				return nil, sizes, err
+			}
+		}
+		if file == nil {
+			if id, err = ps.reservePack(); err != nil {
+				return nil, sizes, err
+			}
+			file, err = os.OpenFile(ps.packPath(id), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+			if err != nil {
+				return nil, sizes, fmt.Errorf("failed to open pack: %w", err)
+			}
+			sizes[id] = 0
+		}
+
+		encoded := encodePackRecord(record.key, record.location.Extension, data)
+		if _, err := file.Write(encoded); err != nil {
+			closePack()
+			return nil, sizes, fmt.Errorf("failed to write pack: %w", err)
+		}
+		written[record.key] = &packEntry{
+			Pack:      id,
+			Offset:    sizes[id] + packHeaderSize(record.key, record.location.Extension),
+			Length:    int64(len(data)),
+			Extension: record.location.Extension,
+		}
+		sizes[id] += int64(len(encoded))
+	}
+
+	if err := closePack(); err != nil {
+		return nil, sizes, err
+	}
+	if err := syncDir(ps.dir); err != nil {
+		return nil, sizes, err
+	}
+	return written, sizes, nil
+}
+
+// reservePack returns the id of a new pack that appends never write to
+func (ps *packStore) reservePack() (int, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if err := ps.rollover(); err != nil {
+		return 0, err
+	}
+	id := ps.activeID
+	ps.activeID++
+	return id, nil
+}
+
+// writeIndexRecord appends a record to the index log and syncs it. The caller must hold mu.
+func (ps *packStore) writeIndexRecord(record packIndexRecord) error {
+	if ps.indexLog == nil {
+		if err := os.MkdirAll(ps.dir, 0755); err != nil {
+			return fmt.Errorf("failed to create packs directory: %w", err)
+		}
+		file, err := os.OpenFile(filepath.Join(ps.dir, packIndexName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open pack index: %w", err)
+		}
+		ps.indexLog = file
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode pack index: %w", err)
+	}
+	if _, err := ps.indexLog.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write pack index: %w", err)
+	}
+	if err := ps.indexLog.Sync(); err != nil {
+		return fmt.Errorf("failed to sync pack index: %w", err)
+	}
+	return nil
+}
+
+// writeSnapshot atomically replaces the index log with the put records of index.
+// The caller must hold mu or have exclusive access.
+func (ps *packStore) writeSnapshot(index map[string]*packEntry) error {
+	keys := make([]string, 0, len(index))
+	for key := range index {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var snapshot []byte
+	for _, key := range keys {
+		line, err := json.Marshal(putRecord(key, index[key]))
+		if err != nil {
+			return fmt.Errorf("failed to encode pack index: %w", err)
+		}
+		snapshot = append(append(snapshot, line...), '\n')
+	}
+
+	if err := os.MkdirAll(ps.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create packs directory: %w", err)
+	}
+	if ps.indexLog != nil {
+		ps.indexLog.Close()
+		ps.indexLog = nil
+	}
+	if err := WriteFileAtomic(filepath.Join(ps.dir, packIndexName), snapshot, 0644); err != nil {
+		return fmt.Errorf("failed to write pack index: %w", err)
+	}
+	return nil
+}
+
+// putRecord returns the index record of a packed block
+func putRecord(key string, entry *packEntry) packIndexRecord {
+	return packIndexRecord{
+		Op:        packOpPut,
+		Key:       key,
+		Pack:      entry.Pack,
+		Offset:    entry.Offset,
+		Length:    entry.Length,
+		Extension: entry.Extension,
+		Size:      entry.Size,
+		ModTime:   entry.ModTime.UnixNano(),
+	}
+}
@@ -0,0 +1,327 @@
+package filesystem
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"zerodupe/pkg/hasher"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupPackedStorage creates a temporary filesystem storage that writes packs
+func setupPackedStorage(t *testing.T) (*FilesystemStorage, string) {
+	t.Helper()
+
+	storage, tempDir := setupFileSystemStorage(t)
+	require.NoError(t, storage.SetLayout(LayoutPack))
+	return storage, tempDir
+}
+
+// savePackedChunks saves count distinct chunks and returns their hashes and contents
+func savePackedChunks(t *testing.T, storage *FilesystemStorage, count int) ([]string, map[string][]byte) {
+	t.Helper()
+
+	var hashes []string
+	contents := make(map[string][]byte)
+	for i := 0; i < count; i++ {
+		content := []byte(fmt.Sprintf("packed chunk %d", i))
+		chunkHash := hasher.CalculateChunkHash(content)
+		_, err := storage.SaveChunkData(chunkHash, content)
+		require.NoError(t, err)
+		hashes = append(hashes, chunkHash)
+		contents[chunkHash] = content
+	}
+	return hashes, contents
+}
+
+func TestPackedChunks(t *testing.T) {
+	t.Run("Test SaveChunkData in pack layout appends to a pack", func(t *testing.T) {
+		storage, tempDir := setupPackedStorage(t)
+		defer teardownFileSystemStorage(t, tempDir)
+
+		hashes, contents := savePackedChunks(t, storage, 3)
+
+		assert.NoFileExists(t, filepath.Join(tempDir, "blocks", hashes[0][:4], hashes[0]))
+		assert.FileExists(t, filepath.Join(tempDir, packsDirName, "pack-000001.pack"))
+		assert.FileExists(t, filepath.Join(tempDir, packsDirName, packIndexName))
+
+		for chunkHash, content := range contents {
+			got, err := storage.GetChunkData(chunkHash)
+			require.NoError(t, err)
+			assert.Equal(t, content, got)
+		}
+
+		missingHash := hasher.CalculateChunkHash([]byte("missing"))
+		existing, missing, err := storage.CheckChunkExists(append(hashes, missingHash))
+		require.NoError(t, err)
+		assert.Equal(t, hashes, existing)
+		assert.Equal(t, []string{missingHash}, missing)
+
+		listed, err := storage.ListChunks()
+		require.NoError(t, err)
+		assert.ElementsMatch(t, hashes, listed)
+
+		assert.Equal(t, int64(3), storage.Stats().Blocks)
+	})
+
+	t.Run("Test packed chunks of other algorithms and prefixed SHA-256 hashes", func(t *testing.T) {
+		storage, tempDir := setupPackedStorage(t)
+		defer teardownFileSystemStorage(t, tempDir)
+
+		content := []byte("test")
+		blake3Hash, err := hasher.Sum(hasher.BLAKE3, content)
+		require.NoError(t, err)
+		sha256Hash, err := hasher.Sum(hasher.SHA256, content)
+		require.NoError(t, err)
+
+		_, err = storage.SaveChunkData(blake3Hash, content)
+		require.NoError(t, err)
+		_, err = storage.SaveChunkData(sha256Hash, content)
+		require.NoError(t, err)
+
+		got, err := storage.GetChunkData(hasher.CalculateChunkHash(content))
+		require.NoError(t, err)
+		assert.Equal(t, content, got)
+
+		listed, err := storage.ListChunks()
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{blake3Hash, hasher.CalculateChunkHash(content)}, listed)
+	})
+
+	t.Run("Test packed chunks survive a restart", func(t *testing.T) {
+		storage, tempDir := setupPackedStorage(t)
+		defer teardownFileSystemStorage(t, tempDir)
+
+		hashes, contents := savePackedChunks(t, storage, 3)
+		require.NoError(t, storage.DeleteChunk(hashes[0]))
+
+		reopened, err := NewFilesystemStorage(tempDir)
+		require.NoError(t, err)
+
+		exists, _, err := reopened.CheckChunkExists([]string{hashes[0]})
+		require.NoError(t, err)
+		assert.Empty(t, exists)
+		for _, chunkHash := range hashes[1:] {
+			got, err := reopened.GetChunkData(chunkHash)
+			require.NoError(t, err)
+			assert.Equal(t, contents[chunkHash], got)
+		}
+		assert.Equal(t, int64(2), reopened.Stats().Blocks)
+	})
+
+	t.Run("Test a torn index line is ignored", func(t *testing.T) {
+		storage, tempDir := setupPackedStorage(t)
+		defer teardownFileSystemStorage(t, tempDir)
+
+		hashes, _ := savePackedChunks(t, storage, 2)
+
+		indexFile, err := os.OpenFile(filepath.Join(tempDir, packsDirName, packIndexName), os.O_WRONLY|os.O_APPEND, 0644)
+		require.NoError(t, err)
+		_, err = indexFile.WriteString(`{"op":"delete","key":"` + hashes[0][:10])
+		require.NoError(t, err)
+		require.NoError(t, indexFile.Close())
+
+		reopened, err := NewFilesystemStorage(tempDir)
+		require.NoError(t, err)
+
+		listed, err := reopened.ListChunks()
+		require.NoError(t, err)
+		assert.ElementsMatch(t, hashes, listed)
+	})
+
+	t.Run("Test the index is rebuilt from the packs when it is lost", func(t *testing.T) {
+		storage, tempDir := setupPackedStorage(t)
+		defer teardownFileSystemStorage(t, tempDir)
+		require.NoError(t, storage.SetCompression(DefaultCompression))
+
+		compressible := []byte(strings.Repeat("compressible ", 100))
+		compressibleHash := hasher.CalculateChunkHash(compressible)
+		_, err := storage.SaveChunkData(compressibleHash, compressible)
+		require.NoError(t, err)
+		hashes, contents := savePackedChunks(t, storage, 2)
+		contents[compressibleHash] = compressible
+
+		require.NoError(t, os.Remove(filepath.Join(tempDir, packsDirName, packIndexName)))
+
+		reopened, err := NewFilesystemStorage(tempDir)
+		require.NoError(t, err)
+
+		listed, err := reopened.ListChunks()
+		require.NoError(t, err)
+		assert.ElementsMatch(t, append(hashes, compressibleHash), listed)
+		for chunkHash, content := range contents {
+			got, err := reopened.GetChunkData(chunkHash)
+			require.NoError(t, err)
+			assert.Equal(t, content, got)
+		}
+		assert.FileExists(t, filepath.Join(tempDir, packsDirName, packIndexName))
+	})
+
+	t.Run("Test a full pack starts a new one", func(t *testing.T) {
+		storage, tempDir := setupPackedStorage(t)
+		defer teardownFileSystemStorage(t, tempDir)
+		storage.packs.maxPackSize = 1
+
+		hashes, contents := savePackedChunks(t, storage, 3)
+
+		ids, err := storage.packs.listPacks()
+		require.NoError(t, err)
+		assert.Equal(t, []int{1, 2, 3}, ids)
+		for _, chunkHash := range hashes {
+			got, err := storage.GetChunkData(chunkHash)
+			require.NoError(t, err)
+			assert.Equal(t, contents[chunkHash], got)
+		}
+	})
+
+	t.Run("Test concurrent saves of the same chunk pack it once", func(t *testing.T) {
+		storage, tempDir := setupPackedStorage(t)
+		defer teardownFileSystemStorage(t, tempDir)
+
+		content := []byte("concurrent packed chunk")
+		chunkHash := hasher.CalculateChunkHash(content)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := storage.SaveChunkData(chunkHash, content)
+				assert.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+
+		info, err := os.Stat(filepath.Join(tempDir, packsDirName, "pack-000001.pack"))
+		require.NoError(t, err)
+		assert.Equal(t, packHeaderSize(chunkHash, "")+int64(len(content)), info.Size())
+		assert.Equal(t, int64(1), storage.Stats().Blocks)
+	})
+}
+
+func TestCompact(t *testing.T) {
+	t.Run("Test Compact rewrites packs with deleted chunks", func(t *testing.T) {
+		storage, tempDir := setupPackedStorage(t)
+		defer teardownFileSystemStorage(t, tempDir)
+
+		hashes, contents := savePackedChunks(t, storage, 4)
+		oldPack := filepath.Join(tempDir, packsDirName, "pack-000001.pack")
+		oldInfo, err := os.Stat(oldPack)
+		require.NoError(t, err)
+
+		require.NoError(t, storage.DeleteChunk(hashes[0]))
+		require.NoError(t, storage.DeleteChunk(hashes[1]))
+
+		reclaimed, err := storage.Compact()
+		require.NoError(t, err)
+		assert.Equal(t, packHeaderSize(hashes[0], "")+int64(len(contents[hashes[0]]))+
+			packHeaderSize(hashes[1], "")+int64(len(contents[hashes[1]])), reclaimed)
+		assert.NoFileExists(t, oldPack)
+
+		newInfo, err := os.Stat(filepath.Join(tempDir, packsDirName, "pack-000002.pack"))
+		require.NoError(t, err)
+		assert.Equal(t, oldInfo.Size()-reclaimed, newInfo.Size())
+
+		for _, chunkHash := range hashes[2:] {
+			got, err := storage.GetChunkData(chunkHash)
+			require.NoError(t, err)
+			assert.Equal(t, contents[chunkHash], got)
+		}
+
+		// the compacted index and chunks packed after compaction survive a restart
+		content := []byte("after compaction")
+		chunkHash := hasher.CalculateChunkHash(content)
+		_, err = storage.SaveChunkData(chunkHash, content)
+		require.NoError(t, err)
+
+		reopened, err := NewFilesystemStorage(tempDir)
+		require.NoError(t, err)
+		listed, err := reopened.ListChunks()
+		require.NoError(t, err)
+		assert.ElementsMatch(t, append(hashes[2:], chunkHash), listed)
+	})
+
+	t.Run("Test Compact runs alongside writes, reads and deletions", func(t *testing.T) {
+		storage, tempDir := setupPackedStorage(t)
+		defer teardownFileSystemStorage(t, tempDir)
+		storage.packs.maxPackSize = 256
+
+		hashes, contents := savePackedChunks(t, storage, 40)
+		for _, chunkHash := range hashes[:20] {
+			require.NoError(t, storage.DeleteChunk(chunkHash))
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		var added []string
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				content := []byte(fmt.Sprintf("written during compaction %d", i))
+				chunkHash := hasher.CalculateChunkHash(content)
+				if _, err := storage.SaveChunkData(chunkHash, content); !assert.NoError(t, err) {
+					return
+				}
+				added = append(added, chunkHash)
+				contents[chunkHash] = content
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for _, chunkHash := range hashes[20:30] {
+				assert.NoError(t, storage.DeleteChunk(chunkHash))
+			}
+			for _, chunkHash := range hashes[30:] {
+				_, err := storage.GetChunkData(chunkHash)
+				assert.NoError(t, err)
+			}
+		}()
+		_, err := storage.Compact()
+		require.NoError(t, err)
+		wg.Wait()
+
+		kept := append(hashes[30:], added...)
+		reopened, err := NewFilesystemStorage(tempDir)
+		require.NoError(t, err)
+		listed, err := reopened.ListChunks()
+		require.NoError(t, err)
+		assert.ElementsMatch(t, kept, listed)
+		for _, chunkHash := range kept {
+			got, err := reopened.GetChunkData(chunkHash)
+			require.NoError(t, err)
+			assert.Equal(t, contents[chunkHash], got)
+		}
+	})
+
+	t.Run("Test Compact leaves packs with little garbage alone", func(t *testing.T) {
+		storage, tempDir := setupPackedStorage(t)
+		defer teardownFileSystemStorage(t, tempDir)
+
+		hashes, _ := savePackedChunks(t, storage, 10)
+		require.NoError(t, storage.DeleteChunk(hashes[0]))
+
+		reclaimed, err := storage.Compact()
+		require.NoError(t, err)
+		assert.Zero(t, reclaimed)
+		assert.FileExists(t, filepath.Join(tempDir, packsDirName, "pack-000001.pack"))
+	})
+
+	t.Run("Test packs without indexed chunks are removed on startup", func(t *testing.T) {
+		storage, tempDir := setupPackedStorage(t)
+		defer teardownFileSystemStorage(t, tempDir)
+		storage.packs.maxPackSize = 1
+
+		hashes, _ := savePackedChunks(t, storage, 2)
+		require.NoError(t, storage.DeleteChunk(hashes[0]))
+
+		_, err := NewFilesystemStorage(tempDir)
+		require.NoError(t, err)
+		assert.NoFileExists(t, filepath.Join(tempDir, packsDirName, "pack-000001.pack"))
+		assert.FileExists(t, filepath.Join(tempDir, packsDirName, "pack-000002.pack"))
+	})
+}
@@ -0,0 +1,80 @@
+package filesystem
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// quarantineDirName is the directory in the storage directory that keeps rejected chunks
+const quarantineDirName = "quarantine"
+
+// Reasons a chunk is quarantined for
+const (
+	QuarantineUpload = "upload" // an uploaded chunk did not match its hash
+	QuarantineScrub  = "scrub"  // a stored block no longer matched its hash
+)
+
+// QuarantineRecord describes a chunk that was set aside because its content did not match its hash
+type QuarantineRecord struct {
+	ClaimedHash   string    `json:"claimed_hash"`
+	ActualHash    string    `json:"actual_hash"`
+	Reason        string    `json:"reason"`
+	Extension     string    `json:"extension,omitempty"` // codec extension of a quarantined compressed block
+	Size          int       `json:"size"`
+	QuarantinedAt time.Time `json:"quarantined_at"`
+}
+
+// SetQuarantine enables keeping rejected chunks in the quarantine directory for later inspection
+func (fs *FilesystemStorage) SetQuarantine(enabled bool) {
+	fs.quarantine = enabled
+}
+
+// QuarantineChunk moves a stored block that no longer matches its hash into the quarantine
+// directory, whether or not quarantine of rejected uploads is enabled, and deletes it from the
+// block store. The block is kept as stored, compressed or not.
+func (fs *FilesystemStorage) QuarantineChunk(chunkHash, actualHash string) error {
+	data, extension, err := fs.readBlock(chunkHash)
+	if err != nil {
+		return err
+	}
+
+	record := QuarantineRecord{ClaimedHash: chunkHash, ActualHash: actualHash, Reason: QuarantineScrub, Extension: extension}
+	if err := fs.quarantineChunk(record, data); err != nil {
+		return err
+	}
+	return fs.DeleteChunk(chunkHash)
+}
+
+// quarantineChunk stores a chunk and a record describing it in the quarantine directory.
+// Quarantined chunks are never readable through the block store.
+func (fs *FilesystemStorage) quarantineChunk(record QuarantineRecord, content []byte) error {
+	quarantineDir := filepath.Join(fs.storageDir, quarantineDirName)
+	if err := os.MkdirAll(quarantineDir, 0700); err != nil {
+		return fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+
+	record.Size = len(content)
+	record.QuarantinedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode quarantine record: %w", err)
+	}
+
+	// corrupt blocks may not hash to anything, they are named after the hash they claim
+	hash := record.ActualHash
+	if hash == "" {
+		hash = record.ClaimedHash
+	}
+	name := fmt.Sprintf("%d-%s", record.QuarantinedAt.UnixNano(), strings.ReplaceAll(hash, ":", "-"))
+	if err := os.WriteFile(filepath.Join(quarantineDir, name+".bin"), content, 0600); err != nil {
+		return fmt.Errorf("failed to write quarantined chunk: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(quarantineDir, name+".json"), data, 0600); err != nil {
+		return fmt.Errorf("failed to write quarantine record: %w", err)
+	}
+	return nil
+}
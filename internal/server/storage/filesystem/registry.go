@@ -0,0 +1,12 @@
+package filesystem
+
+import (
+	"net/url"
+	"zerodupe/internal/server/storage"
+)
+
+func init() {
+	storage.RegisterFileSystem("file", func(u *url.URL) (storage.FileSystem, error) {
+		return NewFilesystemStorage(storage.URLPath(u))
+	})
+}
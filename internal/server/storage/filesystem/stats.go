@@ -0,0 +1,129 @@
+package filesystem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// statsFileName is the file in the storage directory that keeps the block stats across restarts.
+// The stats are only kept in memory while the storage is open: the file is written by Flush and
+// removed once read, so stats left by a storage that was not flushed are never trusted.
+const statsFileName = "stats.json"
+
+// BlockStats summarizes the blocks stored on disk
+type BlockStats struct {
+	Blocks           int64 `json:"blocks"`
+	CompressedBlocks int64 `json:"compressed_blocks"`
+	LogicalBytes     int64 `json:"logical_bytes"` // size of the chunks before compression
+	StoredBytes      int64 `json:"stored_bytes"`  // size of the blocks on disk
+}
+
+// SavedBytes returns the number of bytes saved by compression
+func (s BlockStats) SavedBytes() int64 {
+	return s.LogicalBytes - s.StoredBytes
+}
+
+// Stats returns the stats of the stored blocks
+func (fs *FilesystemStorage) Stats() BlockStats {
+	fs.statsMu.Lock()
+	defer fs.statsMu.Unlock()
+	return fs.stats
+}
+
+// updateBlockStats records blocks written (positive delta) or deleted (negative delta)
+func (fs *FilesystemStorage) updateBlockStats(delta int64, logicalSize, storedSize int, compressed bool) {
+	fs.statsMu.Lock()
+	defer fs.statsMu.Unlock()
+
+	fs.stats.Blocks += delta
+	if compressed {
+		fs.stats.CompressedBlocks += delta
+	}
+	fs.stats.LogicalBytes += delta * int64(logicalSize)
+	fs.stats.StoredBytes += delta * int64(storedSize)
+}
+
+// Flush writes the stats to the stats file, for the next start to read instead of counting the
+// stored blocks
+func (fs *FilesystemStorage) Flush() error {
+	fs.statsMu.Lock()
+	defer fs.statsMu.Unlock()
+	return fs.saveStats()
+}
+
+// saveStats writes the stats to the stats file. The caller must hold statsMu.
+func (fs *FilesystemStorage) saveStats() error {
+	data, err := json.Marshal(fs.stats)
+	if err != nil {
+		return fmt.Errorf("failed to encode stats: %w", err)
+	}
+
+	if err := WriteFileAtomic(filepath.Join(fs.storageDir, statsFileName), data, 0644); err != nil {
+		return fmt.Errorf("failed to write stats: %w", err)
+	}
+	return nil
+}
+
+// loadStats reads and removes the stats file, or computes the stats from the stored blocks when
+// there is none
+func (fs *FilesystemStorage) loadStats() error {
+	path := filepath.Join(fs.storageDir, statsFileName)
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if err := json.Unmarshal(data, &fs.stats); err != nil {
+			return fmt.Errorf("failed to decode stats: %w", err)
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove stats: %w", err)
+		}
+		return syncDir(fs.storageDir)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read stats: %w", err)
+	}
+
+	hashes, err := fs.ListChunks()
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range hashes {
+		if entry, ok := fs.packs.lookup(hash); ok {
+			fs.stats.Blocks++
+			if entry.Extension != "" {
+				fs.stats.CompressedBlocks++
+			}
+			fs.stats.LogicalBytes += entry.Size
+			fs.stats.StoredBytes += entry.Length
+			continue
+		}
+
+		path, extension, err := fs.findBlock(hash)
+		if err != nil {
+			return err
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to stat block: %w", err)
+		}
+
+		logicalSize := info.Size()
+		if extension != "" {
+			content, err := fs.GetChunkData(hash)
+			if err != nil {
+				return err
+			}
+			logicalSize = int64(len(content))
+			fs.stats.CompressedBlocks++
+		}
+
+		fs.stats.Blocks++
+		fs.stats.LogicalBytes += logicalSize
+		fs.stats.StoredBytes += info.Size()
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package filesystem
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"zerodupe/pkg/hasher"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	compressible := bytes.Repeat([]byte("zerodupe "), 10*1024)
+
+	t.Run("Test Stats reports the space saved by compression", func(t *testing.T) {
+		storage, tempDir := setupFileSystemStorage(t)
+		defer teardownFileSystemStorage(t, tempDir)
+		require.NoError(t, storage.SetCompression(CompressionZstd))
+
+		_, err := storage.SaveChunkData(hasher.CalculateChunkHash(compressible), compressible)
+		require.NoError(t, err)
+		_, err = storage.SaveChunkData(hasher.CalculateChunkHash([]byte("test")), []byte("test"))
+		require.NoError(t, err)
+
+		stats := storage.Stats()
+		assert.Equal(t, int64(2), stats.Blocks)
+		assert.Equal(t, int64(1), stats.CompressedBlocks)
+		assert.Equal(t, int64(len(compressible)+4), stats.LogicalBytes)
+		assert.Greater(t, stats.SavedBytes(), int64(0))
+	})
+
+	t.Run("Test Stats persist across restarts", func(t *testing.T) {
+		storage, tempDir := setupFileSystemStorage(t)
+		defer teardownFileSystemStorage(t, tempDir)
+		require.NoError(t, storage.SetCompression(CompressionZstd))
+
+		_, err := storage.SaveChunkData(hasher.CalculateChunkHash(compressible), compressible)
+		require.NoError(t, err)
+		require.NoError(t, storage.Flush())
+
+		reopened, err := NewFilesystemStorage(tempDir)
+		require.NoError(t, err)
+		assert.Equal(t, storage.Stats(), reopened.Stats())
+		assert.NoFileExists(t, filepath.Join(tempDir, statsFileName))
+	})
+
+	t.Run("Test Stats are rebuilt from the stored blocks when they were not flushed", func(t *testing.T) {
+		storage, tempDir := setupFileSystemStorage(t)
+		defer teardownFileSystemStorage(t, tempDir)
+		require.NoError(t, storage.SetCompression(CompressionZstd))
+
+		_, err := storage.SaveChunkData(hasher.CalculateChunkHash(compressible), compressible)
+		require.NoError(t, err)
+		require.NoError(t, storage.Flush())
+
+		// the storage stops without flushing the stats after another write
+		restarted, err := NewFilesystemStorage(tempDir)
+		require.NoError(t, err)
+		require.NoError(t, restarted.SetCompression(CompressionZstd))
+		_, err = restarted.SaveChunkData(hasher.CalculateChunkHash([]byte("test")), []byte("test"))
+		require.NoError(t, err)
+
+		reopened, err := NewFilesystemStorage(tempDir)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), reopened.Stats().Blocks)
+		assert.Equal(t, restarted.Stats(), reopened.Stats())
+	})
+}
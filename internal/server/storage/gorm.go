@@ -3,11 +3,27 @@ package storage
 import (
 	"errors"
 	"fmt"
+	"path"
+	"strings"
+	"time"
 	"zerodupe/internal/server/model"
+	"zerodupe/pkg/hasher"
 
+	"github.com/rs/zerolog/log"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// gormModels are the tables of the gorm storage
+var gormModels = []interface{}{
+	&model.User{}, &model.FileMetadata{}, &model.ChunkMetadata{}, &model.ChunkRef{}, &model.Migration{},
+	&model.FileOwner{}, &model.UserChunkRef{}, &model.Usage{}, &model.FileGrant{}, &model.ShareLink{},
+	&model.PathEntry{}, &model.UploadedChunk{}, &model.Totals{}, &model.FileAlias{},
+}
+
+// totalsID is the id of the single row of the totals table
+const totalsID = 1
+
 type GormDB struct {
 	db *gorm.DB
 }
@@ -18,8 +34,12 @@ func NewGormStorage(dialector gorm.Dialector) (DB, error) {
 		return nil, err
 	}
 
+	if err := repairChunkMetadataSchema(db); err != nil {
+		return nil, fmt.Errorf("failed to repair chunk metadata schema: %w", err)
+	}
+
 	// Migrate models
-	err = db.AutoMigrate(&model.User{}, &model.FileMetadata{}, &model.ChunkMetadata{})
+	err = db.AutoMigrate(gormModels...)
 	if err != nil {
 		return nil, err
 	}
@@ -37,13 +57,30 @@ func (g *GormDB) CreateUser(user *model.User) error {
 func (g *GormDB) GetUserByUsername(username string) (*model.User, error) {
 	var user model.User
 	err := g.db.Where("username = ?", username).First(&user).Error
-	if err != nil {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %w", ErrUserNotFound, err)
+	} else if err != nil {
 		return nil, err
 	}
 
 	return &user, nil
 }
 
+// SetUserQuota sets the quota of a user
+func (g *GormDB) SetUserQuota(username string, quota model.Quota) error {
+	result := g.db.Model(&model.User{}).Where("username = ?", username).Updates(map[string]interface{}{
+		"quota_logical_bytes": quota.LogicalBytes,
+		"quota_unique_bytes":  quota.UniqueBytes,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to set quota: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
 // Close closes the database connection
 func (g *GormDB) Close() error {
 	sqlDB, err := g.db.DB()
@@ -53,29 +90,32 @@ func (g *GormDB) Close() error {
 	return sqlDB.Close()
 }
 
-func (g *GormDB) SaveChunkMetadata(fileHash, chunkHash string, chunkOrder int) error {
+func (g *GormDB) SaveChunkMetadata(fileHash, chunkHash string, chunkOrder int, chunkSize int64, chunker string) error {
+	// the file may already be stored under another spelling of the same hash
 	var fileMetadata model.FileMetadata
-
-	err := g.db.Where("file_hash = ?", fileHash).First(&fileMetadata).Error
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			fileMetadata = model.FileMetadata{FileHash: fileHash}
-			if err := g.db.Create(&fileMetadata).Error; err != nil {
-				return fmt.Errorf("failed to create file metadata: %w", err)
-
+	err := byFileHash(g.db, fileHash).First(&fileMetadata).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// chunks of the same file are uploaded concurrently, so creating the file metadata must tolerate a concurrent insert
+		fileMetadata = model.FileMetadata{FileHash: fileHash, Chunker: chunker, LastChunkAt: time.Now()}
+		if err := g.db.Transaction(func(tx *gorm.DB) error {
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&fileMetadata)
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
 			}
-		} else {
-			return fmt.Errorf("failed to query file metadata: %w", err)
-
+			return addTotals(tx, model.Totals{Files: 1})
+		}); err != nil {
+			return fmt.Errorf("failed to create file metadata: %w", err)
 		}
+		err = g.db.Where("file_hash = ?", fileHash).First(&fileMetadata).Error
+	}
+	if err != nil {
+		return fmt.Errorf("failed to query file metadata: %w", err)
 	}
 
 	var existingChunk model.ChunkMetadata
-	err = g.db.Where("file_metadata_id = ? AND chunk_order = ? AND chunk_hash = ?", fileMetadata.ID, chunkOrder, chunkHash).
-		First(&existingChunk).Error
+	err = g.db.Where("file_metadata_id = ? AND chunk_order = ?", fileMetadata.ID, chunkOrder).First(&existingChunk).Error
 	if err == nil {
-		// Chunk already exists
-		return nil
+		return sameChunk(existingChunk, chunkHash)
 	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
 		return fmt.Errorf("failed to check existing chunk: %w", err)
 	}
@@ -84,8 +124,58 @@ func (g *GormDB) SaveChunkMetadata(fileHash, chunkHash string, chunkOrder int) e
 		FileMetadataID: fileMetadata.ID,
 		ChunkOrder:     chunkOrder,
 		ChunkHash:      chunkHash,
+		Size:           chunkSize,
 	}
-	if err := g.db.Create(&newChunk).Error; err != nil {
+	err = g.db.Transaction(func(tx *gorm.DB) error {
+		// write before reading so that concurrent uploads queue for the lock rather than fail to upgrade theirs
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&newChunk)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		// the chunks of a complete file are final, so nobody can append to a file they only know the hash of
+		var complete int64
+		if err := tx.Model(&model.FileMetadata{}).Where("id = ? AND complete = ?", fileMetadata.ID, true).Count(&complete).Error; err != nil {
+			return err
+		}
+		if complete > 0 {
+			return ErrFileComplete
+		}
+		if result.RowsAffected == 0 {
+			// a concurrent upload stored a chunk at this position first
+			if err := tx.Where("file_metadata_id = ? AND chunk_order = ?", fileMetadata.ID, chunkOrder).First(&existingChunk).Error; err != nil {
+				return err
+			}
+			return sameChunk(existingChunk, chunkHash)
+		}
+		if err := addChunkRef(tx, chunkHash, 1, chunkSize); err != nil {
+			return err
+		}
+		if err := tx.Model(&fileMetadata).UpdateColumns(map[string]interface{}{
+			"size":          gorm.Expr("size + ?", chunkSize),
+			"last_chunk_at": time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+
+		// the chunk counts towards every owner of the file
+		var owners []uint
+		if err := tx.Model(&model.FileOwner{}).Where("file_metadata_id = ?", fileMetadata.ID).Pluck("user_id", &owners).Error; err != nil {
+			return err
+		}
+		for _, userID := range owners {
+			if err := addUsage(tx, userID, model.Usage{LogicalBytes: chunkSize}); err != nil {
+				return err
+			}
+			if err := addUserChunkRef(tx, userID, chunkHash, 1); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, ErrChunkConflict) || errors.Is(err, ErrFileComplete) {
+		return err
+	} else if err != nil {
 		return fmt.Errorf("failed to save chunk metadata: %w", err)
 	}
 
@@ -93,13 +183,179 @@ func (g *GormDB) SaveChunkMetadata(fileHash, chunkHash string, chunkOrder int) e
 
 }
 
+func (g *GormDB) CompleteFile(fileHash string, totalChunks int) (bool, error) {
+	var fileMetadata model.FileMetadata
+	err := byFileHash(g.db.Select("id", "file_hash", "complete"), fileHash).First(&fileMetadata).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, ErrFileNotFound
+	} else if err != nil {
+		return false, fmt.Errorf("failed to get file metadata: %w", err)
+	}
+	if fileMetadata.Complete {
+		return true, nil
+	}
+
+	// only hash the chunks once every position is stored
+	var positions struct {
+		Count    int
+		MaxOrder int
+	}
+	err = g.db.Model(&model.ChunkMetadata{}).Select("COUNT(*) AS count, COALESCE(MAX(chunk_order), 0) AS max_order").
+		Where("file_metadata_id = ?", fileMetadata.ID).Scan(&positions).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to count chunks: %w", err)
+	}
+	if positions.Count == 0 || positions.MaxOrder != positions.Count || (totalChunks > 0 && positions.Count != totalChunks) {
+		return false, nil
+	}
+
+	var chunks []model.ChunkMetadata
+	if err := g.db.Where("file_metadata_id = ?", fileMetadata.ID).Find(&chunks).Error; err != nil {
+		return false, fmt.Errorf("failed to get chunk metadata: %w", err)
+	}
+	if !ChunksHashToFile(fileMetadata.FileHash, chunks) {
+		return false, nil
+	}
+	if err := g.db.Model(&fileMetadata).UpdateColumn("complete", true).Error; err != nil {
+		return false, fmt.Errorf("failed to complete file: %w", err)
+	}
+	return true, nil
+}
+
+func (g *GormDB) RecordUploadedChunk(fileHash string, userID uint, chunkOrder int, chunkHash string, chunkSize int64) (bool, error) {
+	var fileMetadata model.FileMetadata
+	err := byFileHash(g.db.Select("id"), fileHash).First(&fileMetadata).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, ErrFileNotFound
+	} else if err != nil {
+		return false, fmt.Errorf("failed to get file metadata: %w", err)
+	}
+
+	var owners int64
+	if err := g.db.Model(&model.FileOwner{}).Where("file_metadata_id = ? AND user_id = ?", fileMetadata.ID, userID).Count(&owners).Error; err != nil {
+		return false, fmt.Errorf("failed to check file owner: %w", err)
+	}
+	if owners > 0 {
+		return true, nil
+	}
+
+	owned := false
+	err = g.db.Transaction(func(tx *gorm.DB) error {
+		// write before reading so that concurrent uploads queue for the lock rather than fail to upgrade theirs
+		uploaded := model.UploadedChunk{FileMetadataID: fileMetadata.ID, UserID: userID, ChunkOrder: chunkOrder, ChunkHash: chunkHash, Size: chunkSize}
+		if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&uploaded).Error; err != nil {
+			return fmt.Errorf("failed to record uploaded chunk: %w", err)
+		}
+		if err := tx.Model(&fileMetadata).UpdateColumn("last_chunk_at", time.Now()).Error; err != nil {
+			return fmt.Errorf("failed to record uploaded chunk: %w", err)
+		}
+		if err := tx.Preload("Chunks").Where("id = ?", fileMetadata.ID).First(&fileMetadata).Error; err != nil {
+			return fmt.Errorf("failed to get file metadata: %w", err)
+		}
+		var uploads []model.UploadedChunk
+		if err := tx.Where("file_metadata_id = ? AND user_id = ?", fileMetadata.ID, userID).Find(&uploads).Error; err != nil {
+			return fmt.Errorf("failed to get uploaded chunks: %w", err)
+		}
+
+		if fileMetadata.Complete {
+			if err := CheckUploadedChunk(fileMetadata.Chunks, uploaded); err != nil {
+				return err
+			}
+		} else {
+			// chunks stored first by someone who does not have the file must not keep it from
+			// completing, so the user's own chunks replace them once they hash to the file hash
+			chunks := UploadedChunksOf(uploads)
+			if !ChunksHashToFile(fileMetadata.FileHash, chunks) {
+				return nil
+			}
+			if err := replaceChunks(tx, &fileMetadata, chunks); err != nil {
+				return fmt.Errorf("failed to replace chunks: %w", err)
+			}
+		}
+		if !UploadedChunksCover(fileMetadata.Chunks, uploads) {
+			return nil
+		}
+
+		if err := addFileOwner(tx, fileMetadata.ID, userID); err != nil {
+			return fmt.Errorf("failed to add file owner: %w", err)
+		}
+		if err := tx.Where("file_metadata_id = ? AND user_id = ?", fileMetadata.ID, userID).Delete(&model.UploadedChunk{}).Error; err != nil {
+			return fmt.Errorf("failed to delete uploaded chunks: %w", err)
+		}
+		owned = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return owned, nil
+}
+
+func (g *GormDB) ExpireIncompleteFiles(before time.Time, dryRun bool) ([]string, error) {
+	var files []model.FileMetadata
+	if err := g.abandonedFiles(g.db, before).Select("id", "file_hash").Find(&files).Error; err != nil {
+		return nil, fmt.Errorf("failed to list incomplete files: %w", err)
+	}
+
+	expired := []string{}
+	for _, file := range files {
+		if dryRun {
+			expired = append(expired, file.FileHash)
+			continue
+		}
+		deleted := false
+		err := g.db.Transaction(func(tx *gorm.DB) error {
+			// write before reading, and keep the file if an upload continued it since it was listed
+			result := g.abandonedFiles(tx, before).Where("id = ?", file.ID).UpdateColumn("last_chunk_at", gorm.Expr("last_chunk_at"))
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+			if err := tx.Preload("Chunks").Where("id = ?", file.ID).First(&file).Error; err != nil {
+				return err
+			}
+			deleted = true
+			return deleteFile(tx, &file)
+		})
+		if err != nil {
+			return expired, fmt.Errorf("failed to expire file %s: %w", file.FileHash, err)
+		}
+		if deleted {
+			expired = append(expired, file.FileHash)
+		}
+	}
+	return expired, nil
+}
+
+// abandonedFiles selects the incomplete files without owners that nobody uploaded a chunk of since before
+func (g *GormDB) abandonedFiles(tx *gorm.DB, before time.Time) *gorm.DB {
+	return tx.Model(&model.FileMetadata{}).
+		Where("complete = ? AND created_at < ? AND last_chunk_at < ?", false, before, before).
+		Where("id NOT IN (?)", tx.Model(&model.FileOwner{}).Select("file_metadata_id"))
+}
+
+func (g *GormDB) AddFileAlias(fileHash, alias string) error {
+	fileMetadata := model.FileMetadata{}
+	err := byFileHash(g.db.Select("id"), fileHash).First(&fileMetadata).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrFileNotFound
+	} else if err != nil {
+		return fmt.Errorf("failed to get file metadata: %w", err)
+	}
+
+	err = g.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&model.FileAlias{AliasHash: hasher.CanonicalHash(alias), FileMetadataID: fileMetadata.ID}).Error
+	if err != nil {
+		return fmt.Errorf("failed to add file alias: %w", err)
+	}
+	return nil
+}
+
 func (g *GormDB) GetFileMetadata(fileHash string) (*model.FileMetadata, error) {
 	var fileMetadata model.FileMetadata
 
-	err := g.db.Preload("Chunks").Where("file_hash = ?", fileHash).First(&fileMetadata).Error
+	err := byFileHash(g.db.Preload("Chunks"), fileHash).First(&fileMetadata).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, gorm.ErrRecordNotFound
+			return nil, nil
 		}
 		return nil, fmt.Errorf("failed to get file metadata: %w", err)
 	}
@@ -109,10 +365,7 @@ func (g *GormDB) GetFileMetadata(fileHash string) (*model.FileMetadata, error) {
 
 func (g *GormDB) CheckFileExists(fileHash string) (bool, error) {
 	var file model.FileMetadata
-	err := g.db.
-		Select("id").
-		Where("file_hash = ?", fileHash).
-		First(&file).Error
+	err := byFileHash(g.db.Select("id"), fileHash).First(&file).Error
 
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -123,3 +376,990 @@ func (g *GormDB) CheckFileExists(fileHash string) (bool, error) {
 
 	return true, nil
 }
+
+func (g *GormDB) SaveFileMetadata(metadata *model.FileMetadata) error {
+	metadata.Size = 0
+	for _, chunk := range metadata.Chunks {
+		metadata.Size += chunk.Size
+	}
+	metadata.Complete = ChunksHashToFile(metadata.FileHash, metadata.Chunks)
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(metadata).Error; err != nil {
+			return err
+		}
+		if err := addTotals(tx, model.Totals{Files: 1}); err != nil {
+			return err
+		}
+		for _, chunk := range metadata.Chunks {
+			if err := addChunkRef(tx, chunk.ChunkHash, 1, chunk.Size); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save file metadata: %w", err)
+	}
+	return nil
+}
+
+func (g *GormDB) SetFileInfo(fileHash, name, contentType, uploader string) error {
+	// only empty fields are set, so the first upload of a file names it
+	keep := func(column, value string) clause.Expr {
+		return gorm.Expr("CASE WHEN COALESCE("+column+", '') = '' THEN ? ELSE "+column+" END", value)
+	}
+	result := byFileHash(g.db.Model(&model.FileMetadata{}), fileHash).Updates(map[string]interface{}{
+		"name":         keep("name", name),
+		"content_type": keep("content_type", contentType),
+		"uploader":     keep("uploader", uploader),
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to set file info: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrFileNotFound
+	}
+	return nil
+}
+
+func (g *GormDB) DeleteFileMetadata(fileHash string) error {
+	return g.db.Transaction(func(tx *gorm.DB) error {
+		var fileMetadata model.FileMetadata
+		err := byFileHash(tx.Preload("Chunks"), fileHash).First(&fileMetadata).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrFileNotFound
+		} else if err != nil {
+			return fmt.Errorf("failed to get file metadata: %w", err)
+		}
+
+		var owners []uint
+		if err := tx.Model(&model.FileOwner{}).Where("file_metadata_id = ?", fileMetadata.ID).Pluck("user_id", &owners).Error; err != nil {
+			return fmt.Errorf("failed to get file owners: %w", err)
+		}
+		for _, userID := range owners {
+			if err := releaseFile(tx, userID, fileMetadata.Chunks); err != nil {
+				return fmt.Errorf("failed to release usage: %w", err)
+			}
+		}
+		return deleteFile(tx, &fileMetadata)
+	})
+}
+
+func (g *GormDB) RemoveFileOwner(fileHash string, userID uint) (bool, error) {
+	deleted := false
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		var fileMetadata model.FileMetadata
+		err := byFileHash(tx.Preload("Chunks"), fileHash).First(&fileMetadata).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrFileNotFound
+		} else if err != nil {
+			return fmt.Errorf("failed to get file metadata: %w", err)
+		}
+
+		result := tx.Where("file_metadata_id = ? AND user_id = ?", fileMetadata.ID, userID).Delete(&model.FileOwner{})
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete file owner: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrFileNotFound
+		}
+		if err := tx.Where("file_metadata_id = ? AND user_id = ?", fileMetadata.ID, userID).Delete(&model.PathEntry{}).Error; err != nil {
+			return fmt.Errorf("failed to delete file paths: %w", err)
+		}
+		if err := releaseFile(tx, userID, fileMetadata.Chunks); err != nil {
+			return fmt.Errorf("failed to release usage: %w", err)
+		}
+
+		var owners int64
+		if err := tx.Model(&model.FileOwner{}).Where("file_metadata_id = ?", fileMetadata.ID).Count(&owners).Error; err != nil {
+			return fmt.Errorf("failed to count file owners: %w", err)
+		}
+		if owners > 0 {
+			return nil
+		}
+		deleted = true
+		return deleteFile(tx, &fileMetadata)
+	})
+	if err != nil {
+		return false, err
+	}
+	return deleted, nil
+}
+
+func (g *GormDB) AddFileOwner(fileHash string, userID uint) error {
+	var fileMetadata model.FileMetadata
+	err := byFileHash(g.db.Select("id"), fileHash).First(&fileMetadata).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrFileNotFound
+	} else if err != nil {
+		return fmt.Errorf("failed to get file metadata: %w", err)
+	}
+
+	err = g.db.Transaction(func(tx *gorm.DB) error {
+		return addFileOwner(tx, fileMetadata.ID, userID)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add file owner: %w", err)
+	}
+	return nil
+}
+
+func (g *GormDB) CheckFileOwner(fileHash string, userID uint) (bool, error) {
+	var count int64
+	fileIDs := byFileHash(g.db.Model(&model.FileMetadata{}).Select("id"), fileHash)
+	err := g.db.Model(&model.FileOwner{}).Where("user_id = ? AND file_metadata_id IN (?)", userID, fileIDs).Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("database error checking file owner: %w", err)
+	}
+	return count > 0, nil
+}
+
+func (g *GormDB) CheckFileAccess(fileHash string, userID uint) (bool, error) {
+	var count int64
+	err := byFileHash(g.readableFiles(userID), fileHash).Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("database error checking file access: %w", err)
+	}
+	return count > 0, nil
+}
+
+func (g *GormDB) CheckChunkAccess(chunkHash string, userID uint) (bool, error) {
+	var count int64
+	fileIDs := g.readableFiles(userID).Select("id")
+	err := g.db.Model(&model.ChunkMetadata{}).Where("chunk_hash IN ? AND file_metadata_id IN (?)", hasher.HashVariants(chunkHash), fileIDs).Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("database error checking chunk access: %w", err)
+	}
+	return count > 0, nil
+}
+
+func (g *GormDB) GrantFileAccess(fileHash string, userID, grantedBy uint) error {
+	var fileMetadata model.FileMetadata
+	err := byFileHash(g.db.Select("id"), fileHash).First(&fileMetadata).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrFileNotFound
+	} else if err != nil {
+		return fmt.Errorf("failed to get file metadata: %w", err)
+	}
+
+	grant := model.FileGrant{FileMetadataID: fileMetadata.ID, UserID: userID, GrantedBy: grantedBy}
+	if err := g.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&grant).Error; err != nil {
+		return fmt.Errorf("failed to grant file access: %w", err)
+	}
+	return nil
+}
+
+func (g *GormDB) RevokeFileAccess(fileHash string, userID uint) error {
+	result := g.db.Where("user_id = ? AND file_metadata_id IN (?)", userID, g.fileIDs(fileHash)).Delete(&model.FileGrant{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke file access: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrGrantNotFound
+	}
+	return nil
+}
+
+func (g *GormDB) ListFileGrants(fileHash string) ([]model.FileGrant, error) {
+	var grants []model.FileGrant
+	err := g.db.Model(&model.FileGrant{}).
+		Select("file_grants.*, users.username").
+		Joins("JOIN users ON users.id = file_grants.user_id").
+		Where("file_grants.file_metadata_id IN (?)", g.fileIDs(fileHash)).
+		Order("file_grants.created_at, file_grants.user_id").
+		Find(&grants).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list file grants: %w", err)
+	}
+	return grants, nil
+}
+
+func (g *GormDB) CreateShareLink(fileHash string, link *model.ShareLink) error {
+	var fileMetadata model.FileMetadata
+	err := byFileHash(g.db.Select("id", "file_hash"), fileHash).First(&fileMetadata).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrFileNotFound
+	} else if err != nil {
+		return fmt.Errorf("failed to get file metadata: %w", err)
+	}
+
+	link.FileMetadataID = fileMetadata.ID
+	if err := g.db.Create(link).Error; err != nil {
+		return fmt.Errorf("failed to create share link: %w", err)
+	}
+	link.FileHash = fileMetadata.FileHash
+	return nil
+}
+
+func (g *GormDB) GetShareLink(token string) (*model.ShareLink, error) {
+	var link model.ShareLink
+	err := g.shareLinks().Where("share_links.token = ?", token).First(&link).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrShareLinkNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get share link: %w", err)
+	}
+	return &link, nil
+}
+
+func (g *GormDB) ListShareLinks(fileHash string) ([]model.ShareLink, error) {
+	var links []model.ShareLink
+	err := g.shareLinks().
+		Where("share_links.file_metadata_id IN (?)", g.fileIDs(fileHash)).
+		Order("share_links.created_at, share_links.token").
+		Find(&links).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list share links: %w", err)
+	}
+	return links, nil
+}
+
+func (g *GormDB) DeleteShareLink(fileHash, token string) error {
+	result := g.db.Where("token = ? AND file_metadata_id IN (?)", token, g.fileIDs(fileHash)).Delete(&model.ShareLink{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete share link: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrShareLinkNotFound
+	}
+	return nil
+}
+
+func (g *GormDB) CreateDirectory(userID uint, dirPath string) (*model.PathEntry, error) {
+	entry := model.PathEntry{UserID: userID, Path: dirPath, Parent: path.Dir(dirPath), IsDir: true}
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkPathFree(tx, userID, dirPath); err != nil {
+			return err
+		}
+		return tx.Create(&entry).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	return &entry, nil
+}
+
+func (g *GormDB) SaveFilePath(userID uint, filePath, fileHash string) (*model.PathEntry, error) {
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		var fileMetadata model.FileMetadata
+		err := byFileHash(tx.Select("id"), fileHash).First(&fileMetadata).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrFileNotFound
+		} else if err != nil {
+			return err
+		}
+
+		var existing model.PathEntry
+		err = tx.Where("user_id = ? AND path = ?", userID, filePath).First(&existing).Error
+		if err == nil {
+			if existing.IsDir {
+				return ErrPathExists
+			}
+			return tx.Model(&existing).Update("file_metadata_id", fileMetadata.ID).Error
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if err := checkPathFree(tx, userID, filePath); err != nil {
+			return err
+		}
+		return tx.Create(&model.PathEntry{UserID: userID, Path: filePath, Parent: path.Dir(filePath), FileMetadataID: fileMetadata.ID}).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save file path: %w", err)
+	}
+	return g.GetPathEntry(userID, filePath)
+}
+
+func (g *GormDB) GetPathEntry(userID uint, entryPath string) (*model.PathEntry, error) {
+	var entry model.PathEntry
+	err := g.pathEntries().Where("path_entries.user_id = ? AND path_entries.path = ?", userID, entryPath).First(&entry).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPathNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get path: %w", err)
+	}
+	return &entry, nil
+}
+
+func (g *GormDB) ListDirectory(userID uint, dirPath string) ([]model.PathEntry, error) {
+	if dirPath != "/" {
+		dir, err := g.GetPathEntry(userID, dirPath)
+		if err != nil {
+			return nil, err
+		}
+		if !dir.IsDir {
+			return nil, ErrNotDirectory
+		}
+	}
+
+	var entries []model.PathEntry
+	err := g.pathEntries().
+		Where("path_entries.user_id = ? AND path_entries.parent = ?", userID, dirPath).
+		Order("path_entries.is_dir DESC, path_entries.path").
+		Find(&entries).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list directory: %w", err)
+	}
+	return entries, nil
+}
+
+func (g *GormDB) MovePath(userID uint, fromPath, toPath string) (*model.PathEntry, error) {
+	if strings.HasPrefix(toPath, fromPath+"/") {
+		return nil, ErrInvalidMove
+	}
+
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		var entry model.PathEntry
+		err := tx.Where("user_id = ? AND path = ?", userID, fromPath).First(&entry).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrPathNotFound
+		} else if err != nil {
+			return err
+		}
+		if fromPath == toPath {
+			return nil
+		}
+		if err := checkPathFree(tx, userID, toPath); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&entry).Updates(map[string]interface{}{"path": toPath, "parent": path.Dir(toPath)}).Error; err != nil {
+			return err
+		}
+		if !entry.IsDir {
+			return nil
+		}
+		// the entries below the directory keep the part of their paths after it, cut in bytes
+		suffix := len(fromPath) + 1
+		return tx.Model(&model.PathEntry{}).Where("user_id = ?", userID).Where(belowPath(fromPath)).
+			Updates(map[string]interface{}{
+				"path":   gorm.Expr("? || CAST(substr(CAST(path AS BLOB), ?) AS TEXT)", toPath, suffix),
+				"parent": gorm.Expr("? || CAST(substr(CAST(parent AS BLOB), ?) AS TEXT)", toPath, suffix),
+			}).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to move path: %w", err)
+	}
+	return g.GetPathEntry(userID, toPath)
+}
+
+func (g *GormDB) DeletePath(userID uint, entryPath string, recursive bool) (int64, error) {
+	var removed int64
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		var entry model.PathEntry
+		err := tx.Where("user_id = ? AND path = ?", userID, entryPath).First(&entry).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrPathNotFound
+		} else if err != nil {
+			return err
+		}
+
+		if entry.IsDir {
+			below := tx.Where("user_id = ?", userID).Where(belowPath(entryPath))
+			if !recursive {
+				var count int64
+				if err := below.Model(&model.PathEntry{}).Count(&count).Error; err != nil {
+					return err
+				}
+				if count > 0 {
+					return ErrDirectoryNotEmpty
+				}
+			} else {
+				result := below.Delete(&model.PathEntry{})
+				if result.Error != nil {
+					return result.Error
+				}
+				removed += result.RowsAffected
+			}
+		}
+
+		if err := tx.Delete(&entry).Error; err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete path: %w", err)
+	}
+	return removed, nil
+}
+
+// pathEntries selects path entries with the hash, size and content type of their files
+func (g *GormDB) pathEntries() *gorm.DB {
+	return g.db.Model(&model.PathEntry{}).
+		Select("path_entries.*, COALESCE(file_metadata.file_hash, '') AS file_hash, " +
+			"COALESCE(file_metadata.size, 0) AS size, COALESCE(file_metadata.content_type, '') AS content_type").
+		Joins("LEFT JOIN file_metadata ON file_metadata.id = path_entries.file_metadata_id")
+}
+
+// checkPathFree checks that nothing exists at a path of a user and that its parent is a directory
+func checkPathFree(tx *gorm.DB, userID uint, entryPath string) error {
+	var count int64
+	if err := tx.Model(&model.PathEntry{}).Where("user_id = ? AND path = ?", userID, entryPath).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrPathExists
+	}
+
+	parent := path.Dir(entryPath)
+	if parent == "/" {
+		return nil
+	}
+	if err := tx.Model(&model.PathEntry{}).Where("user_id = ? AND path = ? AND is_dir = ?", userID, parent, true).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrParentNotFound
+	}
+	return nil
+}
+
+// belowPath matches the paths below a directory. It compares bytes, as LIKE ignores the case of
+// ASCII letters and substr counts characters of text.
+func belowPath(dirPath string) clause.Expr {
+	prefix := dirPath + "/"
+	return gorm.Expr("substr(CAST(path AS BLOB), 1, ?) = CAST(? AS BLOB)", len(prefix), prefix)
+}
+
+// fileIDs selects the id of the file stored under any spelling of fileHash
+func (g *GormDB) fileIDs(fileHash string) *gorm.DB {
+	return byFileHash(g.db.Model(&model.FileMetadata{}).Select("id"), fileHash)
+}
+
+// byFileHash restricts a query on file metadata to the file with a hash, in any spelling or as an alias
+func byFileHash(tx *gorm.DB, fileHash string) *gorm.DB {
+	variants := hasher.HashVariants(fileHash)
+	aliased := tx.Session(&gorm.Session{NewDB: true}).Model(&model.FileAlias{}).Select("file_metadata_id").Where("alias_hash IN ?", variants)
+	return tx.Where("(file_hash IN ? OR id IN (?))", variants, aliased)
+}
+
+// readableFiles selects the files a user owns or has been granted access to
+func (g *GormDB) readableFiles(userID uint) *gorm.DB {
+	owned := g.db.Model(&model.FileOwner{}).Select("file_metadata_id").Where("user_id = ?", userID)
+	granted := g.db.Model(&model.FileGrant{}).Select("file_metadata_id").Where("user_id = ?", userID)
+	return g.db.Model(&model.FileMetadata{}).Where("(id IN (?) OR id IN (?))", owned, granted)
+}
+
+// shareLinks selects share links with the hash of their file
+func (g *GormDB) shareLinks() *gorm.DB {
+	return g.db.Model(&model.ShareLink{}).
+		Select("share_links.*, file_metadata.file_hash").
+		Joins("JOIN file_metadata ON file_metadata.id = share_links.file_metadata_id")
+}
+
+func (g *GormDB) GetUsage(userID uint) (*model.Usage, error) {
+	var usage model.Usage
+	err := g.db.Where("user_id = ?", userID).First(&usage).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &model.Usage{UserID: userID}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get usage: %w", err)
+	}
+	return &usage, nil
+}
+
+func (g *GormDB) GetChunkRef(chunkHash string) (*model.ChunkRef, error) {
+	var ref model.ChunkRef
+	err := g.db.Where("chunk_hash = ?", hasher.CanonicalHash(chunkHash)).First(&ref).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get chunk reference: %w", err)
+	}
+	return &ref, nil
+}
+
+func (g *GormDB) SetChunkSize(chunkHash string, size int64) error {
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.ChunkMetadata{}).Where("chunk_hash IN ?", hasher.HashVariants(chunkHash)).Update("size", size).Error; err != nil {
+			return err
+		}
+		fileIDs := tx.Model(&model.ChunkMetadata{}).Select("file_metadata_id").Where("chunk_hash IN ?", hasher.HashVariants(chunkHash))
+		if err := sumFileSizes(tx, "id IN (?)", fileIDs); err != nil {
+			return err
+		}
+		ref := model.ChunkRef{ChunkHash: hasher.CanonicalHash(chunkHash)}
+		err := tx.Where(&ref).First(&ref).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		var totals model.Totals
+		AddChunkTotals(&totals, ref, -1)
+		ref.Size = size
+		AddChunkTotals(&totals, ref, 1)
+		if err := tx.Model(&ref).Update("size", size).Error; err != nil {
+			return err
+		}
+		return addTotals(tx, totals)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set chunk size: %w", err)
+	}
+	return nil
+}
+
+func (g *GormDB) CheckChunkReferenced(chunkHash string) (bool, error) {
+	var count int64
+	err := g.db.Model(&model.ChunkMetadata{}).
+		Where("chunk_hash IN ?", hasher.HashVariants(chunkHash)).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("database error checking chunk references: %w", err)
+	}
+
+	return count > 0, nil
+}
+
+func (g *GormDB) MarkChunkDamaged(chunkHash string) ([]string, error) {
+	var fileHashes []string
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		fileIDs := tx.Model(&model.ChunkMetadata{}).
+			Select("file_metadata_id").
+			Where("chunk_hash IN ?", hasher.HashVariants(chunkHash))
+
+		if err := tx.Model(&model.FileMetadata{}).Where("id IN (?)", fileIDs).Update("damaged", true).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.FileMetadata{}).Where("id IN (?)", fileIDs).Order("id").Pluck("file_hash", &fileHashes).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark files damaged: %w", err)
+	}
+	return fileHashes, nil
+}
+
+func (g *GormDB) ListDamagedFiles() ([]string, error) {
+	var fileHashes []string
+	if err := g.db.Model(&model.FileMetadata{}).Where("damaged = ?", true).Order("id").Pluck("file_hash", &fileHashes).Error; err != nil {
+		return nil, fmt.Errorf("database error listing damaged files: %w", err)
+	}
+	return fileHashes, nil
+}
+
+func (g *GormDB) CheckMigrationApplied(name string) (bool, error) {
+	var count int64
+	if err := g.db.Model(&model.Migration{}).Where("name = ?", name).Count(&count).Error; err != nil {
+		return false, fmt.Errorf("database error checking migration: %w", err)
+	}
+
+	return count > 0, nil
+}
+
+func (g *GormDB) SaveMigration(name string) error {
+	if err := g.db.Create(&model.Migration{Name: name, AppliedAt: time.Now()}).Error; err != nil {
+		return fmt.Errorf("failed to save migration: %w", err)
+	}
+	return nil
+}
+
+func (g *GormDB) ListReferencedChunks() ([]string, error) {
+	var hashes []string
+	if err := g.db.Model(&model.ChunkRef{}).Where("ref_count > 0").Pluck("chunk_hash", &hashes).Error; err != nil {
+		return nil, fmt.Errorf("failed to list referenced chunks: %w", err)
+	}
+	return hashes, nil
+}
+
+func (g *GormDB) ListUnsizedChunks() ([]string, error) {
+	var hashes []string
+	if err := g.db.Model(&model.ChunkMetadata{}).Distinct().Where("size = 0").Pluck("chunk_hash", &hashes).Error; err != nil {
+		return nil, fmt.Errorf("failed to list unsized chunks: %w", err)
+	}
+	return CanonicalHashes(hashes), nil
+}
+
+func (g *GormDB) HasFiles() (bool, error) {
+	var ids []uint
+	if err := g.db.Model(&model.FileMetadata{}).Limit(1).Pluck("id", &ids).Error; err != nil {
+		return false, fmt.Errorf("failed to check for files: %w", err)
+	}
+	return len(ids) > 0, nil
+}
+
+func (g *GormDB) GetStats() (*model.Stats, error) {
+	var totals model.Totals
+	if err := g.db.Where("id = ?", totalsID).Limit(1).Find(&totals).Error; err != nil {
+		return nil, fmt.Errorf("failed to get totals: %w", err)
+	}
+	return &model.Stats{Files: totals.Files, Chunks: totals.Chunks, ChunkBytes: totals.ChunkBytes, LogicalBytes: totals.LogicalBytes}, nil
+}
+
+func (g *GormDB) ListSharedChunks(userID uint, limit int) ([]model.ChunkRef, error) {
+	query := g.db.Where("ref_count > 1")
+	if userID != 0 {
+		query = query.Where("chunk_hash IN (?)", g.db.Model(&model.UserChunkRef{}).Select("chunk_hash").Where("user_id = ?", userID))
+	}
+	var refs []model.ChunkRef
+	if err := query.Order("ref_count DESC, chunk_hash").Limit(limit).Find(&refs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list shared chunks: %w", err)
+	}
+	return refs, nil
+}
+
+func (g *GormDB) RebuildChunkRefs() error {
+	var chunks []model.ChunkMetadata
+	if err := g.db.Select("file_metadata_id", "chunk_order", "chunk_hash", "size").Find(&chunks).Error; err != nil {
+		return fmt.Errorf("failed to list chunk metadata: %w", err)
+	}
+	var owners []model.FileOwner
+	if err := g.db.Find(&owners).Error; err != nil {
+		return fmt.Errorf("failed to list file owners: %w", err)
+	}
+	var files []model.FileMetadata
+	if err := g.db.Select("id", "file_hash").Find(&files).Error; err != nil {
+		return fmt.Errorf("failed to list file metadata: %w", err)
+	}
+
+	counts := CountChunkRefs(chunks, owners)
+	totals := model.Totals{ID: totalsID, Files: int64(len(files))}
+	for _, ref := range counts.Refs {
+		AddChunkTotals(&totals, *ref, 1)
+	}
+	fileChunks := make(map[uint][]model.ChunkMetadata)
+	for _, chunk := range chunks {
+		fileChunks[chunk.FileMetadataID] = append(fileChunks[chunk.FileMetadataID], chunk)
+	}
+	var complete []uint
+	for _, file := range files {
+		if ChunksHashToFile(file.FileHash, fileChunks[file.ID]) {
+			complete = append(complete, file.ID)
+		}
+	}
+
+	return g.db.Transaction(func(tx *gorm.DB) error {
+		for _, table := range []interface{}{&model.ChunkRef{}, &model.UserChunkRef{}, &model.Usage{}, &model.Totals{}} {
+			if err := tx.Where("1 = 1").Delete(table).Error; err != nil {
+				return fmt.Errorf("failed to clear chunk references: %w", err)
+			}
+		}
+		for _, ref := range counts.Refs {
+			if err := tx.Create(ref).Error; err != nil {
+				return fmt.Errorf("failed to save chunk references: %w", err)
+			}
+		}
+		if len(counts.UserRefs) > 0 {
+			if err := tx.CreateInBatches(counts.UserRefs, 500).Error; err != nil {
+				return fmt.Errorf("failed to save user chunk references: %w", err)
+			}
+		}
+		for _, usage := range counts.Usages {
+			if err := tx.Create(usage).Error; err != nil {
+				return fmt.Errorf("failed to save usage: %w", err)
+			}
+		}
+		if err := tx.Create(&totals).Error; err != nil {
+			return fmt.Errorf("failed to save totals: %w", err)
+		}
+		if err := sumFileSizes(tx, "1 = 1"); err != nil {
+			return fmt.Errorf("failed to sum file sizes: %w", err)
+		}
+		if err := tx.Model(&model.FileMetadata{}).Where("1 = 1").UpdateColumn("complete", false).Error; err != nil {
+			return fmt.Errorf("failed to reset complete files: %w", err)
+		}
+		for start := 0; start < len(complete); start += 500 {
+			batch := complete[start:min(start+500, len(complete))]
+			if err := tx.Model(&model.FileMetadata{}).Where("id IN ?", batch).UpdateColumn("complete", true).Error; err != nil {
+				return fmt.Errorf("failed to mark complete files: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// sumFileSizes sets the size of the files matching the condition to the sum of the sizes of their chunks
+func sumFileSizes(tx *gorm.DB, query string, args ...interface{}) error {
+	return tx.Model(&model.FileMetadata{}).Where(query, args...).UpdateColumn("size", gorm.Expr(
+		"(SELECT COALESCE(SUM(size), 0) FROM chunk_metadata WHERE chunk_metadata.file_metadata_id = file_metadata.id)",
+	)).Error
+}
+
+// legacyChunkOrderIndex is the unique index of older databases that, despite its name, only
+// covered the chunk hash and so kept two files or positions from sharing a chunk
+const legacyChunkOrderIndex = "idx_file_chunk_order"
+
+// repairChunkMetadataSchema drops the legacy unique index on chunk hashes before AutoMigrate
+// creates the index on file and position. Positions of a file holding several chunks keep the
+// first one stored and the others are logged as they are dropped. The recount migration then
+// counts the chunk references, usage and file sizes without them.
+func repairChunkMetadataSchema(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&model.ChunkMetadata{}) || !migrator.HasIndex(&model.ChunkMetadata{}, legacyChunkOrderIndex) {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropIndex(&model.ChunkMetadata{}, legacyChunkOrderIndex); err != nil {
+			return err
+		}
+		first := tx.Model(&model.ChunkMetadata{}).Select("MIN(id)").Group("file_metadata_id, chunk_order")
+		var dropped []model.ChunkMetadata
+		if err := tx.Where("id NOT IN (?)", first).Find(&dropped).Error; err != nil {
+			return err
+		}
+		for _, chunk := range dropped {
+			log.Warn().Uint("file_id", chunk.FileMetadataID).Int("chunk_order", chunk.ChunkOrder).Str("chunk", chunk.ChunkHash).
+				Msg("Dropping an extra chunk stored at a position of a file")
+		}
+		return tx.Where("id NOT IN (?)", first).Delete(&model.ChunkMetadata{}).Error
+	})
+}
+
+// sameChunk returns ErrChunkConflict unless the chunk stored at a position of a file is chunkHash
+func sameChunk(stored model.ChunkMetadata, chunkHash string) error {
+	if !hasher.EqualHashes(stored.ChunkHash, chunkHash) {
+		return ErrChunkConflict
+	}
+	return nil
+}
+
+// addFileOwner makes a user an owner of a file and accounts its chunks to the user, unless the
+// user already owns it
+func addFileOwner(tx *gorm.DB, fileID, userID uint) error {
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.FileOwner{FileMetadataID: fileID, UserID: userID})
+	if result.Error != nil || result.RowsAffected == 0 {
+		// already an owner
+		return result.Error
+	}
+
+	var chunks []model.ChunkMetadata
+	if err := tx.Where("file_metadata_id = ?", fileID).Find(&chunks).Error; err != nil {
+		return err
+	}
+	return accountFile(tx, userID, chunks)
+}
+
+// replaceChunks replaces the chunks of an incomplete file with chunks that hash to its file hash,
+// marks it complete and clears the name, content type and uploader the replaced chunks came with
+func replaceChunks(tx *gorm.DB, fileMetadata *model.FileMetadata, chunks []model.ChunkMetadata) error {
+	var owners []uint
+	if err := tx.Model(&model.FileOwner{}).Where("file_metadata_id = ?", fileMetadata.ID).Pluck("user_id", &owners).Error; err != nil {
+		return err
+	}
+	for _, userID := range owners {
+		if err := releaseFile(tx, userID, fileMetadata.Chunks); err != nil {
+			return err
+		}
+	}
+	if err := tx.Where("file_metadata_id = ?", fileMetadata.ID).Delete(&model.ChunkMetadata{}).Error; err != nil {
+		return err
+	}
+
+	var size int64
+	for i := range chunks {
+		chunks[i].FileMetadataID = fileMetadata.ID
+		size += chunks[i].Size
+		if err := addChunkRef(tx, chunks[i].ChunkHash, 1, chunks[i].Size); err != nil {
+			return err
+		}
+	}
+	if err := tx.Create(&chunks).Error; err != nil {
+		return err
+	}
+	for _, chunk := range fileMetadata.Chunks {
+		if err := addChunkRef(tx, chunk.ChunkHash, -1, 0); err != nil {
+			return err
+		}
+	}
+	if err := tx.Where("ref_count <= 0").Delete(&model.ChunkRef{}).Error; err != nil {
+		return err
+	}
+
+	err := tx.Model(&model.FileMetadata{}).Where("id = ?", fileMetadata.ID).UpdateColumns(map[string]interface{}{
+		"size": size, "complete": true, "name": "", "content_type": "", "uploader": "",
+	}).Error
+	if err != nil {
+		return err
+	}
+	fileMetadata.Chunks = chunks
+	for _, userID := range owners {
+		if err := accountFile(tx, userID, chunks); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addChunkRef adds delta to the reference count of a chunk, records its size unless it is 0 and
+// updates the totals with the change
+func addChunkRef(tx *gorm.DB, chunkHash string, delta int, size int64) error {
+	ref := model.ChunkRef{ChunkHash: hasher.CanonicalHash(chunkHash)}
+	if err := tx.Where(&ref).First(&ref).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	var totals model.Totals
+	AddChunkTotals(&totals, ref, -1)
+	ref.RefCount += delta
+	if size > 0 {
+		ref.Size = size
+	}
+	AddChunkTotals(&totals, ref, 1)
+
+	err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "chunk_hash"}},
+		DoUpdates: clause.AssignmentColumns([]string{"ref_count", "size"}),
+	}).Create(&ref).Error
+	if err != nil {
+		return err
+	}
+	return addTotals(tx, totals)
+}
+
+// addTotals adds the counters of delta to the totals of all files
+func addTotals(tx *gorm.DB, delta model.Totals) error {
+	delta.ID = totalsID
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"files":         gorm.Expr("files + ?", delta.Files),
+			"chunks":        gorm.Expr("chunks + ?", delta.Chunks),
+			"chunk_bytes":   gorm.Expr("chunk_bytes + ?", delta.ChunkBytes),
+			"logical_bytes": gorm.Expr("logical_bytes + ?", delta.LogicalBytes),
+		}),
+	}).Create(&delta).Error
+}
+
+// addUserChunkRef adds delta to the references of a chunk from the files of a user. The user's
+// distinct chunks and unique bytes change when the user starts or stops referencing the chunk.
+func addUserChunkRef(tx *gorm.DB, userID uint, chunkHash string, delta int) error {
+	ref := model.UserChunkRef{UserID: userID, ChunkHash: hasher.CanonicalHash(chunkHash)}
+	err := tx.Where(&ref).First(&ref).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	before := ref.RefCount
+	ref.RefCount += delta
+	if ref.RefCount > 0 {
+		err = tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&ref).Error
+	} else {
+		err = tx.Delete(&ref).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case before <= 0 && ref.RefCount > 0:
+		return addChunkUser(tx, userID, ref.ChunkHash, 1)
+	case before > 0 && ref.RefCount <= 0:
+		return addChunkUser(tx, userID, ref.ChunkHash, -1)
+	}
+	return nil
+}
+
+// addChunkUser adds delta to the users of a chunk. The chunk's size is unique to a user while no
+// other user references it, so it moves between the users' unique bytes as they come and go.
+func addChunkUser(tx *gorm.DB, userID uint, chunkHash string, delta int) error {
+	var ref model.ChunkRef
+	if err := tx.Where("chunk_hash = ?", chunkHash).First(&ref).Error; err != nil {
+		return err
+	}
+	users := ref.Users + delta
+	if err := tx.Model(&ref).Update("users", users).Error; err != nil {
+		return err
+	}
+
+	usage := model.Usage{Chunks: int64(delta), ChunkBytes: int64(delta) * ref.Size}
+	switch {
+	case delta > 0 && users == 1, delta < 0 && users == 0:
+		usage.UniqueBytes = int64(delta) * ref.Size
+	case delta > 0 && users == 2, delta < 0 && users == 1:
+		// the only other user shares the chunk now, or has it to themselves again
+		var other model.UserChunkRef
+		if err := tx.Where("chunk_hash = ? AND user_id <> ?", chunkHash, userID).First(&other).Error; err != nil {
+			return err
+		}
+		if err := addUsage(tx, other.UserID, model.Usage{UniqueBytes: -int64(delta) * ref.Size}); err != nil {
+			return err
+		}
+	}
+	return addUsage(tx, userID, usage)
+}
+
+// deleteFile deletes a file with its chunk metadata, owners, uploaded chunks, grants, share links, paths and aliases and releases its chunk references.
+// The usage of its owners must already be released.
+func deleteFile(tx *gorm.DB, fileMetadata *model.FileMetadata) error {
+	if err := tx.Where("file_metadata_id = ?", fileMetadata.ID).Delete(&model.ChunkMetadata{}).Error; err != nil {
+		return fmt.Errorf("failed to delete chunk metadata: %w", err)
+	}
+	if err := tx.Where("file_metadata_id = ?", fileMetadata.ID).Delete(&model.FileOwner{}).Error; err != nil {
+		return fmt.Errorf("failed to delete file owners: %w", err)
+	}
+	if err := tx.Where("file_metadata_id = ?", fileMetadata.ID).Delete(&model.UploadedChunk{}).Error; err != nil {
+		return fmt.Errorf("failed to delete uploaded chunks: %w", err)
+	}
+	if err := tx.Where("file_metadata_id = ?", fileMetadata.ID).Delete(&model.FileGrant{}).Error; err != nil {
+		return fmt.Errorf("failed to delete file grants: %w", err)
+	}
+	if err := tx.Where("file_metadata_id = ?", fileMetadata.ID).Delete(&model.ShareLink{}).Error; err != nil {
+		return fmt.Errorf("failed to delete share links: %w", err)
+	}
+	if err := tx.Where("file_metadata_id = ?", fileMetadata.ID).Delete(&model.PathEntry{}).Error; err != nil {
+		return fmt.Errorf("failed to delete file paths: %w", err)
+	}
+	if err := tx.Where("file_metadata_id = ?", fileMetadata.ID).Delete(&model.FileAlias{}).Error; err != nil {
+		return fmt.Errorf("failed to delete file aliases: %w", err)
+	}
+	if err := tx.Delete(fileMetadata).Error; err != nil {
+		return fmt.Errorf("failed to delete file metadata: %w", err)
+	}
+	if err := addTotals(tx, model.Totals{Files: -1}); err != nil {
+		return fmt.Errorf("failed to count deleted file: %w", err)
+	}
+
+	// chunks shared with other files keep a positive count, the others become garbage
+	for _, chunk := range fileMetadata.Chunks {
+		if err := addChunkRef(tx, chunk.ChunkHash, -1, 0); err != nil {
+			return fmt.Errorf("failed to release chunk reference: %w", err)
+		}
+	}
+	if err := tx.Where("ref_count <= 0").Delete(&model.ChunkRef{}).Error; err != nil {
+		return fmt.Errorf("failed to delete chunk references: %w", err)
+	}
+	return nil
+}
+
+// accountFile adds a file with the given chunks to the usage of one of its owners
+func accountFile(tx *gorm.DB, userID uint, chunks []model.ChunkMetadata) error {
+	usage := model.Usage{Files: 1}
+	for _, chunk := range chunks {
+		usage.LogicalBytes += chunk.Size
+		if err := addUserChunkRef(tx, userID, chunk.ChunkHash, 1); err != nil {
+			return err
+		}
+	}
+	return addUsage(tx, userID, usage)
+}
+
+// releaseFile removes a file with the given chunks from the usage of one of its owners
+func releaseFile(tx *gorm.DB, userID uint, chunks []model.ChunkMetadata) error {
+	usage := model.Usage{Files: -1}
+	for _, chunk := range chunks {
+		usage.LogicalBytes -= chunk.Size
+		if err := addUserChunkRef(tx, userID, chunk.ChunkHash, -1); err != nil {
+			return err
+		}
+	}
+	return addUsage(tx, userID, usage)
+}
+
+// addUsage adds the counters of delta to the usage of a user
+func addUsage(tx *gorm.DB, userID uint, delta model.Usage) error {
+	delta.UserID = userID
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"files":         gorm.Expr("files + ?", delta.Files),
+			"chunks":        gorm.Expr("chunks + ?", delta.Chunks),
+			"chunk_bytes":   gorm.Expr("chunk_bytes + ?", delta.ChunkBytes),
+			"logical_bytes": gorm.Expr("logical_bytes + ?", delta.LogicalBytes),
+			"unique_bytes":  gorm.Expr("unique_bytes + ?", delta.UniqueBytes),
+		}),
+	}).Create(&delta).Error
+}
@@ -1,8 +1,10 @@
 package storage
 
 import (
+	"path/filepath"
 	"testing"
 	"zerodupe/internal/server/model"
+	"zerodupe/pkg/hasher"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -10,11 +12,25 @@ import (
 	"gorm.io/gorm"
 )
 
+const testChunker = "fastcdc:2048:8192:65536"
+
+// legacyChunkMetadata is the chunk metadata schema of older databases, whose unique index only covered the chunk hash
+type legacyChunkMetadata struct {
+	ID             uint `gorm:"primaryKey;autoIncrement"`
+	FileMetadataID uint `gorm:"index"`
+	ChunkOrder     int
+	ChunkHash      string `gorm:"uniqueIndex:idx_file_chunk_order,priority:2"`
+}
+
+func (legacyChunkMetadata) TableName() string {
+	return "chunk_metadata"
+}
+
 func setupTestGormDB(t *testing.T) *GormDB {
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	require.NoError(t, err)
 
-	err = db.AutoMigrate(&model.User{}, &model.FileMetadata{}, &model.ChunkMetadata{})
+	err = db.AutoMigrate(gormModels...)
 	require.NoError(t, err)
 
 	return &GormDB{db: db}
@@ -79,8 +95,8 @@ func TestGetUserByUsername(t *testing.T) {
 	t.Run("Test GetUserByUsername returns error for non-existing user", func(t *testing.T) {
 		db := setupTestGormDB(t)
 		_, err := db.GetUserByUsername("test")
-		assert.Error(t, err)
-		assert.Equal(t, gorm.ErrRecordNotFound, err)
+		assert.ErrorIs(t, err, ErrUserNotFound)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
 	})
 }
 
@@ -92,12 +108,13 @@ func TestSaveChunkMetadata(t *testing.T) {
 		chunkHash := "chunkhash12345678910"
 		chunkOrder := 1
 
-		err := db.SaveChunkMetadata(fileHash, chunkHash, chunkOrder)
+		err := db.SaveChunkMetadata(fileHash, chunkHash, chunkOrder, 0, testChunker)
 		assert.NoError(t, err)
 		fileMeta, err := db.GetFileMetadata(fileHash)
 		assert.NoError(t, err)
 		assert.NotNil(t, fileMeta)
 		assert.Equal(t, fileHash, fileMeta.FileHash)
+		assert.Equal(t, testChunker, fileMeta.Chunker)
 		assert.Len(t, fileMeta.Chunks, 1)
 		assert.Equal(t, chunkHash, fileMeta.Chunks[0].ChunkHash)
 		assert.Equal(t, chunkOrder, fileMeta.Chunks[0].ChunkOrder)
@@ -106,9 +123,9 @@ func TestSaveChunkMetadata(t *testing.T) {
 	t.Run("Test SaveChunkMetadata adds another chunk to same file", func(t *testing.T) {
 		db := setupTestGormDB(t)
 		fileHash := "filehash1"
-		_ = db.SaveChunkMetadata(fileHash, "chunk1", 0)
+		_ = db.SaveChunkMetadata(fileHash, "chunk1", 0, 0, testChunker)
 
-		err := db.SaveChunkMetadata(fileHash, "chunk2", 1)
+		err := db.SaveChunkMetadata(fileHash, "chunk2", 1, 0, testChunker)
 		assert.NoError(t, err)
 
 		fileMeta, err := db.GetFileMetadata(fileHash)
@@ -120,10 +137,10 @@ func TestSaveChunkMetadata(t *testing.T) {
 		db := setupTestGormDB(t)
 		fileHash := "filehash2"
 		chunkHash := "chunk3"
-		err := db.SaveChunkMetadata(fileHash, chunkHash, 2)
+		err := db.SaveChunkMetadata(fileHash, chunkHash, 2, 0, testChunker)
 		assert.NoError(t, err)
 
-		err = db.SaveChunkMetadata(fileHash, chunkHash, 2)
+		err = db.SaveChunkMetadata(fileHash, chunkHash, 2, 0, testChunker)
 		assert.NoError(t, err)
 
 		fileMeta, err := db.GetFileMetadata(fileHash)
@@ -133,10 +150,10 @@ func TestSaveChunkMetadata(t *testing.T) {
 
 	t.Run("Test SaveChunkMetadata with different file", func(t *testing.T) {
 		db := setupTestGormDB(t)
-		err := db.SaveChunkMetadata("filehashA", "chunkA1", 0)
+		err := db.SaveChunkMetadata("filehashA", "chunkA1", 0, 0, testChunker)
 		assert.NoError(t, err)
 
-		err = db.SaveChunkMetadata("filehashB", "chunkB1", 0)
+		err = db.SaveChunkMetadata("filehashB", "chunkB1", 0, 0, testChunker)
 		assert.NoError(t, err)
 
 		meta1, err := db.GetFileMetadata("filehashA")
@@ -150,6 +167,67 @@ func TestSaveChunkMetadata(t *testing.T) {
 	})
 }
 
+func TestSharedChunkMetadata(t *testing.T) {
+	t.Run("Test SaveChunkMetadata stores a chunk shared by files and positions once per position", func(t *testing.T) {
+		db := setupTestGormDB(t)
+
+		require.NoError(t, db.SaveChunkMetadata("file1", "zeros", 1, 0, testChunker))
+		require.NoError(t, db.SaveChunkMetadata("file1", "zeros", 2, 0, testChunker))
+		require.NoError(t, db.SaveChunkMetadata("file2", "zeros", 1, 0, testChunker))
+		require.NoError(t, db.SaveChunkMetadata("file2", "zeros", 1, 0, testChunker)) // retried upload
+
+		var rows int64
+		require.NoError(t, db.db.Model(&model.ChunkMetadata{}).Where("chunk_hash = ?", "zeros").Count(&rows).Error)
+		assert.Equal(t, int64(3), rows)
+
+		var ref model.ChunkRef
+		require.NoError(t, db.db.First(&ref, "chunk_hash = ?", hasher.CanonicalHash("zeros")).Error)
+		assert.Equal(t, 3, ref.RefCount)
+
+		assert.ErrorIs(t, db.SaveChunkMetadata("file2", "other", 1, 0, testChunker), ErrChunkConflict)
+	})
+
+	t.Run("Test NewGormStorage repairs the legacy chunk metadata schema", func(t *testing.T) {
+		dsn := filepath.Join(t.TempDir(), "metadata.db")
+		legacy, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+		require.NoError(t, err)
+		require.NoError(t, legacy.AutoMigrate(&model.FileMetadata{}, &legacyChunkMetadata{}))
+		require.NoError(t, legacy.Create(&model.FileMetadata{ID: 1, FileHash: "file1", Chunker: testChunker}).Error)
+		require.NoError(t, legacy.Create(&[]legacyChunkMetadata{
+			{FileMetadataID: 1, ChunkOrder: 1, ChunkHash: "chunk1"},
+			{FileMetadataID: 1, ChunkOrder: 2, ChunkHash: "chunk2"},
+			{FileMetadataID: 1, ChunkOrder: 2, ChunkHash: "conflicting"},
+		}).Error)
+		sqlDB, err := legacy.DB()
+		require.NoError(t, err)
+		require.NoError(t, sqlDB.Close())
+
+		repaired, err := NewGormStorage(sqlite.Open(dsn))
+		require.NoError(t, err)
+		db := repaired.(*GormDB)
+		defer db.Close()
+
+		assert.False(t, db.db.Migrator().HasIndex(&model.ChunkMetadata{}, legacyChunkOrderIndex))
+		assert.True(t, db.db.Migrator().HasIndex(&model.ChunkMetadata{}, "idx_chunk_metadata_file_order"))
+
+		// the first chunk stored at a position is kept
+		metadata, err := db.GetFileMetadata("file1")
+		require.NoError(t, err)
+		require.NotNil(t, metadata)
+		require.Len(t, metadata.Chunks, 2)
+		assert.Equal(t, "chunk2", metadata.Chunks[1].ChunkHash)
+
+		// files can share chunks now
+		require.NoError(t, db.SaveChunkMetadata("file1", "chunk1", 3, 0, testChunker))
+		require.NoError(t, db.SaveChunkMetadata("file2", "chunk1", 1, 0, testChunker))
+		require.NoError(t, db.RebuildChunkRefs())
+		ref, err := db.GetChunkRef("chunk1")
+		require.NoError(t, err)
+		require.NotNil(t, ref)
+		assert.Equal(t, 3, ref.RefCount)
+	})
+}
+
 func TestGetFileMetadata(t *testing.T) {
 
 	t.Run("Test GetFileMetadata", func(t *testing.T) {
@@ -199,6 +277,26 @@ func TestCheckFileExists(t *testing.T) {
 		assert.True(t, exists)
 	})
 
+	t.Run("Test CheckFileExists finds legacy files by their prefixed hash", func(t *testing.T) {
+		db := setupTestGormDB(t)
+
+		legacyHash := hasher.CalculateChunkHash([]byte("hello world"))
+		err := db.db.Create(&model.FileMetadata{FileHash: legacyHash}).Error
+		require.NoError(t, err)
+
+		exists, err := db.CheckFileExists("sha256:" + legacyHash)
+		assert.NoError(t, err)
+		assert.True(t, exists)
+
+		// saving chunks under the prefixed hash extends the legacy file instead of duplicating it
+		err = db.SaveChunkMetadata("sha256:"+legacyHash, "sha256:"+legacyHash, 1, 0, testChunker)
+		require.NoError(t, err)
+
+		var count int64
+		db.db.Model(&model.FileMetadata{}).Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+
 	t.Run("Test CheckFileExists for non-existing file", func(t *testing.T) {
 		db := setupTestGormDB(t)
 
@@ -207,3 +305,132 @@ func TestCheckFileExists(t *testing.T) {
 		assert.False(t, exists)
 	})
 }
+
+func TestSaveFileMetadata(t *testing.T) {
+	t.Run("Test SaveFileMetadata saves file with its chunks", func(t *testing.T) {
+		db := setupTestGormDB(t)
+
+		err := db.SaveFileMetadata(&model.FileMetadata{
+			FileHash: "filehash",
+			Chunker:  testChunker,
+			Chunks:   []model.ChunkMetadata{{ChunkOrder: 1, ChunkHash: "chunk1"}},
+		})
+		require.NoError(t, err)
+
+		got, err := db.GetFileMetadata("filehash")
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		assert.Equal(t, testChunker, got.Chunker)
+		require.Len(t, got.Chunks, 1)
+		assert.Equal(t, "chunk1", got.Chunks[0].ChunkHash)
+
+		referenced, err := db.CheckChunkReferenced("chunk1")
+		require.NoError(t, err)
+		assert.True(t, referenced)
+
+		referenced, err = db.CheckChunkReferenced("chunk2")
+		require.NoError(t, err)
+		assert.False(t, referenced)
+	})
+}
+
+func TestMigrations(t *testing.T) {
+	t.Run("Test SaveMigration marks migration as applied", func(t *testing.T) {
+		db := setupTestGormDB(t)
+
+		applied, err := db.CheckMigrationApplied("migration")
+		require.NoError(t, err)
+		assert.False(t, applied)
+
+		require.NoError(t, db.SaveMigration("migration"))
+
+		applied, err = db.CheckMigrationApplied("migration")
+		require.NoError(t, err)
+		assert.True(t, applied)
+	})
+}
+
+func TestChunkRefs(t *testing.T) {
+	t.Run("Test SaveChunkMetadata and SaveFileMetadata count chunk references", func(t *testing.T) {
+		db := setupTestGormDB(t)
+
+		require.NoError(t, db.SaveChunkMetadata("file1", "chunk1", 1, 0, testChunker))
+		require.NoError(t, db.SaveChunkMetadata("file1", "chunk1", 1, 0, testChunker)) // retried upload
+		require.NoError(t, db.SaveFileMetadata(&model.FileMetadata{
+			FileHash: "file2",
+			Chunker:  testChunker,
+			Chunks:   []model.ChunkMetadata{{ChunkOrder: 1, ChunkHash: "chunk2"}},
+		}))
+
+		var ref model.ChunkRef
+		require.NoError(t, db.db.First(&ref, "chunk_hash = ?", hasher.CanonicalHash("chunk1")).Error)
+		assert.Equal(t, 1, ref.RefCount)
+
+		referenced, err := db.ListReferencedChunks()
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{hasher.CanonicalHash("chunk1"), hasher.CanonicalHash("chunk2")}, referenced)
+	})
+
+	t.Run("Test RebuildChunkRefs counts references from chunk metadata", func(t *testing.T) {
+		db := setupTestGormDB(t)
+
+		require.NoError(t, db.SaveChunkMetadata("file1", "chunk1", 1, 0, testChunker))
+		require.NoError(t, db.db.Where("1 = 1").Delete(&model.ChunkRef{}).Error)
+
+		referenced, err := db.ListReferencedChunks()
+		require.NoError(t, err)
+		assert.Empty(t, referenced)
+
+		require.NoError(t, db.RebuildChunkRefs())
+
+		referenced, err = db.ListReferencedChunks()
+		require.NoError(t, err)
+		assert.Equal(t, []string{hasher.CanonicalHash("chunk1")}, referenced)
+	})
+}
+
+func TestDeleteFileMetadata(t *testing.T) {
+	t.Run("Test DeleteFileMetadata deletes the file and releases its chunks", func(t *testing.T) {
+		db := setupTestGormDB(t)
+
+		require.NoError(t, db.SaveFileMetadata(&model.FileMetadata{
+			FileHash: "file1",
+			Chunker:  testChunker,
+			Chunks: []model.ChunkMetadata{
+				{ChunkOrder: 1, ChunkHash: "chunk1"},
+				{ChunkOrder: 2, ChunkHash: "chunk2"},
+			},
+		}))
+		require.NoError(t, db.SaveFileMetadata(&model.FileMetadata{
+			FileHash: "file2",
+			Chunker:  testChunker,
+			Chunks:   []model.ChunkMetadata{{ChunkOrder: 1, ChunkHash: "chunk3"}},
+		}))
+
+		require.NoError(t, db.DeleteFileMetadata("file1"))
+
+		got, err := db.GetFileMetadata("file1")
+		require.NoError(t, err)
+		assert.Nil(t, got)
+
+		referenced, err := db.CheckChunkReferenced("chunk1")
+		require.NoError(t, err)
+		assert.False(t, referenced)
+
+		refs, err := db.ListReferencedChunks()
+		require.NoError(t, err)
+		assert.Equal(t, []string{hasher.CanonicalHash("chunk3")}, refs)
+
+		got, err = db.GetFileMetadata("file2")
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		assert.Len(t, got.Chunks, 1)
+	})
+
+	t.Run("Test DeleteFileMetadata returns ErrFileNotFound for unknown file", func(t *testing.T) {
+		db := setupTestGormDB(t)
+
+		err := db.DeleteFileMetadata("missing")
+		assert.ErrorIs(t, err, ErrFileNotFound)
+	})
+}
@@ -0,0 +1,1156 @@
+package memory
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"zerodupe/internal/server/model"
+	"zerodupe/internal/server/storage"
+	"zerodupe/pkg/hasher"
+)
+
+// MemoryDB implements the DB interface in memory, with the semantics of the gorm storage:
+// ids are assigned on insert, file and chunk hashes match any spelling of the same hash,
+// and chunk reference counts are keyed by canonical hash. Usage is counted from the files and
+// their owners when it is read, while chunk references, their users and the totals of all files
+// are maintained as the gorm storage maintains them.
+type MemoryDB struct {
+	mu sync.Mutex
+
+	users      map[string]*model.User
+	files      []*model.FileMetadata // in insertion order, like rows ordered by primary key
+	owners     []model.FileOwner
+	uploads    []model.UploadedChunk
+	grants     []model.FileGrant
+	links      []model.ShareLink         // in creation order
+	paths      []model.PathEntry         // in creation order
+	aliases    map[string]uint           // file ids by canonical alias hash
+	refs       map[string]model.ChunkRef // by canonical chunk hash, only chunks with references
+	chunkUsers map[string]map[uint]int   // references of a chunk from the files of each user
+	totals     model.Totals
+	migrations map[string]time.Time
+
+	nextUserID  uint
+	nextFileID  uint
+	nextChunkID uint
+	nextPathID  uint
+}
+
+// NewMemoryDB creates a new, empty in-memory database
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{
+		users:      make(map[string]*model.User),
+		refs:       make(map[string]model.ChunkRef),
+		aliases:    make(map[string]uint),
+		chunkUsers: make(map[string]map[uint]int),
+		migrations: make(map[string]time.Time),
+	}
+}
+
+// CreateUser creates a new user
+func (m *MemoryDB) CreateUser(user *model.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[user.Username]; ok {
+		return fmt.Errorf("user %q already exists", user.Username)
+	}
+
+	m.nextUserID++
+	user.ID = m.nextUserID
+	stored := *user
+	stored.Password = append([]byte(nil), user.Password...)
+	m.users[user.Username] = &stored
+	return nil
+}
+
+// GetUserByUsername gets a user by username
+func (m *MemoryDB) GetUserByUsername(username string) (*model.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[username]
+	if !ok {
+		return nil, storage.ErrUserNotFound
+	}
+	found := *user
+	found.Password = append([]byte(nil), user.Password...)
+	return &found, nil
+}
+
+// SetUserQuota sets the quota of a user
+func (m *MemoryDB) SetUserQuota(username string, quota model.Quota) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[username]
+	if !ok {
+		return storage.ErrUserNotFound
+	}
+	user.Quota = quota
+	return nil
+}
+
+func (m *MemoryDB) SaveChunkMetadata(fileHash, chunkHash string, chunkOrder int, chunkSize int64, chunker string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// the file may already be stored under another spelling of the same hash
+	fileMetadata := m.findFile(fileHash)
+	if fileMetadata == nil {
+		m.nextFileID++
+		fileMetadata = &model.FileMetadata{ID: m.nextFileID, FileHash: fileHash, Chunker: chunker, CreatedAt: time.Now(), LastChunkAt: time.Now()}
+		m.files = append(m.files, fileMetadata)
+	}
+
+	for _, chunk := range fileMetadata.Chunks {
+		if chunk.ChunkOrder == chunkOrder {
+			if !hasher.EqualHashes(chunk.ChunkHash, chunkHash) {
+				return storage.ErrChunkConflict
+			}
+			// Chunk already exists
+			return nil
+		}
+	}
+	// the chunks of a complete file are final, so nobody can append to a file they only know the hash of
+	if fileMetadata.Complete {
+		return storage.ErrFileComplete
+	}
+
+	m.nextChunkID++
+	fileMetadata.Chunks = append(fileMetadata.Chunks, model.ChunkMetadata{
+		ID:             m.nextChunkID,
+		FileMetadataID: fileMetadata.ID,
+		ChunkOrder:     chunkOrder,
+		ChunkHash:      chunkHash,
+		Size:           chunkSize,
+	})
+	fileMetadata.Size += chunkSize
+	fileMetadata.LastChunkAt = time.Now()
+	m.addChunkRef(chunkHash, 1, chunkSize)
+	// the chunk counts towards every owner of the file
+	for _, owner := range m.owners {
+		if owner.FileMetadataID == fileMetadata.ID {
+			m.addUserChunkRef(owner.UserID, chunkHash, 1)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryDB) CompleteFile(fileHash string, totalChunks int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fileMetadata := m.findFile(fileHash)
+	if fileMetadata == nil {
+		return false, storage.ErrFileNotFound
+	}
+	if !fileMetadata.Complete && (totalChunks == 0 || len(fileMetadata.Chunks) == totalChunks) {
+		fileMetadata.Complete = storage.ChunksHashToFile(fileMetadata.FileHash, fileMetadata.Chunks)
+	}
+	return fileMetadata.Complete, nil
+}
+
+func (m *MemoryDB) RecordUploadedChunk(fileHash string, userID uint, chunkOrder int, chunkHash string, chunkSize int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fileMetadata := m.findFile(fileHash)
+	if fileMetadata == nil {
+		return false, storage.ErrFileNotFound
+	}
+	if m.isOwner(fileMetadata.ID, userID) {
+		return true, nil
+	}
+
+	uploaded := model.UploadedChunk{FileMetadataID: fileMetadata.ID, UserID: userID, ChunkOrder: chunkOrder, ChunkHash: chunkHash, Size: chunkSize}
+	if fileMetadata.Complete {
+		if err := storage.CheckUploadedChunk(fileMetadata.Chunks, uploaded); err != nil {
+			return false, err
+		}
+	}
+	m.deleteUploads(func(upload model.UploadedChunk) bool {
+		return upload.FileMetadataID == fileMetadata.ID && upload.UserID == userID && upload.ChunkOrder == chunkOrder
+	})
+	m.uploads = append(m.uploads, uploaded)
+	fileMetadata.LastChunkAt = time.Now()
+
+	var uploads []model.UploadedChunk
+	for _, upload := range m.uploads {
+		if upload.FileMetadataID == fileMetadata.ID && upload.UserID == userID {
+			uploads = append(uploads, upload)
+		}
+	}
+	if !fileMetadata.Complete {
+		// chunks stored first by someone who does not have the file must not keep it from
+		// completing, so the user's own chunks replace them once they hash to the file hash
+		chunks := storage.UploadedChunksOf(uploads)
+		if !storage.ChunksHashToFile(fileMetadata.FileHash, chunks) {
+			return false, nil
+		}
+		m.replaceChunks(fileMetadata, chunks)
+	}
+	if !storage.UploadedChunksCover(fileMetadata.Chunks, uploads) {
+		return false, nil
+	}
+
+	m.addOwner(fileMetadata, userID)
+	m.deleteUploads(func(upload model.UploadedChunk) bool {
+		return upload.FileMetadataID == fileMetadata.ID && upload.UserID == userID
+	})
+	return true, nil
+}
+
+func (m *MemoryDB) ExpireIncompleteFiles(before time.Time, dryRun bool) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expired := []string{}
+	for _, fileMetadata := range append([]*model.FileMetadata(nil), m.files...) {
+		if fileMetadata.Complete || !fileMetadata.CreatedAt.Before(before) || !fileMetadata.LastChunkAt.Before(before) || m.hasOwners(fileMetadata.ID) {
+			continue
+		}
+		if !dryRun {
+			m.deleteFile(fileMetadata)
+		}
+		expired = append(expired, fileMetadata.FileHash)
+	}
+	return expired, nil
+}
+
+func (m *MemoryDB) AddFileAlias(fileHash, alias string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fileMetadata := m.findFile(fileHash)
+	if fileMetadata == nil {
+		return storage.ErrFileNotFound
+	}
+	m.aliases[hasher.CanonicalHash(alias)] = fileMetadata.ID
+	return nil
+}
+
+func (m *MemoryDB) GetFileMetadata(fileHash string) (*model.FileMetadata, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fileMetadata := m.findFile(fileHash)
+	if fileMetadata == nil {
+		return nil, nil
+	}
+	return copyFile(fileMetadata), nil
+}
+
+func (m *MemoryDB) CheckFileExists(fileHash string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.findFile(fileHash) != nil, nil
+}
+
+func (m *MemoryDB) SaveFileMetadata(metadata *model.FileMetadata) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// file hashes are unique as spelled, like the unique index of the gorm storage
+	for _, file := range m.files {
+		if file.FileHash == metadata.FileHash {
+			return fmt.Errorf("failed to save file metadata: file %s already exists", metadata.FileHash)
+		}
+	}
+
+	m.nextFileID++
+	metadata.ID = m.nextFileID
+	if metadata.CreatedAt.IsZero() {
+		metadata.CreatedAt = time.Now()
+	}
+	metadata.Size = 0
+	for i := range metadata.Chunks {
+		m.nextChunkID++
+		metadata.Chunks[i].ID = m.nextChunkID
+		metadata.Chunks[i].FileMetadataID = metadata.ID
+		metadata.Size += metadata.Chunks[i].Size
+		m.addChunkRef(metadata.Chunks[i].ChunkHash, 1, metadata.Chunks[i].Size)
+	}
+	metadata.Complete = storage.ChunksHashToFile(metadata.FileHash, metadata.Chunks)
+	m.files = append(m.files, copyFile(metadata))
+	return nil
+}
+
+func (m *MemoryDB) SetFileInfo(fileHash, name, contentType, uploader string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fileMetadata := m.findFile(fileHash)
+	if fileMetadata == nil {
+		return storage.ErrFileNotFound
+	}
+	// only empty fields are set, so the first upload of a file names it
+	if fileMetadata.Name == "" {
+		fileMetadata.Name = name
+	}
+	if fileMetadata.ContentType == "" {
+		fileMetadata.ContentType = contentType
+	}
+	if fileMetadata.Uploader == "" {
+		fileMetadata.Uploader = uploader
+	}
+	return nil
+}
+
+func (m *MemoryDB) DeleteFileMetadata(fileHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fileMetadata := m.findFile(fileHash)
+	if fileMetadata == nil {
+		return storage.ErrFileNotFound
+	}
+	m.deleteFile(fileMetadata)
+	return nil
+}
+
+func (m *MemoryDB) RemoveFileOwner(fileHash string, userID uint) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fileMetadata := m.findFile(fileHash)
+	if fileMetadata == nil || !m.isOwner(fileMetadata.ID, userID) {
+		return false, storage.ErrFileNotFound
+	}
+
+	owners := m.owners[:0]
+	remaining := 0
+	for _, owner := range m.owners {
+		if owner.FileMetadataID == fileMetadata.ID {
+			if owner.UserID == userID {
+				continue
+			}
+			remaining++
+		}
+		owners = append(owners, owner)
+	}
+	m.owners = owners
+	m.releaseFile(fileMetadata, userID)
+	m.deletePaths(func(entry model.PathEntry) bool {
+		return entry.FileMetadataID == fileMetadata.ID && entry.UserID == userID
+	})
+
+	if remaining > 0 {
+		return false, nil
+	}
+	m.deleteFile(fileMetadata)
+	return true, nil
+}
+
+// deleteFile deletes a file with its owners, uploaded chunks, grants, share links, paths and aliases and releases its chunk references. The caller must hold mu.
+func (m *MemoryDB) deleteFile(fileMetadata *model.FileMetadata) {
+	files := m.files[:0]
+	for _, file := range m.files {
+		if file != fileMetadata {
+			files = append(files, file)
+		}
+	}
+	m.files = files
+
+	owners := m.owners[:0]
+	for _, owner := range m.owners {
+		if owner.FileMetadataID != fileMetadata.ID {
+			owners = append(owners, owner)
+		} else {
+			m.releaseFile(fileMetadata, owner.UserID)
+		}
+	}
+	m.owners = owners
+
+	m.deleteUploads(func(upload model.UploadedChunk) bool {
+		return upload.FileMetadataID == fileMetadata.ID
+	})
+
+	grants := m.grants[:0]
+	for _, grant := range m.grants {
+		if grant.FileMetadataID != fileMetadata.ID {
+			grants = append(grants, grant)
+		}
+	}
+	m.grants = grants
+
+	links := m.links[:0]
+	for _, link := range m.links {
+		if link.FileMetadataID != fileMetadata.ID {
+			links = append(links, link)
+		}
+	}
+	m.links = links
+
+	m.deletePaths(func(entry model.PathEntry) bool {
+		return entry.FileMetadataID == fileMetadata.ID
+	})
+
+	for alias, fileID := range m.aliases {
+		if fileID == fileMetadata.ID {
+			delete(m.aliases, alias)
+		}
+	}
+
+	// chunks shared with other files keep a positive count, the others become garbage
+	for _, chunk := range fileMetadata.Chunks {
+		m.addChunkRef(chunk.ChunkHash, -1, 0)
+	}
+}
+
+// addOwner makes a user an owner of a file and counts its chunks towards the user. The caller must hold mu.
+func (m *MemoryDB) addOwner(fileMetadata *model.FileMetadata, userID uint) {
+	m.owners = append(m.owners, model.FileOwner{FileMetadataID: fileMetadata.ID, UserID: userID, CreatedAt: time.Now()})
+	for _, chunk := range fileMetadata.Chunks {
+		m.addUserChunkRef(userID, chunk.ChunkHash, 1)
+	}
+}
+
+// replaceChunks replaces the chunks of an incomplete file with chunks that hash to its file hash, marks
+// it complete and clears the name, content type and uploader the replaced chunks came with. The caller
+// must hold mu.
+func (m *MemoryDB) replaceChunks(fileMetadata *model.FileMetadata, chunks []model.ChunkMetadata) {
+	var owners []uint
+	for _, owner := range m.owners {
+		if owner.FileMetadataID == fileMetadata.ID {
+			owners = append(owners, owner.UserID)
+			m.releaseFile(fileMetadata, owner.UserID)
+		}
+	}
+
+	replaced := fileMetadata.Chunks
+	fileMetadata.Chunks = nil
+	for _, chunk := range chunks {
+		m.nextChunkID++
+		chunk.ID = m.nextChunkID
+		chunk.FileMetadataID = fileMetadata.ID
+		fileMetadata.Chunks = append(fileMetadata.Chunks, chunk)
+		m.addChunkRef(chunk.ChunkHash, 1, chunk.Size)
+	}
+	for _, chunk := range replaced {
+		m.addChunkRef(chunk.ChunkHash, -1, 0)
+	}
+	fileMetadata.Size = sumChunkSizes(fileMetadata.Chunks)
+	fileMetadata.Complete = true
+	fileMetadata.Name, fileMetadata.ContentType, fileMetadata.Uploader = "", "", ""
+
+	for _, userID := range owners {
+		for _, chunk := range fileMetadata.Chunks {
+			m.addUserChunkRef(userID, chunk.ChunkHash, 1)
+		}
+	}
+}
+
+// releaseFile stops counting the chunks of a file towards a user. The caller must hold mu.
+func (m *MemoryDB) releaseFile(fileMetadata *model.FileMetadata, userID uint) {
+	for _, chunk := range fileMetadata.Chunks {
+		m.addUserChunkRef(userID, chunk.ChunkHash, -1)
+	}
+}
+
+// addChunkRef adds delta to the reference count of a chunk, records its size unless it is 0 and
+// updates the totals with the change. The caller must hold mu.
+func (m *MemoryDB) addChunkRef(chunkHash string, delta int, size int64) {
+	key := hasher.CanonicalHash(chunkHash)
+	ref, ok := m.refs[key]
+	if !ok {
+		ref = model.ChunkRef{ChunkHash: key}
+	}
+
+	storage.AddChunkTotals(&m.totals, ref, -1)
+	ref.RefCount += delta
+	if size > 0 {
+		ref.Size = size
+	}
+	storage.AddChunkTotals(&m.totals, ref, 1)
+
+	if ref.RefCount > 0 {
+		m.refs[key] = ref
+	} else {
+		delete(m.refs, key)
+	}
+}
+
+// addUserChunkRef adds delta to the references of a chunk from the files of a user. The caller must hold mu.
+func (m *MemoryDB) addUserChunkRef(userID uint, chunkHash string, delta int) {
+	key := hasher.CanonicalHash(chunkHash)
+	users := m.chunkUsers[key]
+	if users == nil {
+		users = make(map[uint]int)
+		m.chunkUsers[key] = users
+	}
+
+	users[userID] += delta
+	if users[userID] <= 0 {
+		delete(users, userID)
+	}
+	if len(users) == 0 {
+		delete(m.chunkUsers, key)
+	}
+}
+
+func (m *MemoryDB) AddFileOwner(fileHash string, userID uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fileMetadata := m.findFile(fileHash)
+	if fileMetadata == nil {
+		return storage.ErrFileNotFound
+	}
+	if m.isOwner(fileMetadata.ID, userID) {
+		return nil
+	}
+	m.addOwner(fileMetadata, userID)
+	return nil
+}
+
+func (m *MemoryDB) CheckFileOwner(fileHash string, userID uint) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fileMetadata := m.findFile(fileHash)
+	return fileMetadata != nil && m.isOwner(fileMetadata.ID, userID), nil
+}
+
+func (m *MemoryDB) CheckFileAccess(fileHash string, userID uint) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fileMetadata := m.findFile(fileHash)
+	return fileMetadata != nil && m.canRead(fileMetadata.ID, userID), nil
+}
+
+func (m *MemoryDB) CheckChunkAccess(chunkHash string, userID uint) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, file := range m.files {
+		if !m.canRead(file.ID, userID) {
+			continue
+		}
+		for _, chunk := range file.Chunks {
+			if hasher.EqualHashes(chunk.ChunkHash, chunkHash) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (m *MemoryDB) GrantFileAccess(fileHash string, userID, grantedBy uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fileMetadata := m.findFile(fileHash)
+	if fileMetadata == nil {
+		return storage.ErrFileNotFound
+	}
+	for _, grant := range m.grants {
+		if grant.FileMetadataID == fileMetadata.ID && grant.UserID == userID {
+			return nil
+		}
+	}
+	m.grants = append(m.grants, model.FileGrant{FileMetadataID: fileMetadata.ID, UserID: userID, GrantedBy: grantedBy, CreatedAt: time.Now()})
+	return nil
+}
+
+func (m *MemoryDB) RevokeFileAccess(fileHash string, userID uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if fileMetadata := m.findFile(fileHash); fileMetadata != nil {
+		for i, grant := range m.grants {
+			if grant.FileMetadataID == fileMetadata.ID && grant.UserID == userID {
+				m.grants = append(m.grants[:i], m.grants[i+1:]...)
+				return nil
+			}
+		}
+	}
+	return storage.ErrGrantNotFound
+}
+
+func (m *MemoryDB) ListFileGrants(fileHash string) ([]model.FileGrant, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fileMetadata := m.findFile(fileHash)
+	if fileMetadata == nil {
+		return nil, nil
+	}
+	var grants []model.FileGrant
+	for _, grant := range m.grants {
+		if grant.FileMetadataID != fileMetadata.ID {
+			continue
+		}
+		for _, user := range m.users {
+			if user.ID == grant.UserID {
+				grant.Username = user.Username
+				grants = append(grants, grant)
+				break
+			}
+		}
+	}
+	return grants, nil
+}
+
+func (m *MemoryDB) CreateShareLink(fileHash string, link *model.ShareLink) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fileMetadata := m.findFile(fileHash)
+	if fileMetadata == nil {
+		return storage.ErrFileNotFound
+	}
+	for _, existing := range m.links {
+		if existing.Token == link.Token {
+			return fmt.Errorf("failed to create share link: token already exists")
+		}
+	}
+
+	link.FileMetadataID = fileMetadata.ID
+	link.FileHash = fileMetadata.FileHash
+	if link.CreatedAt.IsZero() {
+		link.CreatedAt = time.Now()
+	}
+	stored := *link
+	stored.Password = append([]byte(nil), link.Password...)
+	m.links = append(m.links, stored)
+	return nil
+}
+
+func (m *MemoryDB) GetShareLink(token string) (*model.ShareLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, link := range m.links {
+		if link.Token == token {
+			link.Password = append([]byte(nil), link.Password...)
+			return &link, nil
+		}
+	}
+	return nil, storage.ErrShareLinkNotFound
+}
+
+func (m *MemoryDB) ListShareLinks(fileHash string) ([]model.ShareLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fileMetadata := m.findFile(fileHash)
+	if fileMetadata == nil {
+		return nil, nil
+	}
+	var links []model.ShareLink
+	for _, link := range m.links {
+		if link.FileMetadataID == fileMetadata.ID {
+			link.Password = append([]byte(nil), link.Password...)
+			links = append(links, link)
+		}
+	}
+	return links, nil
+}
+
+func (m *MemoryDB) DeleteShareLink(fileHash, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if fileMetadata := m.findFile(fileHash); fileMetadata != nil {
+		for i, link := range m.links {
+			if link.Token == token && link.FileMetadataID == fileMetadata.ID {
+				m.links = append(m.links[:i], m.links[i+1:]...)
+				return nil
+			}
+		}
+	}
+	return storage.ErrShareLinkNotFound
+}
+
+func (m *MemoryDB) CreateDirectory(userID uint, dirPath string) (*model.PathEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkPathFree(userID, dirPath); err != nil {
+		return nil, err
+	}
+	entry := m.addPath(model.PathEntry{UserID: userID, Path: dirPath, Parent: path.Dir(dirPath), IsDir: true})
+	return &entry, nil
+}
+
+func (m *MemoryDB) SaveFilePath(userID uint, filePath, fileHash string) (*model.PathEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fileMetadata := m.findFile(fileHash)
+	if fileMetadata == nil {
+		return nil, storage.ErrFileNotFound
+	}
+
+	if i := m.findPath(userID, filePath); i >= 0 {
+		if m.paths[i].IsDir {
+			return nil, storage.ErrPathExists
+		}
+		m.paths[i].FileMetadataID = fileMetadata.ID
+		m.paths[i].UpdatedAt = time.Now()
+		entry := m.withFile(m.paths[i])
+		return &entry, nil
+	}
+
+	if err := m.checkPathFree(userID, filePath); err != nil {
+		return nil, err
+	}
+	entry := m.withFile(m.addPath(model.PathEntry{UserID: userID, Path: filePath, Parent: path.Dir(filePath), FileMetadataID: fileMetadata.ID}))
+	return &entry, nil
+}
+
+func (m *MemoryDB) GetPathEntry(userID uint, entryPath string) (*model.PathEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.findPath(userID, entryPath)
+	if i < 0 {
+		return nil, storage.ErrPathNotFound
+	}
+	entry := m.withFile(m.paths[i])
+	return &entry, nil
+}
+
+func (m *MemoryDB) ListDirectory(userID uint, dirPath string) ([]model.PathEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if dirPath != "/" {
+		i := m.findPath(userID, dirPath)
+		if i < 0 {
+			return nil, storage.ErrPathNotFound
+		}
+		if !m.paths[i].IsDir {
+			return nil, storage.ErrNotDirectory
+		}
+	}
+
+	var entries []model.PathEntry
+	for _, entry := range m.paths {
+		if entry.UserID == userID && entry.Parent == dirPath {
+			entries = append(entries, m.withFile(entry))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].IsDir != entries[j].IsDir {
+			return entries[i].IsDir
+		}
+		return entries[i].Path < entries[j].Path
+	})
+	return entries, nil
+}
+
+func (m *MemoryDB) MovePath(userID uint, fromPath, toPath string) (*model.PathEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if strings.HasPrefix(toPath, fromPath+"/") {
+		return nil, storage.ErrInvalidMove
+	}
+	i := m.findPath(userID, fromPath)
+	if i < 0 {
+		return nil, storage.ErrPathNotFound
+	}
+	if fromPath != toPath {
+		if err := m.checkPathFree(userID, toPath); err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+		for j, entry := range m.paths {
+			if entry.UserID != userID {
+				continue
+			}
+			if j == i {
+				m.paths[j].Path = toPath
+				m.paths[j].Parent = path.Dir(toPath)
+				m.paths[j].UpdatedAt = now
+			} else if strings.HasPrefix(entry.Path, fromPath+"/") {
+				// the entries below the directory keep the part of their paths after it
+				m.paths[j].Path = toPath + strings.TrimPrefix(entry.Path, fromPath)
+				m.paths[j].Parent = toPath + strings.TrimPrefix(entry.Parent, fromPath)
+				m.paths[j].UpdatedAt = now
+			}
+		}
+	}
+	entry := m.withFile(m.paths[i])
+	return &entry, nil
+}
+
+func (m *MemoryDB) DeletePath(userID uint, entryPath string, recursive bool) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.findPath(userID, entryPath)
+	if i < 0 {
+		return 0, storage.ErrPathNotFound
+	}
+	below := func(entry model.PathEntry) bool {
+		return entry.UserID == userID && strings.HasPrefix(entry.Path, entryPath+"/")
+	}
+	if m.paths[i].IsDir && !recursive {
+		for _, entry := range m.paths {
+			if below(entry) {
+				return 0, storage.ErrDirectoryNotEmpty
+			}
+		}
+	}
+
+	return m.deletePaths(func(entry model.PathEntry) bool {
+		return entry.UserID == userID && (entry.Path == entryPath || below(entry))
+	}), nil
+}
+
+func (m *MemoryDB) GetUsage(userID uint) (*model.Usage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usage, ok := m.countChunkRefs().Usages[userID]
+	if !ok {
+		return &model.Usage{UserID: userID}, nil
+	}
+	return usage, nil
+}
+
+func (m *MemoryDB) GetChunkRef(chunkHash string) (*model.ChunkRef, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.countChunkRefs().Refs[hasher.CanonicalHash(chunkHash)], nil
+}
+
+func (m *MemoryDB) SetChunkSize(chunkHash string, size int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, file := range m.files {
+		for i := range file.Chunks {
+			if hasher.EqualHashes(file.Chunks[i].ChunkHash, chunkHash) {
+				file.Chunks[i].Size = size
+			}
+		}
+		file.Size = sumChunkSizes(file.Chunks)
+	}
+	if ref, ok := m.refs[hasher.CanonicalHash(chunkHash)]; ok {
+		storage.AddChunkTotals(&m.totals, ref, -1)
+		ref.Size = size
+		storage.AddChunkTotals(&m.totals, ref, 1)
+		m.refs[ref.ChunkHash] = ref
+	}
+	return nil
+}
+
+func (m *MemoryDB) CheckChunkReferenced(chunkHash string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, file := range m.files {
+		for _, chunk := range file.Chunks {
+			if hasher.EqualHashes(chunk.ChunkHash, chunkHash) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (m *MemoryDB) MarkChunkDamaged(chunkHash string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var fileHashes []string
+	for _, file := range m.files {
+		for _, chunk := range file.Chunks {
+			if hasher.EqualHashes(chunk.ChunkHash, chunkHash) {
+				file.Damaged = true
+				fileHashes = append(fileHashes, file.FileHash)
+				break
+			}
+		}
+	}
+	return fileHashes, nil
+}
+
+func (m *MemoryDB) ListDamagedFiles() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var fileHashes []string
+	for _, file := range m.files {
+		if file.Damaged {
+			fileHashes = append(fileHashes, file.FileHash)
+		}
+	}
+	return fileHashes, nil
+}
+
+func (m *MemoryDB) GetStats() (*model.Stats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return &model.Stats{
+		Files:        int64(len(m.files)),
+		Chunks:       m.totals.Chunks,
+		ChunkBytes:   m.totals.ChunkBytes,
+		LogicalBytes: m.totals.LogicalBytes,
+	}, nil
+}
+
+func (m *MemoryDB) ListSharedChunks(userID uint, limit int) ([]model.ChunkRef, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var refs []model.ChunkRef
+	for hash, ref := range m.refs {
+		users := m.chunkUsers[hash]
+		if ref.RefCount > 1 && (userID == 0 || users[userID] > 0) {
+			ref.Users = len(users)
+			refs = append(refs, ref)
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].RefCount != refs[j].RefCount {
+			return refs[i].RefCount > refs[j].RefCount
+		}
+		return refs[i].ChunkHash < refs[j].ChunkHash
+	})
+	if len(refs) > limit {
+		refs = refs[:limit]
+	}
+	return refs, nil
+}
+
+func (m *MemoryDB) ListReferencedChunks() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var hashes []string
+	for chunkHash := range m.refs {
+		hashes = append(hashes, chunkHash)
+	}
+	sort.Strings(hashes)
+	return hashes, nil
+}
+
+func (m *MemoryDB) ListUnsizedChunks() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var hashes []string
+	for _, file := range m.files {
+		for _, chunk := range file.Chunks {
+			if chunk.Size == 0 {
+				hashes = append(hashes, chunk.ChunkHash)
+			}
+		}
+	}
+	return storage.CanonicalHashes(hashes), nil
+}
+
+func (m *MemoryDB) HasFiles() (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.files) > 0, nil
+}
+
+func (m *MemoryDB) RebuildChunkRefs() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, file := range m.files {
+		file.Size = sumChunkSizes(file.Chunks)
+		file.Complete = storage.ChunksHashToFile(file.FileHash, file.Chunks)
+	}
+
+	counts := m.countChunkRefs()
+	m.refs = make(map[string]model.ChunkRef)
+	m.totals = model.Totals{}
+	for key, ref := range counts.Refs {
+		m.refs[key] = model.ChunkRef{ChunkHash: key, RefCount: ref.RefCount, Size: ref.Size}
+		storage.AddChunkTotals(&m.totals, *ref, 1)
+	}
+	m.chunkUsers = make(map[string]map[uint]int)
+	for _, userRef := range counts.UserRefs {
+		m.addUserChunkRef(userRef.UserID, userRef.ChunkHash, userRef.RefCount)
+	}
+	return nil
+}
+
+func (m *MemoryDB) CheckMigrationApplied(name string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.migrations[name]
+	return ok, nil
+}
+
+func (m *MemoryDB) SaveMigration(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.migrations[name]; ok {
+		return fmt.Errorf("failed to save migration: %s already applied", name)
+	}
+	m.migrations[name] = time.Now()
+	return nil
+}
+
+// sumChunkSizes returns the size of a file made of chunks
+func sumChunkSizes(chunks []model.ChunkMetadata) int64 {
+	var size int64
+	for _, chunk := range chunks {
+		size += chunk.Size
+	}
+	return size
+}
+
+// findFile returns the first file stored under any spelling of fileHash, or aliased by it. The caller must hold mu.
+func (m *MemoryDB) findFile(fileHash string) *model.FileMetadata {
+	variants := hasher.HashVariants(fileHash)
+	aliased, isAlias := m.aliases[hasher.CanonicalHash(fileHash)]
+	for _, file := range m.files {
+		if isAlias && file.ID == aliased {
+			return file
+		}
+		for _, variant := range variants {
+			if file.FileHash == variant {
+				return file
+			}
+		}
+	}
+	return nil
+}
+
+// findPath returns the index of the entry at a path of a user, or -1. The caller must hold mu.
+func (m *MemoryDB) findPath(userID uint, entryPath string) int {
+	for i, entry := range m.paths {
+		if entry.UserID == userID && entry.Path == entryPath {
+			return i
+		}
+	}
+	return -1
+}
+
+// checkPathFree checks that nothing exists at a path of a user and that its parent is a directory.
+// The caller must hold mu.
+func (m *MemoryDB) checkPathFree(userID uint, entryPath string) error {
+	if m.findPath(userID, entryPath) >= 0 {
+		return storage.ErrPathExists
+	}
+	parent := path.Dir(entryPath)
+	if parent == "/" {
+		return nil
+	}
+	if i := m.findPath(userID, parent); i < 0 || !m.paths[i].IsDir {
+		return storage.ErrParentNotFound
+	}
+	return nil
+}
+
+// addPath stores a new path entry and returns it with its id and times. The caller must hold mu.
+func (m *MemoryDB) addPath(entry model.PathEntry) model.PathEntry {
+	m.nextPathID++
+	entry.ID = m.nextPathID
+	entry.CreatedAt = time.Now()
+	entry.UpdatedAt = entry.CreatedAt
+	m.paths = append(m.paths, entry)
+	return entry
+}
+
+// deletePaths deletes the path entries matching remove and returns how many it deleted. The caller must hold mu.
+func (m *MemoryDB) deletePaths(remove func(entry model.PathEntry) bool) int64 {
+	var removed int64
+	paths := m.paths[:0]
+	for _, entry := range m.paths {
+		if remove(entry) {
+			removed++
+			continue
+		}
+		paths = append(paths, entry)
+	}
+	m.paths = paths
+	return removed
+}
+
+// withFile fills in the hash, size and content type of the file saved at a path entry. The caller must hold mu.
+func (m *MemoryDB) withFile(entry model.PathEntry) model.PathEntry {
+	if entry.FileMetadataID == 0 {
+		return entry
+	}
+	for _, file := range m.files {
+		if file.ID == entry.FileMetadataID {
+			entry.FileHash = file.FileHash
+			entry.Size = file.Size
+			entry.ContentType = file.ContentType
+			break
+		}
+	}
+	return entry
+}
+
+// canRead checks if a user owns or has been granted the file with the given id. The caller must hold mu.
+func (m *MemoryDB) canRead(fileID, userID uint) bool {
+	if m.isOwner(fileID, userID) {
+		return true
+	}
+	for _, grant := range m.grants {
+		if grant.FileMetadataID == fileID && grant.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteUploads deletes the uploaded chunks matching remove. The caller must hold mu.
+func (m *MemoryDB) deleteUploads(remove func(upload model.UploadedChunk) bool) {
+	uploads := m.uploads[:0]
+	for _, upload := range m.uploads {
+		if !remove(upload) {
+			uploads = append(uploads, upload)
+		}
+	}
+	m.uploads = uploads
+}
+
+// isOwner checks if a user owns the file with the given id. The caller must hold mu.
+func (m *MemoryDB) isOwner(fileID, userID uint) bool {
+	for _, owner := range m.owners {
+		if owner.FileMetadataID == fileID && owner.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// hasOwners checks if anyone owns the file with the given id. The caller must hold mu.
+func (m *MemoryDB) hasOwners(fileID uint) bool {
+	for _, owner := range m.owners {
+		if owner.FileMetadataID == fileID {
+			return true
+		}
+	}
+	return false
+}
+
+// countChunkRefs counts chunk references and usage from all files and owners. The caller must hold mu.
+func (m *MemoryDB) countChunkRefs() storage.ChunkCounts {
+	var chunks []model.ChunkMetadata
+	for _, file := range m.files {
+		chunks = append(chunks, file.Chunks...)
+	}
+	return storage.CountChunkRefs(chunks, m.owners)
+}
+
+// copyFile returns a copy of a file that shares no chunk slice with it
+func copyFile(fileMetadata *model.FileMetadata) *model.FileMetadata {
+	copied := *fileMetadata
+	copied.Chunks = append([]model.ChunkMetadata(nil), fileMetadata.Chunks...)
+	return &copied
+}
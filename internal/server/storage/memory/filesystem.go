@@ -0,0 +1,188 @@
+// Package memory keeps chunks and metadata in memory, for tests and ephemeral servers.
+// Nothing survives a restart.
+package memory
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+	"zerodupe/internal/server/storage"
+	"zerodupe/pkg/hasher"
+
+	"github.com/rs/zerolog/log"
+)
+
+// StorageURL is the storage location that selects the in-memory backends
+const StorageURL = "memory://"
+
+// chunk is a stored chunk
+type chunk struct {
+	data    []byte
+	modTime time.Time
+}
+
+// MemoryStorage implements the FileSystem interface in memory. Chunks are keyed like the
+// filesystem block store names them: the bare digest for SHA-256 and the prefixed hash otherwise.
+type MemoryStorage struct {
+	mu     sync.RWMutex
+	chunks map[string]*chunk
+}
+
+// NewMemoryStorage creates a new, empty in-memory storage
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{chunks: make(map[string]*chunk)}
+}
+
+// ListChunks returns the hashes of all stored chunks
+func (ms *MemoryStorage) ListChunks() ([]string, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	hashes := make([]string, 0, len(ms.chunks))
+	for key := range ms.chunks {
+		hashes = append(hashes, key)
+	}
+	return hashes, nil
+}
+
+// CheckChunkExists checks if chunks exist
+func (ms *MemoryStorage) CheckChunkExists(hashes []string) ([]string, []string, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	var existingChunks []string
+	var missingChunks []string
+
+	for _, hash := range hashes {
+		key, err := chunkKey(hash)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, ok := ms.chunks[key]; ok {
+			existingChunks = append(existingChunks, hash)
+		} else {
+			missingChunks = append(missingChunks, hash)
+		}
+	}
+
+	return existingChunks, missingChunks, nil
+}
+
+// SaveChunkData saves chunk data. Content that does not match chunkHash is rejected with storage.ErrHashMismatch.
+func (ms *MemoryStorage) SaveChunkData(chunkHash string, content []byte) (string, error) {
+	key, err := chunkKey(chunkHash)
+	if err != nil {
+		return "", err
+	}
+
+	isValid, calculatedHash := hasher.VerifyChunkHash(content, chunkHash)
+	if !isValid {
+		log.Warn().Msgf("Hash mismatch. Expected: %s, Got: %s", chunkHash, calculatedHash)
+		return calculatedHash, fmt.Errorf("%w: expected %s, got %s", storage.ErrHashMismatch, chunkHash, calculatedHash)
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	// reusing an existing chunk renews it for garbage collection
+	if existing, ok := ms.chunks[key]; ok {
+		existing.modTime = time.Now()
+		return chunkHash, nil
+	}
+
+	ms.chunks[key] = &chunk{data: append([]byte(nil), content...), modTime: time.Now()}
+	return calculatedHash, nil
+}
+
+// GetChunkData gets chunk data
+func (ms *MemoryStorage) GetChunkData(chunkHash string) ([]byte, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	stored, err := ms.lookup(chunkHash)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), stored.data...), nil
+}
+
+// StatChunk returns the size and modification time of a stored chunk
+func (ms *MemoryStorage) StatChunk(chunkHash string) (storage.ChunkInfo, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	stored, err := ms.lookup(chunkHash)
+	if err != nil {
+		return storage.ChunkInfo{}, err
+	}
+	return storage.ChunkInfo{Size: int64(len(stored.data)), ModTime: stored.modTime}, nil
+}
+
+// TouchChunk sets the modification time of a stored chunk to now
+func (ms *MemoryStorage) TouchChunk(chunkHash string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	stored, err := ms.lookup(chunkHash)
+	if err != nil {
+		return err
+	}
+	stored.modTime = time.Now()
+	return nil
+}
+
+// SetModTime sets the modification time of a stored chunk, for aging chunks in tests
+func (ms *MemoryStorage) SetModTime(chunkHash string, modTime time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	stored, err := ms.lookup(chunkHash)
+	if err != nil {
+		return err
+	}
+	stored.modTime = modTime
+	return nil
+}
+
+// DeleteChunk deletes a stored chunk
+func (ms *MemoryStorage) DeleteChunk(chunkHash string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	key, err := chunkKey(chunkHash)
+	if err != nil {
+		return err
+	}
+	if _, ok := ms.chunks[key]; !ok {
+		return fmt.Errorf("chunk %s: %w", chunkHash, os.ErrNotExist)
+	}
+	delete(ms.chunks, key)
+	return nil
+}
+
+// lookup returns a stored chunk. The caller must hold mu.
+func (ms *MemoryStorage) lookup(chunkHash string) (*chunk, error) {
+	key, err := chunkKey(chunkHash)
+	if err != nil {
+		return nil, err
+	}
+	stored, ok := ms.chunks[key]
+	if !ok {
+		return nil, fmt.Errorf("chunk not found: %s: %w", chunkHash, os.ErrNotExist)
+	}
+	return stored, nil
+}
+
+// chunkKey returns the key of a chunk, which is the name ListChunks reports for it.
+// It rejects the hashes the filesystem block store rejects.
+func chunkKey(hash string) (string, error) {
+	algorithm, digest, err := hasher.ParseHash(hash)
+	if err != nil {
+		return "", err
+	}
+	if algorithm == hasher.SHA256 {
+		return digest, nil
+	}
+	return hasher.FormatHash(algorithm, digest), nil
+}
@@ -0,0 +1,19 @@
+package memory
+
+import (
+	"testing"
+	"zerodupe/internal/server/storage"
+	"zerodupe/internal/server/storage/storagetest"
+)
+
+func TestMemoryStorageConformance(t *testing.T) {
+	storagetest.TestFileSystem(t, func(t *testing.T) storage.FileSystem {
+		return NewMemoryStorage()
+	})
+}
+
+func TestMemoryDBConformance(t *testing.T) {
+	storagetest.TestDB(t, func(t *testing.T) storage.DB {
+		return NewMemoryDB()
+	})
+}
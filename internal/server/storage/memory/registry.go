@@ -0,0 +1,15 @@
+package memory
+
+import (
+	"net/url"
+	"zerodupe/internal/server/storage"
+)
+
+func init() {
+	storage.RegisterFileSystem("memory", func(u *url.URL) (storage.FileSystem, error) {
+		return NewMemoryStorage(), nil
+	})
+	storage.RegisterDB("memory", func(u *url.URL) (storage.DB, error) {
+		return NewMemoryDB(), nil
+	})
+}
@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"zerodupe/internal/server/model"
+	"zerodupe/pkg/hasher"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Migration is a one-off data migration, applied once per storage
+type Migration struct {
+	Name string
+	Run  func(fileSystem FileSystem, db DB) error
+}
+
+// migrations lists all data migrations in the order they are applied
+var migrations = []Migration{
+	{Name: "single-chunk-file-manifests", Run: migrateSingleChunkFiles},
+	{Name: "chunk-sizes", Run: migrateChunkSizes},
+	{Name: "recount", Run: migrateRecount},
+}
+
+// Migrate applies all data migrations that have not been applied yet
+func Migrate(fileSystem FileSystem, db DB) error {
+	for _, migration := range migrations {
+		applied, err := db.CheckMigrationApplied(migration.Name)
+		if err != nil {
+			return err
+		}
+		if applied {
+			continue
+		}
+
+		log.Info().Str("migration", migration.Name).Msg("Applying migration")
+		if err := migration.Run(fileSystem, db); err != nil {
+			return fmt.Errorf("migration %s failed: %w", migration.Name, err)
+		}
+		if err := db.SaveMigration(migration.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateSingleChunkFiles creates file metadata for files stored before every file had one.
+// Single chunk files used to be stored as a bare chunk whose hash was the file hash: an
+// unreferenced SHA-256 chunk no larger than the fixed chunk size of the time, whose content
+// matches its hash. Each gets a manifest under its Merkle root like any file uploaded since,
+// with the old hash it was known by as an alias, so that clients can still download, check and
+// delete it by the old hash. Both hashes are logged.
+func migrateSingleChunkFiles(fileSystem FileSystem, db DB) error {
+	chunkHashes, err := fileSystem.ListChunks()
+	if err != nil {
+		return err
+	}
+
+	// single chunk files were always cut by the fixed chunker of the time
+	chunker := hasher.FixedChunkerConfig(hasher.ChunkSizeBytes).String()
+
+	migrated := 0
+	for _, chunkHash := range chunkHashes {
+		if !isLegacySHA256(chunkHash) {
+			continue
+		}
+		referenced, err := db.CheckChunkReferenced(chunkHash)
+		if err != nil {
+			return err
+		}
+		if referenced {
+			continue
+		}
+
+		content, err := fileSystem.GetChunkData(chunkHash)
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, ErrCorruptChunk) {
+			log.Warn().Err(err).Str("chunk", chunkHash).Msg("Cannot read a single chunk file")
+			continue
+		} else if err != nil {
+			return err
+		}
+		if len(content) > hasher.ChunkSizeBytes {
+			continue
+		}
+		if ok, _ := hasher.VerifyChunkHash(content, chunkHash); !ok {
+			continue
+		}
+
+		fileHash := hasher.FileHashFromChunkHashes([]string{chunkHash})
+		exists, err := db.CheckFileExists(fileHash)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		metadata := &model.FileMetadata{
+			FileHash: fileHash,
+			Chunker:  chunker,
+			Chunks:   []model.ChunkMetadata{{ChunkOrder: 1, ChunkHash: chunkHash, Size: int64(len(content))}},
+		}
+		if err := db.SaveFileMetadata(metadata); err != nil {
+			return err
+		}
+		if err := db.AddFileAlias(fileHash, chunkHash); err != nil {
+			return err
+		}
+		log.Info().Str("old_hash", chunkHash).Str("file_hash", fileHash).Msg("Created manifest for single chunk file")
+		migrated++
+	}
+
+	log.Info().Int("files", migrated).Msg("Created manifests for single chunk files")
+	return nil
+}
+
+// isLegacySHA256 reports whether hash is a bare hex SHA-256 hash, the only kind of hash there
+// was before hashes carried their algorithm
+func isLegacySHA256(hash string) bool {
+	_, _, err := hasher.ParseHash(hash)
+	return hasher.IsLegacyHash(hash) && err == nil
+}
+
+// migrateChunkSizes records the sizes of chunks stored before chunk sizes were recorded, reading
+// each one. Chunks missing from the store are left at size 0. The recount migration then counts
+// the sizes of files and the usage of users with them.
+func migrateChunkSizes(fileSystem FileSystem, db DB) error {
+	chunkHashes, err := db.ListUnsizedChunks()
+	if err != nil {
+		return err
+	}
+
+	migrated := 0
+	for _, chunkHash := range chunkHashes {
+		content, err := fileSystem.GetChunkData(chunkHash)
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, ErrCorruptChunk) {
+			log.Warn().Err(err).Str("chunk", chunkHash).Msg("Cannot read the size of a chunk")
+			continue
+		} else if err != nil {
+			return err
+		}
+		if len(content) == 0 {
+			continue
+		}
+		if err := db.SetChunkSize(chunkHash, int64(len(content))); err != nil {
+			return err
+		}
+		migrated++
+	}
+
+	log.Info().Int("chunks", migrated).Msg("Recorded chunk sizes")
+	return nil
+}
+
+// migrateRecount recomputes everything the storage maintains as files are uploaded and deleted, see
+// DB.RebuildChunkRefs. It counts what databases created before it was maintained lack, like the
+// chunk references, chunk bytes of users, file sizes and the totals reported by the stats, and
+// recounts databases whose schema repair dropped extra chunks, see repairChunkMetadataSchema. It
+// also marks the files stored before completeness was recorded complete when their chunks hash to
+// their file hash. It is idempotent, so counters added later are recounted by renaming it rather
+// than by adding another migration. A new database has nothing to count.
+func migrateRecount(fileSystem FileSystem, db DB) error {
+	hasFiles, err := db.HasFiles()
+	if err != nil || !hasFiles {
+		return err
+	}
+	return db.RebuildChunkRefs()
+}
@@ -0,0 +1,175 @@
+package storage_test
+
+import (
+	"path/filepath"
+	"testing"
+	"zerodupe/internal/server/storage"
+	"zerodupe/internal/server/storage/filesystem"
+	"zerodupe/pkg/hasher"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const testChunker = "fastcdc:2048:8192:65536"
+
+// setupMigrationStorage creates an in-memory database and a temporary filesystem storage
+func setupMigrationStorage(t *testing.T) (storage.DB, *filesystem.FilesystemStorage) {
+	t.Helper()
+
+	db, err := storage.NewGormStorage(sqlite.Open(":memory:"))
+	require.NoError(t, err)
+	fileSystem, err := filesystem.NewFilesystemStorage(t.TempDir())
+	require.NoError(t, err)
+
+	return db, fileSystem
+}
+
+func TestMigrate(t *testing.T) {
+	t.Run("Test Migrate creates manifests for single chunk files", func(t *testing.T) {
+		db, fileSystem := setupMigrationStorage(t)
+
+		// a legacy single chunk file is a bare chunk whose hash is the file hash
+		singleChunkHash := hasher.CalculateChunkHash([]byte("single"))
+		_, err := fileSystem.SaveChunkData(singleChunkHash, []byte("single"))
+		require.NoError(t, err)
+
+		// chunks of multi chunk files are referenced by their file
+		chunkHash := hasher.CalculateChunkHash([]byte("chunk"))
+		_, err = fileSystem.SaveChunkData(chunkHash, []byte("chunk"))
+		require.NoError(t, err)
+		require.NoError(t, db.SaveChunkMetadata("multichunkfile", chunkHash, 1, 0, testChunker))
+
+		// neither chunks larger than the chunker of the time cut nor chunks with an algorithm prefix
+		// were single chunk files
+		large := make([]byte, hasher.ChunkSizeBytes+1)
+		largeHash := hasher.CalculateChunkHash(large)
+		_, err = fileSystem.SaveChunkData(largeHash, large)
+		require.NoError(t, err)
+		prefixedHash, err := hasher.Sum(hasher.BLAKE3, []byte("prefixed"))
+		require.NoError(t, err)
+		_, err = fileSystem.SaveChunkData(prefixedHash, []byte("prefixed"))
+		require.NoError(t, err)
+
+		require.NoError(t, storage.Migrate(fileSystem, db))
+
+		// the manifest has its own hash, which a new upload of the same content also gets
+		fileHash := hasher.FileHashFromChunkHashes([]string{singleChunkHash})
+		assert.NotEqual(t, hasher.CanonicalHash(singleChunkHash), fileHash)
+		metadata, err := db.GetFileMetadata(fileHash)
+		require.NoError(t, err)
+		require.NotNil(t, metadata)
+		require.Len(t, metadata.Chunks, 1)
+		assert.Equal(t, singleChunkHash, metadata.Chunks[0].ChunkHash)
+		assert.Equal(t, int64(len("single")), metadata.Size)
+		assert.True(t, metadata.Complete)
+		assert.Equal(t, hasher.FixedChunkerConfig(hasher.ChunkSizeBytes).String(), metadata.Chunker)
+
+		// the old hash is an alias of the manifest
+		metadata, err = db.GetFileMetadata(singleChunkHash)
+		require.NoError(t, err)
+		require.NotNil(t, metadata)
+		assert.Equal(t, fileHash, metadata.FileHash)
+
+		for _, hash := range []string{chunkHash, largeHash, prefixedHash} {
+			metadata, err = db.GetFileMetadata(hash)
+			require.NoError(t, err)
+			assert.Nil(t, metadata, hash)
+		}
+		for _, hash := range []string{singleChunkHash, chunkHash, largeHash, prefixedHash} {
+			metadata, err = db.GetFileMetadata(hasher.FileHashFromChunkHashes([]string{hash}))
+			require.NoError(t, err)
+			assert.Equal(t, hash == singleChunkHash, metadata != nil, hash)
+		}
+	})
+
+	t.Run("Test Migrate applies each migration once", func(t *testing.T) {
+		db, fileSystem := setupMigrationStorage(t)
+
+		require.NoError(t, storage.Migrate(fileSystem, db))
+
+		// chunks stored after the migration are not turned into files
+		chunkHash := hasher.CalculateChunkHash([]byte("chunk"))
+		_, err := fileSystem.SaveChunkData(chunkHash, []byte("chunk"))
+		require.NoError(t, err)
+
+		require.NoError(t, storage.Migrate(fileSystem, db))
+
+		exists, err := db.CheckFileExists(chunkHash)
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("Test Migrate records the sizes of chunks", func(t *testing.T) {
+		db, fileSystem := setupMigrationStorage(t)
+
+		chunkHash := hasher.CalculateChunkHash([]byte("chunk"))
+		_, err := fileSystem.SaveChunkData(chunkHash, []byte("chunk"))
+		require.NoError(t, err)
+		require.NoError(t, db.SaveChunkMetadata("file", chunkHash, 1, 0, testChunker))
+		require.NoError(t, db.AddFileOwner("file", 1))
+		// chunks missing from the store keep no size
+		missingHash := hasher.CalculateChunkHash([]byte("missing"))
+		require.NoError(t, db.SaveChunkMetadata("file", missingHash, 2, 0, testChunker))
+
+		require.NoError(t, storage.Migrate(fileSystem, db))
+
+		ref, err := db.GetChunkRef(chunkHash)
+		require.NoError(t, err)
+		require.NotNil(t, ref)
+		assert.Equal(t, int64(5), ref.Size)
+		usage, err := db.GetUsage(1)
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), usage.LogicalBytes)
+		assert.Equal(t, int64(5), usage.UniqueBytes)
+
+		ref, err = db.GetChunkRef(missingHash)
+		require.NoError(t, err)
+		require.NotNil(t, ref)
+		assert.Zero(t, ref.Size)
+	})
+	t.Run("Test Migrate marks the complete files of an old database", func(t *testing.T) {
+		dsn := filepath.Join(t.TempDir(), "metadata.db")
+		db, err := storage.NewGormStorage(sqlite.Open(dsn))
+		require.NoError(t, err)
+		fileSystem, err := filesystem.NewFilesystemStorage(t.TempDir())
+		require.NoError(t, err)
+
+		chunkHashes := []string{hasher.CalculateChunkHash([]byte("first")), hasher.CalculateChunkHash([]byte("second"))}
+		complete := hasher.FileHashFromChunkHashes(chunkHashes)
+		incomplete := hasher.FileHashFromChunkHashes([]string{chunkHashes[1], chunkHashes[0]})
+		for i, chunkHash := range chunkHashes {
+			require.NoError(t, db.SaveChunkMetadata(complete, chunkHash, i+1, 10, testChunker))
+		}
+		require.NoError(t, db.SaveChunkMetadata(incomplete, chunkHashes[1], 1, 10, testChunker))
+
+		// databases from before completeness and file sizes were recorded have neither
+		old, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+		require.NoError(t, err)
+		require.NoError(t, old.Exec("UPDATE file_metadata SET complete = false, size = 0").Error)
+		sqlDB, err := old.DB()
+		require.NoError(t, err)
+		require.NoError(t, sqlDB.Close())
+
+		require.NoError(t, storage.Migrate(fileSystem, db))
+
+		metadata, err := db.GetFileMetadata(complete)
+		require.NoError(t, err)
+		require.NotNil(t, metadata)
+		assert.True(t, metadata.Complete)
+		assert.Equal(t, int64(20), metadata.Size)
+		metadata, err = db.GetFileMetadata(incomplete)
+		require.NoError(t, err)
+		require.NotNil(t, metadata)
+		assert.False(t, metadata.Complete)
+		assert.Equal(t, int64(10), metadata.Size)
+
+		// the incomplete file can still be completed
+		require.NoError(t, db.SaveChunkMetadata(incomplete, chunkHashes[0], 2, 10, testChunker))
+		done, err := db.CompleteFile(incomplete, 2)
+		require.NoError(t, err)
+		assert.True(t, done)
+	})
+}
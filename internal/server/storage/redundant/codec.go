@@ -0,0 +1,151 @@
+package redundant
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"zerodupe/pkg/hasher"
+
+	"github.com/klauspost/reedsolomon"
+)
+
+// codec splits chunk content into the shards stored in the directories and joins it back
+type codec interface {
+	// minShards returns the number of valid shards needed to rebuild a chunk
+	minShards() int
+
+	// encode returns the content of every shard of a chunk, one per directory
+	encode(content []byte) ([][]byte, error)
+
+	// valid reports whether a shard read from disk is intact
+	valid(chunkHash string, shard []byte) bool
+
+	// decode rebuilds the content of a chunk from its shards. Missing and invalid shards are
+	// nil, at least minShards are not.
+	decode(shards [][]byte) ([]byte, error)
+}
+
+// mirrorCodec stores a full copy of every chunk in each directory
+type mirrorCodec struct {
+	copies int
+}
+
+func (mc *mirrorCodec) minShards() int {
+	return 1
+}
+
+func (mc *mirrorCodec) encode(content []byte) ([][]byte, error) {
+	shards := make([][]byte, mc.copies)
+	for i := range shards {
+		shards[i] = content
+	}
+	return shards, nil
+}
+
+// valid verifies a copy against the chunk hash, a copy carries no checksum of its own
+func (mc *mirrorCodec) valid(chunkHash string, shard []byte) bool {
+	ok, _ := hasher.VerifyChunkHash(shard, chunkHash)
+	return ok
+}
+
+func (mc *mirrorCodec) decode(shards [][]byte) ([]byte, error) {
+	for _, shard := range shards {
+		if shard != nil {
+			return shard, nil
+		}
+	}
+	return nil, errors.New("no valid copy")
+}
+
+// erasureHeaderSize is the size of the header of an erasure-coded shard: a CRC-32 of the rest
+// of the shard followed by the size of the chunk content
+const erasureHeaderSize = 4 + 8
+
+// erasureCodec stores every chunk as data shards and parity shards computed with Reed-Solomon
+// coding, so any dataShards of the shards rebuild the chunk
+type erasureCodec struct {
+	dataShards   int
+	parityShards int
+	encoder      reedsolomon.Encoder
+}
+
+func newErasureCodec(dataShards, parityShards int) (*erasureCodec, error) {
+	encoder, err := reedsolomon.New(dataShards, parityShards)
+	if err != nil {
+		return nil, fmt.Errorf("invalid erasure coding %d+%d: %w", dataShards, parityShards, err)
+	}
+	return &erasureCodec{dataShards: dataShards, parityShards: parityShards, encoder: encoder}, nil
+}
+
+func (ec *erasureCodec) minShards() int {
+	return ec.dataShards
+}
+
+func (ec *erasureCodec) encode(content []byte) ([][]byte, error) {
+	// Split cannot split nothing, an empty chunk is coded as a single zero byte of size 0.
+	// Split may also write into spare capacity of its input, so it gets a copy.
+	data := append([]byte(nil), content...)
+	if len(data) == 0 {
+		data = []byte{0}
+	}
+
+	payloads, err := ec.encoder.Split(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to split chunk: %w", err)
+	}
+	if err := ec.encoder.Encode(payloads); err != nil {
+		return nil, fmt.Errorf("failed to encode parity: %w", err)
+	}
+
+	shards := make([][]byte, len(payloads))
+	for i, payload := range payloads {
+		shard := make([]byte, erasureHeaderSize+len(payload))
+		binary.BigEndian.PutUint64(shard[4:erasureHeaderSize], uint64(len(content)))
+		copy(shard[erasureHeaderSize:], payload)
+		binary.BigEndian.PutUint32(shard[:4], crc32.ChecksumIEEE(shard[4:]))
+		shards[i] = shard
+	}
+	return shards, nil
+}
+
+// valid verifies the checksum of a shard, the chunk hash is only known for the whole chunk
+func (ec *erasureCodec) valid(chunkHash string, shard []byte) bool {
+	if len(shard) <= erasureHeaderSize {
+		return false
+	}
+	return binary.BigEndian.Uint32(shard[:4]) == crc32.ChecksumIEEE(shard[4:])
+}
+
+func (ec *erasureCodec) decode(shards [][]byte) ([]byte, error) {
+	// every shard of a chunk has the same size, shards that disagree with the first are dropped
+	var size uint64
+	payloadSize := -1
+	payloads := make([][]byte, len(shards))
+	for i, shard := range shards {
+		if shard == nil {
+			continue
+		}
+		shardSize := binary.BigEndian.Uint64(shard[4:erasureHeaderSize])
+		if payloadSize < 0 {
+			size, payloadSize = shardSize, len(shard)-erasureHeaderSize
+		} else if shardSize != size || len(shard)-erasureHeaderSize != payloadSize {
+			continue
+		}
+		payloads[i] = shard[erasureHeaderSize:]
+	}
+
+	if err := ec.encoder.ReconstructData(payloads); err != nil {
+		return nil, fmt.Errorf("failed to reconstruct chunk: %w", err)
+	}
+	if size > uint64(payloadSize)*uint64(ec.dataShards) {
+		return nil, fmt.Errorf("chunk size %d exceeds its shards", size)
+	}
+
+	var content bytes.Buffer
+	if err := ec.encoder.Join(&content, payloads, int(size)); err != nil {
+		return nil, fmt.Errorf("failed to join shards: %w", err)
+	}
+	return content.Bytes(), nil
+}
@@ -0,0 +1,539 @@
+// Package redundant spreads every chunk over several directories, ideally on different disks,
+// either as full copies or erasure coded, so chunks survive the loss of some of them.
+package redundant
+
+import (
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"zerodupe/internal/server/storage"
+	"zerodupe/internal/server/storage/filesystem"
+	"zerodupe/pkg/hasher"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Redundancy modes
+const (
+	ModeMirror  = "mirror"
+	ModeErasure = "erasure"
+)
+
+// RedundantStorage implements the FileSystem interface over several directories. Shard i of
+// every chunk is stored in directory i under the name the filesystem block store gives the
+// chunk's block. A mirror stores a full copy as every shard, erasure coding stores k data
+// shards and m parity shards. Reads rebuild a chunk from the shards that are left as long as
+// enough of them are, and Repair writes the missing shards again.
+type RedundantStorage struct {
+	mode  string
+	dirs  []string
+	codec codec
+
+	locksMu sync.Mutex
+	locks   map[string]*chunkLock
+}
+
+// chunkLock serializes the operations on one chunk
+type chunkLock struct {
+	mu    sync.Mutex
+	users int
+}
+
+// NewMirrorStorage creates a storage keeping a full copy of every chunk in each of at least
+// two directories. A chunk stays readable as long as one copy is left.
+func NewMirrorStorage(dirs []string) (*RedundantStorage, error) {
+	if len(dirs) < 2 {
+		return nil, fmt.Errorf("a mirror needs at least 2 directories, got %d", len(dirs))
+	}
+	return newRedundantStorage(ModeMirror, dirs, &mirrorCodec{copies: len(dirs)})
+}
+
+// NewErasureStorage creates a storage splitting every chunk into dataShards data shards and
+// parityShards parity shards, one per directory, so len(dirs) must be their sum. A chunk stays
+// readable as long as dataShards of its shards are left.
+func NewErasureStorage(dirs []string, dataShards, parityShards int) (*RedundantStorage, error) {
+	if dataShards < 1 || parityShards < 1 {
+		return nil, fmt.Errorf("erasure coding needs at least 1 data and 1 parity shard, got %d+%d", dataShards, parityShards)
+	}
+	if len(dirs) != dataShards+parityShards {
+		return nil, fmt.Errorf("erasure coding %d+%d needs %d directories, got %d", dataShards, parityShards, dataShards+parityShards, len(dirs))
+	}
+	erasure, err := newErasureCodec(dataShards, parityShards)
+	if err != nil {
+		return nil, err
+	}
+	return newRedundantStorage(ModeErasure, dirs, erasure)
+}
+
+func newRedundantStorage(mode string, dirs []string, codec codec) (*RedundantStorage, error) {
+	seen := make(map[string]bool, len(dirs))
+	cleaned := make([]string, len(dirs))
+	for i, dir := range dirs {
+		if dir == "" {
+			return nil, errors.New("empty directory")
+		}
+		cleaned[i] = filepath.Clean(dir)
+		if seen[cleaned[i]] {
+			return nil, fmt.Errorf("directory %s is listed twice", dir)
+		}
+		seen[cleaned[i]] = true
+
+		if err := os.MkdirAll(cleaned[i], 0755); err != nil {
+			return nil, fmt.Errorf("failed to create directory %s: %w", dir, err)
+		}
+	}
+
+	rs := &RedundantStorage{
+		mode:  mode,
+		dirs:  cleaned,
+		codec: codec,
+		locks: make(map[string]*chunkLock),
+	}
+
+	removed, err := rs.sweepTempFiles()
+	if err != nil {
+		return nil, err
+	}
+	if removed > 0 {
+		log.Info().Int("files", removed).Msg("Removed temp files of interrupted writes")
+	}
+	return rs, nil
+}
+
+// Mode returns the redundancy mode, ModeMirror or ModeErasure
+func (rs *RedundantStorage) Mode() string {
+	return rs.mode
+}
+
+// Dirs returns the directories holding the shards, in shard order
+func (rs *RedundantStorage) Dirs() []string {
+	return append([]string(nil), rs.dirs...)
+}
+
+// MinShards returns the number of shards a chunk needs to stay readable
+func (rs *RedundantStorage) MinShards() int {
+	return rs.codec.minShards()
+}
+
+// ListChunks returns the hashes of all chunks with a shard in any directory
+func (rs *RedundantStorage) ListChunks() ([]string, error) {
+	seen := make(map[string]bool)
+	var hashes []string
+	for _, dir := range rs.dirs {
+		dirHashes, err := listShards(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, hash := range dirHashes {
+			if !seen[hash] {
+				seen[hash] = true
+				hashes = append(hashes, hash)
+			}
+		}
+	}
+	return hashes, nil
+}
+
+// CheckChunkExists checks if chunks exist. A chunk exists if enough of its shards are left to
+// read it, so chunks that lost too many shards are uploaded again.
+func (rs *RedundantStorage) CheckChunkExists(hashes []string) ([]string, []string, error) {
+	var existingChunks []string
+	var missingChunks []string
+
+	for _, hash := range hashes {
+		paths, err := rs.shardPaths(hash)
+		if err != nil {
+			return nil, nil, err
+		}
+		present, err := countShards(paths)
+		if err != nil {
+			return nil, nil, err
+		}
+		if present >= rs.codec.minShards() {
+			existingChunks = append(existingChunks, hash)
+		} else {
+			missingChunks = append(missingChunks, hash)
+		}
+	}
+
+	return existingChunks, missingChunks, nil
+}
+
+// SaveChunkData saves chunk data as one shard per directory. Content that does not match
+// chunkHash is rejected with storage.ErrHashMismatch. Saving an existing chunk renews it and
+// writes the shards it is missing. The save succeeds, degraded, as long as enough shards to
+// read the chunk could be written.
+func (rs *RedundantStorage) SaveChunkData(chunkHash string, content []byte) (string, error) {
+	paths, err := rs.shardPaths(chunkHash)
+	if err != nil {
+		return "", err
+	}
+
+	isValid, calculatedHash := hasher.VerifyChunkHash(content, chunkHash)
+	if !isValid {
+		log.Warn().Msgf("Hash mismatch. Expected: %s, Got: %s", chunkHash, calculatedHash)
+		return calculatedHash, fmt.Errorf("%w: expected %s, got %s", storage.ErrHashMismatch, chunkHash, calculatedHash)
+	}
+
+	unlock := rs.lock(paths[0])
+	defer unlock()
+
+	shards, err := rs.codec.encode(content)
+	if err != nil {
+		return "", err
+	}
+
+	existed := false
+	written := 0
+	var writeErrs []error
+	now := time.Now()
+	for i, path := range paths {
+		// existing shards are only renewed, a damaged one is left for Repair
+		if err := os.Chtimes(path, now, now); err == nil {
+			existed = true
+			written++
+			continue
+		} else if !errors.Is(err, os.ErrNotExist) {
+			writeErrs = append(writeErrs, err)
+			continue
+		}
+
+		if err := writeShard(path, shards[i]); err != nil {
+			writeErrs = append(writeErrs, fmt.Errorf("shard %d: %w", i, err))
+			continue
+		}
+		written++
+	}
+
+	if written < rs.codec.minShards() {
+		return "", fmt.Errorf("failed to save chunk %s, wrote %d of %d shards: %w", chunkHash, written, len(paths), errors.Join(writeErrs...))
+	}
+	if len(writeErrs) > 0 {
+		log.Warn().Err(errors.Join(writeErrs...)).Str("chunk", chunkHash).Int("shards", written).Msg("Saved chunk degraded")
+	}
+
+	if existed {
+		return chunkHash, nil
+	}
+	return calculatedHash, nil
+}
+
+// GetChunkData gets chunk data, rebuilt from the intact shards. It returns an error wrapping
+// storage.ErrCorruptChunk if too few of them are left.
+func (rs *RedundantStorage) GetChunkData(chunkHash string) ([]byte, error) {
+	paths, err := rs.shardPaths(chunkHash)
+	if err != nil {
+		return nil, err
+	}
+
+	// the first shards are enough unless they fail to rebuild the chunk: a copy for a mirror and
+	// the data shards for erasure coding, which need no decoding
+	shards, _, err := rs.readShards(chunkHash, paths, rs.codec.minShards())
+	if err != nil {
+		return nil, err
+	}
+	content, err := rs.decode(chunkHash, shards)
+	if err == nil {
+		return content, nil
+	}
+
+	shards, _, err = rs.readShards(chunkHash, paths, len(paths))
+	if err != nil {
+		return nil, err
+	}
+	return rs.decode(chunkHash, shards)
+}
+
+// StatChunk returns the size of all shards of a chunk and the latest modification time of any
+func (rs *RedundantStorage) StatChunk(chunkHash string) (storage.ChunkInfo, error) {
+	paths, err := rs.shardPaths(chunkHash)
+	if err != nil {
+		return storage.ChunkInfo{}, err
+	}
+
+	var info storage.ChunkInfo
+	present := 0
+	for _, path := range paths {
+		shardInfo, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return storage.ChunkInfo{}, err
+		}
+		present++
+		info.Size += shardInfo.Size()
+		if shardInfo.ModTime().After(info.ModTime) {
+			info.ModTime = shardInfo.ModTime()
+		}
+	}
+
+	if present == 0 {
+		return storage.ChunkInfo{}, fmt.Errorf("chunk not found: %s: %w", chunkHash, os.ErrNotExist)
+	}
+	return info, nil
+}
+
+// TouchChunk sets the modification time of every shard of a chunk to now
+func (rs *RedundantStorage) TouchChunk(chunkHash string) error {
+	paths, err := rs.shardPaths(chunkHash)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	present := 0
+	for _, path := range paths {
+		err := os.Chtimes(path, now, now)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to touch chunk: %w", err)
+		}
+		present++
+	}
+
+	if present == 0 {
+		return fmt.Errorf("chunk not found: %s: %w", chunkHash, os.ErrNotExist)
+	}
+	return nil
+}
+
+// DeleteChunk deletes every shard of a chunk
+func (rs *RedundantStorage) DeleteChunk(chunkHash string) error {
+	paths, err := rs.shardPaths(chunkHash)
+	if err != nil {
+		return err
+	}
+
+	unlock := rs.lock(paths[0])
+	defer unlock()
+
+	present := 0
+	for _, path := range paths {
+		err := os.Remove(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to delete chunk: %w", err)
+		}
+		present++
+	}
+
+	if present == 0 {
+		return fmt.Errorf("chunk %s: %w", chunkHash, os.ErrNotExist)
+	}
+	return nil
+}
+
+// readShards reads the shards of a chunk in shard order until want of them are valid. Missing,
+// invalid and unread shards are nil. It returns the number of shards found on disk, valid or
+// not, and an error wrapping os.ErrNotExist if there are none.
+func (rs *RedundantStorage) readShards(chunkHash string, paths []string, want int) ([][]byte, int, error) {
+	shards := make([][]byte, len(paths))
+	present, valid := 0, 0
+	for i, path := range paths {
+		if valid == want {
+			break
+		}
+		shard, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		present++
+		if err != nil {
+			log.Warn().Err(err).Str("chunk", chunkHash).Int("shard", i).Msg("Failed to read shard")
+			continue
+		}
+		if !rs.codec.valid(chunkHash, shard) {
+			log.Warn().Str("chunk", chunkHash).Int("shard", i).Msg("Corrupt shard")
+			continue
+		}
+		shards[i] = shard
+		valid++
+	}
+
+	if present == 0 {
+		return nil, 0, fmt.Errorf("chunk not found: %s: %w", chunkHash, os.ErrNotExist)
+	}
+	return shards, present, nil
+}
+
+// decode rebuilds a chunk from its valid shards and verifies it against its hash
+func (rs *RedundantStorage) decode(chunkHash string, shards [][]byte) ([]byte, error) {
+	valid := 0
+	for _, shard := range shards {
+		if shard != nil {
+			valid++
+		}
+	}
+	if valid < rs.codec.minShards() {
+		return nil, fmt.Errorf("%w: %s has %d of the %d shards needed", storage.ErrCorruptChunk, chunkHash, valid, rs.codec.minShards())
+	}
+
+	content, err := rs.codec.decode(shards)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", storage.ErrCorruptChunk, chunkHash, err)
+	}
+	if ok, actualHash := hasher.VerifyChunkHash(content, chunkHash); !ok {
+		return nil, fmt.Errorf("%w: %s rebuilt as %s", storage.ErrCorruptChunk, chunkHash, actualHash)
+	}
+	return content, nil
+}
+
+// shardPaths returns the path of every shard of a chunk, in shard order
+func (rs *RedundantStorage) shardPaths(hash string) ([]string, error) {
+	name, err := filesystem.BlockName(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, len(rs.dirs))
+	for i, dir := range rs.dirs {
+		paths[i] = filepath.Join(dir, name)
+	}
+	return paths, nil
+}
+
+// lock serializes writes and deletions of the chunk whose first shard is at path, so a repair
+// never brings back a chunk that is being deleted. It returns the unlock function.
+func (rs *RedundantStorage) lock(path string) func() {
+	rs.locksMu.Lock()
+	chunk, ok := rs.locks[path]
+	if !ok {
+		chunk = &chunkLock{}
+		rs.locks[path] = chunk
+	}
+	chunk.users++
+	rs.locksMu.Unlock()
+
+	chunk.mu.Lock()
+	return func() {
+		chunk.mu.Unlock()
+
+		rs.locksMu.Lock()
+		chunk.users--
+		if chunk.users == 0 {
+			delete(rs.locks, path)
+		}
+		rs.locksMu.Unlock()
+	}
+}
+
+// sweepTempFiles removes temp files left behind by shard writes interrupted by a crash
+func (rs *RedundantStorage) sweepTempFiles() (int, error) {
+	removed := 0
+	for _, dir := range rs.dirs {
+		err := filepath.WalkDir(dir, func(path string, entry iofs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() || !filesystem.IsTempFile(entry.Name()) {
+				return nil
+			}
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			removed++
+			return nil
+		})
+		if err != nil {
+			return removed, fmt.Errorf("failed to remove temp files: %w", err)
+		}
+	}
+	return removed, nil
+}
+
+// writeShard writes a shard atomically, creating its directories first since a shard directory
+// may have been lost
+func writeShard(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	return filesystem.WriteFileAtomic(path, data, 0644)
+}
+
+// listShards returns the hashes of the chunks with a shard in a directory. A missing directory,
+// such as one on a replaced disk, holds no shards.
+func listShards(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shards: %w", err)
+	}
+
+	var hashes []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		// shards of algorithms other than SHA-256 are nested one level deeper
+		if _, err := hasher.LookupAlgorithm(entry.Name()); err == nil {
+			prefixes, err := os.ReadDir(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				return nil, fmt.Errorf("failed to list shards: %w", err)
+			}
+			for _, prefix := range prefixes {
+				if !prefix.IsDir() {
+					continue
+				}
+				digests, err := listShardDir(filepath.Join(dir, entry.Name(), prefix.Name()))
+				if err != nil {
+					return nil, err
+				}
+				for _, digest := range digests {
+					hashes = append(hashes, hasher.FormatHash(entry.Name(), digest))
+				}
+			}
+			continue
+		}
+
+		digests, err := listShardDir(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, digests...)
+	}
+	return hashes, nil
+}
+
+// listShardDir returns the names of the shards in a single prefix directory
+func listShardDir(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shards: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && !filesystem.IsTempFile(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// countShards returns how many of the shard files exist
+func countShards(paths []string) (int, error) {
+	present := 0
+	for _, path := range paths {
+		_, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to check shard: %w", err)
+		}
+		present++
+	}
+	return present, nil
+}
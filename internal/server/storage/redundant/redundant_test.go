@@ -0,0 +1,285 @@
+package redundant
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"zerodupe/internal/server/storage"
+	"zerodupe/internal/server/storage/storagetest"
+	"zerodupe/pkg/hasher"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// shardDirs returns n shard directories under a temporary directory
+func shardDirs(t *testing.T, n int) []string {
+	t.Helper()
+
+	root := t.TempDir()
+	dirs := make([]string, n)
+	for i := range dirs {
+		dirs[i] = filepath.Join(root, "disk"+string(rune('a'+i)))
+	}
+	return dirs
+}
+
+// setupStorages returns a 3-way mirror and a 2+2 erasure-coded storage over fresh directories
+func setupStorages(t *testing.T) map[string]*RedundantStorage {
+	t.Helper()
+
+	mirror, err := NewMirrorStorage(shardDirs(t, 3))
+	require.NoError(t, err)
+	erasure, err := NewErasureStorage(shardDirs(t, 4), 2, 2)
+	require.NoError(t, err)
+	return map[string]*RedundantStorage{ModeMirror: mirror, ModeErasure: erasure}
+}
+
+// saveChunk saves content and returns its hash
+func saveChunk(t *testing.T, rs *RedundantStorage, content []byte) string {
+	t.Helper()
+
+	chunkHash := hasher.CalculateChunkHash(content)
+	_, err := rs.SaveChunkData(chunkHash, content)
+	require.NoError(t, err)
+	return chunkHash
+}
+
+// testContent returns content spanning several erasure-coded shards
+func testContent(seed string) []byte {
+	return bytes.Repeat([]byte(seed), 1000)
+}
+
+func TestRedundantStorageConformance(t *testing.T) {
+	t.Run("Test mirror", func(t *testing.T) {
+		storagetest.TestFileSystem(t, func(t *testing.T) storage.FileSystem {
+			rs, err := NewMirrorStorage(shardDirs(t, 2))
+			require.NoError(t, err)
+			return rs
+		})
+	})
+
+	t.Run("Test erasure coding", func(t *testing.T) {
+		storagetest.TestFileSystem(t, func(t *testing.T) storage.FileSystem {
+			rs, err := NewErasureStorage(shardDirs(t, 3), 2, 1)
+			require.NoError(t, err)
+			return rs
+		})
+	})
+}
+
+func TestNewRedundantStorage(t *testing.T) {
+	t.Run("Test invalid configurations are rejected", func(t *testing.T) {
+		_, err := NewMirrorStorage(shardDirs(t, 1))
+		assert.Error(t, err)
+
+		dirs := shardDirs(t, 2)
+		_, err = NewMirrorStorage([]string{dirs[0], dirs[0] + "/"})
+		assert.Error(t, err)
+
+		_, err = NewErasureStorage(shardDirs(t, 3), 2, 2)
+		assert.Error(t, err)
+		_, err = NewErasureStorage(shardDirs(t, 2), 2, 0)
+		assert.Error(t, err)
+	})
+
+	t.Run("Test temp files of interrupted writes are removed", func(t *testing.T) {
+		dirs := shardDirs(t, 2)
+		rs, err := NewMirrorStorage(dirs)
+		require.NoError(t, err)
+		chunkHash := saveChunk(t, rs, []byte("content"))
+
+		tempFile := filepath.Join(dirs[0], chunkHash[:4], "."+chunkHash+".123.tmp")
+		require.NoError(t, os.WriteFile(tempFile, []byte("partial"), 0644))
+
+		_, err = NewMirrorStorage(dirs)
+		require.NoError(t, err)
+		assert.NoFileExists(t, tempFile)
+	})
+}
+
+func TestDegradedReads(t *testing.T) {
+	for mode, rs := range setupStorages(t) {
+		t.Run("Test "+mode+" reads with lost directories", func(t *testing.T) {
+			content := testContent(mode)
+			chunkHash := saveChunk(t, rs, content)
+			empty := saveChunk(t, rs, []byte{})
+
+			// losing as many directories as there is redundancy keeps every chunk readable
+			lost := len(rs.dirs) - rs.MinShards()
+			for _, dir := range rs.dirs[:lost] {
+				require.NoError(t, os.RemoveAll(dir))
+			}
+
+			got, err := rs.GetChunkData(chunkHash)
+			require.NoError(t, err)
+			assert.Equal(t, content, got)
+			got, err = rs.GetChunkData(empty)
+			require.NoError(t, err)
+			assert.Empty(t, got)
+
+			existing, _, err := rs.CheckChunkExists([]string{chunkHash})
+			require.NoError(t, err)
+			assert.Equal(t, []string{chunkHash}, existing)
+			hashes, err := rs.ListChunks()
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []string{chunkHash, empty}, hashes)
+
+			// one more lost directory leaves too few shards
+			require.NoError(t, os.RemoveAll(rs.dirs[lost]))
+			if rs.MinShards() == 1 {
+				_, err = rs.GetChunkData(chunkHash)
+				assert.ErrorIs(t, err, os.ErrNotExist)
+				return
+			}
+			_, err = rs.GetChunkData(chunkHash)
+			assert.ErrorIs(t, err, storage.ErrCorruptChunk)
+			_, missing, err := rs.CheckChunkExists([]string{chunkHash})
+			require.NoError(t, err)
+			assert.Equal(t, []string{chunkHash}, missing)
+		})
+	}
+
+	for mode, rs := range setupStorages(t) {
+		t.Run("Test "+mode+" reads skip corrupt shards", func(t *testing.T) {
+			content := testContent(mode)
+			chunkHash := saveChunk(t, rs, content)
+
+			paths, err := rs.shardPaths(chunkHash)
+			require.NoError(t, err)
+			for _, path := range paths[:len(paths)-rs.MinShards()] {
+				shard, err := os.ReadFile(path)
+				require.NoError(t, err)
+				shard[len(shard)-1] ^= 0xff
+				require.NoError(t, os.WriteFile(path, shard, 0644))
+			}
+
+			got, err := rs.GetChunkData(chunkHash)
+			require.NoError(t, err)
+			assert.Equal(t, content, got)
+		})
+	}
+
+	for mode, rs := range setupStorages(t) {
+		t.Run("Test "+mode+" reads only the shards they need", func(t *testing.T) {
+			chunkHash := saveChunk(t, rs, testContent(mode))
+			paths, err := rs.shardPaths(chunkHash)
+			require.NoError(t, err)
+
+			shards, present, err := rs.readShards(chunkHash, paths, rs.MinShards())
+			require.NoError(t, err)
+			assert.Equal(t, rs.MinShards(), present)
+			for i, shard := range shards {
+				assert.Equal(t, i < rs.MinShards(), shard != nil, "shard %d", i)
+			}
+		})
+	}
+
+	t.Run("Test saving an existing chunk writes its missing shards", func(t *testing.T) {
+		rs := setupStorages(t)[ModeErasure]
+		content := testContent("resaved")
+		chunkHash := saveChunk(t, rs, content)
+		require.NoError(t, os.RemoveAll(rs.dirs[1]))
+
+		saveChunk(t, rs, content)
+
+		paths, err := rs.shardPaths(chunkHash)
+		require.NoError(t, err)
+		assert.FileExists(t, paths[1])
+	})
+}
+
+func TestRepair(t *testing.T) {
+	for mode, rs := range setupStorages(t) {
+		t.Run("Test "+mode+" repair restores lost and corrupt shards", func(t *testing.T) {
+			first := saveChunk(t, rs, testContent("first"))
+			second := saveChunk(t, rs, testContent("second"))
+			healthy := saveChunk(t, rs, testContent("healthy"))
+
+			aged := time.Now().Add(-time.Hour).Truncate(time.Second)
+			firstPaths, err := rs.shardPaths(first)
+			require.NoError(t, err)
+			for _, path := range firstPaths {
+				require.NoError(t, os.Chtimes(path, aged, aged))
+			}
+
+			// the first chunk loses a shard with its directory, the second has a corrupt one
+			require.NoError(t, os.Remove(firstPaths[0]))
+			secondPaths, err := rs.shardPaths(second)
+			require.NoError(t, err)
+			require.NoError(t, os.WriteFile(secondPaths[len(secondPaths)-1], []byte("tampered"), 0644))
+
+			report, err := rs.Repair(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, 3, report.Scanned)
+			assert.Equal(t, 1, report.Healthy)
+			assert.Equal(t, 2, report.Repaired)
+			assert.Equal(t, 2, report.ShardsWritten)
+			assert.Empty(t, report.Unrecoverable)
+
+			// every shard is intact again, so the chunks survive losing the other directories
+			for _, dir := range rs.dirs[1 : 1+len(rs.dirs)-rs.MinShards()] {
+				require.NoError(t, os.RemoveAll(dir))
+			}
+			for hash, content := range map[string][]byte{first: testContent("first"), second: testContent("second"), healthy: testContent("healthy")} {
+				got, err := rs.GetChunkData(hash)
+				require.NoError(t, err)
+				assert.Equal(t, content, got)
+			}
+
+			// the rewritten shard keeps the age of the chunk
+			info, err := os.Stat(firstPaths[0])
+			require.NoError(t, err)
+			assert.True(t, info.ModTime().Equal(aged), "modification time %s", info.ModTime())
+		})
+	}
+
+	t.Run("Test repair reports unrecoverable chunks", func(t *testing.T) {
+		rs := setupStorages(t)[ModeErasure]
+		chunkHash := saveChunk(t, rs, testContent("lost"))
+		for _, dir := range rs.dirs[:3] {
+			require.NoError(t, os.RemoveAll(dir))
+		}
+
+		report, err := rs.Repair(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []string{chunkHash}, report.Unrecoverable)
+		assert.Zero(t, report.Repaired)
+	})
+
+	t.Run("Test repair stops when canceled", func(t *testing.T) {
+		rs := setupStorages(t)[ModeMirror]
+		saveChunk(t, rs, testContent("canceled"))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := rs.Repair(ctx)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestOpenFileSystem(t *testing.T) {
+	t.Run("Test mirror and erasure URLs", func(t *testing.T) {
+		dirs := shardDirs(t, 3)
+		query := "?dir=" + dirs[0] + "&dir=" + dirs[1] + "&dir=" + dirs[2]
+
+		fileSystem, err := storage.OpenFileSystem("mirror://" + query)
+		require.NoError(t, err)
+		require.IsType(t, &RedundantStorage{}, fileSystem)
+		assert.Equal(t, ModeMirror, fileSystem.(*RedundantStorage).Mode())
+		assert.Equal(t, dirs, fileSystem.(*RedundantStorage).Dirs())
+
+		fileSystem, err = storage.OpenFileSystem("erasure://" + query + "&data=2&parity=1")
+		require.NoError(t, err)
+		assert.Equal(t, ModeErasure, fileSystem.(*RedundantStorage).Mode())
+		assert.Equal(t, 2, fileSystem.(*RedundantStorage).MinShards())
+
+		_, err = storage.OpenFileSystem("erasure://" + query + "&data=2")
+		assert.Error(t, err)
+		_, err = storage.OpenFileSystem("erasure://" + query + "&data=two&parity=1")
+		assert.Error(t, err)
+	})
+}
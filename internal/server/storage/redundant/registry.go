@@ -0,0 +1,39 @@
+package redundant
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"zerodupe/internal/server/storage"
+)
+
+func init() {
+	storage.RegisterFileSystem(ModeMirror, func(u *url.URL) (storage.FileSystem, error) {
+		return NewMirrorStorage(u.Query()["dir"])
+	})
+	storage.RegisterFileSystem(ModeErasure, func(u *url.URL) (storage.FileSystem, error) {
+		query := u.Query()
+		dataShards, err := shardCount(query, "data")
+		if err != nil {
+			return nil, err
+		}
+		parityShards, err := shardCount(query, "parity")
+		if err != nil {
+			return nil, err
+		}
+		return NewErasureStorage(query["dir"], dataShards, parityShards)
+	})
+}
+
+// shardCount parses a number of shards from a URL query parameter
+func shardCount(query url.Values, name string) (int, error) {
+	value := query.Get(name)
+	if value == "" {
+		return 0, fmt.Errorf("missing %s shard count", name)
+	}
+	count, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s shard count %q: %w", name, value, err)
+	}
+	return count, nil
+}
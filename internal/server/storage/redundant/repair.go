@@ -0,0 +1,120 @@
+package redundant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// RepairReport summarizes a repair
+type RepairReport struct {
+	StartedAt     time.Time     `json:"started_at"`
+	Scanned       int           `json:"scanned"`                        // chunks with a shard in any directory
+	Healthy       int           `json:"healthy"`                        // chunks with all their shards intact
+	Repaired      int           `json:"repaired"`                       // chunks whose missing or corrupt shards were written again
+	ShardsWritten int           `json:"shards_written"`                 // shards written again
+	Unrecoverable []string      `json:"unrecoverable"`                  // chunks with too few intact shards to rebuild
+	Vanished      int           `json:"vanished"`                       // chunks deleted while the repair ran
+	Failed        int           `json:"failed"`                         // chunks whose shards could not be written
+	Duration      time.Duration `json:"duration" swaggertype:"integer"` // in nanoseconds
+}
+
+// Repair checks the shards of every chunk and writes the missing and corrupt ones again from
+// the intact ones. It stops early with the context's error when ctx is canceled.
+func (rs *RedundantStorage) Repair(ctx context.Context) (*RepairReport, error) {
+	report := &RepairReport{StartedAt: time.Now()}
+
+	chunkHashes, err := rs.ListChunks()
+	if err != nil {
+		return nil, err
+	}
+	report.Scanned = len(chunkHashes)
+
+	for _, chunkHash := range chunkHashes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		written, err := rs.repairChunk(chunkHash)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			report.Vanished++
+		case errors.Is(err, errUnrecoverable):
+			log.Error().Err(err).Str("chunk", chunkHash).Msg("Chunk cannot be repaired")
+			report.Unrecoverable = append(report.Unrecoverable, chunkHash)
+		case err != nil:
+			log.Warn().Err(err).Str("chunk", chunkHash).Msg("Failed to repair chunk")
+			report.Failed++
+		case written == 0:
+			report.Healthy++
+		default:
+			report.Repaired++
+			report.ShardsWritten += written
+		}
+	}
+
+	report.Duration = time.Since(report.StartedAt)
+	return report, nil
+}
+
+// errUnrecoverable is returned when a chunk has too few intact shards to rebuild it
+var errUnrecoverable = errors.New("too few intact shards")
+
+// repairChunk writes the missing and corrupt shards of a chunk again and returns how many it wrote
+func (rs *RedundantStorage) repairChunk(chunkHash string) (int, error) {
+	paths, err := rs.shardPaths(chunkHash)
+	if err != nil {
+		return 0, err
+	}
+
+	unlock := rs.lock(paths[0])
+	defer unlock()
+
+	shards, _, err := rs.readShards(chunkHash, paths, len(paths))
+	if err != nil {
+		return 0, err
+	}
+
+	var damaged []int
+	var modTime time.Time
+	for i, shard := range shards {
+		if shard == nil {
+			damaged = append(damaged, i)
+			continue
+		}
+		if info, err := os.Stat(paths[i]); err == nil && info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	if len(damaged) == 0 {
+		return 0, nil
+	}
+
+	content, err := rs.decode(chunkHash, shards)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errUnrecoverable, err)
+	}
+	encoded, err := rs.codec.encode(content)
+	if err != nil {
+		return 0, err
+	}
+
+	written := 0
+	var writeErrs []error
+	for _, i := range damaged {
+		if err := writeShard(paths[i], encoded[i]); err != nil {
+			writeErrs = append(writeErrs, fmt.Errorf("shard %d: %w", i, err))
+			continue
+		}
+		// a rewritten shard keeps the age of the chunk for garbage collection
+		if err := os.Chtimes(paths[i], modTime, modTime); err != nil {
+			writeErrs = append(writeErrs, fmt.Errorf("shard %d: %w", i, err))
+		}
+		written++
+	}
+	return written, errors.Join(writeErrs...)
+}
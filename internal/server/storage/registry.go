@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// FileSystemOpener creates a chunk store from a backend URL
+type FileSystemOpener func(u *url.URL) (FileSystem, error)
+
+// DBOpener creates a metadata store from a backend URL
+type DBOpener func(u *url.URL) (DB, error)
+
+var (
+	registryMu  sync.RWMutex
+	fileSystems = make(map[string]FileSystemOpener)
+	dbs         = make(map[string]DBOpener)
+)
+
+func init() {
+	RegisterDB("sqlite", func(u *url.URL) (DB, error) {
+		file := URLPath(u)
+		if file == "" {
+			return nil, fmt.Errorf("sqlite URL %q names no database file", u.Redacted())
+		}
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create directory of %s: %w", file, err)
+		}
+		return NewSqliteStorage(file)
+	})
+}
+
+// RegisterFileSystem makes a chunk store backend available under a URL scheme.
+// Backend packages register themselves in init; registering a scheme twice replaces the previous backend.
+func RegisterFileSystem(scheme string, open FileSystemOpener) {
+	if scheme == "" {
+		panic("storage: empty backend scheme")
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	fileSystems[scheme] = open
+}
+
+// RegisterDB makes a metadata store backend available under a URL scheme.
+// Backend packages register themselves in init; registering a scheme twice replaces the previous backend.
+func RegisterDB(scheme string, open DBOpener) {
+	if scheme == "" {
+		panic("storage: empty backend scheme")
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	dbs[scheme] = open
+}
+
+// OpenFileSystem opens the chunk store at a backend URL, e.g. file:///data/blocks, memory:// or s3://bucket/prefix
+func OpenFileSystem(rawURL string) (FileSystem, error) {
+	u, err := parseBackendURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	registryMu.RLock()
+	open, ok := fileSystems[u.Scheme]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown chunk store %q, available: %v", u.Scheme, FileSystemSchemes())
+	}
+	return open(u)
+}
+
+// OpenDB opens the metadata store at a backend URL, e.g. sqlite:///data/meta.db or memory://
+func OpenDB(rawURL string) (DB, error) {
+	u, err := parseBackendURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	registryMu.RLock()
+	open, ok := dbs[u.Scheme]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown metadata store %q, available: %v", u.Scheme, DBSchemes())
+	}
+	return open(u)
+}
+
+// FileSystemSchemes returns the URL schemes of all registered chunk stores
+func FileSystemSchemes() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	schemes := make([]string, 0, len(fileSystems))
+	for scheme := range fileSystems {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// DBSchemes returns the URL schemes of all registered metadata stores
+func DBSchemes() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	schemes := make([]string, 0, len(dbs))
+	for scheme := range dbs {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// URLPath returns the local path a file-like backend URL points to. Absolute paths use three
+// slashes (file:///data/blocks); file://data/blocks and file:data/blocks are relative paths.
+func URLPath(u *url.URL) string {
+	if u.Opaque != "" {
+		return u.Opaque
+	}
+	return u.Host + u.Path
+}
+
+// parseBackendURL parses a backend URL, which must name its scheme
+func parseBackendURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backend URL: %w", err)
+	}
+	if u.Scheme == "" {
+		return nil, fmt.Errorf("backend URL %q has no scheme", rawURL)
+	}
+	return u, nil
+}
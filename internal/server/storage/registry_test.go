@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestURLPath(t *testing.T) {
+	tests := []struct {
+		rawURL string
+		path   string
+	}{
+		{"file:///data/blocks", "/data/blocks"},
+		{"file://data/blocks", "data/blocks"},
+		{"file:data/blocks", "data/blocks"},
+		{"sqlite:///data/meta.db", "/data/meta.db"},
+		{"sqlite:meta.db", "meta.db"},
+	}
+
+	for _, tt := range tests {
+		t.Run("Test URLPath of "+tt.rawURL, func(t *testing.T) {
+			u, err := url.Parse(tt.rawURL)
+			require.NoError(t, err)
+			assert.Equal(t, tt.path, URLPath(u))
+		})
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	t.Run("Test registered backends are opened by scheme", func(t *testing.T) {
+		opened := ""
+		RegisterFileSystem("test-registry", func(u *url.URL) (FileSystem, error) {
+			opened = URLPath(u)
+			return nil, nil
+		})
+
+		_, err := OpenFileSystem("test-registry:///chunks")
+		require.NoError(t, err)
+		assert.Equal(t, "/chunks", opened)
+		assert.Contains(t, FileSystemSchemes(), "test-registry")
+	})
+
+	t.Run("Test unknown schemes are rejected", func(t *testing.T) {
+		_, err := OpenFileSystem("ftp://host/chunks")
+		assert.ErrorContains(t, err, `unknown chunk store "ftp"`)
+
+		_, err = OpenDB("postgres://host/db")
+		assert.ErrorContains(t, err, `unknown metadata store "postgres"`)
+	})
+
+	t.Run("Test URLs without a scheme are rejected", func(t *testing.T) {
+		_, err := OpenFileSystem("data/storage")
+		assert.ErrorContains(t, err, "has no scheme")
+
+		_, err = OpenDB("data/storage/users.db")
+		assert.ErrorContains(t, err, "has no scheme")
+	})
+
+	t.Run("Test empty schemes panic", func(t *testing.T) {
+		assert.Panics(t, func() { RegisterFileSystem("", nil) })
+		assert.Panics(t, func() { RegisterDB("", nil) })
+	})
+
+	t.Run("Test sqlite URLs open a database", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "nested", "meta.db")
+
+		db, err := OpenDB("sqlite://" + file)
+		require.NoError(t, err)
+		require.NotNil(t, db)
+		assert.FileExists(t, file)
+
+		_, err = OpenDB("sqlite://")
+		assert.Error(t, err)
+	})
+}
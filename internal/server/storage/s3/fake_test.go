@@ -0,0 +1,243 @@
+package s3
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	fakeAccessKeyID     = "AKIDFAKE"
+	fakeSecretAccessKey = "fake-secret"
+	fakeRegion          = "us-test-1"
+	fakeBucket          = "chunks"
+)
+
+// fakeObject is an object stored in the fake bucket
+type fakeObject struct {
+	data    []byte
+	modTime time.Time
+}
+
+// fakeS3 is an in-process S3-compatible server with a single bucket. It checks the SigV4
+// signature and payload hash of every request and implements the calls S3Storage makes:
+// PUT, copy, GET, HEAD and DELETE of objects and ListObjectsV2.
+type fakeS3 struct {
+	signer  signer
+	maxKeys int // page size of object listings
+
+	mu      sync.Mutex
+	objects map[string]*fakeObject
+
+	server *httptest.Server
+}
+
+// newFakeS3 starts a fake S3 server that is closed when the test ends
+func newFakeS3(t *testing.T) *fakeS3 {
+	t.Helper()
+
+	fake := &fakeS3{
+		signer:  signer{accessKeyID: fakeAccessKeyID, secretAccessKey: fakeSecretAccessKey, region: fakeRegion},
+		maxKeys: 1000,
+		objects: make(map[string]*fakeObject),
+	}
+	fake.server = httptest.NewServer(fake)
+	t.Cleanup(fake.server.Close)
+	return fake
+}
+
+// config returns the config of an S3 storage on the fake bucket
+func (f *fakeS3) config() Config {
+	return Config{
+		Endpoint:        f.server.URL,
+		Region:          fakeRegion,
+		Bucket:          fakeBucket,
+		AccessKeyID:     fakeAccessKeyID,
+		SecretAccessKey: fakeSecretAccessKey,
+	}
+}
+
+// setModTime sets the modification time of an object
+func (f *fakeS3) setModTime(key string, modTime time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.objects[key].modTime = modTime
+}
+
+// keys returns the keys of all objects
+func (f *fakeS3) keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	keys := make([]string, 0, len(f.objects))
+	for key := range f.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeFakeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	if code, message := f.verify(r, body); code != "" {
+		writeFakeError(w, http.StatusForbidden, code, message)
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != fakeBucket {
+		writeFakeError(w, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		f.list(w, r.URL.Query())
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		f.copy(w, key, r.Header.Get("X-Amz-Copy-Source"))
+	case r.Method == http.MethodPut:
+		f.objects[key] = &fakeObject{data: body, modTime: time.Now().UTC().Truncate(time.Second)}
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		object, ok := f.objects[key]
+		if !ok {
+			writeFakeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(object.data)))
+		w.Header().Set("Last-Modified", object.modTime.Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(object.data)
+		}
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeFakeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	}
+}
+
+// verify recomputes the signature of a request and checks the payload hash
+func (f *fakeS3) verify(r *http.Request, body []byte) (string, string) {
+	if r.Header.Get("X-Amz-Content-Sha256") != hashHex(body) {
+		return "XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed."
+	}
+	amzDate, err := time.Parse(amzDateFormat, r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return "AccessDenied", "missing or invalid X-Amz-Date"
+	}
+
+	signed := &http.Request{
+		Method: r.Method,
+		URL:    &url.URL{Path: r.URL.Path, RawQuery: r.URL.RawQuery},
+		Host:   r.Host,
+		Header: make(http.Header),
+	}
+	for name, values := range r.Header {
+		lower := strings.ToLower(name)
+		if (strings.HasPrefix(lower, "x-amz-") || lower == "range") && lower != "x-amz-date" && lower != "x-amz-content-sha256" {
+			signed.Header[name] = values
+		}
+	}
+	f.signer.sign(signed, hashHex(body), amzDate)
+
+	if signed.Header.Get("Authorization") != r.Header.Get("Authorization") {
+		return "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided."
+	}
+	return "", ""
+}
+
+// list implements ListObjectsV2. The caller must hold mu.
+func (f *fakeS3) list(w http.ResponseWriter, query url.Values) {
+	if query.Get("list-type") != "2" {
+		writeFakeError(w, http.StatusNotImplemented, "NotImplemented", "only ListObjectsV2 is supported")
+		return
+	}
+	prefix := query.Get("prefix")
+	after := query.Get("continuation-token")
+
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	type content struct {
+		Key          string `xml:"Key"`
+		LastModified string `xml:"LastModified"`
+		Size         int    `xml:"Size"`
+	}
+	result := struct {
+		XMLName               xml.Name  `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+		Name                  string    `xml:"Name"`
+		Prefix                string    `xml:"Prefix"`
+		KeyCount              int       `xml:"KeyCount"`
+		IsTruncated           bool      `xml:"IsTruncated"`
+		NextContinuationToken string    `xml:"NextContinuationToken,omitempty"`
+		Contents              []content `xml:"Contents"`
+	}{Name: fakeBucket, Prefix: prefix}
+
+	if len(keys) > f.maxKeys {
+		keys = keys[:f.maxKeys]
+		result.IsTruncated = true
+		result.NextContinuationToken = keys[len(keys)-1]
+	}
+	for _, key := range keys {
+		object := f.objects[key]
+		result.Contents = append(result.Contents, content{
+			Key:          key,
+			LastModified: object.modTime.Format(time.RFC3339),
+			Size:         len(object.data),
+		})
+	}
+	result.KeyCount = len(result.Contents)
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(result)
+}
+
+// copy implements CopyObject, which renews the modification time. The caller must hold mu.
+func (f *fakeS3) copy(w http.ResponseWriter, key, source string) {
+	source, err := url.PathUnescape(source)
+	if err != nil {
+		writeFakeError(w, http.StatusBadRequest, "InvalidArgument", "invalid copy source")
+		return
+	}
+	object, ok := f.objects[strings.TrimPrefix(source, "/"+fakeBucket+"/")]
+	if !ok {
+		writeFakeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	f.objects[key] = &fakeObject{data: object.data, modTime: now}
+	w.Header().Set("Content-Type", "application/xml")
+	fmt.Fprintf(w, "%s<CopyObjectResult><LastModified>%s</LastModified></CopyObjectResult>", xml.Header, now.Format(time.RFC3339))
+}
+
+// writeFakeError writes an S3 error document
+func writeFakeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "%s<Error><Code>%s</Code><Message>%s</Message></Error>", xml.Header, code, message)
+}
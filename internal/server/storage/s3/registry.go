@@ -0,0 +1,50 @@
+package s3
+
+import (
+	"net/url"
+	"os"
+	"strings"
+	"zerodupe/internal/server/storage"
+)
+
+// defaultRegion is the region of s3:// URLs that name none
+const defaultRegion = "us-east-1"
+
+func init() {
+	storage.RegisterFileSystem("s3", func(u *url.URL) (storage.FileSystem, error) {
+		return NewS3Storage(ConfigFromURL(u))
+	})
+}
+
+// ConfigFromURL returns the configuration of an s3://bucket/prefix?endpoint=...&region=... URL.
+// Credentials are taken from the user info of the URL, or else from the AWS_ACCESS_KEY_ID and
+// AWS_SECRET_ACCESS_KEY environment variables. The session token is taken from the session_token
+// parameter, or else from AWS_SESSION_TOKEN.
+func ConfigFromURL(u *url.URL) Config {
+	query := u.Query()
+	config := Config{
+		Endpoint:     query.Get("endpoint"),
+		Region:       query.Get("region"),
+		Bucket:       u.Host,
+		Prefix:       strings.TrimPrefix(u.Path, "/"),
+		SessionToken: query.Get("session_token"),
+	}
+	if config.SessionToken == "" {
+		config.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if config.Region == "" {
+		config.Region = defaultRegion
+	}
+	if config.Prefix != "" && !strings.HasSuffix(config.Prefix, "/") {
+		config.Prefix += "/"
+	}
+
+	if u.User != nil {
+		config.AccessKeyID = u.User.Username()
+		config.SecretAccessKey, _ = u.User.Password()
+	} else {
+		config.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		config.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	return config
+}
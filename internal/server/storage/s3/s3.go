@@ -0,0 +1,357 @@
+// Package s3 stores chunks in an S3-compatible object storage bucket.
+package s3
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"zerodupe/internal/server/storage"
+	"zerodupe/pkg/hasher"
+
+	"github.com/rs/zerolog/log"
+)
+
+// blocksPrefix is the key prefix of the chunks, below the configured prefix
+const blocksPrefix = "blocks/"
+
+// Config configures an S3 storage
+type Config struct {
+	Endpoint        string // base URL of the S3 API, e.g. https://s3.eu-west-1.amazonaws.com
+	Region          string
+	Bucket          string
+	Prefix          string // prefix of all keys, e.g. "zerodupe/"
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// S3Storage implements the FileSystem interface on an S3-compatible bucket. Objects are
+// addressed path-style, endpoint/bucket/key, which all S3-compatible services support.
+// Chunks use the key layout of the filesystem block store under <prefix>blocks/.
+type S3Storage struct {
+	endpoint   *url.URL
+	bucket     string
+	prefix     string
+	signer     signer
+	httpClient *http.Client
+	now        func() time.Time
+}
+
+// NewS3Storage creates a new S3 storage
+func NewS3Storage(config Config) (*S3Storage, error) {
+	if config.Endpoint == "" {
+		return nil, fmt.Errorf("s3 endpoint is required")
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(config.Endpoint, "/"))
+	if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", config.Endpoint)
+	}
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("s3 bucket is required")
+	}
+	if config.Region == "" {
+		return nil, fmt.Errorf("s3 region is required")
+	}
+	if config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return nil, fmt.Errorf("s3 credentials are required")
+	}
+
+	return &S3Storage{
+		endpoint: endpoint,
+		bucket:   config.Bucket,
+		prefix:   config.Prefix,
+		signer: signer{
+			accessKeyID:     config.AccessKeyID,
+			secretAccessKey: config.SecretAccessKey,
+			sessionToken:    config.SessionToken,
+			region:          config.Region,
+		},
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+		now:        time.Now,
+	}, nil
+}
+
+// SetHTTPClient sets the HTTP client used for requests to the bucket
+func (s *S3Storage) SetHTTPClient(client *http.Client) {
+	s.httpClient = client
+}
+
+// CheckChunkExists checks if chunks exist
+func (s *S3Storage) CheckChunkExists(hashes []string) ([]string, []string, error) {
+	var existingChunks []string
+	var missingChunks []string
+
+	for _, hash := range hashes {
+		_, err := s.StatChunk(hash)
+		if errors.Is(err, os.ErrNotExist) {
+			missingChunks = append(missingChunks, hash)
+		} else if err != nil {
+			return nil, nil, err
+		} else {
+			existingChunks = append(existingChunks, hash)
+		}
+	}
+
+	return existingChunks, missingChunks, nil
+}
+
+// SaveChunkData saves chunk data. Content that does not match chunkHash is rejected with storage.ErrHashMismatch.
+func (s *S3Storage) SaveChunkData(chunkHash string, content []byte) (string, error) {
+	key, err := s.objectKey(chunkHash)
+	if err != nil {
+		return "", err
+	}
+
+	isValid, calculatedHash := hasher.VerifyChunkHash(content, chunkHash)
+	if !isValid {
+		log.Warn().Msgf("Hash mismatch. Expected: %s, Got: %s", chunkHash, calculatedHash)
+		return calculatedHash, fmt.Errorf("%w: expected %s, got %s", storage.ErrHashMismatch, chunkHash, calculatedHash)
+	}
+
+	// reusing a chunk renews it for garbage collection
+	if _, err := s.StatChunk(chunkHash); err == nil {
+		if err := s.TouchChunk(chunkHash); err != nil {
+			return "", err
+		}
+		return chunkHash, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to check if chunk exists: %w", err)
+	}
+
+	// a PUT replaces the object atomically, concurrent uploads of a chunk store the same content
+	resp, err := s.do(http.MethodPut, key, nil, content, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to write chunk data: %w", err)
+	}
+	resp.Body.Close()
+
+	return calculatedHash, nil
+}
+
+// GetChunkData gets chunk data
+func (s *S3Storage) GetChunkData(chunkHash string) ([]byte, error) {
+	key, err := s.objectKey(chunkHash)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(http.MethodGet, key, nil, nil, nil)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("chunk not found: %w", err)
+	} else if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunk data: %w", err)
+	}
+	log.Debug().Msgf("Read chunk %s, size: %d bytes", chunkHash, len(content))
+	return content, nil
+}
+
+// ListChunks returns the hashes of all stored chunks
+func (s *S3Storage) ListChunks() ([]string, error) {
+	var hashes []string
+	continuationToken := ""
+	for {
+		query := url.Values{
+			"list-type": {"2"},
+			"prefix":    {s.prefix + blocksPrefix},
+		}
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+
+		resp, err := s.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list chunks: %w", err)
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode chunk list: %w", err)
+		}
+
+		for _, object := range result.Contents {
+			if hash, ok := s.chunkHash(object.Key); ok {
+				hashes = append(hashes, hash)
+			}
+		}
+
+		if !result.IsTruncated {
+			return hashes, nil
+		}
+		continuationToken = result.NextContinuationToken
+	}
+}
+
+// StatChunk returns the size and modification time of a stored chunk
+func (s *S3Storage) StatChunk(chunkHash string) (storage.ChunkInfo, error) {
+	key, err := s.objectKey(chunkHash)
+	if err != nil {
+		return storage.ChunkInfo{}, err
+	}
+
+	resp, err := s.do(http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return storage.ChunkInfo{}, err
+	}
+	resp.Body.Close()
+
+	if resp.ContentLength < 0 {
+		return storage.ChunkInfo{}, fmt.Errorf("missing content length of chunk %s", chunkHash)
+	}
+	modTime, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+	if err != nil {
+		return storage.ChunkInfo{}, fmt.Errorf("invalid modification time of chunk %s: %w", chunkHash, err)
+	}
+	return storage.ChunkInfo{Size: resp.ContentLength, ModTime: modTime}, nil
+}
+
+// TouchChunk copies a stored chunk onto itself, which sets its modification time to now
+func (s *S3Storage) TouchChunk(chunkHash string) error {
+	key, err := s.objectKey(chunkHash)
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{
+		"X-Amz-Copy-Source":        uriEncode("/"+s.bucket+"/"+key, false),
+		"X-Amz-Metadata-Directive": "REPLACE",
+	}
+	resp, err := s.do(http.MethodPut, key, nil, nil, headers)
+	if err != nil {
+		return fmt.Errorf("failed to touch chunk: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// a copy can fail after the 200 status has been sent, the error is then in the body
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to touch chunk: %w", err)
+	}
+	var s3Error errorResponse
+	if xml.Unmarshal(data, &s3Error) == nil && s3Error.Code != "" {
+		return fmt.Errorf("failed to touch chunk: %s: %s", s3Error.Code, s3Error.Message)
+	}
+	return nil
+}
+
+// DeleteChunk deletes a stored chunk
+func (s *S3Storage) DeleteChunk(chunkHash string) error {
+	key, err := s.objectKey(chunkHash)
+	if err != nil {
+		return err
+	}
+
+	// S3 deletes succeed for missing keys, report them like the other backends
+	if _, err := s.StatChunk(chunkHash); err != nil {
+		return err
+	}
+
+	resp, err := s.do(http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete chunk: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// objectKey returns the key of the object stored under hash, using the layout of the
+// filesystem block store: blocks/<digest[:4]>/<digest> for SHA-256 and
+// blocks/<algorithm>/<digest[:4]>/<digest> for other algorithms
+func (s *S3Storage) objectKey(hash string) (string, error) {
+	algorithm, digest, err := hasher.ParseHash(hash)
+	if err != nil {
+		return "", err
+	}
+	if algorithm == hasher.SHA256 {
+		return s.prefix + blocksPrefix + digest[:4] + "/" + digest, nil
+	}
+	return s.prefix + blocksPrefix + algorithm + "/" + digest[:4] + "/" + digest, nil
+}
+
+// chunkHash returns the hash of the chunk stored under an object key
+func (s *S3Storage) chunkHash(key string) (string, bool) {
+	path, ok := strings.CutPrefix(key, s.prefix+blocksPrefix)
+	if !ok {
+		return "", false
+	}
+
+	parts := strings.Split(path, "/")
+	switch len(parts) {
+	case 2:
+		return parts[1], true
+	case 3:
+		if _, err := hasher.LookupAlgorithm(parts[0]); err != nil {
+			return "", false
+		}
+		return hasher.FormatHash(parts[0], parts[2]), true
+	default:
+		return "", false
+	}
+}
+
+// listBucketResult is the response of ListObjectsV2
+type listBucketResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+}
+
+// errorResponse is the error document of the S3 API
+type errorResponse struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// do sends a signed request for an object of the bucket, or for the bucket itself when key
+// is empty. Responses with a 404 status return an error wrapping os.ErrNotExist, other
+// unsuccessful responses an error with the S3 error code.
+func (s *S3Storage) do(method, key string, query url.Values, body []byte, headers map[string]string) (*http.Response, error) {
+	u := *s.endpoint
+	u.Path = s.endpoint.Path + "/" + s.bucket + "/" + key
+	u.RawPath = uriEncode(u.Path, false)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.ContentLength = int64(len(body))
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	s.signer.sign(req, hashHex(body), s.now())
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to s3: %w", err)
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("s3 object %s: %w", key, os.ErrNotExist)
+	}
+
+	var s3Error errorResponse
+	if data, err := io.ReadAll(resp.Body); err == nil && xml.Unmarshal(data, &s3Error) == nil && s3Error.Code != "" {
+		return nil, fmt.Errorf("s3 %s %s: %s: %s", method, key, s3Error.Code, s3Error.Message)
+	}
+	return nil, fmt.Errorf("s3 %s %s: %s", method, key, resp.Status)
+}
@@ -0,0 +1,259 @@
+package s3
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+	"zerodupe/internal/server/storage"
+	"zerodupe/internal/server/storage/storagetest"
+	"zerodupe/pkg/hasher"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupS3Storage creates an S3 storage on a fake bucket
+func setupS3Storage(t *testing.T) (*S3Storage, *fakeS3) {
+	t.Helper()
+
+	fake := newFakeS3(t)
+	s3Storage, err := NewS3Storage(fake.config())
+	require.NoError(t, err)
+	return s3Storage, fake
+}
+
+func TestNewS3Storage(t *testing.T) {
+	t.Run("Test NewS3Storage validates the config", func(t *testing.T) {
+		valid := Config{
+			Endpoint:        "http://localhost:9000",
+			Region:          "us-east-1",
+			Bucket:          "chunks",
+			AccessKeyID:     "id",
+			SecretAccessKey: "secret",
+		}
+		_, err := NewS3Storage(valid)
+		require.NoError(t, err)
+
+		for name, mutate := range map[string]func(*Config){
+			"endpoint":    func(c *Config) { c.Endpoint = "" },
+			"bad url":     func(c *Config) { c.Endpoint = "localhost:9000" },
+			"region":      func(c *Config) { c.Region = "" },
+			"bucket":      func(c *Config) { c.Bucket = "" },
+			"credentials": func(c *Config) { c.SecretAccessKey = "" },
+		} {
+			config := valid
+			mutate(&config)
+			_, err := NewS3Storage(config)
+			assert.Error(t, err, name)
+		}
+	})
+}
+
+func TestSaveChunkData(t *testing.T) {
+	t.Run("Test SaveChunkData stores chunks under the block layout", func(t *testing.T) {
+		s3Storage, fake := setupS3Storage(t)
+
+		content := []byte("test")
+		sha256Hash := hasher.CalculateChunkHash(content)
+		blake3Hash, err := hasher.Sum(hasher.BLAKE3, content)
+		require.NoError(t, err)
+		_, blake3Digest, err := hasher.ParseHash(blake3Hash)
+		require.NoError(t, err)
+
+		calculatedHash, err := s3Storage.SaveChunkData(sha256Hash, content)
+		require.NoError(t, err)
+		assert.Equal(t, sha256Hash, calculatedHash)
+		_, err = s3Storage.SaveChunkData(blake3Hash, content)
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{
+			"blocks/" + sha256Hash[:4] + "/" + sha256Hash,
+			"blocks/blake3/" + blake3Digest[:4] + "/" + blake3Digest,
+		}, fake.keys())
+
+		for _, chunkHash := range []string{sha256Hash, "sha256:" + sha256Hash, blake3Hash} {
+			got, err := s3Storage.GetChunkData(chunkHash)
+			require.NoError(t, err)
+			assert.Equal(t, content, got)
+		}
+	})
+
+	t.Run("Test SaveChunkData rejects content that does not match its hash", func(t *testing.T) {
+		s3Storage, fake := setupS3Storage(t)
+
+		_, err := s3Storage.SaveChunkData(hasher.CalculateChunkHash([]byte("expected")), []byte("forged"))
+		assert.ErrorIs(t, err, storage.ErrHashMismatch)
+		assert.Empty(t, fake.keys())
+	})
+
+	t.Run("Test SaveChunkData renews an existing chunk", func(t *testing.T) {
+		s3Storage, fake := setupS3Storage(t)
+
+		content := []byte("test")
+		chunkHash := hasher.CalculateChunkHash(content)
+		_, err := s3Storage.SaveChunkData(chunkHash, content)
+		require.NoError(t, err)
+
+		old := time.Now().Add(-48 * time.Hour).UTC().Truncate(time.Second)
+		fake.setModTime("blocks/"+chunkHash[:4]+"/"+chunkHash, old)
+		info, err := s3Storage.StatChunk(chunkHash)
+		require.NoError(t, err)
+		assert.True(t, info.ModTime.Equal(old))
+		assert.Equal(t, int64(len(content)), info.Size)
+
+		_, err = s3Storage.SaveChunkData(chunkHash, content)
+		require.NoError(t, err)
+
+		info, err = s3Storage.StatChunk(chunkHash)
+		require.NoError(t, err)
+		assert.True(t, info.ModTime.After(time.Now().Add(-time.Hour)))
+	})
+}
+
+func TestCheckChunkExists(t *testing.T) {
+	t.Run("Test CheckChunkExists splits existing and missing chunks", func(t *testing.T) {
+		s3Storage, _ := setupS3Storage(t)
+
+		content := []byte("test")
+		chunkHash := hasher.CalculateChunkHash(content)
+		_, err := s3Storage.SaveChunkData(chunkHash, content)
+		require.NoError(t, err)
+
+		missingHash := hasher.CalculateChunkHash([]byte("missing"))
+		existing, missing, err := s3Storage.CheckChunkExists([]string{chunkHash, missingHash})
+		require.NoError(t, err)
+		assert.Equal(t, []string{chunkHash}, existing)
+		assert.Equal(t, []string{missingHash}, missing)
+	})
+}
+
+func TestGetChunkData(t *testing.T) {
+	t.Run("Test GetChunkData for non-existing chunk", func(t *testing.T) {
+		s3Storage, _ := setupS3Storage(t)
+
+		_, err := s3Storage.GetChunkData(hasher.CalculateChunkHash([]byte("missing")))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
+
+func TestListChunks(t *testing.T) {
+	t.Run("Test ListChunks pages through the bucket and ignores other keys", func(t *testing.T) {
+		fake := newFakeS3(t)
+		fake.maxKeys = 2
+		config := fake.config()
+		config.Prefix = "zerodupe/"
+		s3Storage, err := NewS3Storage(config)
+		require.NoError(t, err)
+
+		var hashes []string
+		for i := 0; i < 5; i++ {
+			content := []byte(fmt.Sprintf("chunk %d", i))
+			chunkHash := hasher.CalculateChunkHash(content)
+			_, err := s3Storage.SaveChunkData(chunkHash, content)
+			require.NoError(t, err)
+			hashes = append(hashes, chunkHash)
+		}
+		blake3Hash, err := hasher.Sum(hasher.BLAKE3, []byte("blake3"))
+		require.NoError(t, err)
+		_, err = s3Storage.SaveChunkData(blake3Hash, []byte("blake3"))
+		require.NoError(t, err)
+		hashes = append(hashes, blake3Hash)
+
+		// objects outside the prefix belong to someone else
+		other, err := NewS3Storage(fake.config())
+		require.NoError(t, err)
+		_, err = other.SaveChunkData(hasher.CalculateChunkHash([]byte("other")), []byte("other"))
+		require.NoError(t, err)
+
+		listed, err := s3Storage.ListChunks()
+		require.NoError(t, err)
+		assert.ElementsMatch(t, hashes, listed)
+	})
+}
+
+func TestDeleteChunk(t *testing.T) {
+	t.Run("Test DeleteChunk removes the chunk", func(t *testing.T) {
+		s3Storage, fake := setupS3Storage(t)
+
+		content := []byte("test")
+		chunkHash := hasher.CalculateChunkHash(content)
+		_, err := s3Storage.SaveChunkData(chunkHash, content)
+		require.NoError(t, err)
+
+		require.NoError(t, s3Storage.DeleteChunk(chunkHash))
+		assert.Empty(t, fake.keys())
+
+		err = s3Storage.DeleteChunk(chunkHash)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
+
+func TestSigning(t *testing.T) {
+	t.Run("Test requests with wrong credentials are rejected", func(t *testing.T) {
+		fake := newFakeS3(t)
+		config := fake.config()
+		config.SecretAccessKey = "wrong"
+		s3Storage, err := NewS3Storage(config)
+		require.NoError(t, err)
+
+		content := []byte("test")
+		_, err = s3Storage.SaveChunkData(hasher.CalculateChunkHash(content), content)
+		assert.ErrorContains(t, err, "403 Forbidden")
+
+		// HEAD responses have no body, the error code comes with GET
+		_, err = s3Storage.GetChunkData(hasher.CalculateChunkHash(content))
+		assert.ErrorContains(t, err, "SignatureDoesNotMatch")
+		assert.NotErrorIs(t, err, os.ErrNotExist)
+	})
+}
+
+func TestS3StorageConformance(t *testing.T) {
+	storagetest.TestFileSystem(t, func(t *testing.T) storage.FileSystem {
+		s3Storage, _ := setupS3Storage(t)
+		return s3Storage
+	})
+}
+
+func TestConfigFromURL(t *testing.T) {
+	t.Run("Test ConfigFromURL with credentials in the URL", func(t *testing.T) {
+		t.Setenv("AWS_SESSION_TOKEN", "")
+		u, err := url.Parse("s3://key:secret@chunks/zerodupe?endpoint=http://localhost:9000&region=eu-west-1")
+		require.NoError(t, err)
+
+		assert.Equal(t, Config{
+			Endpoint:        "http://localhost:9000",
+			Region:          "eu-west-1",
+			Bucket:          "chunks",
+			Prefix:          "zerodupe/",
+			AccessKeyID:     "key",
+			SecretAccessKey: "secret",
+		}, ConfigFromURL(u))
+	})
+
+	t.Run("Test ConfigFromURL defaults", func(t *testing.T) {
+		t.Setenv("AWS_ACCESS_KEY_ID", "env-key")
+		t.Setenv("AWS_SECRET_ACCESS_KEY", "env-secret")
+		t.Setenv("AWS_SESSION_TOKEN", "env-token")
+		u, err := url.Parse("s3://chunks?endpoint=http://localhost:9000")
+		require.NoError(t, err)
+
+		assert.Equal(t, Config{
+			Endpoint:        "http://localhost:9000",
+			Region:          defaultRegion,
+			Bucket:          "chunks",
+			AccessKeyID:     "env-key",
+			SecretAccessKey: "env-secret",
+			SessionToken:    "env-token",
+		}, ConfigFromURL(u))
+	})
+
+	t.Run("Test ConfigFromURL with a session token in the URL", func(t *testing.T) {
+		t.Setenv("AWS_SESSION_TOKEN", "env-token")
+		u, err := url.Parse("s3://key:secret@chunks?session_token=url-token")
+		require.NoError(t, err)
+
+		assert.Equal(t, "url-token", ConfigFromURL(u).SessionToken)
+	})
+}
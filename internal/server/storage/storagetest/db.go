@@ -0,0 +1,1242 @@
+package storagetest
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+	"zerodupe/internal/server/model"
+	"zerodupe/internal/server/storage"
+	"zerodupe/pkg/hasher"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDB runs the conformance suite for storage.DB. newDB must return an empty database for every call.
+func TestDB(t *testing.T, newDB func(t *testing.T) storage.DB) {
+	t.Run("Test CreateUser and GetUserByUsername", func(t *testing.T) {
+		db := newDB(t)
+
+		alice := &model.User{Username: "alice", Password: []byte("hashed")}
+		require.NoError(t, db.CreateUser(alice))
+		bob := &model.User{Username: "bob", Password: []byte("hashed")}
+		require.NoError(t, db.CreateUser(bob))
+		assert.NotZero(t, alice.ID)
+		assert.NotEqual(t, alice.ID, bob.ID)
+
+		user, err := db.GetUserByUsername("alice")
+		require.NoError(t, err)
+		assert.Equal(t, alice.ID, user.ID)
+		assert.Equal(t, "alice", user.Username)
+		assert.Equal(t, []byte("hashed"), user.Password)
+	})
+
+	t.Run("Test CreateUser rejects a taken username", func(t *testing.T) {
+		db := newDB(t)
+
+		require.NoError(t, db.CreateUser(&model.User{Username: "alice", Password: []byte("hashed")}))
+		assert.Error(t, db.CreateUser(&model.User{Username: "alice", Password: []byte("other")}))
+	})
+
+	t.Run("Test GetUserByUsername for a missing user", func(t *testing.T) {
+		db := newDB(t)
+
+		_, err := db.GetUserByUsername("alice")
+		assert.ErrorIs(t, err, storage.ErrUserNotFound)
+	})
+
+	t.Run("Test SaveChunkMetadata creates the file", func(t *testing.T) {
+		db := newDB(t)
+
+		fileHash := hasher.CalculateChunkHash([]byte("file"))
+		chunker := hasher.DefaultChunkerConfig().String()
+		chunkHashes := testChunkHashes(3)
+		for i, chunkHash := range chunkHashes {
+			require.NoError(t, db.SaveChunkMetadata(fileHash, chunkHash, i+1, 0, chunker))
+		}
+
+		exists, err := db.CheckFileExists(fileHash)
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		metadata, err := db.GetFileMetadata(fileHash)
+		require.NoError(t, err)
+		require.NotNil(t, metadata)
+		assert.NotZero(t, metadata.ID)
+		assert.Equal(t, fileHash, metadata.FileHash)
+		assert.Equal(t, chunker, metadata.Chunker)
+		assert.Equal(t, chunkHashes, orderedChunkHashes(metadata))
+		for _, chunk := range metadata.Chunks {
+			assert.Equal(t, metadata.ID, chunk.FileMetadataID)
+		}
+	})
+
+	t.Run("Test SaveChunkMetadata is idempotent", func(t *testing.T) {
+		db := newDB(t)
+
+		fileHash := hasher.CalculateChunkHash([]byte("file"))
+		chunkHash := testChunkHashes(1)[0]
+		require.NoError(t, db.SaveChunkMetadata(fileHash, chunkHash, 1, 0, ""))
+		// uploads retried under the prefixed spelling of the hashes add nothing
+		require.NoError(t, db.SaveChunkMetadata(fileHash, chunkHash, 1, 0, ""))
+		require.NoError(t, db.SaveChunkMetadata(hasher.CanonicalHash(fileHash), hasher.CanonicalHash(chunkHash), 1, 0, ""))
+
+		metadata, err := db.GetFileMetadata(fileHash)
+		require.NoError(t, err)
+		require.NotNil(t, metadata)
+		assert.Len(t, metadata.Chunks, 1)
+
+		referenced, err := db.ListReferencedChunks()
+		require.NoError(t, err)
+		assert.Equal(t, []string{hasher.CanonicalHash(chunkHash)}, referenced)
+	})
+
+	t.Run("Test AddFileAlias", func(t *testing.T) {
+		db := newDB(t)
+
+		chunkHash := testChunkHashes(1)[0]
+		fileHash := hasher.FileHashFromChunkHashes([]string{chunkHash})
+		require.NoError(t, db.SaveChunkMetadata(fileHash, chunkHash, 1, 10, ""))
+		require.NoError(t, db.AddFileOwner(fileHash, 1))
+		alias := hasher.CalculateChunkHash([]byte("old hash"))
+		require.NoError(t, db.AddFileAlias(fileHash, alias))
+		assert.ErrorIs(t, db.AddFileAlias(hasher.CalculateChunkHash([]byte("missing")), alias), storage.ErrFileNotFound)
+
+		// every lookup by hash accepts any spelling of the alias
+		prefixedAlias := hasher.FormatHash(hasher.SHA256, alias)
+		metadata, err := db.GetFileMetadata(prefixedAlias)
+		require.NoError(t, err)
+		require.NotNil(t, metadata)
+		assert.Equal(t, fileHash, metadata.FileHash)
+		exists, err := db.CheckFileExists(alias)
+		require.NoError(t, err)
+		assert.True(t, exists)
+		owned, err := db.CheckFileOwner(alias, 1)
+		require.NoError(t, err)
+		assert.True(t, owned)
+
+		// the alias goes with the file
+		deleted, err := db.RemoveFileOwner(alias, 1)
+		require.NoError(t, err)
+		assert.True(t, deleted)
+		exists, err = db.CheckFileExists(alias)
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("Test HasFiles and ListUnsizedChunks", func(t *testing.T) {
+		db := newDB(t)
+
+		hasFiles, err := db.HasFiles()
+		require.NoError(t, err)
+		assert.False(t, hasFiles)
+
+		fileHash := hasher.CalculateChunkHash([]byte("file"))
+		chunkHashes := testChunkHashes(2)
+		require.NoError(t, db.SaveChunkMetadata(fileHash, chunkHashes[0], 1, 0, ""))
+		require.NoError(t, db.SaveChunkMetadata(fileHash, chunkHashes[1], 2, 10, ""))
+		require.NoError(t, db.SaveChunkMetadata(hasher.CalculateChunkHash([]byte("other")), hasher.FormatHash(hasher.SHA256, chunkHashes[0]), 1, 0, ""))
+
+		hasFiles, err = db.HasFiles()
+		require.NoError(t, err)
+		assert.True(t, hasFiles)
+		unsized, err := db.ListUnsizedChunks()
+		require.NoError(t, err)
+		assert.Equal(t, []string{hasher.CanonicalHash(chunkHashes[0])}, unsized)
+
+		require.NoError(t, db.SetChunkSize(chunkHashes[0], 10))
+		unsized, err = db.ListUnsizedChunks()
+		require.NoError(t, err)
+		assert.Empty(t, unsized)
+	})
+
+	t.Run("Test SaveChunkMetadata shares chunks between files and positions", func(t *testing.T) {
+		db := newDB(t)
+
+		chunkHashes := testChunkHashes(2)
+		first := hasher.CalculateChunkHash([]byte("first"))
+		second := hasher.CalculateChunkHash([]byte("second"))
+		for i, chunkHash := range []string{chunkHashes[0], chunkHashes[1], chunkHashes[0]} {
+			require.NoError(t, db.SaveChunkMetadata(first, chunkHash, i+1, 10, ""))
+		}
+		require.NoError(t, db.SaveChunkMetadata(second, chunkHashes[0], 1, 10, ""))
+
+		metadata, err := db.GetFileMetadata(first)
+		require.NoError(t, err)
+		require.NotNil(t, metadata)
+		assert.Equal(t, []string{chunkHashes[0], chunkHashes[1], chunkHashes[0]}, orderedChunkHashes(metadata))
+		ref, err := db.GetChunkRef(chunkHashes[0])
+		require.NoError(t, err)
+		require.NotNil(t, ref)
+		assert.Equal(t, 3, ref.RefCount)
+
+		// a position holds one chunk
+		assert.ErrorIs(t, db.SaveChunkMetadata(first, chunkHashes[1], 1, 10, ""), storage.ErrChunkConflict)
+		metadata, err = db.GetFileMetadata(first)
+		require.NoError(t, err)
+		require.NotNil(t, metadata)
+		assert.Len(t, metadata.Chunks, 3)
+
+		// the chunk outlives the file that repeats it
+		require.NoError(t, db.DeleteFileMetadata(first))
+		ref, err = db.GetChunkRef(chunkHashes[0])
+		require.NoError(t, err)
+		require.NotNil(t, ref)
+		assert.Equal(t, 1, ref.RefCount)
+		referenced, err := db.ListReferencedChunks()
+		require.NoError(t, err)
+		assert.Equal(t, []string{hasher.CanonicalHash(chunkHashes[0])}, referenced)
+	})
+
+	t.Run("Test file hashes match any spelling", func(t *testing.T) {
+		db := newDB(t)
+
+		fileHash := hasher.CalculateChunkHash([]byte("file"))
+		require.NoError(t, db.SaveChunkMetadata(fileHash, testChunkHashes(1)[0], 1, 0, ""))
+
+		prefixedHash := hasher.FormatHash(hasher.SHA256, fileHash)
+		exists, err := db.CheckFileExists(prefixedHash)
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		metadata, err := db.GetFileMetadata(prefixedHash)
+		require.NoError(t, err)
+		require.NotNil(t, metadata)
+		assert.Equal(t, fileHash, metadata.FileHash)
+	})
+
+	t.Run("Test GetFileMetadata and CheckFileExists for a missing file", func(t *testing.T) {
+		db := newDB(t)
+
+		metadata, err := db.GetFileMetadata(hasher.CalculateChunkHash([]byte("missing")))
+		require.NoError(t, err)
+		assert.Nil(t, metadata)
+
+		exists, err := db.CheckFileExists(hasher.CalculateChunkHash([]byte("missing")))
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("Test SaveFileMetadata", func(t *testing.T) {
+		db := newDB(t)
+
+		chunkHashes := testChunkHashes(2)
+		metadata := &model.FileMetadata{
+			FileHash: hasher.FileHashFromChunkHashes(chunkHashes),
+			Chunks: []model.ChunkMetadata{
+				{ChunkOrder: 1, ChunkHash: chunkHashes[0], Size: 10},
+				{ChunkOrder: 2, ChunkHash: chunkHashes[1], Size: 5},
+			},
+		}
+		require.NoError(t, db.SaveFileMetadata(metadata))
+		assert.NotZero(t, metadata.ID)
+		for _, chunk := range metadata.Chunks {
+			assert.NotZero(t, chunk.ID)
+			assert.Equal(t, metadata.ID, chunk.FileMetadataID)
+		}
+
+		saved, err := db.GetFileMetadata(metadata.FileHash)
+		require.NoError(t, err)
+		require.NotNil(t, saved)
+		assert.Equal(t, metadata.ID, saved.ID)
+		assert.Equal(t, chunkHashes, orderedChunkHashes(saved))
+		assert.Equal(t, int64(15), saved.Size)
+		assert.True(t, saved.Complete)
+		assert.False(t, saved.CreatedAt.IsZero())
+
+		for _, chunkHash := range chunkHashes {
+			referenced, err := db.CheckChunkReferenced(chunkHash)
+			require.NoError(t, err)
+			assert.True(t, referenced)
+		}
+
+		duplicate := &model.FileMetadata{FileHash: metadata.FileHash}
+		assert.Error(t, db.SaveFileMetadata(duplicate))
+	})
+
+	t.Run("Test DeleteFileMetadata releases chunk references", func(t *testing.T) {
+		db := newDB(t)
+
+		chunkHashes := testChunkHashes(4)
+		kept := hasher.CalculateChunkHash([]byte("kept"))
+		deleted := hasher.CalculateChunkHash([]byte("deleted"))
+		for i, chunkHash := range chunkHashes[:2] {
+			require.NoError(t, db.SaveChunkMetadata(kept, chunkHash, i+1, 0, ""))
+		}
+		for i, chunkHash := range chunkHashes[2:] {
+			require.NoError(t, db.SaveChunkMetadata(deleted, chunkHash, i+1, 0, ""))
+		}
+
+		// files are deleted by any spelling of their hash
+		require.NoError(t, db.DeleteFileMetadata(hasher.FormatHash(hasher.SHA256, deleted)))
+
+		exists, err := db.CheckFileExists(deleted)
+		require.NoError(t, err)
+		assert.False(t, exists)
+
+		for i, chunkHash := range chunkHashes {
+			referenced, err := db.CheckChunkReferenced(chunkHash)
+			require.NoError(t, err)
+			assert.Equal(t, i < 2, referenced, chunkHash)
+		}
+
+		referenced, err := db.ListReferencedChunks()
+		require.NoError(t, err)
+		assert.ElementsMatch(t, canonicalHashes(chunkHashes[:2]), referenced)
+
+		assert.ErrorIs(t, db.DeleteFileMetadata(deleted), storage.ErrFileNotFound)
+	})
+
+	t.Run("Test CheckChunkReferenced matches any spelling", func(t *testing.T) {
+		db := newDB(t)
+
+		chunkHash := testChunkHashes(1)[0]
+		require.NoError(t, db.SaveChunkMetadata(hasher.CalculateChunkHash([]byte("file")), chunkHash, 1, 0, ""))
+
+		for _, hash := range []string{chunkHash, hasher.CanonicalHash(chunkHash)} {
+			referenced, err := db.CheckChunkReferenced(hash)
+			require.NoError(t, err)
+			assert.True(t, referenced)
+		}
+
+		referenced, err := db.CheckChunkReferenced(hasher.CalculateChunkHash([]byte("unreferenced")))
+		require.NoError(t, err)
+		assert.False(t, referenced)
+	})
+
+	t.Run("Test MarkChunkDamaged and ListDamagedFiles", func(t *testing.T) {
+		db := newDB(t)
+
+		chunkHashes := testChunkHashes(5)
+		first := hasher.CalculateChunkHash([]byte("first"))
+		second := hasher.CalculateChunkHash([]byte("second"))
+		intact := hasher.CalculateChunkHash([]byte("intact"))
+		third := hasher.CalculateChunkHash([]byte("third"))
+		fourth := hasher.CalculateChunkHash([]byte("fourth"))
+		require.NoError(t, db.SaveChunkMetadata(first, chunkHashes[0], 1, 0, ""))
+		require.NoError(t, db.SaveChunkMetadata(first, chunkHashes[1], 2, 0, ""))
+		require.NoError(t, db.SaveChunkMetadata(second, chunkHashes[2], 1, 0, ""))
+		require.NoError(t, db.SaveChunkMetadata(intact, chunkHashes[3], 1, 0, ""))
+		require.NoError(t, db.SaveChunkMetadata(third, chunkHashes[4], 1, 0, ""))
+		require.NoError(t, db.SaveChunkMetadata(fourth, chunkHashes[4], 1, 0, ""))
+		require.NoError(t, db.SaveChunkMetadata(fourth, chunkHashes[4], 2, 0, ""))
+
+		damaged, err := db.ListDamagedFiles()
+		require.NoError(t, err)
+		assert.Empty(t, damaged)
+
+		// chunks are matched under any spelling of their hash
+		marked, err := db.MarkChunkDamaged(hasher.CanonicalHash(chunkHashes[1]))
+		require.NoError(t, err)
+		assert.Equal(t, []string{first}, marked)
+		marked, err = db.MarkChunkDamaged(chunkHashes[2])
+		require.NoError(t, err)
+		assert.Equal(t, []string{second}, marked)
+
+		// a shared chunk damages every file with it, each listed once
+		marked, err = db.MarkChunkDamaged(chunkHashes[4])
+		require.NoError(t, err)
+		assert.Equal(t, []string{third, fourth}, marked)
+
+		damaged, err = db.ListDamagedFiles()
+		require.NoError(t, err)
+		assert.Equal(t, []string{first, second, third, fourth}, damaged)
+
+		metadata, err := db.GetFileMetadata(first)
+		require.NoError(t, err)
+		require.NotNil(t, metadata)
+		assert.True(t, metadata.Damaged)
+		metadata, err = db.GetFileMetadata(intact)
+		require.NoError(t, err)
+		require.NotNil(t, metadata)
+		assert.False(t, metadata.Damaged)
+
+		marked, err = db.MarkChunkDamaged(hasher.CalculateChunkHash([]byte("unreferenced")))
+		require.NoError(t, err)
+		assert.Empty(t, marked)
+	})
+
+	t.Run("Test file size follows its chunks", func(t *testing.T) {
+		db := newDB(t)
+
+		fileHash := hasher.CalculateChunkHash([]byte("file"))
+		chunkHashes := testChunkHashes(3)
+		for i, chunkHash := range chunkHashes {
+			require.NoError(t, db.SaveChunkMetadata(fileHash, chunkHash, i+1, int64(10*(i+1)), ""))
+		}
+		// storing a chunk again does not count it twice
+		require.NoError(t, db.SaveChunkMetadata(fileHash, chunkHashes[0], 1, 10, ""))
+
+		metadata, err := db.GetFileMetadata(fileHash)
+		require.NoError(t, err)
+		require.NotNil(t, metadata)
+		assert.Equal(t, int64(60), metadata.Size)
+		assert.False(t, metadata.CreatedAt.IsZero())
+
+		require.NoError(t, db.RebuildChunkRefs())
+		metadata, err = db.GetFileMetadata(fileHash)
+		require.NoError(t, err)
+		assert.Equal(t, int64(60), metadata.Size)
+	})
+
+	t.Run("Test SetFileInfo", func(t *testing.T) {
+		db := newDB(t)
+
+		fileHash := hasher.CalculateChunkHash([]byte("file"))
+		assert.ErrorIs(t, db.SetFileInfo(fileHash, "report.pdf", "application/pdf", "alice"), storage.ErrFileNotFound)
+
+		require.NoError(t, db.SaveChunkMetadata(fileHash, testChunkHashes(1)[0], 1, 0, ""))
+		require.NoError(t, db.SetFileInfo(fileHash, "", "application/pdf", "alice"))
+		// fields already set are kept, the others are filled in
+		require.NoError(t, db.SetFileInfo(hasher.CanonicalHash(fileHash), "report.pdf", "text/plain", "bob"))
+
+		metadata, err := db.GetFileMetadata(fileHash)
+		require.NoError(t, err)
+		require.NotNil(t, metadata)
+		assert.Equal(t, "report.pdf", metadata.Name)
+		assert.Equal(t, "application/pdf", metadata.ContentType)
+		assert.Equal(t, "alice", metadata.Uploader)
+	})
+
+	t.Run("Test RebuildChunkRefs", func(t *testing.T) {
+		db := newDB(t)
+
+		chunkHashes := testChunkHashes(3)
+		for i, chunkHash := range chunkHashes {
+			require.NoError(t, db.SaveChunkMetadata(hasher.CalculateChunkHash([]byte("file")), chunkHash, i+1, 0, ""))
+		}
+
+		require.NoError(t, db.RebuildChunkRefs())
+		referenced, err := db.ListReferencedChunks()
+		require.NoError(t, err)
+		assert.ElementsMatch(t, canonicalHashes(chunkHashes), referenced)
+	})
+
+	t.Run("Test SetUserQuota", func(t *testing.T) {
+		db := newDB(t)
+
+		require.NoError(t, db.CreateUser(&model.User{Username: "alice", Password: []byte("hashed")}))
+		quota := model.Quota{LogicalBytes: 1 << 20, UniqueBytes: -1}
+		require.NoError(t, db.SetUserQuota("alice", quota))
+
+		user, err := db.GetUserByUsername("alice")
+		require.NoError(t, err)
+		assert.Equal(t, quota, user.Quota)
+
+		assert.ErrorIs(t, db.SetUserQuota("bob", quota), storage.ErrUserNotFound)
+	})
+
+	t.Run("Test AddFileOwner and CheckFileOwner", func(t *testing.T) {
+		db := newDB(t)
+
+		fileHash := hasher.CalculateChunkHash([]byte("file"))
+		require.NoError(t, db.SaveChunkMetadata(fileHash, testChunkHashes(1)[0], 1, 10, ""))
+		require.NoError(t, db.AddFileOwner(fileHash, 1))
+		// owners are added once, by any spelling of the file hash
+		require.NoError(t, db.AddFileOwner(hasher.FormatHash(hasher.SHA256, fileHash), 1))
+
+		owned, err := db.CheckFileOwner(hasher.FormatHash(hasher.SHA256, fileHash), 1)
+		require.NoError(t, err)
+		assert.True(t, owned)
+		owned, err = db.CheckFileOwner(fileHash, 2)
+		require.NoError(t, err)
+		assert.False(t, owned)
+
+		usage, err := db.GetUsage(1)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), usage.Files)
+
+		missing := hasher.CalculateChunkHash([]byte("missing"))
+		assert.ErrorIs(t, db.AddFileOwner(missing, 1), storage.ErrFileNotFound)
+		owned, err = db.CheckFileOwner(missing, 1)
+		require.NoError(t, err)
+		assert.False(t, owned)
+	})
+
+	t.Run("Test CompleteFile and RecordUploadedChunk", func(t *testing.T) {
+		db := newDB(t)
+
+		chunkHashes := testChunkHashes(3)
+		fileHash := hasher.FileHashFromChunkHashes(chunkHashes)
+		for i, chunkHash := range chunkHashes[:2] {
+			require.NoError(t, db.SaveChunkMetadata(fileHash, chunkHash, i+1, 10, ""))
+			owned, err := db.RecordUploadedChunk(fileHash, 1, i+1, chunkHash, 10)
+			require.NoError(t, err)
+			assert.False(t, owned)
+		}
+
+		// a file is only complete once its chunks hash to its file hash
+		complete, err := db.CompleteFile(fileHash, 3)
+		require.NoError(t, err)
+		assert.False(t, complete)
+		complete, err = db.CompleteFile(fileHash, 0)
+		require.NoError(t, err)
+		assert.False(t, complete)
+
+		require.NoError(t, db.SaveChunkMetadata(fileHash, chunkHashes[2], 3, 10, ""))
+		complete, err = db.CompleteFile(fileHash, 4)
+		require.NoError(t, err)
+		assert.False(t, complete)
+		complete, err = db.CompleteFile(hasher.CanonicalHash(fileHash), 3)
+		require.NoError(t, err)
+		assert.True(t, complete)
+
+		// no chunk can be added to a complete file, while its own chunks can be sent again
+		assert.ErrorIs(t, db.SaveChunkMetadata(fileHash, testChunkHashes(4)[3], 4, 10, ""), storage.ErrFileComplete)
+		require.NoError(t, db.SaveChunkMetadata(fileHash, chunkHashes[0], 1, 10, ""))
+		saved, err := db.GetFileMetadata(fileHash)
+		require.NoError(t, err)
+		assert.Equal(t, chunkHashes, orderedChunkHashes(saved))
+		assert.True(t, saved.Complete)
+
+		// users own the file once they have uploaded every position of it
+		owned, err := db.RecordUploadedChunk(fileHash, 2, 3, chunkHashes[2], 10)
+		require.NoError(t, err)
+		assert.False(t, owned)
+		owned, err = db.RecordUploadedChunk(fileHash, 1, 3, chunkHashes[2], 10)
+		require.NoError(t, err)
+		assert.True(t, owned)
+		owned, err = db.CheckFileOwner(fileHash, 1)
+		require.NoError(t, err)
+		assert.True(t, owned)
+		owned, err = db.CheckFileOwner(fileHash, 2)
+		require.NoError(t, err)
+		assert.False(t, owned)
+
+		usage, err := db.GetUsage(1)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), usage.Files)
+		assert.Equal(t, int64(30), usage.LogicalBytes)
+
+		// owners stay owners
+		owned, err = db.RecordUploadedChunk(fileHash, 1, 1, chunkHashes[0], 10)
+		require.NoError(t, err)
+		assert.True(t, owned)
+
+		missing := hasher.CalculateChunkHash([]byte("missing"))
+		_, err = db.CompleteFile(missing, 1)
+		assert.ErrorIs(t, err, storage.ErrFileNotFound)
+		_, err = db.RecordUploadedChunk(missing, 1, 1, missing, 10)
+		assert.ErrorIs(t, err, storage.ErrFileNotFound)
+	})
+
+	t.Run("Test RecordUploadedChunk replaces the chunks of an incomplete file", func(t *testing.T) {
+		db := newDB(t)
+
+		chunkHashes := testChunkHashes(3)
+		fileHash := hasher.FileHashFromChunkHashes(chunkHashes)
+		junk := testChunkHashes(5)[4]
+
+		// user 1 does not have the file and stores a wrong chunk and one past its end
+		for _, chunkOrder := range []int{1, 4} {
+			require.NoError(t, db.SaveChunkMetadata(fileHash, junk, chunkOrder, 10, ""))
+			owned, err := db.RecordUploadedChunk(fileHash, 1, chunkOrder, junk, 10)
+			require.NoError(t, err)
+			assert.False(t, owned)
+		}
+
+		// user 2 uploads the file, and owns it once their chunks hash to the file hash
+		assert.ErrorIs(t, db.SaveChunkMetadata(fileHash, chunkHashes[0], 1, 10, ""), storage.ErrChunkConflict)
+		for i, chunkHash := range chunkHashes {
+			if i > 0 {
+				require.NoError(t, db.SaveChunkMetadata(fileHash, chunkHash, i+1, 10, ""))
+			}
+			owned, err := db.RecordUploadedChunk(fileHash, 2, i+1, chunkHash, 10)
+			require.NoError(t, err)
+			assert.Equal(t, i == 2, owned)
+		}
+
+		saved, err := db.GetFileMetadata(fileHash)
+		require.NoError(t, err)
+		assert.Equal(t, chunkHashes, orderedChunkHashes(saved))
+		assert.True(t, saved.Complete)
+		assert.Equal(t, int64(30), saved.Size)
+		ref, err := db.GetChunkRef(junk)
+		require.NoError(t, err)
+		assert.Nil(t, ref)
+		usage, err := db.GetUsage(2)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), usage.Files)
+		assert.Equal(t, int64(30), usage.LogicalBytes)
+
+		// the chunks of the complete file are final
+		_, err = db.RecordUploadedChunk(fileHash, 1, 1, junk, 10)
+		assert.ErrorIs(t, err, storage.ErrChunkConflict)
+		_, err = db.RecordUploadedChunk(fileHash, 1, 4, junk, 10)
+		assert.ErrorIs(t, err, storage.ErrFileComplete)
+		owned, err := db.CheckFileOwner(fileHash, 1)
+		require.NoError(t, err)
+		assert.False(t, owned)
+	})
+
+	t.Run("Test ExpireIncompleteFiles", func(t *testing.T) {
+		db := newDB(t)
+
+		chunkHashes := testChunkHashes(3)
+		incomplete := hasher.FileHashFromChunkHashes(chunkHashes)
+		require.NoError(t, db.SaveChunkMetadata(incomplete, chunkHashes[0], 1, 10, ""))
+		complete := hasher.FileHashFromChunkHashes(chunkHashes[1:2])
+		require.NoError(t, db.SaveChunkMetadata(complete, chunkHashes[1], 1, 10, ""))
+		_, err := db.CompleteFile(complete, 1)
+		require.NoError(t, err)
+
+		// files with a chunk uploaded since the cutoff are kept
+		expired, err := db.ExpireIncompleteFiles(time.Now().Add(-time.Minute), false)
+		require.NoError(t, err)
+		assert.Empty(t, expired)
+
+		expired, err = db.ExpireIncompleteFiles(time.Now().Add(time.Minute), true)
+		require.NoError(t, err)
+		assert.Equal(t, []string{incomplete}, expired)
+		exists, err := db.CheckFileExists(incomplete)
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		expired, err = db.ExpireIncompleteFiles(time.Now().Add(time.Minute), false)
+		require.NoError(t, err)
+		assert.Equal(t, []string{incomplete}, expired)
+		exists, err = db.CheckFileExists(incomplete)
+		require.NoError(t, err)
+		assert.False(t, exists)
+		exists, err = db.CheckFileExists(complete)
+		require.NoError(t, err)
+		assert.True(t, exists)
+		referenced, err := db.CheckChunkReferenced(chunkHashes[0])
+		require.NoError(t, err)
+		assert.False(t, referenced)
+	})
+
+	t.Run("Test RebuildChunkRefs marks complete files", func(t *testing.T) {
+		db := newDB(t)
+
+		chunkHashes := testChunkHashes(2)
+		fileHash := hasher.FileHashFromChunkHashes(chunkHashes)
+		for i, chunkHash := range chunkHashes {
+			require.NoError(t, db.SaveChunkMetadata(fileHash, chunkHash, i+1, 10, ""))
+		}
+		legacyHash := hasher.LegacyFileHashFromChunkHashes(chunkHashes)
+		for i, chunkHash := range chunkHashes {
+			require.NoError(t, db.SaveChunkMetadata(legacyHash, chunkHash, i+1, 10, ""))
+		}
+		partialHash := hasher.FileHashFromChunkHashes(testChunkHashes(3))
+		require.NoError(t, db.SaveChunkMetadata(partialHash, chunkHashes[0], 1, 10, ""))
+
+		require.NoError(t, db.RebuildChunkRefs())
+		for fileHash, complete := range map[string]bool{fileHash: true, legacyHash: true, partialHash: false} {
+			saved, err := db.GetFileMetadata(fileHash)
+			require.NoError(t, err)
+			assert.Equal(t, complete, saved.Complete, fileHash)
+		}
+	})
+
+	t.Run("Test RemoveFileOwner deletes the file with its last owner", func(t *testing.T) {
+		db := newDB(t)
+
+		fileHash := hasher.CalculateChunkHash([]byte("file"))
+		chunkHash := testChunkHashes(1)[0]
+		require.NoError(t, db.SaveChunkMetadata(fileHash, chunkHash, 1, 10, ""))
+		require.NoError(t, db.AddFileOwner(fileHash, 1))
+		require.NoError(t, db.AddFileOwner(fileHash, 2))
+
+		_, err := db.RemoveFileOwner(fileHash, 3)
+		assert.ErrorIs(t, err, storage.ErrFileNotFound)
+
+		deleted, err := db.RemoveFileOwner(hasher.FormatHash(hasher.SHA256, fileHash), 1)
+		require.NoError(t, err)
+		assert.False(t, deleted)
+		owned, err := db.CheckFileOwner(fileHash, 1)
+		require.NoError(t, err)
+		assert.False(t, owned)
+		assertUsage(t, db, 1, model.Usage{})
+		assertUsage(t, db, 2, model.Usage{Files: 1, Chunks: 1, ChunkBytes: 10, LogicalBytes: 10, UniqueBytes: 10})
+
+		deleted, err = db.RemoveFileOwner(fileHash, 2)
+		require.NoError(t, err)
+		assert.True(t, deleted)
+		exists, err := db.CheckFileExists(fileHash)
+		require.NoError(t, err)
+		assert.False(t, exists)
+		referenced, err := db.CheckChunkReferenced(chunkHash)
+		require.NoError(t, err)
+		assert.False(t, referenced)
+		assertUsage(t, db, 2, model.Usage{})
+
+		_, err = db.RemoveFileOwner(fileHash, 2)
+		assert.ErrorIs(t, err, storage.ErrFileNotFound)
+	})
+
+	t.Run("Test CheckFileAccess and CheckChunkAccess", func(t *testing.T) {
+		db := newDB(t)
+
+		fileHash := hasher.CalculateChunkHash([]byte("file"))
+		otherHash := hasher.CalculateChunkHash([]byte("other"))
+		chunkHashes := testChunkHashes(3)
+		require.NoError(t, db.SaveChunkMetadata(fileHash, chunkHashes[0], 1, 10, ""))
+		require.NoError(t, db.SaveChunkMetadata(fileHash, chunkHashes[1], 2, 10, ""))
+		require.NoError(t, db.SaveChunkMetadata(otherHash, chunkHashes[1], 1, 10, ""))
+		require.NoError(t, db.SaveChunkMetadata(otherHash, chunkHashes[2], 2, 10, ""))
+		require.NoError(t, db.AddFileOwner(fileHash, 1))
+		require.NoError(t, db.AddFileOwner(otherHash, 2))
+
+		for _, tc := range []struct {
+			fileHash string
+			userID   uint
+			expected bool
+		}{
+			{hasher.FormatHash(hasher.SHA256, fileHash), 1, true},
+			{fileHash, 2, false},
+			{otherHash, 1, false},
+			{hasher.CalculateChunkHash([]byte("missing")), 1, false},
+		} {
+			accessible, err := db.CheckFileAccess(tc.fileHash, tc.userID)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, accessible, "file %s, user %d", tc.fileHash, tc.userID)
+		}
+
+		// a chunk may be read through any file it belongs to
+		for _, tc := range []struct {
+			chunkHash string
+			userID    uint
+			expected  bool
+		}{
+			{hasher.CanonicalHash(chunkHashes[0]), 1, true},
+			{chunkHashes[1], 1, true},
+			{chunkHashes[1], 2, true},
+			{chunkHashes[2], 1, false},
+			{chunkHashes[0], 2, false},
+		} {
+			accessible, err := db.CheckChunkAccess(tc.chunkHash, tc.userID)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, accessible, "chunk %s, user %d", tc.chunkHash, tc.userID)
+		}
+	})
+
+	t.Run("Test GrantFileAccess, ListFileGrants and RevokeFileAccess", func(t *testing.T) {
+		db := newDB(t)
+
+		alice := &model.User{Username: "alice", Password: []byte("hash")}
+		bob := &model.User{Username: "bob", Password: []byte("hash")}
+		require.NoError(t, db.CreateUser(alice))
+		require.NoError(t, db.CreateUser(bob))
+
+		fileHash := hasher.CalculateChunkHash([]byte("file"))
+		chunkHash := testChunkHashes(1)[0]
+		assert.ErrorIs(t, db.GrantFileAccess(fileHash, bob.ID, alice.ID), storage.ErrFileNotFound)
+
+		require.NoError(t, db.SaveChunkMetadata(fileHash, chunkHash, 1, 10, ""))
+		require.NoError(t, db.AddFileOwner(fileHash, alice.ID))
+		require.NoError(t, db.GrantFileAccess(fileHash, bob.ID, alice.ID))
+		// grants are added once, by any spelling of the file hash
+		require.NoError(t, db.GrantFileAccess(hasher.FormatHash(hasher.SHA256, fileHash), bob.ID, alice.ID))
+
+		accessible, err := db.CheckFileAccess(fileHash, bob.ID)
+		require.NoError(t, err)
+		assert.True(t, accessible)
+		accessible, err = db.CheckChunkAccess(chunkHash, bob.ID)
+		require.NoError(t, err)
+		assert.True(t, accessible)
+		owned, err := db.CheckFileOwner(fileHash, bob.ID)
+		require.NoError(t, err)
+		assert.False(t, owned)
+		// a grant does not count towards the usage of the grantee
+		assertUsage(t, db, bob.ID, model.Usage{})
+
+		grants, err := db.ListFileGrants(fileHash)
+		require.NoError(t, err)
+		require.Len(t, grants, 1)
+		assert.Equal(t, bob.ID, grants[0].UserID)
+		assert.Equal(t, "bob", grants[0].Username)
+		assert.Equal(t, alice.ID, grants[0].GrantedBy)
+		assert.False(t, grants[0].CreatedAt.IsZero())
+
+		require.NoError(t, db.RevokeFileAccess(hasher.CanonicalHash(fileHash), bob.ID))
+		assert.ErrorIs(t, db.RevokeFileAccess(fileHash, bob.ID), storage.ErrGrantNotFound)
+		accessible, err = db.CheckFileAccess(fileHash, bob.ID)
+		require.NoError(t, err)
+		assert.False(t, accessible)
+		grants, err = db.ListFileGrants(fileHash)
+		require.NoError(t, err)
+		assert.Empty(t, grants)
+	})
+
+	t.Run("Test CreateShareLink, GetShareLink, ListShareLinks and DeleteShareLink", func(t *testing.T) {
+		db := newDB(t)
+
+		fileHash := hasher.CalculateChunkHash([]byte("file"))
+		otherHash := hasher.CalculateChunkHash([]byte("other"))
+		expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+		assert.ErrorIs(t, db.CreateShareLink(fileHash, &model.ShareLink{Token: "first", ExpiresAt: expiresAt}), storage.ErrFileNotFound)
+
+		require.NoError(t, db.SaveChunkMetadata(fileHash, testChunkHashes(1)[0], 1, 10, ""))
+		require.NoError(t, db.SaveChunkMetadata(otherHash, testChunkHashes(2)[1], 1, 10, ""))
+		first := &model.ShareLink{Token: "first", CreatedBy: 1, Password: []byte("hash"), ExpiresAt: expiresAt}
+		require.NoError(t, db.CreateShareLink(hasher.FormatHash(hasher.SHA256, fileHash), first))
+		assert.Equal(t, fileHash, first.FileHash)
+		assert.NotZero(t, first.FileMetadataID)
+		require.NoError(t, db.CreateShareLink(fileHash, &model.ShareLink{Token: "second", CreatedBy: 1, ExpiresAt: expiresAt}))
+		assert.Error(t, db.CreateShareLink(otherHash, &model.ShareLink{Token: "first", ExpiresAt: expiresAt}))
+
+		link, err := db.GetShareLink("first")
+		require.NoError(t, err)
+		assert.Equal(t, fileHash, link.FileHash)
+		assert.Equal(t, uint(1), link.CreatedBy)
+		assert.Equal(t, []byte("hash"), link.Password)
+		assert.True(t, expiresAt.Equal(link.ExpiresAt))
+		_, err = db.GetShareLink("missing")
+		assert.ErrorIs(t, err, storage.ErrShareLinkNotFound)
+
+		links, err := db.ListShareLinks(fileHash)
+		require.NoError(t, err)
+		require.Len(t, links, 2)
+		assert.Equal(t, "first", links[0].Token)
+		assert.Equal(t, "second", links[1].Token)
+
+		// links are only deleted through their own file
+		assert.ErrorIs(t, db.DeleteShareLink(otherHash, "first"), storage.ErrShareLinkNotFound)
+		require.NoError(t, db.DeleteShareLink(fileHash, "first"))
+		assert.ErrorIs(t, db.DeleteShareLink(fileHash, "first"), storage.ErrShareLinkNotFound)
+		_, err = db.GetShareLink("first")
+		assert.ErrorIs(t, err, storage.ErrShareLinkNotFound)
+	})
+
+	t.Run("Test DeleteFileMetadata deletes grants and share links", func(t *testing.T) {
+		db := newDB(t)
+
+		fileHash := hasher.CalculateChunkHash([]byte("file"))
+		require.NoError(t, db.SaveChunkMetadata(fileHash, testChunkHashes(1)[0], 1, 10, ""))
+		require.NoError(t, db.GrantFileAccess(fileHash, 2, 1))
+		require.NoError(t, db.CreateShareLink(fileHash, &model.ShareLink{Token: "token", ExpiresAt: time.Now().Add(time.Hour)}))
+
+		require.NoError(t, db.DeleteFileMetadata(fileHash))
+		_, err := db.GetShareLink("token")
+		assert.ErrorIs(t, err, storage.ErrShareLinkNotFound)
+
+		// a new file with the same content starts without them
+		require.NoError(t, db.SaveChunkMetadata(fileHash, testChunkHashes(1)[0], 1, 10, ""))
+		accessible, err := db.CheckFileAccess(fileHash, 2)
+		require.NoError(t, err)
+		assert.False(t, accessible)
+	})
+
+	t.Run("Test CreateDirectory, SaveFilePath, GetPathEntry and ListDirectory", func(t *testing.T) {
+		db := newDB(t)
+
+		fileHash := hasher.CalculateChunkHash([]byte("file"))
+		otherHash := hasher.CalculateChunkHash([]byte("other"))
+		require.NoError(t, db.SaveChunkMetadata(fileHash, testChunkHashes(1)[0], 1, 10, ""))
+		require.NoError(t, db.SaveChunkMetadata(otherHash, testChunkHashes(2)[1], 1, 20, ""))
+		require.NoError(t, db.SetFileInfo(fileHash, "a.txt", "text/plain", "alice"))
+
+		dir, err := db.CreateDirectory(1, "/docs")
+		require.NoError(t, err)
+		assert.True(t, dir.IsDir)
+		assert.Equal(t, "/", dir.Parent)
+		_, err = db.CreateDirectory(1, "/docs")
+		assert.ErrorIs(t, err, storage.ErrPathExists)
+		_, err = db.CreateDirectory(1, "/missing/sub")
+		assert.ErrorIs(t, err, storage.ErrParentNotFound)
+		// every user has a namespace of their own
+		_, err = db.CreateDirectory(2, "/docs")
+		require.NoError(t, err)
+
+		_, err = db.SaveFilePath(1, "/docs/a.txt", "missing")
+		assert.ErrorIs(t, err, storage.ErrFileNotFound)
+		entry, err := db.SaveFilePath(1, "/docs/a.txt", hasher.FormatHash(hasher.SHA256, fileHash))
+		require.NoError(t, err)
+		assert.False(t, entry.IsDir)
+		assert.Equal(t, fileHash, entry.FileHash)
+		assert.Equal(t, int64(10), entry.Size)
+		assert.Equal(t, "text/plain", entry.ContentType)
+		_, err = db.SaveFilePath(1, "/docs/a.txt/b.txt", fileHash)
+		assert.ErrorIs(t, err, storage.ErrParentNotFound)
+		_, err = db.SaveFilePath(1, "/docs", fileHash)
+		assert.ErrorIs(t, err, storage.ErrPathExists)
+
+		// saving another file at a path replaces the file there
+		entry, err = db.SaveFilePath(1, "/docs/a.txt", otherHash)
+		require.NoError(t, err)
+		assert.Equal(t, otherHash, entry.FileHash)
+		assert.Equal(t, int64(20), entry.Size)
+		_, err = db.SaveFilePath(1, "/b.txt", fileHash)
+		require.NoError(t, err)
+		_, err = db.CreateDirectory(1, "/docs/sub")
+		require.NoError(t, err)
+
+		entry, err = db.GetPathEntry(1, "/docs/a.txt")
+		require.NoError(t, err)
+		assert.Equal(t, otherHash, entry.FileHash)
+		assert.Equal(t, "/docs", entry.Parent)
+		_, err = db.GetPathEntry(2, "/docs/a.txt")
+		assert.ErrorIs(t, err, storage.ErrPathNotFound)
+
+		entries, err := db.ListDirectory(1, "/")
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		assert.Equal(t, "/docs", entries[0].Path)
+		assert.Equal(t, "/b.txt", entries[1].Path)
+		entries, err = db.ListDirectory(1, "/docs")
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		assert.Equal(t, "/docs/sub", entries[0].Path)
+		assert.Equal(t, "/docs/a.txt", entries[1].Path)
+		_, err = db.ListDirectory(1, "/b.txt")
+		assert.ErrorIs(t, err, storage.ErrNotDirectory)
+		_, err = db.ListDirectory(1, "/missing")
+		assert.ErrorIs(t, err, storage.ErrPathNotFound)
+		entries, err = db.ListDirectory(2, "/docs")
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("Test MovePath and DeletePath", func(t *testing.T) {
+		db := newDB(t)
+
+		fileHash := hasher.CalculateChunkHash([]byte("file"))
+		require.NoError(t, db.SaveChunkMetadata(fileHash, testChunkHashes(1)[0], 1, 10, ""))
+		for _, dir := range []string{"/docs", "/docs/sub", "/docs_old", "/archive"} {
+			_, err := db.CreateDirectory(1, dir)
+			require.NoError(t, err)
+		}
+		for _, filePath := range []string{"/docs/a.txt", "/docs/sub/b.txt", "/docs_old/c.txt"} {
+			_, err := db.SaveFilePath(1, filePath, fileHash)
+			require.NoError(t, err)
+		}
+
+		_, err := db.MovePath(1, "/missing", "/other")
+		assert.ErrorIs(t, err, storage.ErrPathNotFound)
+		_, err = db.MovePath(1, "/docs", "/docs/sub/docs")
+		assert.ErrorIs(t, err, storage.ErrInvalidMove)
+		_, err = db.MovePath(1, "/docs", "/archive")
+		assert.ErrorIs(t, err, storage.ErrPathExists)
+		_, err = db.MovePath(1, "/docs", "/missing/docs")
+		assert.ErrorIs(t, err, storage.ErrParentNotFound)
+
+		// the entries below a directory move with it, those of a directory with a similar name do not
+		moved, err := db.MovePath(1, "/docs", "/archive/docs")
+		require.NoError(t, err)
+		assert.Equal(t, "/archive/docs", moved.Path)
+		assert.Equal(t, "/archive", moved.Parent)
+		entry, err := db.GetPathEntry(1, "/archive/docs/sub/b.txt")
+		require.NoError(t, err)
+		assert.Equal(t, "/archive/docs/sub", entry.Parent)
+		assert.Equal(t, fileHash, entry.FileHash)
+		_, err = db.GetPathEntry(1, "/docs/a.txt")
+		assert.ErrorIs(t, err, storage.ErrPathNotFound)
+		_, err = db.GetPathEntry(1, "/docs_old/c.txt")
+		require.NoError(t, err)
+
+		moved, err = db.MovePath(1, "/archive/docs/a.txt", "/a.txt")
+		require.NoError(t, err)
+		assert.Equal(t, "/", moved.Parent)
+		assert.Equal(t, fileHash, moved.FileHash)
+
+		_, err = db.DeletePath(1, "/archive", false)
+		assert.ErrorIs(t, err, storage.ErrDirectoryNotEmpty)
+		_, err = db.DeletePath(1, "/missing", false)
+		assert.ErrorIs(t, err, storage.ErrPathNotFound)
+		removed, err := db.DeletePath(1, "/archive", true)
+		require.NoError(t, err)
+		assert.Equal(t, int64(4), removed)
+		removed, err = db.DeletePath(1, "/a.txt", false)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), removed)
+
+		// removing paths keeps the files saved at them
+		exists, err := db.CheckFileExists(fileHash)
+		require.NoError(t, err)
+		assert.True(t, exists)
+		entries, err := db.ListDirectory(1, "/")
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "/docs_old", entries[0].Path)
+
+		// paths below a directory are matched by bytes, whatever their characters and case
+		for _, dir := range []string{"/café", "/café/docs", "/Café"} {
+			_, err := db.CreateDirectory(1, dir)
+			require.NoError(t, err)
+		}
+		for _, filePath := range []string{"/café/docs/d.txt", "/Café/e.txt"} {
+			_, err := db.SaveFilePath(1, filePath, fileHash)
+			require.NoError(t, err)
+		}
+		_, err = db.MovePath(1, "/café", "/new")
+		require.NoError(t, err)
+		entry, err = db.GetPathEntry(1, "/new/docs")
+		require.NoError(t, err)
+		assert.Equal(t, "/new", entry.Parent)
+		entry, err = db.GetPathEntry(1, "/new/docs/d.txt")
+		require.NoError(t, err)
+		assert.Equal(t, "/new/docs", entry.Parent)
+		_, err = db.GetPathEntry(1, "/Café/e.txt")
+		require.NoError(t, err)
+
+		_, err = db.MovePath(1, "/Café", "/CAFÉ")
+		require.NoError(t, err)
+		removed, err = db.DeletePath(1, "/new", true)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), removed)
+		entries, err = db.ListDirectory(1, "/CAFÉ")
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "/CAFÉ/e.txt", entries[0].Path)
+	})
+
+	t.Run("Test RemoveFileOwner and DeleteFileMetadata delete file paths", func(t *testing.T) {
+		db := newDB(t)
+
+		fileHash := hasher.CalculateChunkHash([]byte("file"))
+		require.NoError(t, db.SaveChunkMetadata(fileHash, testChunkHashes(1)[0], 1, 10, ""))
+		require.NoError(t, db.AddFileOwner(fileHash, 1))
+		require.NoError(t, db.AddFileOwner(fileHash, 2))
+		for _, userID := range []uint{1, 2} {
+			_, err := db.SaveFilePath(userID, "/file", fileHash)
+			require.NoError(t, err)
+		}
+
+		_, err := db.RemoveFileOwner(fileHash, 1)
+		require.NoError(t, err)
+		_, err = db.GetPathEntry(1, "/file")
+		assert.ErrorIs(t, err, storage.ErrPathNotFound)
+		_, err = db.GetPathEntry(2, "/file")
+		require.NoError(t, err)
+
+		require.NoError(t, db.DeleteFileMetadata(fileHash))
+		_, err = db.GetPathEntry(2, "/file")
+		assert.ErrorIs(t, err, storage.ErrPathNotFound)
+	})
+
+	t.Run("Test usage accounts logical and unique bytes", func(t *testing.T) {
+		db := newDB(t)
+
+		chunkHashes := testChunkHashes(4)
+		shared := hasher.CalculateChunkHash([]byte("shared"))
+		own := hasher.CalculateChunkHash([]byte("own"))
+
+		// chunks saved before and after the first owner are accounted alike
+		require.NoError(t, db.SaveChunkMetadata(shared, chunkHashes[0], 1, 10, ""))
+		require.NoError(t, db.AddFileOwner(shared, 1))
+		require.NoError(t, db.SaveChunkMetadata(shared, chunkHashes[1], 2, 20, ""))
+		require.NoError(t, db.SaveChunkMetadata(shared, chunkHashes[2], 3, 30, ""))
+		assertUsage(t, db, 1, model.Usage{Files: 1, Chunks: 3, ChunkBytes: 60, LogicalBytes: 60, UniqueBytes: 60})
+
+		// a second owner shares every chunk, so neither has unique bytes left
+		require.NoError(t, db.AddFileOwner(shared, 2))
+		require.NoError(t, db.SaveChunkMetadata(own, chunkHashes[3], 1, 40, ""))
+		require.NoError(t, db.AddFileOwner(own, 2))
+		assertUsage(t, db, 1, model.Usage{Files: 1, Chunks: 3, ChunkBytes: 60, LogicalBytes: 60, UniqueBytes: 0})
+		assertUsage(t, db, 2, model.Usage{Files: 2, Chunks: 4, ChunkBytes: 100, LogicalBytes: 100, UniqueBytes: 40})
+
+		ref, err := db.GetChunkRef(hasher.FormatHash(hasher.SHA256, chunkHashes[1]))
+		require.NoError(t, err)
+		require.NotNil(t, ref)
+		assert.Equal(t, model.ChunkRef{ChunkHash: hasher.CanonicalHash(chunkHashes[1]), RefCount: 1, Size: 20, Users: 2}, *ref)
+
+		// deleting the shared file releases it from both owners
+		require.NoError(t, db.DeleteFileMetadata(shared))
+		assertUsage(t, db, 1, model.Usage{})
+		assertUsage(t, db, 2, model.Usage{Files: 1, Chunks: 1, ChunkBytes: 40, LogicalBytes: 40, UniqueBytes: 40})
+		owned, err := db.CheckFileOwner(shared, 1)
+		require.NoError(t, err)
+		assert.False(t, owned)
+
+		ref, err = db.GetChunkRef(chunkHashes[1])
+		require.NoError(t, err)
+		assert.Nil(t, ref)
+		assertUsage(t, db, 3, model.Usage{})
+	})
+
+	t.Run("Test RebuildChunkRefs recomputes usage", func(t *testing.T) {
+		db := newDB(t)
+
+		chunkHashes := testChunkHashes(3)
+		first := hasher.CalculateChunkHash([]byte("first"))
+		second := hasher.CalculateChunkHash([]byte("second"))
+		require.NoError(t, db.SaveChunkMetadata(first, chunkHashes[0], 1, 10, ""))
+		require.NoError(t, db.SaveChunkMetadata(first, chunkHashes[1], 2, 20, ""))
+		require.NoError(t, db.SaveChunkMetadata(second, chunkHashes[2], 1, 30, ""))
+		require.NoError(t, db.AddFileOwner(first, 1))
+		require.NoError(t, db.AddFileOwner(first, 2))
+		require.NoError(t, db.AddFileOwner(second, 2))
+
+		maintained := make(map[uint]model.Usage)
+		for _, userID := range []uint{1, 2} {
+			usage, err := db.GetUsage(userID)
+			require.NoError(t, err)
+			maintained[userID] = *usage
+		}
+
+		require.NoError(t, db.RebuildChunkRefs())
+		for userID, usage := range maintained {
+			assertUsage(t, db, userID, usage)
+		}
+		assertUsage(t, db, 2, model.Usage{Files: 2, Chunks: 3, ChunkBytes: 60, LogicalBytes: 60, UniqueBytes: 30})
+	})
+
+	t.Run("Test SetChunkSize", func(t *testing.T) {
+		db := newDB(t)
+
+		fileHash := hasher.CalculateChunkHash([]byte("file"))
+		chunkHash := testChunkHashes(1)[0]
+		require.NoError(t, db.SaveChunkMetadata(fileHash, chunkHash, 1, 0, ""))
+		require.NoError(t, db.AddFileOwner(fileHash, 1))
+
+		require.NoError(t, db.SetChunkSize(hasher.CanonicalHash(chunkHash), 42))
+
+		metadata, err := db.GetFileMetadata(fileHash)
+		require.NoError(t, err)
+		require.NotNil(t, metadata)
+		require.Len(t, metadata.Chunks, 1)
+		assert.Equal(t, int64(42), metadata.Chunks[0].Size)
+		ref, err := db.GetChunkRef(chunkHash)
+		require.NoError(t, err)
+		require.NotNil(t, ref)
+		assert.Equal(t, int64(42), ref.Size)
+		assert.Equal(t, int64(42), metadata.Size)
+
+		// usage follows once it is rebuilt
+		require.NoError(t, db.RebuildChunkRefs())
+		assertUsage(t, db, 1, model.Usage{Files: 1, Chunks: 1, ChunkBytes: 42, LogicalBytes: 42, UniqueBytes: 42})
+	})
+
+	t.Run("Test GetStats and ListSharedChunks", func(t *testing.T) {
+		db := newDB(t)
+
+		stats, err := db.GetStats()
+		require.NoError(t, err)
+		assert.Equal(t, model.Stats{}, *stats)
+
+		chunkHashes := testChunkHashes(3)
+		first := hasher.CalculateChunkHash([]byte("first"))
+		second := hasher.CalculateChunkHash([]byte("second"))
+		third := hasher.CalculateChunkHash([]byte("third"))
+		require.NoError(t, db.SaveChunkMetadata(first, chunkHashes[0], 1, 10, ""))
+		require.NoError(t, db.SaveChunkMetadata(first, chunkHashes[1], 2, 20, ""))
+		require.NoError(t, db.SaveChunkMetadata(first, chunkHashes[0], 3, 10, ""))
+		require.NoError(t, db.SaveChunkMetadata(second, chunkHashes[0], 1, 10, ""))
+		require.NoError(t, db.SaveChunkMetadata(second, hasher.FormatHash(hasher.SHA256, chunkHashes[1]), 2, 20, ""))
+		require.NoError(t, db.SaveChunkMetadata(third, chunkHashes[2], 1, 30, ""))
+		require.NoError(t, db.AddFileOwner(first, 1))
+		require.NoError(t, db.AddFileOwner(third, 2))
+
+		stats, err = db.GetStats()
+		require.NoError(t, err)
+		assert.Equal(t, model.Stats{Files: 3, Chunks: 3, ChunkBytes: 60, LogicalBytes: 100}, *stats)
+
+		shared, err := db.ListSharedChunks(0, 10)
+		require.NoError(t, err)
+		assert.Equal(t, []model.ChunkRef{
+			{ChunkHash: hasher.CanonicalHash(chunkHashes[0]), RefCount: 3, Size: 10, Users: 1},
+			{ChunkHash: hasher.CanonicalHash(chunkHashes[1]), RefCount: 2, Size: 20, Users: 1},
+		}, shared)
+
+		shared, err = db.ListSharedChunks(0, 1)
+		require.NoError(t, err)
+		require.Len(t, shared, 1)
+		assert.Equal(t, hasher.CanonicalHash(chunkHashes[0]), shared[0].ChunkHash)
+
+		// only the chunks of the user's files, however often other files reference them
+		shared, err = db.ListSharedChunks(1, 10)
+		require.NoError(t, err)
+		assert.Len(t, shared, 2)
+		shared, err = db.ListSharedChunks(2, 10)
+		require.NoError(t, err)
+		assert.Empty(t, shared)
+	})
+
+	t.Run("Test GetStats follows files as they are saved and deleted", func(t *testing.T) {
+		db := newDB(t)
+
+		chunkHashes := testChunkHashes(3)
+		first := hasher.CalculateChunkHash([]byte("first"))
+		require.NoError(t, db.SaveChunkMetadata(first, chunkHashes[0], 1, 10, ""))
+		require.NoError(t, db.SaveChunkMetadata(first, chunkHashes[1], 2, 0, ""))
+		require.NoError(t, db.SaveFileMetadata(&model.FileMetadata{
+			FileHash: hasher.CalculateChunkHash([]byte("second")),
+			Chunks: []model.ChunkMetadata{
+				{ChunkOrder: 1, ChunkHash: chunkHashes[0], Size: 10},
+				{ChunkOrder: 2, ChunkHash: chunkHashes[2], Size: 30},
+			},
+		}))
+		require.NoError(t, db.AddFileOwner(first, 1))
+
+		stats, err := db.GetStats()
+		require.NoError(t, err)
+		assert.Equal(t, model.Stats{Files: 2, Chunks: 3, ChunkBytes: 40, LogicalBytes: 50}, *stats)
+
+		require.NoError(t, db.SetChunkSize(chunkHashes[1], 20))
+		stats, err = db.GetStats()
+		require.NoError(t, err)
+		assert.Equal(t, model.Stats{Files: 2, Chunks: 3, ChunkBytes: 60, LogicalBytes: 70}, *stats)
+
+		// the maintained totals match a recount
+		require.NoError(t, db.RebuildChunkRefs())
+		rebuilt, err := db.GetStats()
+		require.NoError(t, err)
+		assert.Equal(t, stats, rebuilt)
+
+		deleted, err := db.RemoveFileOwner(first, 1)
+		require.NoError(t, err)
+		require.True(t, deleted)
+		stats, err = db.GetStats()
+		require.NoError(t, err)
+		assert.Equal(t, model.Stats{Files: 1, Chunks: 2, ChunkBytes: 40, LogicalBytes: 40}, *stats)
+		shared, err := db.ListSharedChunks(0, 10)
+		require.NoError(t, err)
+		assert.Empty(t, shared)
+	})
+
+	t.Run("Test migrations", func(t *testing.T) {
+		db := newDB(t)
+
+		applied, err := db.CheckMigrationApplied("test-migration")
+		require.NoError(t, err)
+		assert.False(t, applied)
+
+		require.NoError(t, db.SaveMigration("test-migration"))
+
+		applied, err = db.CheckMigrationApplied("test-migration")
+		require.NoError(t, err)
+		assert.True(t, applied)
+	})
+}
+
+// assertUsage asserts the usage of a user
+func assertUsage(t *testing.T, db storage.DB, userID uint, expected model.Usage) {
+	t.Helper()
+
+	usage, err := db.GetUsage(userID)
+	require.NoError(t, err)
+	expected.UserID = userID
+	assert.Equal(t, expected, *usage)
+}
+
+// testChunkHashes returns the hashes of n distinct chunks
+func testChunkHashes(n int) []string {
+	hashes := make([]string, n)
+	for i := range hashes {
+		hashes[i] = hasher.CalculateChunkHash([]byte(fmt.Sprintf("chunk %d", i)))
+	}
+	return hashes
+}
+
+// orderedChunkHashes returns the chunk hashes of a file in chunk order
+func orderedChunkHashes(metadata *model.FileMetadata) []string {
+	chunks := append([]model.ChunkMetadata(nil), metadata.Chunks...)
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].ChunkOrder < chunks[j].ChunkOrder })
+
+	hashes := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		hashes[i] = chunk.ChunkHash
+	}
+	return hashes
+}
+
+// canonicalHashes returns the canonical form of hashes
+func canonicalHashes(hashes []string) []string {
+	canonical := make([]string, len(hashes))
+	for i, hash := range hashes {
+		canonical[i] = hasher.CanonicalHash(hash)
+	}
+	return canonical
+}
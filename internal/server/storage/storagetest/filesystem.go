@@ -0,0 +1,232 @@
+// Package storagetest is a conformance test suite for storage backends. Every implementation
+// of storage.FileSystem and storage.DB runs it from its own tests, so all backends behave alike.
+package storagetest
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"zerodupe/internal/server/storage"
+	"zerodupe/pkg/hasher"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFileSystem runs the conformance suite for storage.FileSystem. newFileSystem must return
+// an empty file system for every call.
+func TestFileSystem(t *testing.T, newFileSystem func(t *testing.T) storage.FileSystem) {
+	t.Run("Test SaveChunkData and GetChunkData round trip", func(t *testing.T) {
+		fileSystem := newFileSystem(t)
+
+		content := []byte("Hello World!")
+		chunkHash := hasher.CalculateChunkHash(content)
+		calculatedHash, err := fileSystem.SaveChunkData(chunkHash, content)
+		require.NoError(t, err)
+		assert.Equal(t, chunkHash, calculatedHash)
+
+		// a legacy SHA-256 hash and its prefixed form name the same chunk
+		for _, hash := range []string{chunkHash, hasher.FormatHash(hasher.SHA256, chunkHash)} {
+			got, err := fileSystem.GetChunkData(hash)
+			require.NoError(t, err)
+			assert.Equal(t, content, got)
+		}
+
+		blake3Hash := sum(t, hasher.BLAKE3, content)
+		calculatedHash, err = fileSystem.SaveChunkData(blake3Hash, content)
+		require.NoError(t, err)
+		assert.Equal(t, blake3Hash, calculatedHash)
+
+		got, err := fileSystem.GetChunkData(blake3Hash)
+		require.NoError(t, err)
+		assert.Equal(t, content, got)
+	})
+
+	t.Run("Test SaveChunkData rejects content that does not match its hash", func(t *testing.T) {
+		fileSystem := newFileSystem(t)
+
+		chunkHash := hasher.CalculateChunkHash([]byte("expected"))
+		calculatedHash, err := fileSystem.SaveChunkData(chunkHash, []byte("forged"))
+		assert.ErrorIs(t, err, storage.ErrHashMismatch)
+		assert.Equal(t, hasher.CalculateChunkHash([]byte("forged")), calculatedHash)
+
+		_, missing, err := fileSystem.CheckChunkExists([]string{chunkHash})
+		require.NoError(t, err)
+		assert.Equal(t, []string{chunkHash}, missing)
+	})
+
+	t.Run("Test SaveChunkData of an existing chunk", func(t *testing.T) {
+		fileSystem := newFileSystem(t)
+
+		content := []byte("Hello World!")
+		chunkHash := hasher.CalculateChunkHash(content)
+		for i := 0; i < 2; i++ {
+			calculatedHash, err := fileSystem.SaveChunkData(chunkHash, content)
+			require.NoError(t, err)
+			assert.Equal(t, chunkHash, calculatedHash)
+		}
+
+		hashes, err := fileSystem.ListChunks()
+		require.NoError(t, err)
+		assert.Equal(t, []string{chunkHash}, hashes)
+	})
+
+	t.Run("Test concurrent saves of the same chunk", func(t *testing.T) {
+		fileSystem := newFileSystem(t)
+
+		content := []byte("Hello World!")
+		chunkHash := hasher.CalculateChunkHash(content)
+
+		var wg sync.WaitGroup
+		errs := make([]error, 8)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, errs[i] = fileSystem.SaveChunkData(chunkHash, content)
+			}(i)
+		}
+		wg.Wait()
+		for _, err := range errs {
+			require.NoError(t, err)
+		}
+
+		got, err := fileSystem.GetChunkData(chunkHash)
+		require.NoError(t, err)
+		assert.Equal(t, content, got)
+	})
+
+	t.Run("Test invalid hashes are rejected", func(t *testing.T) {
+		fileSystem := newFileSystem(t)
+
+		for _, hash := range []string{"ab", "../../etc/passwd", "sha256:zz", "abcdtest567890", strings.Repeat("z", 64)} {
+			_, err := fileSystem.SaveChunkData(hash, []byte("content"))
+			assert.Error(t, err, hash)
+			_, err = fileSystem.GetChunkData(hash)
+			assert.Error(t, err, hash)
+		}
+	})
+
+	t.Run("Test CheckChunkExists splits existing and missing chunks", func(t *testing.T) {
+		fileSystem := newFileSystem(t)
+
+		content := []byte("Hello World!")
+		chunkHash := hasher.CalculateChunkHash(content)
+		_, err := fileSystem.SaveChunkData(chunkHash, content)
+		require.NoError(t, err)
+
+		prefixedHash := hasher.FormatHash(hasher.SHA256, chunkHash)
+		missingHash := hasher.CalculateChunkHash([]byte("missing"))
+		existing, missing, err := fileSystem.CheckChunkExists([]string{missingHash, chunkHash, prefixedHash})
+		require.NoError(t, err)
+		assert.Equal(t, []string{chunkHash, prefixedHash}, existing)
+		assert.Equal(t, []string{missingHash}, missing)
+	})
+
+	t.Run("Test GetChunkData for a missing chunk", func(t *testing.T) {
+		fileSystem := newFileSystem(t)
+
+		_, err := fileSystem.GetChunkData(hasher.CalculateChunkHash([]byte("missing")))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("Test ListChunks names chunks like the block store", func(t *testing.T) {
+		fileSystem := newFileSystem(t)
+
+		hashes, err := fileSystem.ListChunks()
+		require.NoError(t, err)
+		assert.Empty(t, hashes)
+
+		var expected []string
+		for i := 0; i < 3; i++ {
+			content := []byte(fmt.Sprintf("chunk %d", i))
+			chunkHash := hasher.CalculateChunkHash(content)
+			_, err := fileSystem.SaveChunkData(chunkHash, content)
+			require.NoError(t, err)
+			expected = append(expected, chunkHash)
+		}
+
+		// SHA-256 chunks are listed by their bare digest, whatever spelling they were saved under
+		content := []byte("prefixed")
+		_, err = fileSystem.SaveChunkData(hasher.FormatHash(hasher.SHA256, hasher.CalculateChunkHash(content)), content)
+		require.NoError(t, err)
+		expected = append(expected, hasher.CalculateChunkHash(content))
+
+		blake3Hash := sum(t, hasher.BLAKE3, []byte("blake3"))
+		_, err = fileSystem.SaveChunkData(blake3Hash, []byte("blake3"))
+		require.NoError(t, err)
+		expected = append(expected, blake3Hash)
+
+		hashes, err = fileSystem.ListChunks()
+		require.NoError(t, err)
+		assert.ElementsMatch(t, expected, hashes)
+	})
+
+	t.Run("Test StatChunk and TouchChunk", func(t *testing.T) {
+		fileSystem := newFileSystem(t)
+
+		content := []byte("Hello World!")
+		chunkHash := hasher.CalculateChunkHash(content)
+		before := time.Now().Add(-time.Minute)
+		_, err := fileSystem.SaveChunkData(chunkHash, content)
+		require.NoError(t, err)
+
+		info, err := fileSystem.StatChunk(chunkHash)
+		require.NoError(t, err)
+		assert.Positive(t, info.Size)
+		assert.True(t, info.ModTime.After(before), "modification time %s", info.ModTime)
+		assert.True(t, info.ModTime.Before(time.Now().Add(time.Minute)), "modification time %s", info.ModTime)
+
+		require.NoError(t, fileSystem.TouchChunk(chunkHash))
+		touched, err := fileSystem.StatChunk(chunkHash)
+		require.NoError(t, err)
+		assert.False(t, touched.ModTime.Before(info.ModTime))
+		assert.Equal(t, info.Size, touched.Size)
+	})
+
+	t.Run("Test DeleteChunk", func(t *testing.T) {
+		fileSystem := newFileSystem(t)
+
+		content := []byte("Hello World!")
+		chunkHash := hasher.CalculateChunkHash(content)
+		_, err := fileSystem.SaveChunkData(chunkHash, content)
+		require.NoError(t, err)
+
+		require.NoError(t, fileSystem.DeleteChunk(chunkHash))
+
+		_, err = fileSystem.GetChunkData(chunkHash)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		hashes, err := fileSystem.ListChunks()
+		require.NoError(t, err)
+		assert.Empty(t, hashes)
+
+		// a deleted chunk can be uploaded again
+		_, err = fileSystem.SaveChunkData(chunkHash, content)
+		require.NoError(t, err)
+		got, err := fileSystem.GetChunkData(chunkHash)
+		require.NoError(t, err)
+		assert.Equal(t, content, got)
+	})
+
+	t.Run("Test StatChunk, TouchChunk and DeleteChunk of a missing chunk", func(t *testing.T) {
+		fileSystem := newFileSystem(t)
+
+		chunkHash := hasher.CalculateChunkHash([]byte("missing"))
+		_, err := fileSystem.StatChunk(chunkHash)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		assert.ErrorIs(t, fileSystem.TouchChunk(chunkHash), os.ErrNotExist)
+		assert.ErrorIs(t, fileSystem.DeleteChunk(chunkHash), os.ErrNotExist)
+	})
+}
+
+// sum returns the hash of data with an algorithm
+func sum(t *testing.T, algorithm string, data []byte) string {
+	t.Helper()
+
+	hash, err := hasher.Sum(algorithm, data)
+	require.NoError(t, err)
+	return hash
+}
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"sort"
+	"zerodupe/internal/server/model"
+	"zerodupe/pkg/hasher"
+)
+
+// ChunkCounts are chunk references and usage counted from scratch, see CountChunkRefs
+type ChunkCounts struct {
+	Refs     map[string]*model.ChunkRef // by canonical chunk hash
+	UserRefs []model.UserChunkRef
+	Usages   map[uint]*model.Usage // by user id, only for users owning a file
+}
+
+// CountChunkRefs counts the references of every chunk and the usage of every user from the chunk
+// metadata and the file owners. The size of a chunk is the largest size recorded for it.
+func CountChunkRefs(chunks []model.ChunkMetadata, owners []model.FileOwner) ChunkCounts {
+	type userChunk struct {
+		userID    uint
+		chunkHash string
+	}
+
+	fileOwners := make(map[uint][]uint)
+	counts := ChunkCounts{
+		Refs:   make(map[string]*model.ChunkRef),
+		Usages: make(map[uint]*model.Usage),
+	}
+	for _, owner := range owners {
+		fileOwners[owner.FileMetadataID] = append(fileOwners[owner.FileMetadataID], owner.UserID)
+		usage := counts.Usages[owner.UserID]
+		if usage == nil {
+			usage = &model.Usage{UserID: owner.UserID}
+			counts.Usages[owner.UserID] = usage
+		}
+		usage.Files++
+	}
+
+	userRefs := make(map[userChunk]int)
+	var order []userChunk
+	for _, chunk := range chunks {
+		key := hasher.CanonicalHash(chunk.ChunkHash)
+		ref := counts.Refs[key]
+		if ref == nil {
+			ref = &model.ChunkRef{ChunkHash: key}
+			counts.Refs[key] = ref
+		}
+		ref.RefCount++
+		ref.Size = max(ref.Size, chunk.Size)
+
+		for _, userID := range fileOwners[chunk.FileMetadataID] {
+			counts.Usages[userID].LogicalBytes += chunk.Size
+			userRef := userChunk{userID: userID, chunkHash: key}
+			if userRefs[userRef] == 0 {
+				order = append(order, userRef)
+				ref.Users++
+			}
+			userRefs[userRef]++
+		}
+	}
+
+	for _, userRef := range order {
+		ref := counts.Refs[userRef.chunkHash]
+		usage := counts.Usages[userRef.userID]
+		usage.Chunks++
+		usage.ChunkBytes += ref.Size
+		if ref.Users == 1 {
+			usage.UniqueBytes += ref.Size
+		}
+		counts.UserRefs = append(counts.UserRefs, model.UserChunkRef{
+			UserID:    userRef.userID,
+			ChunkHash: userRef.chunkHash,
+			RefCount:  userRefs[userRef],
+		})
+	}
+	return counts
+}
+
+// AddChunkTotals adds what a chunk reference counts towards the totals, times sign
+func AddChunkTotals(totals *model.Totals, ref model.ChunkRef, sign int64) {
+	if ref.RefCount <= 0 {
+		return
+	}
+	totals.Chunks += sign
+	totals.ChunkBytes += sign * ref.Size
+	totals.LogicalBytes += sign * int64(ref.RefCount) * ref.Size
+}
+
+// CanonicalHashes returns the distinct canonical forms of hashes, sorted
+func CanonicalHashes(hashes []string) []string {
+	seen := make(map[string]bool, len(hashes))
+	canonical := []string{}
+	for _, hash := range hashes {
+		hash = hasher.CanonicalHash(hash)
+		if !seen[hash] {
+			seen[hash] = true
+			canonical = append(canonical, hash)
+		}
+	}
+	sort.Strings(canonical)
+	return canonical
+}
@@ -9,8 +9,8 @@ type API interface {
 	// SetToken updates the authentication token
 	SetToken(token string)
 
-	// CheckFileExists checks if a file exists on the server
-	CheckFileExists(fileHash string) (bool, error)
+	// CheckFileExists checks if a file exists on the server and if the caller owns it
+	CheckFileExists(fileHash string) (*FileExistsResponse, error)
 
 	// GetMissingChunks checks if chunks exist on the server
 	GetMissingChunks(hashes []string) ([]string, error)
@@ -22,4 +22,49 @@ type API interface {
 	GetFileChunks(fileHash string) (*DownloadFileHashesResponse, error)
 
 	DownloadChunk(chunkHash string) ([]byte, error)
+
+	// DeleteFile deletes a file from the server
+	DeleteFile(fileHash string) error
+
+	// GetUsage gets the storage accounted to a user and their quota, the caller's for an empty username
+	GetUsage(username string) (*UsageResponse, error)
+
+	// SetQuota sets the quota of a user
+	SetQuota(username string, quota Quota) (*UsageResponse, error)
+
+	// GetStats gets the deduplication statistics with up to top most shared chunks
+	GetStats(top int) (*StatsResponse, error)
+
+	// GrantAccess gives another user read access to a file the caller owns
+	GrantAccess(fileHash, username string) (*GrantResponse, error)
+
+	// RevokeAccess takes back the read access of a user to a file
+	RevokeAccess(fileHash, username string) error
+
+	// ListShares lists the users granted access to a file and its share links
+	ListShares(fileHash string) (*SharesResponse, error)
+
+	// CreateShareLink creates a link serving a file without authentication
+	CreateShareLink(fileHash string, request ShareLinkRequest) (*ShareLinkResponse, error)
+
+	// DeleteShareLink deletes a share link to a file
+	DeleteShareLink(fileHash, token string) error
+
+	// Mkdir creates a directory, with its missing parents when parents is set
+	Mkdir(dirPath string, parents bool) (*PathEntry, error)
+
+	// ListDirectory lists the entries of a directory, or the file at a path
+	ListDirectory(dirPath string) (*ListDirectoryResponse, error)
+
+	// StatPath describes the directory or file at a path
+	StatPath(entryPath string) (*PathEntry, error)
+
+	// MovePath moves a file or directory, into the destination when it is a directory
+	MovePath(fromPath, toPath string) (*PathEntry, error)
+
+	// RemovePath removes a file or directory from the namespace, keeping the files saved at the paths
+	RemovePath(entryPath string, recursive bool) (*RemovePathResponse, error)
+
+	// SaveFilePath saves a file the caller owns at a path
+	SaveFilePath(filePath, fileHash string) (*PathEntry, error)
 }
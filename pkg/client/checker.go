@@ -17,8 +17,8 @@ func NewFileChecker(api API) *FileChecker {
 	}
 }
 
-// CheckFileExists checks if a file exists on the server
-func (fc *FileChecker) CheckFileExists(fileHash string) (bool, error) {
+// CheckFileExists checks if a file exists on the server and if the caller owns it
+func (fc *FileChecker) CheckFileExists(fileHash string) (*FileExistsResponse, error) {
 	return fc.api.CheckFileExists(fileHash)
 }
 
@@ -33,10 +33,9 @@ func (fc *FileChecker) IdentifyExistingChunks(chunks []hasher.FileChunk) (map[st
 		return nil, fmt.Errorf("failed to check chunks: %w", err)
 	}
 
-	// If all chunks exist, we can skip the upload
+	// If all chunks exist, only chunk metadata has to be sent
 	if len(missingChunks) == 0 {
-		fmt.Printf("All chunks already exist on server. Skipping upload.\n")
-		return nil, nil
+		fmt.Printf("All chunks already exist on server. Sending metadata only.\n")
 	}
 
 	existingChunksMap := buildExistingChunksMap(chunkHashes, missingChunks)
@@ -3,6 +3,10 @@ package client
 import (
 	"errors"
 	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
 	"time"
 	"zerodupe/pkg/hasher"
 )
@@ -13,6 +17,8 @@ type Client struct {
 	checker      *FileChecker
 	uploader     *ChunkUploader
 	downloader   *ChunkDownloader
+	chunker      hasher.ChunkerConfig
+	algorithm    string
 	accessToken  string
 	refreshToken string
 }
@@ -26,6 +32,8 @@ func NewClient(serverURL string) *Client {
 		checker:    NewFileChecker(httpClient),
 		uploader:   NewUploader(httpClient),
 		downloader: NewDownloader(httpClient),
+		chunker:    hasher.DefaultChunkerConfig(),
+		algorithm:  hasher.DefaultAlgorithm,
 	}
 }
 
@@ -35,6 +43,24 @@ func (client *Client) SetToken(accessToken string) {
 	client.api.SetToken(accessToken)
 }
 
+// SetChunkerConfig selects the chunker used to split uploaded files
+func (client *Client) SetChunkerConfig(config hasher.ChunkerConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	client.chunker = config
+	return nil
+}
+
+// SetHashAlgorithm selects the hash algorithm used for chunk and file hashes of uploaded files
+func (client *Client) SetHashAlgorithm(algorithm string) error {
+	if _, err := hasher.LookupAlgorithm(algorithm); err != nil {
+		return err
+	}
+	client.algorithm = algorithm
+	return nil
+}
+
 // ExecuteWithAuth executes a function with authentication
 func (client *Client) ExecuteWithAuth(fn func() error) error {
 	err := fn()
@@ -59,43 +85,43 @@ func (client *Client) ExecuteWithAuth(fn func() error) error {
 	return err
 }
 
-// UploadFile uploads a file to the server
-// It handles file validation, chunking, and coordinating the upload process
-func (client *Client) UploadFile(filePath string) error {
+// UploadFile uploads a file to the server and saves it at remotePath, unless it is empty.
+// The file is streamed twice: once to hash its chunks and once to upload the missing ones,
+// so memory use is bounded by the number of chunks uploaded concurrently.
+func (client *Client) UploadFile(filePath string, remotePath string) error {
 	// check if file exists
 	if err := validateFile(filePath); err != nil {
 		return err
 	}
 
-	// Read file content
-	fileContent, err := getFileContent(filePath)
+	// Split file into chunks and calculate file hash
+	chunks, fileHash, err := scanFile(filePath, client.chunker, client.algorithm)
 	if err != nil {
 		return err
 	}
 
-	if len(fileContent) == 0 {
+	if len(chunks) == 0 {
 		return fmt.Errorf("cannot upload empty file")
 	}
 
-	// Split data into chunks and calculate file hash
-	chunks, fileHash, err := hasher.SplitDataIntoChunks(fileContent)
-	if err != nil {
-		return err
-	}
-
 	// Check if file already exists on server
-	exists, err := client.checker.CheckFileExists(fileHash)
+	existing, err := client.checker.CheckFileExists(fileHash)
 	if err != nil {
 		return err
-	} else if exists {
+	} else if existing.Exists && existing.Owned {
 		fmt.Printf("File already exists on server. Skipping upload.\n")
 		fmt.Printf("File hash: %s\n", fileHash)
-		return nil
+		return client.saveFilePath(filePath, remotePath, fileHash)
 	}
 
-	fmt.Printf("File does not exist on server. Uploading...\n")
+	if existing.Exists {
+		// sending every chunk of a stored file makes the caller another owner of it
+		fmt.Printf("File already exists on server. Adding it to your files...\n")
+	} else {
+		fmt.Printf("File does not exist on server. Uploading...\n")
+	}
 	fmt.Printf("File hash: %s\n", fileHash)
-	fmt.Printf("Total chunks: %d\n", len(chunks))
+	fmt.Printf("Total chunks: %d (chunker: %s)\n", len(chunks), client.chunker)
 
 	// Identify which chunks already exist on the server
 	existingChunks, err := client.checker.IdentifyExistingChunks(chunks)
@@ -103,55 +129,270 @@ func (client *Client) UploadFile(filePath string) error {
 		return err
 	}
 
-	// make sever returns not existing chunks
-	if err := client.uploader.UploadChunks(chunks, fileHash, filePath, existingChunks); err != nil {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	reader, err := hasher.NewChunkReader(file, client.chunker, client.algorithm)
+	if err != nil {
+		return err
+	}
+
+	contentType, err := detectContentType(filePath)
+	if err != nil {
+		return err
+	}
+	fileInfo := ChunkUploadRequest{
+		FileHash:    fileHash,
+		Chunker:     client.chunker.String(),
+		TotalChunks: len(chunks),
+		FileName:    filepath.Base(filePath),
+		ContentType: contentType,
+	}
+	if err := client.uploader.UploadChunks(reader, chunks, fileInfo, existingChunks); err != nil {
 		return err
 	}
 
 	fmt.Printf("File uploaded successfully\n")
 	fmt.Printf("File hash: %s (use this hash to download the file)\n", fileHash)
-	return nil
+	return client.saveFilePath(filePath, remotePath, fileHash)
 
 }
 
-// DownloadFile downloads a file from the server
-func (client *Client) DownloadFile(fileHash string, outputDir string, fileName string) error {
-	exists, err := client.checker.CheckFileExists(fileHash)
-	if err != nil {
-		return err
-	} else if !exists {
-		return fmt.Errorf("file does not exist on server")
+// saveFilePath saves an uploaded file at remotePath, creating its missing parent directories.
+// A remotePath ending with a slash, or naming a directory, saves the file in it under the name of
+// the local file.
+func (client *Client) saveFilePath(filePath, remotePath, fileHash string) error {
+	if remotePath == "" {
+		return nil
 	}
 
-	fmt.Printf("File exists on server. Downloading...\n")
+	if strings.HasSuffix(remotePath, "/") {
+		remotePath = path.Join(remotePath, filepath.Base(filePath))
+	} else if entry, err := client.api.StatPath(remotePath); err == nil && entry.IsDir() {
+		remotePath = path.Join(entry.Path, filepath.Base(filePath))
+	} else if err != nil && !errors.Is(err, PathNotFoundError) {
+		return err
+	}
 
-	var response *DownloadFileHashesResponse
-	hashes, err := client.api.GetFileChunks(fileHash)
+	if parent := path.Dir(path.Clean(remotePath)); parent != "/" {
+		if _, err := client.api.Mkdir(parent, true); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", parent, err)
+		}
+	}
+	entry, err := client.api.SaveFilePath(remotePath, fileHash)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to save file at %s: %w", remotePath, err)
 	}
 
-	if hashes.ChunksCount == 0 {
-		response = &DownloadFileHashesResponse{
-			FileHash:    fileHash,
-			ChunkHashes: []string{fileHash},
-			ChunksCount: 1,
+	fmt.Printf("File saved at %s\n", entry.Path)
+	return nil
+}
+
+// DownloadFile downloads a file from the server, by its hash or by a path it was saved at, and
+// returns the path it was written to
+func (client *Client) DownloadFile(file string, outputDir string, fileName string) (string, error) {
+	fileHash := file
+	if IsRemotePath(file) {
+		entry, err := client.api.StatPath(file)
+		if err != nil {
+			return "", err
+		}
+		if entry.IsDir() {
+			return "", fmt.Errorf("%s is a directory", entry.Path)
+		}
+		fileHash = entry.FileHash
+		// files downloaded by path are named after it unless a name is given
+		if fileName == "" {
+			fileName = safeFileName(entry.Name)
 		}
-	} else {
-		response = hashes
 	}
 
-	content, err := client.downloader.DownloadChunks(response)
+	existing, err := client.checker.CheckFileExists(fileHash)
 	if err != nil {
-		return err
+		return "", err
+	} else if !existing.Exists {
+		return "", fmt.Errorf("file does not exist on server")
 	}
 
-	// combine chunks into file
-	if err := hasher.CombineChunksIntoFile(content, outputDir, fileName); err != nil {
-		return err
+	fmt.Printf("File exists on server. Downloading...\n")
+
+	response, err := client.api.GetFileChunks(fileHash)
+	if err != nil {
+		return "", err
 	}
+	fmt.Printf("Chunks: %d (chunker: %s)\n", response.ChunksCount, response.Chunker)
 
-	return nil
+	// files are named as uploaded unless a name is given, or by their hash if they have no name
+	if fileName == "" {
+		fileName = safeFileName(response.Name)
+	}
+	if fileName == "" {
+		fileName = fileHash
+	}
+
+	outputPath := filepath.Join(outputDir, fileName)
+	if err := client.downloader.DownloadToFile(response, outputPath); err != nil {
+		return "", err
+	}
+
+	fmt.Printf("File %s created successfully at %s\n", fileName, outputDir)
+	return outputPath, nil
+}
+
+// GetFileInfo gets the metadata of a file and its chunks
+func (client *Client) GetFileInfo(fileHash string) (*DownloadFileHashesResponse, error) {
+	var info *DownloadFileHashesResponse
+	err := client.ExecuteWithAuth(func() error {
+		var err error
+		info, err = client.api.GetFileChunks(fileHash)
+		return err
+	})
+	return info, err
+}
+
+// DeleteFile deletes a file from the server
+func (client *Client) DeleteFile(fileHash string) error {
+	return client.ExecuteWithAuth(func() error {
+		return client.api.DeleteFile(fileHash)
+	})
+}
+
+// GetUsage gets the storage accounted to a user and their quota, the caller's for an empty username
+func (client *Client) GetUsage(username string) (*UsageResponse, error) {
+	var usage *UsageResponse
+	err := client.ExecuteWithAuth(func() error {
+		var err error
+		usage, err = client.api.GetUsage(username)
+		return err
+	})
+	return usage, err
+}
+
+// SetQuota sets the quota of a user
+func (client *Client) SetQuota(username string, quota Quota) (*UsageResponse, error) {
+	var usage *UsageResponse
+	err := client.ExecuteWithAuth(func() error {
+		var err error
+		usage, err = client.api.SetQuota(username, quota)
+		return err
+	})
+	return usage, err
+}
+
+// GetStats gets the deduplication statistics with up to top most shared chunks
+func (client *Client) GetStats(top int) (*StatsResponse, error) {
+	var stats *StatsResponse
+	err := client.ExecuteWithAuth(func() error {
+		var err error
+		stats, err = client.api.GetStats(top)
+		return err
+	})
+	return stats, err
+}
+
+// GrantAccess gives another user read access to a file the caller owns
+func (client *Client) GrantAccess(fileHash, username string) (*GrantResponse, error) {
+	var grant *GrantResponse
+	err := client.ExecuteWithAuth(func() error {
+		var err error
+		grant, err = client.api.GrantAccess(fileHash, username)
+		return err
+	})
+	return grant, err
+}
+
+// RevokeAccess takes back the read access of a user to a file
+func (client *Client) RevokeAccess(fileHash, username string) error {
+	return client.ExecuteWithAuth(func() error {
+		return client.api.RevokeAccess(fileHash, username)
+	})
+}
+
+// ListShares lists the users granted access to a file and its share links
+func (client *Client) ListShares(fileHash string) (*SharesResponse, error) {
+	var shares *SharesResponse
+	err := client.ExecuteWithAuth(func() error {
+		var err error
+		shares, err = client.api.ListShares(fileHash)
+		return err
+	})
+	return shares, err
+}
+
+// CreateShareLink creates a link serving a file without authentication
+func (client *Client) CreateShareLink(fileHash string, request ShareLinkRequest) (*ShareLinkResponse, error) {
+	var link *ShareLinkResponse
+	err := client.ExecuteWithAuth(func() error {
+		var err error
+		link, err = client.api.CreateShareLink(fileHash, request)
+		return err
+	})
+	return link, err
+}
+
+// DeleteShareLink deletes a share link to a file
+func (client *Client) DeleteShareLink(fileHash, token string) error {
+	return client.ExecuteWithAuth(func() error {
+		return client.api.DeleteShareLink(fileHash, token)
+	})
+}
+
+// Mkdir creates a directory, with its missing parents when parents is set
+func (client *Client) Mkdir(dirPath string, parents bool) (*PathEntry, error) {
+	var entry *PathEntry
+	err := client.ExecuteWithAuth(func() error {
+		var err error
+		entry, err = client.api.Mkdir(dirPath, parents)
+		return err
+	})
+	return entry, err
+}
+
+// ListDirectory lists the entries of a directory, or the file at a path
+func (client *Client) ListDirectory(dirPath string) (*ListDirectoryResponse, error) {
+	var listing *ListDirectoryResponse
+	err := client.ExecuteWithAuth(func() error {
+		var err error
+		listing, err = client.api.ListDirectory(dirPath)
+		return err
+	})
+	return listing, err
+}
+
+// StatPath describes the directory or file at a path
+func (client *Client) StatPath(entryPath string) (*PathEntry, error) {
+	var entry *PathEntry
+	err := client.ExecuteWithAuth(func() error {
+		var err error
+		entry, err = client.api.StatPath(entryPath)
+		return err
+	})
+	return entry, err
+}
+
+// MovePath moves a file or directory, into the destination when it is a directory
+func (client *Client) MovePath(fromPath, toPath string) (*PathEntry, error) {
+	var entry *PathEntry
+	err := client.ExecuteWithAuth(func() error {
+		var err error
+		entry, err = client.api.MovePath(fromPath, toPath)
+		return err
+	})
+	return entry, err
+}
+
+// RemovePath removes a file or directory from the namespace, keeping the files saved at the paths
+func (client *Client) RemovePath(entryPath string, recursive bool) (*RemovePathResponse, error) {
+	var response *RemovePathResponse
+	err := client.ExecuteWithAuth(func() error {
+		var err error
+		response, err = client.api.RemovePath(entryPath, recursive)
+		return err
+	})
+	return response, err
 }
 
 // Signup creates a new user account
@@ -3,7 +3,6 @@ package cmd
 import (
 	"fmt"
 	"log"
-	"path/filepath"
 	"zerodupe/pkg/client"
 
 	"github.com/spf13/cobra"
@@ -17,19 +16,19 @@ var (
 )
 
 var downloadCmd = &cobra.Command{
-	Use:   "download <filehash>",
-	Short: "Download a file from the server by its hash",
+	Use:   "download <filehash|path>",
+	Short: "Download a file from the server by its hash or path",
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		fileHash := args[0]
+		file := args[0]
 
 		c := client.NewClient(downloadServer)
 		c.SetToken(downloadToken)
 
-		fmt.Printf("Downloading file with hash %s from %s\n", fileHash, downloadServer)
+		fmt.Printf("Downloading file %s from %s\n", file, downloadServer)
 
-		outputPath := filepath.Join(downloadOutput, downloadFileName)
-		if err := c.DownloadFile(fileHash, downloadOutput, downloadFileName); err != nil {
+		outputPath, err := c.DownloadFile(file, downloadOutput, downloadFileName)
+		if err != nil {
 			log.Fatalf("Failed to download file: %v", err)
 		}
 
@@ -41,6 +40,6 @@ func init() {
 	downloadCmd.Flags().StringVar(&downloadServer, "server", "http://localhost:8080", "Server URL")
 	downloadCmd.Flags().StringVar(&downloadToken, "token", "", "JWT authentication token")
 	downloadCmd.Flags().StringVarP(&downloadOutput, "output", "o", ".", "Output directory")
-	downloadCmd.Flags().StringVarP(&downloadFileName, "name", "n", "", "Output file name (default: file hash)")
+	downloadCmd.Flags().StringVarP(&downloadFileName, "name", "n", "", "Output file name (default: name of the path, or of the uploaded file, or file hash)")
 	downloadCmd.MarkFlagRequired("token")
 }
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"time"
+	"zerodupe/pkg/client"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	infoServer string
+	infoToken  string
+)
+
+var infoCmd = &cobra.Command{
+	Use:   "info <filehash>",
+	Short: "Show the metadata of a file and its chunks",
+	Long: `Show the size, original name, content type, creation time and uploader of a file,
+and the hash, size and offset of each of its chunks.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c := client.NewClient(infoServer)
+		c.SetToken(infoToken)
+
+		info, err := c.GetFileInfo(args[0])
+		if err != nil {
+			log.Fatalf("Failed to get file info: %v", err)
+		}
+
+		fmt.Printf("File hash:      %s\n", info.FileHash)
+		fmt.Printf("Name:           %s\n", orUnknown(info.Name))
+		fmt.Printf("Size:           %s (%d bytes)\n", formatBytes(info.Size), info.Size)
+		fmt.Printf("Content type:   %s\n", orUnknown(info.ContentType))
+		if info.CreatedAt != nil {
+			fmt.Printf("Created:        %s\n", info.CreatedAt.Local().Format(time.RFC3339))
+		} else {
+			fmt.Printf("Created:        %s\n", orUnknown(""))
+		}
+		fmt.Printf("Uploader:       %s\n", orUnknown(info.Uploader))
+		fmt.Printf("Chunker:        %s\n", info.Chunker)
+		if info.Damaged {
+			fmt.Printf("Damaged:        yes, a chunk was found corrupt and quarantined\n")
+		}
+
+		fmt.Println()
+		fmt.Printf("Chunks: %d\n", info.ChunksCount)
+		for i, chunk := range info.Chunks {
+			fmt.Printf("  %4d  %s  offset %d  %s\n", i+1, chunk.ChunkHash, chunk.Offset, formatBytes(chunk.Size))
+		}
+	},
+}
+
+// orUnknown returns value, or a placeholder for metadata not recorded for files uploaded before it was
+func orUnknown(value string) string {
+	if value == "" {
+		return "(unknown)"
+	}
+	return value
+}
+
+func init() {
+	infoCmd.Flags().StringVar(&infoServer, "server", "http://localhost:8080", "Server URL")
+	infoCmd.Flags().StringVar(&infoToken, "token", "", "JWT authentication token")
+	infoCmd.MarkFlagRequired("token")
+}
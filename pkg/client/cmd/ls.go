@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"zerodupe/pkg/client"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	lsServer string
+	lsToken  string
+)
+
+var lsCmd = &cobra.Command{
+	Use:   "ls [path]",
+	Short: "List a directory of your directory tree",
+	Long: `List the directories and files of a directory, the root by default, with the size
+and hash of each file. Listing a file shows the file alone.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dirPath := "/"
+		if len(args) == 1 {
+			dirPath = args[0]
+		}
+
+		c := client.NewClient(lsServer)
+		c.SetToken(lsToken)
+
+		listing, err := c.ListDirectory(dirPath)
+		if err != nil {
+			log.Fatalf("Failed to list directory: %v", err)
+		}
+
+		for _, entry := range listing.Entries {
+			if entry.IsDir() {
+				fmt.Printf("%10s  %s/\n", "dir", entry.Name)
+				continue
+			}
+			fmt.Printf("%10s  %s  %s\n", formatBytes(entry.Size), entry.Name, entry.FileHash)
+		}
+	},
+}
+
+func init() {
+	lsCmd.Flags().StringVar(&lsServer, "server", "http://localhost:8080", "Server URL")
+	lsCmd.Flags().StringVar(&lsToken, "token", "", "JWT authentication token")
+	lsCmd.MarkFlagRequired("token")
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"zerodupe/pkg/client"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	mkdirServer  string
+	mkdirToken   string
+	mkdirParents bool
+)
+
+var mkdirCmd = &cobra.Command{
+	Use:   "mkdir <path>",
+	Short: "Create a directory in your directory tree",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c := client.NewClient(mkdirServer)
+		c.SetToken(mkdirToken)
+
+		entry, err := c.Mkdir(args[0], mkdirParents)
+		if err != nil {
+			log.Fatalf("Failed to create directory: %v", err)
+		}
+
+		fmt.Printf("Directory %s created\n", entry.Path)
+	},
+}
+
+func init() {
+	mkdirCmd.Flags().StringVar(&mkdirServer, "server", "http://localhost:8080", "Server URL")
+	mkdirCmd.Flags().StringVar(&mkdirToken, "token", "", "JWT authentication token")
+	mkdirCmd.Flags().BoolVarP(&mkdirParents, "parents", "p", false, "Create missing parent directories, and accept a directory that exists")
+	mkdirCmd.MarkFlagRequired("token")
+}
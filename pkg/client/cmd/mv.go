@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"zerodupe/pkg/client"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	mvServer string
+	mvToken  string
+)
+
+var mvCmd = &cobra.Command{
+	Use:   "mv <from> <to>",
+	Short: "Move or rename a file or directory of your directory tree",
+	Long: `Move or rename a file or directory, with everything below a directory. Moving to a
+directory that exists moves the entry into it.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		c := client.NewClient(mvServer)
+		c.SetToken(mvToken)
+
+		entry, err := c.MovePath(args[0], args[1])
+		if err != nil {
+			log.Fatalf("Failed to move path: %v", err)
+		}
+
+		fmt.Printf("Moved %s to %s\n", args[0], entry.Path)
+	},
+}
+
+func init() {
+	mvCmd.Flags().StringVar(&mvServer, "server", "http://localhost:8080", "Server URL")
+	mvCmd.Flags().StringVar(&mvToken, "token", "", "JWT authentication token")
+	mvCmd.MarkFlagRequired("token")
+}
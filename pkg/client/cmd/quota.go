@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"log"
+	"zerodupe/pkg/client"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	quotaServer    string
+	quotaToken     string
+	quotaLogicalMB int64
+	quotaUniqueMB  int64
+)
+
+var quotaCmd = &cobra.Command{
+	Use:   "quota <username>",
+	Short: "Set the storage quota of a user (administrators only)",
+	Long: `Set the limits of the storage accounted to a user in megabytes. A limit of 0 falls back
+to the server's default quota and a negative limit is unlimited.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c := client.NewClient(quotaServer)
+		c.SetToken(quotaToken)
+
+		quota := client.Quota{
+			LogicalBytes: megabytes(quotaLogicalMB),
+			UniqueBytes:  megabytes(quotaUniqueMB),
+		}
+		usage, err := c.SetQuota(args[0], quota)
+		if err != nil {
+			log.Fatalf("Failed to set quota: %v", err)
+		}
+
+		printUsage(usage)
+	},
+}
+
+// megabytes converts a limit in megabytes to bytes, keeping negative limits unlimited
+func megabytes(limit int64) int64 {
+	if limit < 0 {
+		return -1
+	}
+	return limit << 20
+}
+
+func init() {
+	quotaCmd.Flags().StringVar(&quotaServer, "server", "http://localhost:8080", "Server URL")
+	quotaCmd.Flags().StringVar(&quotaToken, "token", "", "JWT authentication token")
+	quotaCmd.Flags().Int64Var(&quotaLogicalMB, "logical-mb", 0, "Limit of the total size of the files the user owns in megabytes")
+	quotaCmd.Flags().Int64Var(&quotaUniqueMB, "unique-mb", 0, "Limit of the size of the chunks only the user references in megabytes")
+	quotaCmd.MarkFlagRequired("token")
+}
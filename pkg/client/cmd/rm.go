@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"zerodupe/pkg/client"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	rmServer    string
+	rmToken     string
+	rmRecursive bool
+)
+
+var rmCmd = &cobra.Command{
+	Use:   "rm <filehash|path>",
+	Short: "Delete a file by its hash, or remove a path",
+	Long: `Delete a file from the server by its hash, which removes it from your files and from
+every path it is saved at. Given a path, remove the path from your directory tree instead,
+and with -r the directories and files below it. Removing a path keeps the file.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c := client.NewClient(rmServer)
+		c.SetToken(rmToken)
+
+		if client.IsRemotePath(args[0]) {
+			response, err := c.RemovePath(args[0], rmRecursive)
+			if err != nil {
+				log.Fatalf("Failed to remove path: %v", err)
+			}
+			fmt.Printf("Removed %s (%d entries)\n", response.Path, response.Removed)
+			return
+		}
+
+		fileHash := args[0]
+		if err := c.DeleteFile(fileHash); err != nil {
+			log.Fatalf("Failed to delete file: %v", err)
+		}
+
+		fmt.Printf("File %s deleted\n", fileHash)
+	},
+}
+
+func init() {
+	rmCmd.Flags().StringVar(&rmServer, "server", "http://localhost:8080", "Server URL")
+	rmCmd.Flags().StringVar(&rmToken, "token", "", "JWT authentication token")
+	rmCmd.Flags().BoolVarP(&rmRecursive, "recursive", "r", false, "Remove the directories and files below a path too")
+	rmCmd.MarkFlagRequired("token")
+}
@@ -13,6 +13,18 @@ func init() {
 	rootCmd.AddCommand(refreshCmd)
 	rootCmd.AddCommand(uploadCmd)
 	rootCmd.AddCommand(downloadCmd)
+	rootCmd.AddCommand(infoCmd)
+	rootCmd.AddCommand(rmCmd)
+	rootCmd.AddCommand(mkdirCmd)
+	rootCmd.AddCommand(lsCmd)
+	rootCmd.AddCommand(mvCmd)
+	rootCmd.AddCommand(statCmd)
+	rootCmd.AddCommand(shareCmd)
+	rootCmd.AddCommand(unshareCmd)
+	rootCmd.AddCommand(sharesCmd)
+	rootCmd.AddCommand(usageCmd)
+	rootCmd.AddCommand(quotaCmd)
+	rootCmd.AddCommand(statsCmd)
 }
 
 func Execute() error {
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"zerodupe/pkg/client"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	shareServer   string
+	shareToken    string
+	shareUser     string
+	shareLink     bool
+	shareExpires  string
+	sharePassword string
+)
+
+var shareCmd = &cobra.Command{
+	Use:   "share <filehash>",
+	Short: "Share a file with another user or through a link",
+	Long: `Give another user read access to a file you own with --user, or create a link that
+downloads the file without logging in with --link. Links expire, after 24 hours unless
+--expires says otherwise, and can require a password.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if (shareUser == "") == !shareLink {
+			log.Fatal("exactly one of --user and --link is required")
+		}
+		c := client.NewClient(shareServer)
+		c.SetToken(shareToken)
+
+		if shareUser != "" {
+			grant, err := c.GrantAccess(args[0], shareUser)
+			if err != nil {
+				log.Fatalf("Failed to share file: %v", err)
+			}
+			fmt.Printf("Shared %s with %s\n", args[0], grant.Username)
+			return
+		}
+
+		link, err := c.CreateShareLink(args[0], client.ShareLinkRequest{
+			ExpiresIn: shareExpires,
+			Password:  sharePassword,
+		})
+		if err != nil {
+			log.Fatalf("Failed to create share link: %v", err)
+		}
+		fmt.Printf("Share link: %s\n", shareURL(shareServer, link))
+		fmt.Printf("Token:      %s\n", link.Token)
+		fmt.Printf("Expires:    %s\n", formatTime(link.ExpiresAt))
+		if link.Protected {
+			fmt.Println("Password:   required")
+		}
+	},
+}
+
+func init() {
+	shareCmd.Flags().StringVar(&shareServer, "server", "http://localhost:8080", "Server URL")
+	shareCmd.Flags().StringVar(&shareToken, "token", "", "JWT authentication token")
+	shareCmd.Flags().StringVar(&shareUser, "user", "", "User to give read access to")
+	shareCmd.Flags().BoolVar(&shareLink, "link", false, "Create a share link instead")
+	shareCmd.Flags().StringVar(&shareExpires, "expires", "", "How long the link is valid, such as 72h (24h by default, at most 720h)")
+	shareCmd.Flags().StringVar(&sharePassword, "password", "", "Password needed to download through the link")
+	shareCmd.MarkFlagRequired("token")
+}
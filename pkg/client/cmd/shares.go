@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"zerodupe/pkg/client"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	sharesServer string
+	sharesToken  string
+)
+
+var sharesCmd = &cobra.Command{
+	Use:   "shares <filehash>",
+	Short: "List the users and links a file is shared with",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c := client.NewClient(sharesServer)
+		c.SetToken(sharesToken)
+
+		shares, err := c.ListShares(args[0])
+		if err != nil {
+			log.Fatalf("Failed to list shares: %v", err)
+		}
+
+		fmt.Printf("Users: %d\n", len(shares.Grants))
+		for _, grant := range shares.Grants {
+			fmt.Printf("  %s  since %s\n", grant.Username, formatTime(grant.GrantedAt))
+		}
+
+		fmt.Println()
+		fmt.Printf("Links: %d\n", len(shares.Links))
+		for _, link := range shares.Links {
+			state := "expires " + formatTime(link.ExpiresAt)
+			if link.Expired {
+				state = "expired " + formatTime(link.ExpiresAt)
+			}
+			if link.Protected {
+				state += ", password protected"
+			}
+			fmt.Printf("  %s  %s\n", shareURL(sharesServer, &link), state)
+		}
+	},
+}
+
+// shareURL returns the URL a share link serves its file at
+func shareURL(serverURL string, link *client.ShareLinkResponse) string {
+	return strings.TrimRight(serverURL, "/") + link.Path
+}
+
+// formatTime formats a time in the local time zone
+func formatTime(t time.Time) string {
+	return t.Local().Format(time.RFC3339)
+}
+
+func init() {
+	sharesCmd.Flags().StringVar(&sharesServer, "server", "http://localhost:8080", "Server URL")
+	sharesCmd.Flags().StringVar(&sharesToken, "token", "", "JWT authentication token")
+	sharesCmd.MarkFlagRequired("token")
+}
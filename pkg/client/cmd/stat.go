@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"zerodupe/pkg/client"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	statServer string
+	statToken  string
+)
+
+var statCmd = &cobra.Command{
+	Use:   "stat <path>",
+	Short: "Show the directory or file at a path of your directory tree",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c := client.NewClient(statServer)
+		c.SetToken(statToken)
+
+		entry, err := c.StatPath(args[0])
+		if err != nil {
+			log.Fatalf("Failed to stat path: %v", err)
+		}
+
+		fmt.Printf("Path:           %s\n", entry.Path)
+		fmt.Printf("Type:           %s\n", entry.Type)
+		if !entry.IsDir() {
+			fmt.Printf("File hash:      %s\n", entry.FileHash)
+			fmt.Printf("Size:           %s (%d bytes)\n", formatBytes(entry.Size), entry.Size)
+			fmt.Printf("Content type:   %s\n", orUnknown(entry.ContentType))
+		}
+		if entry.CreatedAt != nil {
+			fmt.Printf("Created:        %s\n", formatTime(*entry.CreatedAt))
+		}
+		if entry.UpdatedAt != nil {
+			fmt.Printf("Modified:       %s\n", formatTime(*entry.UpdatedAt))
+		}
+	},
+}
+
+func init() {
+	statCmd.Flags().StringVar(&statServer, "server", "http://localhost:8080", "Server URL")
+	statCmd.Flags().StringVar(&statToken, "token", "", "JWT authentication token")
+	statCmd.MarkFlagRequired("token")
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"zerodupe/pkg/client"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	statsServer string
+	statsToken  string
+	statsTop    int
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show deduplication statistics",
+	Long: `Show how much deduplication saves on your files: their logical bytes, the bytes of their
+distinct chunks, which are stored once, and the chunks most often referenced. Administrators
+also get the statistics of all files on the server and of its chunk store.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		c := client.NewClient(statsServer)
+		c.SetToken(statsToken)
+
+		stats, err := c.GetStats(statsTop)
+		if err != nil {
+			log.Fatalf("Failed to get stats: %v", err)
+		}
+
+		fmt.Printf("Files of %s:\n", stats.Username)
+		printStats(stats.User)
+		fmt.Printf("Unique bytes:   %s\n", formatBytes(stats.User.UniqueBytes))
+
+		if stats.Global != nil {
+			fmt.Println()
+			fmt.Println("All files:")
+			printStats(stats.Global.Stats)
+			if blocks := stats.Global.Blocks; blocks != nil {
+				fmt.Printf("Blocks:         %d, %d compressed, %s on disk\n", blocks.Blocks, blocks.CompressedBlocks, formatBytes(blocks.StoredBytes))
+			}
+			if cache := stats.Global.Cache; cache != nil {
+				fmt.Printf("Chunk cache:    %d hits, %d misses, %d evictions, %s of %s\n",
+					cache.Hits, cache.Misses, cache.Evictions, formatBytes(cache.Bytes), formatBytes(cache.MaxBytes))
+			}
+		}
+
+		printTopChunks("Most shared chunks of your files:", stats.User.TopChunks)
+		if stats.Global != nil {
+			printTopChunks("Most shared chunks of all files:", stats.Global.TopChunks)
+		}
+	},
+}
+
+// printStats prints the counts and dedup ratio of deduplication statistics
+func printStats(stats client.Stats) {
+	fmt.Printf("Files:          %d\n", stats.Files)
+	fmt.Printf("Chunks:         %d\n", stats.Chunks)
+	fmt.Printf("Logical bytes:  %s\n", formatBytes(stats.LogicalBytes))
+	fmt.Printf("Chunk bytes:    %s\n", formatBytes(stats.ChunkBytes))
+	fmt.Printf("Dedup ratio:    %.2fx (%s saved)\n", stats.DedupRatio, formatBytes(stats.LogicalBytes-stats.ChunkBytes))
+}
+
+// printTopChunks prints the most shared chunks, if there are any
+func printTopChunks(title string, chunks []client.ChunkRef) {
+	if len(chunks) == 0 {
+		return
+	}
+	fmt.Println()
+	fmt.Println(title)
+	for _, chunk := range chunks {
+		fmt.Printf("  %s  %d references  %s  %d users\n", chunk.ChunkHash, chunk.RefCount, formatBytes(chunk.Size), chunk.Users)
+	}
+}
+
+func init() {
+	statsCmd.Flags().StringVar(&statsServer, "server", "http://localhost:8080", "Server URL")
+	statsCmd.Flags().StringVar(&statsToken, "token", "", "JWT authentication token")
+	statsCmd.Flags().IntVar(&statsTop, "top", 10, "Number of most shared chunks to show (at most 100)")
+	statsCmd.MarkFlagRequired("token")
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"zerodupe/pkg/client"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	unshareServer string
+	unshareToken  string
+	unshareUser   string
+	unshareLink   string
+)
+
+var unshareCmd = &cobra.Command{
+	Use:   "unshare <filehash>",
+	Short: "Stop sharing a file with a user or through a link",
+	Long: `Take back the read access of a user to a file with --user, or delete a share link
+with --link and its token, as listed by the shares command.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if (unshareUser == "") == (unshareLink == "") {
+			log.Fatal("exactly one of --user and --link is required")
+		}
+		c := client.NewClient(unshareServer)
+		c.SetToken(unshareToken)
+
+		if unshareUser != "" {
+			if err := c.RevokeAccess(args[0], unshareUser); err != nil {
+				log.Fatalf("Failed to unshare file: %v", err)
+			}
+			fmt.Printf("Stopped sharing %s with %s\n", args[0], unshareUser)
+			return
+		}
+
+		if err := c.DeleteShareLink(args[0], unshareLink); err != nil {
+			log.Fatalf("Failed to delete share link: %v", err)
+		}
+		fmt.Printf("Deleted share link %s\n", unshareLink)
+	},
+}
+
+func init() {
+	unshareCmd.Flags().StringVar(&unshareServer, "server", "http://localhost:8080", "Server URL")
+	unshareCmd.Flags().StringVar(&unshareToken, "token", "", "JWT authentication token")
+	unshareCmd.Flags().StringVar(&unshareUser, "user", "", "User to take read access from")
+	unshareCmd.Flags().StringVar(&unshareLink, "link", "", "Token of the share link to delete")
+	unshareCmd.MarkFlagRequired("token")
+}
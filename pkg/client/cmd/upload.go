@@ -4,19 +4,30 @@ import (
 	"fmt"
 	"github.com/spf13/cobra"
 	"log"
+	"strings"
 	"zerodupe/pkg/client"
+	"zerodupe/pkg/hasher"
 )
 
 var (
 	uploadServer       string
 	uploadToken        string
 	uploadRefreshToken string
+	uploadChunker      string
+	uploadMinChunkSize int
+	uploadAvgChunkSize int
+	uploadMaxChunkSize int
+	uploadHash         string
+	uploadPath         string
 )
 
 var uploadCmd = &cobra.Command{
 	Use:   "upload <filepath>",
 	Short: "Upload a file to the server",
-	Args:  cobra.ExactArgs(1),
+	Long: `Upload a file to the server. With --path the file is also saved at that path of your
+directory tree, creating the missing directories. A path ending with a slash, or naming a
+directory, saves the file in it under its local name.`,
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		filePath := args[0]
 		fmt.Printf("Uploading file %s to %s\n", filePath, uploadServer)
@@ -24,8 +35,15 @@ var uploadCmd = &cobra.Command{
 		c := client.NewClient(uploadServer)
 		c.SetToken(uploadToken)
 
+		if err := c.SetChunkerConfig(uploadChunkerConfig()); err != nil {
+			log.Fatalf("Invalid chunker configuration: %v", err)
+		}
+		if err := c.SetHashAlgorithm(uploadHash); err != nil {
+			log.Fatalf("Invalid hash algorithm: %v", err)
+		}
+
 		err := c.ExecuteWithAuth(func() error {
-			return c.UploadFile(filePath)
+			return c.UploadFile(filePath, uploadPath)
 		})
 		if err != nil {
 			log.Fatalf("Failed to upload file: %v", err)
@@ -34,9 +52,28 @@ var uploadCmd = &cobra.Command{
 	},
 }
 
+// uploadChunkerConfig builds the chunker config from the upload flags
+func uploadChunkerConfig() hasher.ChunkerConfig {
+	if uploadChunker == hasher.ChunkerFixed {
+		return hasher.FixedChunkerConfig(uploadAvgChunkSize)
+	}
+	return hasher.ChunkerConfig{
+		Type:    uploadChunker,
+		MinSize: uploadMinChunkSize,
+		AvgSize: uploadAvgChunkSize,
+		MaxSize: uploadMaxChunkSize,
+	}
+}
+
 func init() {
 	uploadCmd.Flags().StringVar(&uploadServer, "server", "http://localhost:8080", "Server URL")
 	uploadCmd.Flags().StringVar(&uploadToken, "token", "", "JWT authentication token")
 	uploadCmd.Flags().StringVar(&uploadRefreshToken, "refresh-token", "", "Refresh token")
+	uploadCmd.Flags().StringVar(&uploadChunker, "chunker", hasher.ChunkerFixed, "Chunking algorithm (fixed or fastcdc)")
+	uploadCmd.Flags().IntVar(&uploadMinChunkSize, "min-chunk-size", hasher.DefaultMinChunkSize, "Minimum chunk size in bytes (fastcdc)")
+	uploadCmd.Flags().IntVar(&uploadAvgChunkSize, "avg-chunk-size", hasher.DefaultAvgChunkSize, "Average chunk size in bytes (chunk size for fixed)")
+	uploadCmd.Flags().IntVar(&uploadMaxChunkSize, "max-chunk-size", hasher.DefaultMaxChunkSize, "Maximum chunk size in bytes (fastcdc)")
+	uploadCmd.Flags().StringVar(&uploadHash, "hash", hasher.DefaultAlgorithm, "Hash algorithm ("+strings.Join(hasher.Algorithms(), ", ")+")")
+	uploadCmd.Flags().StringVar(&uploadPath, "path", "", "Path to save the file at, such as /docs/report.pdf")
 	uploadCmd.MarkFlagRequired("token")
 }
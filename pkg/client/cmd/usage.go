@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"zerodupe/pkg/client"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	usageServer string
+	usageToken  string
+	usageUser   string
+)
+
+var usageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "Show your storage usage and quota",
+	Long: `Show the storage accounted to you and your quota. Logical bytes are the sizes of the files
+you own, unique bytes the sizes of the chunks no other user's files reference. Administrators
+can show the usage of any user with --user.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		c := client.NewClient(usageServer)
+		c.SetToken(usageToken)
+
+		usage, err := c.GetUsage(usageUser)
+		if err != nil {
+			log.Fatalf("Failed to get usage: %v", err)
+		}
+
+		printUsage(usage)
+	},
+}
+
+// printUsage prints the usage and quota of a user
+func printUsage(usage *client.UsageResponse) {
+	fmt.Printf("User:          %s\n", usage.Username)
+	fmt.Printf("Files:         %d\n", usage.Usage.Files)
+	fmt.Printf("Chunks:        %d\n", usage.Usage.Chunks)
+	fmt.Printf("Logical bytes: %s of %s\n", formatBytes(usage.Usage.LogicalBytes), formatLimit(usage.Quota.LogicalBytes))
+	fmt.Printf("Unique bytes:  %s of %s\n", formatBytes(usage.Usage.UniqueBytes), formatLimit(usage.Quota.UniqueBytes))
+}
+
+// formatBytes formats a number of bytes with a binary unit
+func formatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit && bytes > -unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	value, exp := float64(bytes)/unit, 0
+	for value >= unit || value <= -unit {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGTPE"[exp])
+}
+
+// formatLimit formats a quota limit, where 0 is unlimited
+func formatLimit(limit int64) string {
+	if limit == 0 {
+		return "unlimited"
+	}
+	return formatBytes(limit)
+}
+
+func init() {
+	usageCmd.Flags().StringVar(&usageServer, "server", "http://localhost:8080", "Server URL")
+	usageCmd.Flags().StringVar(&usageToken, "token", "", "JWT authentication token")
+	usageCmd.Flags().StringVar(&usageUser, "user", "", "Show the usage of another user (administrators only)")
+	usageCmd.MarkFlagRequired("token")
+}
@@ -2,12 +2,23 @@ package client
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"sync"
 	"sync/atomic"
 	"time"
 	"zerodupe/pkg/hasher"
 )
 
+const (
+	// maxConcurrentDownloads bounds the number of chunk requests in flight
+	maxConcurrentDownloads = 5
+
+	// downloadWindow bounds the number of downloaded chunks held in memory while
+	// waiting for earlier chunks to be written
+	downloadWindow = 2 * maxConcurrentDownloads
+)
+
 // ChunkDownloader handles downloading chunks from server
 type ChunkDownloader struct {
 	api API
@@ -20,68 +31,144 @@ func NewDownloader(api API) *ChunkDownloader {
 	}
 }
 
-func (d *ChunkDownloader) DownloadChunks(hashes *DownloadFileHashesResponse) ([][]byte, error) {
+// DownloadToFile downloads the chunks of a file and writes them straight to disk.
+// Chunks are written to a temporary file next to outputPath as they arrive, each chunk and the
+// final file hash are verified, and the temporary file is renamed into place only on success.
+func (d *ChunkDownloader) DownloadToFile(hashes *DownloadFileHashesResponse, outputPath string) (err error) {
+	if len(hashes.ChunkHashes) != hashes.ChunksCount {
+		return fmt.Errorf("downloaded chunks count does not match expected count")
+	}
 
-	var wg sync.WaitGroup
-	resultChan := make(chan ChunkDownloadResult, len(hashes.ChunkHashes))
-	semaphore := make(chan struct{}, 5)
+	// the chunk list itself must hash to the requested file before any chunk is trusted
+	if !hasher.VerifyFileHash(hashes.FileHash, hashes.ChunkHashes) {
+		return fmt.Errorf("file hash mismatch. Expected: %s, Got: %s", hashes.FileHash, hasher.FileHashFromChunkHashes(hashes.ChunkHashes))
+	}
+	if len(hashes.Proofs) != 0 && len(hashes.Proofs) != len(hashes.ChunkHashes) {
+		return fmt.Errorf("downloaded proofs count does not match chunks count")
+	}
+	for i, proof := range hashes.Proofs {
+		if proof.Index != i {
+			return fmt.Errorf("proof %d is for chunk %d", i, proof.Index)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	tempFile, err := os.CreateTemp(filepath.Dir(outputPath), "."+filepath.Base(outputPath)+".*.part")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tempFile.Close()
+			os.Remove(tempFile.Name())
+		}
+	}()
 
-	var downloadContent atomic.Int32
+	if err := d.downloadChunks(hashes, tempFile); err != nil {
+		return err
+	}
+
+	if err := tempFile.Sync(); err != nil {
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+	if err := tempFile.Close(); err != nil {
+		return fmt.Errorf("failed to close file: %w", err)
+	}
+	if err := os.Rename(tempFile.Name(), outputPath); err != nil {
+		return fmt.Errorf("failed to move file into place: %w", err)
+	}
+
+	return nil
+}
+
+// downloadChunks downloads chunks concurrently and writes each verified chunk at its offset in file.
+// Offsets are known once all previous chunks have arrived, so at most downloadWindow chunks wait in memory.
+func (d *ChunkDownloader) downloadChunks(hashes *DownloadFileHashesResponse, file *os.File) error {
+	var wg sync.WaitGroup
 	totalChunks := len(hashes.ChunkHashes)
+	resultChan := make(chan ChunkDownloadResult, totalChunks)
+	semaphore := make(chan struct{}, maxConcurrentDownloads)
+	window := make(chan struct{}, downloadWindow)
+	done := make(chan struct{})
+	defer close(done)
+
+	var downloadedCount atomic.Int32
 	progressTicker := time.NewTicker(500 * time.Millisecond)
 	defer progressTicker.Stop()
 
-	go reportDownloadProgress(&downloadContent, totalChunks, progressTicker)
+	go reportDownloadProgress(&downloadedCount, totalChunks, progressTicker)
 
-	for i, hash := range hashes.ChunkHashes {
-		wg.Add(1)
-		chunkIndex := i
-		currentHash := hash
-		go func(hash string) {
-			defer wg.Done()
+	go func() {
+		defer func() {
+			wg.Wait()
+			close(resultChan)
+		}()
+
+		for i, hash := range hashes.ChunkHashes {
+			select {
+			case window <- struct{}{}:
+			case <-done:
+				return
+			}
 
-			semaphore <- struct{}{}
-			defer func() { <-semaphore }()
+			wg.Add(1)
+			go func(chunkIndex int, hash string) {
+				defer wg.Done()
 
-			fmt.Printf("Downloading chunk %d/%d with hash: %s\n", chunkIndex+1, hashes.ChunksCount, hash)
+				semaphore <- struct{}{}
+				defer func() { <-semaphore }()
 
-			response, err := d.api.DownloadChunk(hash)
+				fmt.Printf("Downloading chunk %d/%d with hash: %s\n", chunkIndex+1, totalChunks, hash)
 
-			if err == nil {
-				calculatedHash := hasher.CalculateChunkHash(response)
-				if calculatedHash != hash {
-					fmt.Printf("WARNING: Hash mismatch for chunk %d. Expected: %s, Got: %s\n",
-						chunkIndex+1, hash, calculatedHash)
+				response, err := d.api.DownloadChunk(hash)
+				if err == nil {
+					if isValid, calculatedHash := hasher.VerifyChunkHash(response, hash); !isValid {
+						err = fmt.Errorf("hash mismatch. Expected: %s, Got: %s", hash, calculatedHash)
+					} else if len(hashes.Proofs) != 0 && !hasher.VerifyMerkleProof(hashes.FileHash, hash, hashes.Proofs[chunkIndex]) {
+						err = fmt.Errorf("chunk %s is not part of file %s", hash, hashes.FileHash)
+					}
 				}
-			}
-
-			resultChan <- ChunkDownloadResult{
-				index:   chunkIndex,
-				content: response,
-				err:     err,
-			}
 
-		}(currentHash)
-	}
-
-	go func() {
-		wg.Wait()
-		close(resultChan)
+				resultChan <- ChunkDownloadResult{
+					index:   chunkIndex,
+					content: response,
+					err:     err,
+				}
+			}(i, hash)
+		}
 	}()
 
-	results := make([][]byte, len(hashes.ChunkHashes))
+	pending := make(map[int][]byte)
+	nextIndex := 0
+	var offset int64
+
 	for result := range resultChan {
 		if result.err != nil {
-			return nil, fmt.Errorf("failed to download chunk %d: %w", result.index+1, result.err)
+			return fmt.Errorf("failed to download chunk %d: %w", result.index+1, result.err)
+		}
+		pending[result.index] = result.content
+
+		// write every chunk whose offset is now known
+		for content, ok := pending[nextIndex]; ok; content, ok = pending[nextIndex] {
+			if _, err := file.WriteAt(content, offset); err != nil {
+				return fmt.Errorf("failed to write chunk %d: %w", nextIndex+1, err)
+			}
+			delete(pending, nextIndex)
+			offset += int64(len(content))
+			nextIndex++
+			downloadedCount.Add(1)
+			<-window
 		}
-		results[result.index] = result.content
 	}
 
-	if len(results) != hashes.ChunksCount {
-		return nil, fmt.Errorf("downloaded chunks count does not match expected count")
+	if nextIndex != totalChunks {
+		return fmt.Errorf("downloaded chunks count does not match expected count")
 	}
 
-	return results, nil
+	return nil
 }
 
 // reportDownloadProgress displays download progress at regular intervals
@@ -4,3 +4,36 @@ import "errors"
 
 // UnauthorizedError represents an authentication failure
 var UnauthorizedError = errors.New("unauthorized")
+
+// HashMismatchError represents a chunk rejected by the server because its content does not match its hash
+var HashMismatchError = errors.New("hash mismatch")
+
+// FileNotFoundError represents a file the server does not have
+var FileNotFoundError = errors.New("file not found")
+
+// QuotaExceededError represents an upload rejected because it would take the user over their quota
+var QuotaExceededError = errors.New("quota exceeded")
+
+// ForbiddenError represents a request only administrators may make
+var ForbiddenError = errors.New("forbidden")
+
+// UserNotFoundError represents a user the server does not have
+var UserNotFoundError = errors.New("user not found")
+
+// GrantNotFoundError represents a user that was not granted access to a file
+var GrantNotFoundError = errors.New("grant not found")
+
+// ShareLinkNotFoundError represents a share link the server does not have
+var ShareLinkNotFoundError = errors.New("share link not found")
+
+// PathNotFoundError represents a path with nothing at it in the namespace of the user
+var PathNotFoundError = errors.New("path not found")
+
+// ParentNotFoundError represents a path whose parent is not a directory
+var ParentNotFoundError = errors.New("parent directory not found")
+
+// PathExistsError represents a path that is already taken
+var PathExistsError = errors.New("path already exists")
+
+// DirectoryNotEmptyError represents a directory removed without the entries below it
+var DirectoryNotEmptyError = errors.New("directory not empty")
@@ -1,8 +1,15 @@
 package client
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"mime"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
+	"zerodupe/pkg/hasher"
 )
 
 // validateFile checks if a file exists or not
@@ -14,11 +21,75 @@ func validateFile(filePath string) error {
 	return nil
 }
 
-func getFileContent(filePath string) ([]byte, error) {
-	// check if file exists
-	if err := validateFile(filePath); err != nil {
-		return nil, err
+// detectContentType returns the MIME type of a file from its extension, or from its first bytes
+// if the extension is unknown
+func detectContentType(filePath string) (string, error) {
+	if contentType := mime.TypeByExtension(filepath.Ext(filePath)); contentType != "" {
+		return contentType, nil
 	}
 
-	return os.ReadFile(filePath)
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	return http.DetectContentType(head[:n]), nil
+}
+
+// safeFileName returns the last element of a file name recorded by the server, or an empty name
+// if it has none, so that a download never writes outside its output directory
+func safeFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == ".." || name == "/" {
+		return ""
+	}
+	return name
+}
+
+// scanFile streams a file through the chunker and returns its chunk hashes and file hash.
+// The returned chunks carry no data, so memory use does not grow with the file size.
+func scanFile(filePath string, config hasher.ChunkerConfig, algorithm string) ([]hasher.FileChunk, string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	reader, err := hasher.NewChunkReader(file, config, algorithm)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var chunks []hasher.FileChunk
+	for {
+		chunk, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, "", err
+		}
+
+		chunks = append(chunks, hasher.FileChunk{
+			ChunkHash:  chunk.ChunkHash,
+			ChunkOrder: chunk.ChunkOrder,
+		})
+	}
+
+	fileHash, err := reader.FileHash()
+	if err != nil {
+		return nil, "", err
+	}
+	return chunks, fileHash, nil
+}
+
+// IsRemotePath reports whether a file argument is a path in the namespace of the user rather than
+// a file hash. Paths are absolute, hashes never start with a slash.
+func IsRemotePath(file string) bool {
+	return strings.HasPrefix(file, "/")
 }
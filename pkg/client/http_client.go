@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 )
@@ -155,34 +156,34 @@ func (c *HTTPClient) addAuthHeader(req *http.Request) {
 	}
 }
 
-// checkFileExists checks if a file exists on the server
-func (c *HTTPClient) CheckFileExists(fileHash string) (bool, error) {
+// checkFileExists checks if a file exists on the server and if the caller owns it
+func (c *HTTPClient) CheckFileExists(fileHash string) (*FileExistsResponse, error) {
 	req, err := http.NewRequest("GET", c.serverURL+"/check/"+fileHash, nil)
 	if err != nil {
-		return false, fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	c.addAuthHeader(req)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return false, fmt.Errorf("failed to connect to server: %w", err)
+		return nil, fmt.Errorf("failed to connect to server: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusUnauthorized {
-		return false, UnauthorizedError
+		return nil, UnauthorizedError
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return false, fmt.Errorf("server error: %s", resp.Status)
+		return nil, fmt.Errorf("server error: %s", resp.Status)
 	}
 
 	var result FileExistsResponse
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return false, fmt.Errorf("failed to decode response: %w", err)
+		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	return result.Exists, nil
+	return &result, nil
 }
 
 // checkChunksExists checks if a list of chunks exists on the server and gets missing chunks from server
@@ -255,6 +256,14 @@ func (c *HTTPClient) UploadChunk(request ChunkUploadRequest) (*ChunkUploadRespon
 		return nil, UnauthorizedError
 	}
 
+	if resp.StatusCode == http.StatusUnprocessableEntity {
+		return nil, fmt.Errorf("%w: %s", HashMismatchError, result.Error)
+	}
+
+	if resp.StatusCode == http.StatusInsufficientStorage {
+		return nil, fmt.Errorf("%w: %s", QuotaExceededError, result.Error)
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("server error: %s", resp.Status)
 	}
@@ -323,3 +332,364 @@ func (c *HTTPClient) DownloadChunk(chunkHash string) ([]byte, error) {
 	return chunkContent, nil
 
 }
+
+// DeleteFile deletes a file from the server
+func (c *HTTPClient) DeleteFile(fileHash string) error {
+	req, err := http.NewRequest("DELETE", c.serverURL+"/files/"+fileHash, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	c.addAuthHeader(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to connect to server: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return UnauthorizedError
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return FileNotFoundError
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server error: %s", resp.Status)
+	}
+
+	return nil
+}
+
+// GetUsage gets the usage and quota of a user from the server, the caller's for an empty username
+func (c *HTTPClient) GetUsage(username string) (*UsageResponse, error) {
+	path := "/usage"
+	if username != "" {
+		path = "/users/" + url.PathEscape(username) + "/usage"
+	}
+	req, err := http.NewRequest("GET", c.serverURL+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	c.addAuthHeader(req)
+
+	return c.doUsageRequest(req)
+}
+
+// SetQuota sets the quota of a user on the server
+func (c *HTTPClient) SetQuota(username string, quota Quota) (*UsageResponse, error) {
+	jsonData, err := json.Marshal(quota)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+
+	req, err := http.NewRequest("PUT", c.serverURL+"/users/"+url.PathEscape(username)+"/quota", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	c.addAuthHeader(req)
+
+	return c.doUsageRequest(req)
+}
+
+// GetStats gets the deduplication statistics from the server
+func (c *HTTPClient) GetStats(top int) (*StatsResponse, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/stats?top=%d", c.serverURL, top), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	c.addAuthHeader(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to server: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return nil, UnauthorizedError
+	default:
+		return nil, fmt.Errorf("server error: %s", resp.Status)
+	}
+
+	var result StatsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &result, nil
+}
+
+// doUsageRequest sends a request answered with the usage of a user
+func (c *HTTPClient) doUsageRequest(req *http.Request) (*UsageResponse, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to server: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return nil, UnauthorizedError
+	case http.StatusForbidden:
+		return nil, ForbiddenError
+	case http.StatusNotFound:
+		return nil, UserNotFoundError
+	default:
+		return nil, fmt.Errorf("server error: %s", resp.Status)
+	}
+
+	var result UsageResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &result, nil
+}
+
+// GrantAccess gives another user read access to a file on the server
+func (c *HTTPClient) GrantAccess(fileHash, username string) (*GrantResponse, error) {
+	jsonData, err := json.Marshal(GrantRequest{Username: username})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", c.serverURL+"/files/"+url.PathEscape(fileHash)+"/grants", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	c.addAuthHeader(req)
+
+	var result GrantResponse
+	if err := c.doShareRequest(req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// RevokeAccess takes back the read access of a user to a file on the server
+func (c *HTTPClient) RevokeAccess(fileHash, username string) error {
+	req, err := http.NewRequest("DELETE", c.serverURL+"/files/"+url.PathEscape(fileHash)+"/grants/"+url.PathEscape(username), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	c.addAuthHeader(req)
+
+	return c.doShareRequest(req, nil)
+}
+
+// ListShares lists the users granted access to a file and its share links on the server
+func (c *HTTPClient) ListShares(fileHash string) (*SharesResponse, error) {
+	req, err := http.NewRequest("GET", c.serverURL+"/files/"+url.PathEscape(fileHash)+"/shares", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	c.addAuthHeader(req)
+
+	var result SharesResponse
+	if err := c.doShareRequest(req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// CreateShareLink creates a share link to a file on the server
+func (c *HTTPClient) CreateShareLink(fileHash string, request ShareLinkRequest) (*ShareLinkResponse, error) {
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", c.serverURL+"/files/"+url.PathEscape(fileHash)+"/links", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	c.addAuthHeader(req)
+
+	var result ShareLinkResponse
+	if err := c.doShareRequest(req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeleteShareLink deletes a share link to a file on the server
+func (c *HTTPClient) DeleteShareLink(fileHash, token string) error {
+	req, err := http.NewRequest("DELETE", c.serverURL+"/files/"+url.PathEscape(fileHash)+"/links/"+url.PathEscape(token), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	c.addAuthHeader(req)
+
+	return c.doShareRequest(req, nil)
+}
+
+// doShareRequest sends a request about the shares of a file and decodes the response into result,
+// unless it is nil. The server answers 404 for the file, the user, the grant or the link missing,
+// which the error message tells apart.
+func (c *HTTPClient) doShareRequest(req *http.Request, result interface{}) error {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to connect to server: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
+		if result == nil {
+			return nil
+		}
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+		return nil
+	}
+
+	var errorResponse struct {
+		Error string `json:"error"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&errorResponse)
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		return UnauthorizedError
+	case http.StatusBadRequest:
+		return fmt.Errorf("invalid request: %s", errorResponse.Error)
+	case http.StatusNotFound:
+		switch errorResponse.Error {
+		case "User not found":
+			return UserNotFoundError
+		case "Grant not found":
+			return GrantNotFoundError
+		case "Share link not found":
+			return ShareLinkNotFoundError
+		}
+		return FileNotFoundError
+	default:
+		return fmt.Errorf("server error: %s", resp.Status)
+	}
+}
+
+// Mkdir creates a directory on the server
+func (c *HTTPClient) Mkdir(dirPath string, parents bool) (*PathEntry, error) {
+	var result PathEntry
+	if err := c.doPathRequest("POST", "/fs/mkdir", MkdirRequest{Path: dirPath, Parents: parents}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ListDirectory lists a directory on the server
+func (c *HTTPClient) ListDirectory(dirPath string) (*ListDirectoryResponse, error) {
+	var result ListDirectoryResponse
+	if err := c.doPathRequest("GET", "/fs/ls?path="+url.QueryEscape(dirPath), nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// StatPath describes a path on the server
+func (c *HTTPClient) StatPath(entryPath string) (*PathEntry, error) {
+	var result PathEntry
+	if err := c.doPathRequest("GET", "/fs/stat?path="+url.QueryEscape(entryPath), nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// MovePath moves a path on the server
+func (c *HTTPClient) MovePath(fromPath, toPath string) (*PathEntry, error) {
+	var result PathEntry
+	if err := c.doPathRequest("POST", "/fs/mv", MoveRequest{From: fromPath, To: toPath}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// RemovePath removes a path on the server
+func (c *HTTPClient) RemovePath(entryPath string, recursive bool) (*RemovePathResponse, error) {
+	var result RemovePathResponse
+	query := fmt.Sprintf("/fs/rm?path=%s&recursive=%t", url.QueryEscape(entryPath), recursive)
+	if err := c.doPathRequest("DELETE", query, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SaveFilePath saves a file at a path on the server
+func (c *HTTPClient) SaveFilePath(filePath, fileHash string) (*PathEntry, error) {
+	var result PathEntry
+	if err := c.doPathRequest("PUT", "/fs/files", SaveFileRequest{Path: filePath, FileHash: fileHash}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// doPathRequest sends a namespace request with an optional JSON body and decodes the response
+// into result. The server answers 404 and 409 for several reasons, which the error message
+// tells apart.
+func (c *HTTPClient) doPathRequest(method, path string, body interface{}, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		jsonData, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		reader = bytes.NewBuffer(jsonData)
+	}
+
+	req, err := http.NewRequest(method, c.serverURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	c.addAuthHeader(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to connect to server: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+		return nil
+	}
+
+	var errorResponse struct {
+		Error string `json:"error"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&errorResponse)
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		return UnauthorizedError
+	case http.StatusBadRequest:
+		return fmt.Errorf("invalid request: %s", errorResponse.Error)
+	case http.StatusNotFound:
+		switch errorResponse.Error {
+		case "Parent directory not found":
+			return ParentNotFoundError
+		case "File not found":
+			return FileNotFoundError
+		}
+		return PathNotFoundError
+	case http.StatusConflict:
+		if errorResponse.Error == "Directory not empty" {
+			return DirectoryNotEmptyError
+		}
+		return PathExistsError
+	default:
+		return fmt.Errorf("server error: %s", resp.Status)
+	}
+}
@@ -1,24 +1,36 @@
 package client
 
+import (
+	"time"
+	"zerodupe/pkg/hasher"
+)
+
 // ChunkUploadRequest represents a request to upload a chunk to the server
 type ChunkUploadRequest struct {
 	FileHash   string `json:"file_hash" binding:"required"`
 	ChunkHash  string `json:"chunk_hash" binding:"required"`
 	ChunkOrder int    `json:"chunk_order" binding:"required"`
+	Chunker    string `json:"chunker"`
 	Content    []byte `json:"content"`
+	// TotalChunks is the number of chunks of the file, so the server verifies it once it has them all
+	TotalChunks int `json:"total_chunks"`
+	// FileName and ContentType describe the file; the server records them from the first upload of a file
+	FileName    string `json:"file_name"`
+	ContentType string `json:"content_type"`
 }
 
 // ChunkUploadResponse represents a response from the server after uploading a chunk
 type ChunkUploadResponse struct {
-	Message      string `json:"message"`
-	FileHash     string `json:"fileHash"`
-	HashMismatch bool   `json:"hashMismatch"`
+	Message  string `json:"message"`
+	FileHash string `json:"file_hash"`
+	Error    string `json:"error"`
 }
 
 // FileExistsResponse represents a response from the server when checking if a file exists
 type FileExistsResponse struct {
 	Exists bool   `json:"exists"`
 	Hash   string `json:"hash"`
+	Owned  bool   `json:"owned"`
 }
 
 // MissingChunksRequest represents a request to check if chunks exist on the server
@@ -33,9 +45,25 @@ type MissingChunksResponse struct {
 }
 
 type DownloadFileHashesResponse struct {
-	FileHash    string   `json:"filehash" binding:"required"`
-	ChunkHashes []string `json:"chunk_hashes"`
-	ChunksCount int      `json:"chunks_count"`
+	FileHash    string               `json:"file_hash" binding:"required"`
+	ChunkHashes []string             `json:"chunk_hashes"`
+	ChunksCount int                  `json:"chunks_count"`
+	Chunker     string               `json:"chunker"`
+	Proofs      []hasher.MerkleProof `json:"proofs"`
+	Damaged     bool                 `json:"damaged"`
+	Size        int64                `json:"size"`
+	Name        string               `json:"name"`
+	ContentType string               `json:"content_type"`
+	CreatedAt   *time.Time           `json:"created_at"`
+	Uploader    string               `json:"uploader"`
+	Chunks      []ChunkInfo          `json:"chunks"`
+}
+
+// ChunkInfo describes a chunk of a file and where it starts in the file
+type ChunkInfo struct {
+	ChunkHash string `json:"chunk_hash"`
+	Size      int64  `json:"size"`
+	Offset    int64  `json:"offset"`
 }
 
 // ChunkDownloadResult represents the result of downloading a chunk
@@ -45,6 +73,161 @@ type ChunkDownloadResult struct {
 	err     error
 }
 
+// Usage represents the storage accounted to a user
+type Usage struct {
+	Files        int64 `json:"files"`
+	Chunks       int64 `json:"chunks"`
+	ChunkBytes   int64 `json:"chunk_bytes"`   // size of the distinct chunks of the user's files
+	LogicalBytes int64 `json:"logical_bytes"` // sum of the sizes of the user's files
+	UniqueBytes  int64 `json:"unique_bytes"`  // size of the chunks no other user's files reference
+}
+
+// Quota represents the limits of a user's storage in bytes, 0 is unlimited in responses
+type Quota struct {
+	LogicalBytes int64 `json:"logical_bytes"`
+	UniqueBytes  int64 `json:"unique_bytes"`
+}
+
+// UsageResponse represents a response from the server with the usage and quota of a user
+type UsageResponse struct {
+	Username string `json:"username"`
+	Usage    Usage  `json:"usage"`
+	Quota    Quota  `json:"quota"`
+}
+
+// ChunkRef represents a chunk and the number of references to it
+type ChunkRef struct {
+	ChunkHash string `json:"chunk_hash"`
+	RefCount  int    `json:"ref_count"` // references from the chunk lists of files
+	Size      int64  `json:"size"`
+	Users     int    `json:"users"` // users owning a file that references the chunk
+}
+
+// Stats represents deduplication statistics of all files, or of the files of one user
+type Stats struct {
+	Files        int64      `json:"files"`
+	Chunks       int64      `json:"chunks"`        // distinct chunks of the files
+	ChunkBytes   int64      `json:"chunk_bytes"`   // size of the distinct chunks, each stored once
+	LogicalBytes int64      `json:"logical_bytes"` // sum of the sizes of the files
+	UniqueBytes  int64      `json:"unique_bytes"`  // size of the chunks only the user references
+	DedupRatio   float64    `json:"dedup_ratio"`   // logical bytes per chunk byte
+	TopChunks    []ChunkRef `json:"top_chunks"`
+}
+
+// BlockStats represents the stats of the blocks of a filesystem chunk store
+type BlockStats struct {
+	Blocks           int64 `json:"blocks"`
+	CompressedBlocks int64 `json:"compressed_blocks"`
+	LogicalBytes     int64 `json:"logical_bytes"` // size of the chunks before compression
+	StoredBytes      int64 `json:"stored_bytes"`  // size of the blocks on disk
+}
+
+// CacheStats represents the stats of the server's chunk cache
+type CacheStats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	Entries   int   `json:"entries"`
+	Bytes     int64 `json:"bytes"`
+	MaxBytes  int64 `json:"max_bytes"`
+}
+
+// GlobalStats represents deduplication statistics of all files and the stats of the chunk store
+type GlobalStats struct {
+	Stats
+	Blocks *BlockStats `json:"blocks"` // nil without a filesystem chunk store
+	Cache  *CacheStats `json:"cache"`  // nil without a chunk cache
+}
+
+// StatsResponse represents a response from the server with deduplication statistics
+type StatsResponse struct {
+	Username string       `json:"username"`
+	User     Stats        `json:"user"`
+	Global   *GlobalStats `json:"global"` // only for administrators
+}
+
+// GrantRequest represents a request to grant a user read access to a file
+type GrantRequest struct {
+	Username string `json:"username"`
+}
+
+// GrantResponse describes a user granted read access to a file
+type GrantResponse struct {
+	Username  string    `json:"username"`
+	GrantedAt time.Time `json:"granted_at"`
+}
+
+// ShareLinkRequest represents a request to create a share link to a file
+type ShareLinkRequest struct {
+	ExpiresIn string `json:"expires_in,omitempty"` // the server's default if empty
+	Password  string `json:"password,omitempty"`
+}
+
+// ShareLinkResponse describes a share link to a file
+type ShareLinkResponse struct {
+	Token     string    `json:"token"`
+	Path      string    `json:"path"` // serves the file without authentication, relative to the server URL
+	Protected bool      `json:"protected"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Expired   bool      `json:"expired"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SharesResponse lists the users granted access to a file and its share links
+type SharesResponse struct {
+	FileHash string              `json:"file_hash"`
+	Grants   []GrantResponse     `json:"grants"`
+	Links    []ShareLinkResponse `json:"links"`
+}
+
+// MkdirRequest represents a request to create a directory
+type MkdirRequest struct {
+	Path    string `json:"path"`
+	Parents bool   `json:"parents"`
+}
+
+// MoveRequest represents a request to move a file or directory
+type MoveRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// SaveFileRequest represents a request to save a file at a path
+type SaveFileRequest struct {
+	Path     string `json:"path"`
+	FileHash string `json:"file_hash"`
+}
+
+// PathEntry describes a directory or a file in the namespace of the user
+type PathEntry struct {
+	Path        string     `json:"path"`
+	Name        string     `json:"name"`
+	Type        string     `json:"type"` // "dir" or "file"
+	FileHash    string     `json:"file_hash"`
+	Size        int64      `json:"size"`
+	ContentType string     `json:"content_type"`
+	CreatedAt   *time.Time `json:"created_at"`
+	UpdatedAt   *time.Time `json:"updated_at"`
+}
+
+// IsDir reports whether the entry is a directory
+func (entry *PathEntry) IsDir() bool {
+	return entry.Type == "dir"
+}
+
+// ListDirectoryResponse lists the entries of a directory, or the file at a path
+type ListDirectoryResponse struct {
+	Path    string      `json:"path"`
+	Entries []PathEntry `json:"entries"`
+}
+
+// RemovePathResponse represents a response to a path removal request
+type RemovePathResponse struct {
+	Message string `json:"message"`
+	Path    string `json:"path"`
+	Removed int64  `json:"removed"`
+}
+
 // AuthResponse represents a response from authentication endpoints
 type AuthResponse struct {
 	AccessToken  string `json:"access_token"`
@@ -1,13 +1,18 @@
 package client
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"sync"
 	"sync/atomic"
 	"time"
 	"zerodupe/pkg/hasher"
 )
 
+// maxConcurrentUploads bounds the number of chunks held in memory while uploading
+const maxConcurrentUploads = 5
+
 // ChunkUploader handles uploading chunks to the server
 type ChunkUploader struct {
 	api API
@@ -20,76 +25,86 @@ func NewUploader(api API) *ChunkUploader {
 	}
 }
 
-// UploadChunks uploads all chunks to the server
-func (u *ChunkUploader) UploadChunks(chunks []hasher.FileChunk, fileHash string, filePath string, existingChunks map[string]bool) error {
-	if existingChunks == nil {
-		return nil
-	}
-
+// UploadChunks streams chunks from reader and uploads them to the server.
+// expectedChunks are the chunks computed when the file was first scanned; a chunk that no longer
+// matches means the file changed during the upload. Chunks in existingChunks are sent as metadata only.
+// The file hash, chunker, name and content type of file are sent with every chunk.
+func (u *ChunkUploader) UploadChunks(reader *hasher.ChunkReader, expectedChunks []hasher.FileChunk, file ChunkUploadRequest, existingChunks map[string]bool) error {
 	var wg sync.WaitGroup
-	errChan := make(chan error, len(chunks))
-	semaphore := make(chan struct{}, 5)
+	errChan := make(chan error, len(expectedChunks)+1)
+	semaphore := make(chan struct{}, maxConcurrentUploads)
+	var failed atomic.Bool
 
 	var uploadedCount atomic.Int32
-	totalChunks := len(chunks)
+	totalChunks := len(expectedChunks)
 	progressTicker := time.NewTicker(500 * time.Millisecond)
 	defer progressTicker.Stop()
 
 	go reportUploadProgress(&uploadedCount, totalChunks, progressTicker)
 
-	for i, chunk := range chunks {
+	for !failed.Load() {
+		// acquire a slot before reading so at most maxConcurrentUploads chunks are in memory
+		semaphore <- struct{}{}
 
-		wg.Add(1)
-		chunkIndex := i
-		currentChunk := chunk
+		chunk, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			<-semaphore
+			break
+		} else if err != nil {
+			<-semaphore
+			errChan <- fmt.Errorf("failed to read chunk: %w", err)
+			break
+		}
 
-		go func() {
-			defer wg.Done()
+		if chunk.ChunkOrder > totalChunks || expectedChunks[chunk.ChunkOrder-1].ChunkHash != chunk.ChunkHash {
+			<-semaphore
+			errChan <- fmt.Errorf("file changed during upload at chunk %d", chunk.ChunkOrder)
+			break
+		}
 
-			semaphore <- struct{}{}
+		wg.Add(1)
+		go func(currentChunk *hasher.FileChunk) {
+			defer wg.Done()
 			defer func() { <-semaphore }()
 
 			var content []byte
 
 			if existingChunks[currentChunk.ChunkHash] {
 				fmt.Printf("Chunk %d/%d (Hash: %s) already exists. Sending metadata only.\n",
-					i+1, len(chunks), currentChunk.ChunkHash)
+					currentChunk.ChunkOrder, totalChunks, currentChunk.ChunkHash)
 				content = nil
 			} else {
 				fmt.Printf("Uploading chunk %d/%d (Order: %d, Size: %d bytes, Hash: %s)\n",
-					i+1, len(chunks), currentChunk.ChunkOrder, len(currentChunk.Data), currentChunk.ChunkHash)
+					currentChunk.ChunkOrder, totalChunks, currentChunk.ChunkOrder, len(currentChunk.Data), currentChunk.ChunkHash)
 				content = currentChunk.Data
 			}
 
-			request := ChunkUploadRequest{
-				FileHash:   fileHash,
-				ChunkHash:  currentChunk.ChunkHash,
-				ChunkOrder: currentChunk.ChunkOrder,
-				Content:    content,
-			}
+			request := file
+			request.ChunkHash = currentChunk.ChunkHash
+			request.ChunkOrder = currentChunk.ChunkOrder
+			request.Content = content
 
-			response, err := u.api.UploadChunk(request)
-			if err != nil {
-				errChan <- fmt.Errorf("failed to upload chunk %d: %w", chunkIndex+1, err)
+			if _, err := u.api.UploadChunk(request); err != nil {
+				failed.Store(true)
+				errChan <- fmt.Errorf("failed to upload chunk %d: %w", currentChunk.ChunkOrder, err)
 				return
 			}
-
-			if response.HashMismatch {
-				fmt.Printf("WARNING: Server detected hash mismatch for chunk %s\n", currentChunk.ChunkHash)
-			}
-
-		}()
-
+			uploadedCount.Add(1)
+		}(chunk)
 	}
 
 	wg.Wait()
 	close(errChan)
-	fmt.Printf("\rUpload complete: %d/%d chunks (100%%)      \n", totalChunks, totalChunks)
 
 	for err := range errChan {
 		return err
 	}
 
+	if reader.ChunksCount() != totalChunks {
+		return fmt.Errorf("file changed during upload: expected %d chunks, read %d", totalChunks, reader.ChunksCount())
+	}
+
+	fmt.Printf("\rUpload complete: %d/%d chunks (100%%)      \n", totalChunks, totalChunks)
 	return nil
 }
 
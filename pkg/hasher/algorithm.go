@@ -0,0 +1,167 @@
+package hasher
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+	"sync"
+
+	"lukechampine.com/blake3"
+)
+
+// Built-in hash algorithms
+const (
+	SHA256     = "sha256"
+	SHA512_256 = "sha512-256"
+	BLAKE3     = "blake3"
+)
+
+// DefaultAlgorithm is the algorithm used for new hashes unless another one is selected
+const DefaultAlgorithm = SHA256
+
+// hashSeparator separates the algorithm name from the hex digest in a hash identifier
+const hashSeparator = ":"
+
+// Algorithm describes a hash algorithm usable for chunk and file hashes
+type Algorithm struct {
+	Name string
+	New  func() hash.Hash
+}
+
+var (
+	algorithmsMu sync.RWMutex
+	algorithms   = make(map[string]Algorithm)
+)
+
+func init() {
+	RegisterAlgorithm(SHA256, sha256.New)
+	RegisterAlgorithm(SHA512_256, sha512.New512_256)
+	RegisterAlgorithm(BLAKE3, func() hash.Hash { return blake3.New(32, nil) })
+}
+
+// RegisterAlgorithm makes a hash algorithm available under the given name.
+// Registering a name twice replaces the previous algorithm.
+func RegisterAlgorithm(name string, newHash func() hash.Hash) {
+	if name == "" || strings.Contains(name, hashSeparator) {
+		panic(fmt.Sprintf("hasher: invalid algorithm name %q", name))
+	}
+
+	algorithmsMu.Lock()
+	defer algorithmsMu.Unlock()
+	algorithms[name] = Algorithm{Name: name, New: newHash}
+}
+
+// LookupAlgorithm returns the registered algorithm with the given name
+func LookupAlgorithm(name string) (Algorithm, error) {
+	algorithmsMu.RLock()
+	defer algorithmsMu.RUnlock()
+
+	algorithm, ok := algorithms[name]
+	if !ok {
+		return Algorithm{}, fmt.Errorf("unknown hash algorithm %q", name)
+	}
+	return algorithm, nil
+}
+
+// Algorithms returns the names of all registered algorithms
+func Algorithms() []string {
+	algorithmsMu.RLock()
+	defer algorithmsMu.RUnlock()
+
+	names := make([]string, 0, len(algorithms))
+	for name := range algorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Sum computes the self-describing hash identifier ("<algorithm>:<hex digest>") of data
+func Sum(algorithm string, data []byte) (string, error) {
+	alg, err := LookupAlgorithm(algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	hasher := alg.New()
+	hasher.Write(data)
+	return FormatHash(algorithm, hex.EncodeToString(hasher.Sum(nil))), nil
+}
+
+// FormatHash builds a hash identifier from an algorithm name and a hex digest
+func FormatHash(algorithm, digest string) string {
+	return algorithm + hashSeparator + digest
+}
+
+// ParseHash splits a hash identifier into its algorithm name and hex digest.
+// Bare hex identifiers are legacy SHA-256 hashes from before identifiers carried their algorithm.
+func ParseHash(id string) (string, string, error) {
+	algorithm, digest, found := strings.Cut(id, hashSeparator)
+	if !found {
+		algorithm, digest = SHA256, id
+	}
+
+	alg, err := LookupAlgorithm(algorithm)
+	if err != nil {
+		return "", "", err
+	}
+
+	decoded, err := hex.DecodeString(digest)
+	if err != nil || len(decoded) != alg.New().Size() {
+		return "", "", fmt.Errorf("invalid %s digest in hash %q", algorithm, id)
+	}
+	if digest != strings.ToLower(digest) {
+		return "", "", fmt.Errorf("hash digest must be lowercase hex: %q", id)
+	}
+
+	return algorithm, digest, nil
+}
+
+// IsLegacyHash reports whether id is a bare hex identifier without an algorithm prefix
+func IsLegacyHash(id string) bool {
+	return !strings.Contains(id, hashSeparator)
+}
+
+// CanonicalHash returns the prefixed form of a hash identifier, so a legacy bare SHA-256
+// hash and its "sha256:" form compare equal. Unparseable identifiers are returned unchanged.
+func CanonicalHash(id string) string {
+	algorithm, digest, err := ParseHash(id)
+	if err != nil {
+		return id
+	}
+	return FormatHash(algorithm, digest)
+}
+
+// HashVariants returns every spelling of a hash identifier that refers to the same content,
+// for looking up hashes stored before identifiers carried their algorithm.
+func HashVariants(id string) []string {
+	canonical := CanonicalHash(id)
+	if algorithm, digest, err := ParseHash(canonical); err == nil && algorithm == SHA256 {
+		return []string{canonical, digest}
+	}
+	return []string{canonical}
+}
+
+// EqualHashes reports whether two hash identifiers refer to the same content
+func EqualHashes(a, b string) bool {
+	return CanonicalHash(a) == CanonicalHash(b)
+}
+
+// hashLike computes the hash of data using the algorithm and spelling of reference:
+// legacy bare hex for legacy identifiers and the prefixed form otherwise.
+func hashLike(reference string, data []byte) string {
+	if IsLegacyHash(reference) {
+		return CalculateChunkHash(data)
+	}
+
+	algorithm, _, _ := strings.Cut(reference, hashSeparator)
+	id, err := Sum(algorithm, data)
+	if err != nil {
+		return CalculateChunkHash(data)
+	}
+	return id
+}
@@ -0,0 +1,122 @@
+package hasher
+
+import (
+	"crypto/md5"
+	"strings"
+	"testing"
+)
+
+func TestSum(t *testing.T) {
+	t.Run("Test Sum prefixes the digest with the algorithm name", func(t *testing.T) {
+		id, err := Sum(SHA256, []byte("hello world"))
+		if err != nil {
+			t.Fatalf("Failed to hash data: %v", err)
+		}
+		expected := "sha256:b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+		if id != expected {
+			t.Errorf("Expected hash %s, got %s", expected, id)
+		}
+	})
+
+	t.Run("Test Sum supports all built-in algorithms", func(t *testing.T) {
+		for _, algorithm := range []string{SHA256, SHA512_256, BLAKE3} {
+			id, err := Sum(algorithm, []byte("hello world"))
+			if err != nil {
+				t.Fatalf("Failed to hash data with %s: %v", algorithm, err)
+			}
+			if !strings.HasPrefix(id, algorithm+":") {
+				t.Errorf("Expected %s prefix, got %s", algorithm, id)
+			}
+			if _, _, err := ParseHash(id); err != nil {
+				t.Errorf("Expected %s to parse, got %v", id, err)
+			}
+		}
+	})
+
+	t.Run("Test Sum returns error for unknown algorithm", func(t *testing.T) {
+		if _, err := Sum("md4", []byte("hello world")); err == nil {
+			t.Errorf("Expected error for unknown algorithm")
+		}
+	})
+
+	t.Run("Test RegisterAlgorithm makes a new algorithm available", func(t *testing.T) {
+		RegisterAlgorithm("md5-test", md5.New)
+		id, err := Sum("md5-test", []byte("hello world"))
+		if err != nil {
+			t.Fatalf("Failed to hash data: %v", err)
+		}
+		if id != "md5-test:5eb63bbbe01eeed093cb22bb8f5acdc3" {
+			t.Errorf("Unexpected hash %s", id)
+		}
+	})
+}
+
+func TestParseHash(t *testing.T) {
+	legacy := CalculateChunkHash([]byte("hello world"))
+
+	t.Run("Test ParseHash treats bare hex as legacy SHA-256", func(t *testing.T) {
+		algorithm, digest, err := ParseHash(legacy)
+		if err != nil {
+			t.Fatalf("Failed to parse hash: %v", err)
+		}
+		if algorithm != SHA256 || digest != legacy {
+			t.Errorf("Expected sha256 %s, got %s %s", legacy, algorithm, digest)
+		}
+	})
+
+	t.Run("Test ParseHash rejects malformed identifiers", func(t *testing.T) {
+		for _, id := range []string{"", "incorrectHash", "sha256:abcd", "blake3:" + legacy + "00", "md4:" + legacy, "sha256:" + strings.ToUpper(legacy)} {
+			if _, _, err := ParseHash(id); err == nil {
+				t.Errorf("Expected error for hash %q", id)
+			}
+		}
+	})
+
+	t.Run("Test legacy and prefixed SHA-256 hashes are equal", func(t *testing.T) {
+		if !EqualHashes(legacy, "sha256:"+legacy) {
+			t.Errorf("Expected legacy and prefixed hashes to be equal")
+		}
+		if EqualHashes(legacy, "blake3:"+legacy) {
+			t.Errorf("Expected hashes of different algorithms to differ")
+		}
+
+		variants := HashVariants(legacy)
+		if len(variants) != 2 || variants[0] != "sha256:"+legacy || variants[1] != legacy {
+			t.Errorf("Unexpected variants %v", variants)
+		}
+	})
+}
+
+func TestVerifyChunkHashWithAlgorithms(t *testing.T) {
+	data := []byte("hello world")
+
+	t.Run("Test VerifyChunkHash uses the algorithm of the expected hash", func(t *testing.T) {
+		for _, algorithm := range []string{SHA256, SHA512_256, BLAKE3} {
+			id, _ := Sum(algorithm, data)
+			isValid, actualHash := VerifyChunkHash(data, id)
+			if !isValid || actualHash != id {
+				t.Errorf("Expected %s to verify, got %s", id, actualHash)
+			}
+		}
+	})
+
+	t.Run("Test VerifyChunkHash detects corrupted data", func(t *testing.T) {
+		id, _ := Sum(BLAKE3, data)
+		isValid, actualHash := VerifyChunkHash([]byte("hello world!"), id)
+		if isValid {
+			t.Errorf("Expected invalid hash")
+		}
+		if !strings.HasPrefix(actualHash, BLAKE3+":") {
+			t.Errorf("Expected actual hash in blake3 format, got %s", actualHash)
+		}
+	})
+
+	t.Run("Test FileHashFromChunkHashes keeps the chunk hash algorithm", func(t *testing.T) {
+		hash1, _ := Sum(BLAKE3, []byte("a"))
+		hash2, _ := Sum(BLAKE3, []byte("b"))
+		fileHash := FileHashFromChunkHashes([]string{hash1, hash2})
+		if !strings.HasPrefix(fileHash, BLAKE3+":") {
+			t.Errorf("Expected blake3 file hash, got %s", fileHash)
+		}
+	})
+}
@@ -0,0 +1,228 @@
+package hasher
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// Supported chunker types
+const (
+	ChunkerFixed   = "fixed"
+	ChunkerFastCDC = "fastcdc"
+)
+
+// Default size bounds for content-defined chunking
+const (
+	DefaultMinChunkSize = 256 * 1024
+	DefaultAvgChunkSize = 1 * 1024 * 1024
+	DefaultMaxChunkSize = 4 * 1024 * 1024
+)
+
+// minAllowedChunkSize is the smallest chunk size a chunker can be configured with
+const minAllowedChunkSize = 64
+
+// MaxAllowedChunkSize is the largest chunk size a chunker can be configured with. Readers hold a
+// buffer of the largest chunk and uploads send whole chunks, so it bounds the memory of both.
+const MaxAllowedChunkSize = 64 * 1024 * 1024
+
+// ChunkerConfig describes how a file is split into chunks.
+// Its string form ("fixed:1048576", "fastcdc:262144:1048576:4194304") is
+// stored with the file metadata so downloads know which chunker produced a manifest.
+type ChunkerConfig struct {
+	Type    string
+	MinSize int
+	AvgSize int
+	MaxSize int
+}
+
+// Chunker finds chunk boundaries in a byte stream
+type Chunker interface {
+	// Cut returns the length of the next chunk at the start of data.
+	// data holds at least MaxChunkSize bytes unless it is the end of the stream.
+	Cut(data []byte) int
+
+	// MaxChunkSize returns the largest chunk the chunker can produce
+	MaxChunkSize() int
+}
+
+// DefaultChunkerConfig returns the fixed-size chunker config used by default
+func DefaultChunkerConfig() ChunkerConfig {
+	return FixedChunkerConfig(ChunkSizeBytes)
+}
+
+// FixedChunkerConfig returns a config that cuts chunks of exactly size bytes
+func FixedChunkerConfig(size int) ChunkerConfig {
+	return ChunkerConfig{Type: ChunkerFixed, MinSize: size, AvgSize: size, MaxSize: size}
+}
+
+// FastCDCChunkerConfig returns a content-defined chunker config with the given bounds
+func FastCDCChunkerConfig(minSize, avgSize, maxSize int) ChunkerConfig {
+	return ChunkerConfig{Type: ChunkerFastCDC, MinSize: minSize, AvgSize: avgSize, MaxSize: maxSize}
+}
+
+// String encodes the config in the form stored in file metadata
+func (c ChunkerConfig) String() string {
+	if c.Type == ChunkerFixed {
+		return fmt.Sprintf("%s:%d", c.Type, c.AvgSize)
+	}
+	return fmt.Sprintf("%s:%d:%d:%d", c.Type, c.MinSize, c.AvgSize, c.MaxSize)
+}
+
+// Validate checks that the chunk size bounds are usable
+func (c ChunkerConfig) Validate() error {
+	switch c.Type {
+	case ChunkerFixed:
+		if c.AvgSize < minAllowedChunkSize {
+			return fmt.Errorf("chunk size must be at least %d bytes", minAllowedChunkSize)
+		}
+		if c.AvgSize > MaxAllowedChunkSize {
+			return fmt.Errorf("chunk size must be at most %d bytes", MaxAllowedChunkSize)
+		}
+	case ChunkerFastCDC:
+		if c.MinSize < minAllowedChunkSize {
+			return fmt.Errorf("min chunk size must be at least %d bytes", minAllowedChunkSize)
+		}
+		if c.MinSize > c.AvgSize || c.AvgSize > c.MaxSize {
+			return fmt.Errorf("chunk sizes must satisfy min <= avg <= max")
+		}
+		if c.MaxSize > MaxAllowedChunkSize {
+			return fmt.Errorf("max chunk size must be at most %d bytes", MaxAllowedChunkSize)
+		}
+	default:
+		return fmt.Errorf("unknown chunker type %q", c.Type)
+	}
+	return nil
+}
+
+// ParseChunkerConfig parses the string form of a chunker config.
+// A bare type name ("fixed", "fastcdc") selects the default sizes for that type.
+func ParseChunkerConfig(s string) (ChunkerConfig, error) {
+	parts := strings.Split(s, ":")
+	sizes := make([]int, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		size, err := strconv.Atoi(part)
+		if err != nil {
+			return ChunkerConfig{}, fmt.Errorf("invalid chunk size %q in chunker %q", part, s)
+		}
+		sizes = append(sizes, size)
+	}
+
+	var config ChunkerConfig
+	switch {
+	case parts[0] == ChunkerFixed && len(sizes) == 0:
+		config = DefaultChunkerConfig()
+	case parts[0] == ChunkerFixed && len(sizes) == 1:
+		config = FixedChunkerConfig(sizes[0])
+	case parts[0] == ChunkerFastCDC && len(sizes) == 0:
+		config = FastCDCChunkerConfig(DefaultMinChunkSize, DefaultAvgChunkSize, DefaultMaxChunkSize)
+	case parts[0] == ChunkerFastCDC && len(sizes) == 3:
+		config = FastCDCChunkerConfig(sizes[0], sizes[1], sizes[2])
+	default:
+		return ChunkerConfig{}, fmt.Errorf("invalid chunker %q", s)
+	}
+
+	if err := config.Validate(); err != nil {
+		return ChunkerConfig{}, err
+	}
+	return config, nil
+}
+
+// NewChunker creates the chunker described by the config
+func NewChunker(config ChunkerConfig) (Chunker, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	if config.Type == ChunkerFixed {
+		return &fixedChunker{size: config.AvgSize}, nil
+	}
+
+	avgBits := bits.Len(uint(config.AvgSize)) - 1
+	return &fastCDCChunker{
+		minSize:   config.MinSize,
+		avgSize:   config.AvgSize,
+		maxSize:   config.MaxSize,
+		maskSmall: topBitsMask(avgBits + 2),
+		maskLarge: topBitsMask(avgBits - 2),
+	}, nil
+}
+
+// fixedChunker cuts chunks at fixed size boundaries
+type fixedChunker struct {
+	size int
+}
+
+func (f *fixedChunker) Cut(data []byte) int {
+	return min(len(data), f.size)
+}
+
+func (f *fixedChunker) MaxChunkSize() int {
+	return f.size
+}
+
+// fastCDCChunker implements FastCDC content-defined chunking with normalized chunk sizes.
+// Boundaries depend only on the surrounding bytes, so inserting data into a file only
+// changes the chunks around the insertion point.
+type fastCDCChunker struct {
+	minSize   int
+	avgSize   int
+	maxSize   int
+	maskSmall uint64 // harder to match, used before the average size is reached
+	maskLarge uint64 // easier to match, used after the average size is reached
+}
+
+func (f *fastCDCChunker) Cut(data []byte) int {
+	n := len(data)
+	if n <= f.minSize {
+		return n
+	}
+	if n > f.maxSize {
+		n = f.maxSize
+	}
+	normal := min(n, f.avgSize)
+
+	var fingerprint uint64
+	i := f.minSize
+	for ; i < normal; i++ {
+		fingerprint = (fingerprint << 1) + gearTable[data[i]]
+		if fingerprint&f.maskSmall == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		fingerprint = (fingerprint << 1) + gearTable[data[i]]
+		if fingerprint&f.maskLarge == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
+
+func (f *fastCDCChunker) MaxChunkSize() int {
+	return f.maxSize
+}
+
+// topBitsMask returns a mask with the n most significant bits set
+func topBitsMask(n int) uint64 {
+	n = max(1, min(n, 63))
+	return ^uint64(0) << (64 - n)
+}
+
+// gearTable maps each byte to a random 64 bit value for the gear rolling hash.
+// It is derived from a fixed seed so every client produces the same boundaries;
+// changing it changes every content-defined chunk and breaks deduplication.
+var gearTable = func() [256]uint64 {
+	var table [256]uint64
+	state := uint64(0x7a65726f64757065) // "zerodupe"
+	for i := range table {
+		// splitmix64
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
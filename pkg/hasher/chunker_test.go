@@ -0,0 +1,158 @@
+package hasher
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func randomTestingData(t *testing.T, size int, seed int64) []byte {
+	t.Helper()
+	data := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+func TestParseChunkerConfig(t *testing.T) {
+	t.Run("Test ParseChunkerConfig round trips the string form", func(t *testing.T) {
+		configs := []ChunkerConfig{
+			DefaultChunkerConfig(),
+			FixedChunkerConfig(4096),
+			FastCDCChunkerConfig(2048, 8192, 65536),
+		}
+		for _, config := range configs {
+			parsed, err := ParseChunkerConfig(config.String())
+			if err != nil {
+				t.Fatalf("Failed to parse chunker %s: %v", config, err)
+			}
+			if parsed != config {
+				t.Errorf("Expected %+v, got %+v", config, parsed)
+			}
+		}
+	})
+
+	t.Run("Test ParseChunkerConfig uses default sizes for bare type names", func(t *testing.T) {
+		parsed, err := ParseChunkerConfig(ChunkerFastCDC)
+		if err != nil {
+			t.Fatalf("Failed to parse chunker: %v", err)
+		}
+		expected := FastCDCChunkerConfig(DefaultMinChunkSize, DefaultAvgChunkSize, DefaultMaxChunkSize)
+		if parsed != expected {
+			t.Errorf("Expected %+v, got %+v", expected, parsed)
+		}
+	})
+
+	t.Run("Test ParseChunkerConfig rejects invalid configs", func(t *testing.T) {
+		for _, s := range []string{"", "rabin", "fixed:abc", "fastcdc:1:2", "fastcdc:8192:4096:65536", "fixed:1"} {
+			if _, err := ParseChunkerConfig(s); err == nil {
+				t.Errorf("Expected error for chunker %q", s)
+			}
+		}
+	})
+
+	t.Run("Test ParseChunkerConfig rejects sizes above the maximum", func(t *testing.T) {
+		for _, s := range []string{"fastcdc:64:1024:99999999999", "fixed:99999999999"} {
+			if _, err := ParseChunkerConfig(s); err == nil {
+				t.Errorf("Expected error for chunker %q", s)
+			}
+		}
+
+		config := FastCDCChunkerConfig(DefaultMinChunkSize, DefaultAvgChunkSize, MaxAllowedChunkSize)
+		if _, err := ParseChunkerConfig(config.String()); err != nil {
+			t.Errorf("Expected chunker %s to be valid: %v", config, err)
+		}
+		if _, err := NewChunker(FastCDCChunkerConfig(DefaultMinChunkSize, DefaultAvgChunkSize, MaxAllowedChunkSize+1)); err == nil {
+			t.Error("Expected error for a max chunk size above the maximum")
+		}
+	})
+}
+
+func TestSplitDataIntoChunksWithConfig(t *testing.T) {
+	config := FastCDCChunkerConfig(2*1024, 8*1024, 32*1024)
+
+	t.Run("Test FastCDC chunks respect the configured size bounds", func(t *testing.T) {
+		data := randomTestingData(t, 1024*1024, 1)
+		chunks, _, err := SplitDataIntoChunksWithConfig(data, config)
+		if err != nil {
+			t.Fatalf("Failed to split data into chunks: %v", err)
+		}
+
+		total := 0
+		for i, chunk := range chunks {
+			total += len(chunk.Data)
+			if len(chunk.Data) > config.MaxSize {
+				t.Errorf("Chunk %d is larger than max size: %d", i, len(chunk.Data))
+			}
+			if len(chunk.Data) < config.MinSize && i != len(chunks)-1 {
+				t.Errorf("Chunk %d is smaller than min size: %d", i, len(chunk.Data))
+			}
+			if chunk.ChunkOrder != i+1 {
+				t.Errorf("Expected chunk order %d, got %d", i+1, chunk.ChunkOrder)
+			}
+		}
+		if total != len(data) {
+			t.Errorf("Expected chunks to cover %d bytes, got %d", len(data), total)
+		}
+
+		average := len(data) / len(chunks)
+		if average < config.MinSize || average > config.MaxSize {
+			t.Errorf("Average chunk size %d is outside of configured bounds", average)
+		}
+	})
+
+	t.Run("Test FastCDC keeps most chunks after an insertion near the start", func(t *testing.T) {
+		data := randomTestingData(t, 1024*1024, 2)
+		shifted := append([]byte{data[0], 0x42}, data[1:]...)
+
+		original, _, err := SplitDataIntoChunksWithConfig(data, config)
+		if err != nil {
+			t.Fatalf("Failed to split data into chunks: %v", err)
+		}
+		modified, _, err := SplitDataIntoChunksWithConfig(shifted, config)
+		if err != nil {
+			t.Fatalf("Failed to split data into chunks: %v", err)
+		}
+
+		originalHashes := make(map[string]bool)
+		for _, chunk := range original {
+			originalHashes[chunk.ChunkHash] = true
+		}
+		shared := 0
+		for _, chunk := range modified {
+			if originalHashes[chunk.ChunkHash] {
+				shared++
+			}
+		}
+		if shared < len(original)-2 {
+			t.Errorf("Expected all but the first chunks to be shared, shared %d of %d", shared, len(original))
+		}
+	})
+
+	t.Run("Test fixed chunker loses every chunk after an insertion near the start", func(t *testing.T) {
+		data := randomTestingData(t, 64*1024, 3)
+		shifted := append([]byte{0x42}, data...)
+
+		original, _, _ := SplitDataIntoChunksWithConfig(data, FixedChunkerConfig(4096))
+		modified, _, _ := SplitDataIntoChunksWithConfig(shifted, FixedChunkerConfig(4096))
+		for i := range original {
+			if original[i].ChunkHash == modified[i].ChunkHash {
+				t.Errorf("Expected chunk %d to differ after insertion", i)
+			}
+		}
+	})
+
+	t.Run("Test FastCDC chunking is deterministic", func(t *testing.T) {
+		data := randomTestingData(t, 256*1024, 4)
+		_, hash1, _ := SplitDataIntoChunksWithConfig(data, config)
+		_, hash2, _ := SplitDataIntoChunksWithConfig(data, config)
+		if hash1 != hash2 {
+			t.Errorf("Expected identical file hashes, got %s and %s", hash1, hash2)
+		}
+	})
+
+	t.Run("Test SplitDataIntoChunksWithConfig rejects invalid config", func(t *testing.T) {
+		_, _, err := SplitDataIntoChunksWithConfig([]byte("hello"), ChunkerConfig{Type: "rabin"})
+		if err == nil {
+			t.Errorf("Expected error for unknown chunker")
+		}
+	})
+}
@@ -1,9 +1,12 @@
 package hasher
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 )
@@ -18,47 +21,79 @@ type FileChunk struct {
 	ChunkOrder int
 }
 
-// CalculateChunkHash computes the SHA-256 hash of a byte slice
+// CalculateChunkHash computes the SHA-256 hash of a byte slice as bare hex.
+// This is the legacy identifier format, new hashes carry their algorithm (see Sum).
 func CalculateChunkHash(data []byte) string {
 	hasher := sha256.New()
 	hasher.Write(data)
 	return hex.EncodeToString(hasher.Sum(nil))
 }
 
-// SplitDataIntoChunks splits a byte slice into chunks and returns them along with the file hash
+// SplitDataIntoChunks splits a byte slice into fixed-size chunks and returns them along with the file hash
 func SplitDataIntoChunks(data []byte) ([]FileChunk, string, error) {
-	fileHasher := sha256.New()
-	var chunks []FileChunk
+	return SplitDataIntoChunksWithConfig(data, DefaultChunkerConfig())
+}
+
+// SplitDataIntoChunksWithConfig splits a byte slice using the given chunker and returns the chunks along with the file hash
+func SplitDataIntoChunksWithConfig(data []byte, config ChunkerConfig) ([]FileChunk, string, error) {
+	reader, err := NewChunkReader(bytes.NewReader(data), config, DefaultAlgorithm)
+	if err != nil {
+		return nil, "", err
+	}
 
-	for i, order := 0, 1; i < len(data); i, order = i+ChunkSizeBytes, order+1 {
-		end := i + ChunkSizeBytes
-		if end > len(data) {
-			end = len(data)
+	var chunks []FileChunk
+	for {
+		chunk, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, "", err
 		}
+		chunks = append(chunks, *chunk)
+	}
 
-		chunkData := data[i:end]
-		chunkHash := CalculateChunkHash(chunkData)
-		fileHasher.Write([]byte(chunkHash))
+	fileHash, err := reader.FileHash()
+	if err != nil {
+		return nil, "", err
+	}
+	return chunks, fileHash, nil
+}
+
+// FileHashFromChunkHashes computes the file hash from its ordered chunk hashes as their Merkle root (see MerkleRoot)
+func FileHashFromChunkHashes(chunkHashes []string) string {
+	return MerkleRoot(chunkHashes)
+}
 
-		chunks = append(chunks, FileChunk{
-			Data:       chunkData,
-			ChunkHash:  chunkHash,
-			ChunkOrder: order,
-		})
+// LegacyFileHashFromChunkHashes computes the file hash used before file hashes were Merkle roots:
+// the hash of the concatenated chunk hashes, or the chunk hash itself for single chunk files.
+func LegacyFileHashFromChunkHashes(chunkHashes []string) string {
+	if len(chunkHashes) == 1 {
+		return chunkHashes[0]
 	}
 
-	// special case for single chunk files
-	if len(chunks) == 1 {
-		return chunks, chunks[0].ChunkHash, nil
+	var concatenated []byte
+	for _, chunkHash := range chunkHashes {
+		concatenated = append(concatenated, chunkHash...)
 	}
 
-	fileHash := hex.EncodeToString(fileHasher.Sum(nil))
-	return chunks, fileHash, nil
+	reference := ""
+	if len(chunkHashes) > 0 {
+		reference = chunkHashes[0]
+	}
+	return hashLike(reference, concatenated)
+}
+
+// VerifyFileHash reports whether the ordered chunk hashes make up the file identified by fileHash.
+// Files uploaded before file hashes were Merkle roots are verified against their legacy hash.
+func VerifyFileHash(fileHash string, chunkHashes []string) bool {
+	return EqualHashes(FileHashFromChunkHashes(chunkHashes), fileHash) ||
+		EqualHashes(LegacyFileHashFromChunkHashes(chunkHashes), fileHash)
 }
 
-// VerifyChunkHash verifies that a chunk's data matches its expected hash
+// VerifyChunkHash verifies that a chunk's data matches its expected hash.
+// The actual hash is computed with the algorithm of the expected hash and returned in the same format.
 func VerifyChunkHash(data []byte, expectedHash string) (bool, string) {
-	actualHash := CalculateChunkHash(data)
+	actualHash := hashLike(expectedHash, data)
 	return actualHash == expectedHash, actualHash
 }
 
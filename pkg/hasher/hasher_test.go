@@ -111,3 +111,29 @@ func TestVerifyChunkHash(t *testing.T) {
 		}
 	})
 }
+
+func TestFileHashFromChunkHashes(t *testing.T) {
+	t.Run("Test FileHashFromChunkHashes matches the hash from SplitDataIntoChunks", func(t *testing.T) {
+		data := make([]byte, 2*ChunkSizeBytes+10)
+		chunks, fileHash, err := SplitDataIntoChunks(data)
+		if err != nil {
+			t.Fatalf("Failed to split data into chunks: %v", err)
+		}
+
+		hashes := make([]string, len(chunks))
+		for i, chunk := range chunks {
+			hashes[i] = chunk.ChunkHash
+		}
+		if actualHash := FileHashFromChunkHashes(hashes); actualHash != fileHash {
+			t.Errorf("Expected hash %s, got %s", fileHash, actualHash)
+		}
+	})
+
+	t.Run("Test FileHashFromChunkHashes depends on chunk order", func(t *testing.T) {
+		hash1 := FileHashFromChunkHashes([]string{"a", "b"})
+		hash2 := FileHashFromChunkHashes([]string{"b", "a"})
+		if hash1 == hash2 {
+			t.Errorf("Expected different hashes for different chunk order, got %s", hash1)
+		}
+	})
+}
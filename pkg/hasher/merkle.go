@@ -0,0 +1,194 @@
+package hasher
+
+import (
+	"encoding/hex"
+	"fmt"
+	"hash"
+)
+
+// Domain separation prefixes, so a leaf can never be mistaken for an internal node
+const (
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
+// MerkleProof proves that a chunk hash is the leaf at Index of a file hash with Count leaves.
+// Siblings holds the hex digests needed to recompute the root, from the leaf upwards.
+type MerkleProof struct {
+	Index    int      `json:"index"`
+	Count    int      `json:"count"`
+	Siblings []string `json:"siblings"`
+}
+
+// merkleTree computes Merkle tree nodes with the algorithm of the chunk hashes
+type merkleTree struct {
+	algorithm string
+	newHash   func() hash.Hash
+}
+
+// newMerkleTree creates a tree hashing with the algorithm of the first chunk hash.
+// Chunk hashes that cannot be parsed fall back to the default algorithm.
+func newMerkleTree(chunkHashes []string) merkleTree {
+	algorithm := DefaultAlgorithm
+	if len(chunkHashes) > 0 {
+		if parsed, _, err := ParseHash(chunkHashes[0]); err == nil {
+			algorithm = parsed
+		}
+	}
+	return newMerkleTreeWithAlgorithm(algorithm)
+}
+
+func newMerkleTreeWithAlgorithm(algorithm string) merkleTree {
+	alg, err := LookupAlgorithm(algorithm)
+	if err != nil {
+		alg, _ = LookupAlgorithm(DefaultAlgorithm)
+	}
+	return merkleTree{algorithm: alg.Name, newHash: alg.New}
+}
+
+// leaf hashes a chunk hash identifier. The canonical form is used so legacy and
+// prefixed spellings of a SHA-256 chunk hash produce the same leaf.
+func (t merkleTree) leaf(chunkHash string) []byte {
+	h := t.newHash()
+	h.Write([]byte{merkleLeafPrefix})
+	h.Write([]byte(CanonicalHash(chunkHash)))
+	return h.Sum(nil)
+}
+
+func (t merkleTree) node(left, right []byte) []byte {
+	h := t.newHash()
+	h.Write([]byte{merkleNodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+func (t merkleTree) empty() []byte {
+	return t.newHash().Sum(nil)
+}
+
+func (t merkleTree) leaves(chunkHashes []string) [][]byte {
+	leaves := make([][]byte, len(chunkHashes))
+	for i, chunkHash := range chunkHashes {
+		leaves[i] = t.leaf(chunkHash)
+	}
+	return leaves
+}
+
+// root computes the root of the given leaves. Trees that are not a power of two are split
+// at the largest power of two smaller than the number of leaves, as in RFC 6962.
+func (t merkleTree) root(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		return t.empty()
+	case 1:
+		return leaves[0]
+	}
+	k := splitPoint(len(leaves))
+	return t.node(t.root(leaves[:k]), t.root(leaves[k:]))
+}
+
+// proofs computes the inclusion proofs of all leaves, appending to each the siblings above it
+func (t merkleTree) proofs(leaves [][]byte, siblings [][][]byte) {
+	if len(leaves) <= 1 {
+		return
+	}
+	k := splitPoint(len(leaves))
+	t.proofs(leaves[:k], siblings[:k])
+	t.proofs(leaves[k:], siblings[k:])
+
+	left, right := t.root(leaves[:k]), t.root(leaves[k:])
+	for i := range siblings[:k] {
+		siblings[i] = append(siblings[i], right)
+	}
+	for i := range siblings[k:] {
+		siblings[k+i] = append(siblings[k+i], left)
+	}
+}
+
+// rootFromProof recomputes the root of a tree of count leaves from the leaf at index and its siblings
+func (t merkleTree) rootFromProof(index, count int, leaf []byte, siblings [][]byte) ([]byte, bool) {
+	if count == 1 {
+		return leaf, len(siblings) == 0
+	}
+	if len(siblings) == 0 {
+		return nil, false
+	}
+
+	k := splitPoint(count)
+	last := len(siblings) - 1
+	if index < k {
+		left, ok := t.rootFromProof(index, k, leaf, siblings[:last])
+		return t.node(left, siblings[last]), ok
+	}
+	right, ok := t.rootFromProof(index-k, count-k, leaf, siblings[:last])
+	return t.node(siblings[last], right), ok
+}
+
+// splitPoint returns the largest power of two smaller than n, for n > 1
+func splitPoint(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// MerkleRoot computes the file hash as the root of a Merkle tree over the ordered chunk hashes.
+// The file hash uses the algorithm of the chunk hashes and is always in prefixed form.
+func MerkleRoot(chunkHashes []string) string {
+	tree := newMerkleTree(chunkHashes)
+	return FormatHash(tree.algorithm, hex.EncodeToString(tree.root(tree.leaves(chunkHashes))))
+}
+
+// MerkleProofs returns the inclusion proof of every chunk hash, in chunk order
+func MerkleProofs(chunkHashes []string) []MerkleProof {
+	tree := newMerkleTree(chunkHashes)
+	siblings := make([][][]byte, len(chunkHashes))
+	tree.proofs(tree.leaves(chunkHashes), siblings)
+
+	proofs := make([]MerkleProof, len(chunkHashes))
+	for i := range chunkHashes {
+		proofs[i] = MerkleProof{
+			Index:    i,
+			Count:    len(chunkHashes),
+			Siblings: make([]string, len(siblings[i])),
+		}
+		for j, sibling := range siblings[i] {
+			proofs[i].Siblings[j] = hex.EncodeToString(sibling)
+		}
+	}
+	return proofs
+}
+
+// VerifyMerkleProof reports whether proof shows that chunkHash is part of the file identified by fileHash
+func VerifyMerkleProof(fileHash, chunkHash string, proof MerkleProof) bool {
+	if err := proof.validate(); err != nil {
+		return false
+	}
+
+	algorithm, digest, err := ParseHash(fileHash)
+	if err != nil {
+		return false
+	}
+	tree := newMerkleTreeWithAlgorithm(algorithm)
+
+	siblings := make([][]byte, len(proof.Siblings))
+	for i, sibling := range proof.Siblings {
+		decoded, err := hex.DecodeString(sibling)
+		if err != nil {
+			return false
+		}
+		siblings[i] = decoded
+	}
+
+	root, ok := tree.rootFromProof(proof.Index, proof.Count, tree.leaf(chunkHash), siblings)
+	return ok && hex.EncodeToString(root) == digest
+}
+
+func (p MerkleProof) validate() error {
+	if p.Count <= 0 || p.Index < 0 || p.Index >= p.Count {
+		return fmt.Errorf("invalid proof index %d of %d", p.Index, p.Count)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package hasher
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func testingChunkHashes(t *testing.T, algorithm string, count int) []string {
+	t.Helper()
+	hashes := make([]string, count)
+	for i := range hashes {
+		hash, err := Sum(algorithm, []byte(fmt.Sprintf("chunk %d", i)))
+		if err != nil {
+			t.Fatalf("Failed to hash chunk: %v", err)
+		}
+		hashes[i] = hash
+	}
+	return hashes
+}
+
+func TestMerkleRoot(t *testing.T) {
+	t.Run("Test MerkleRoot of a single chunk differs from the chunk hash", func(t *testing.T) {
+		hashes := testingChunkHashes(t, SHA256, 1)
+		if root := MerkleRoot(hashes); root == hashes[0] {
+			t.Errorf("Expected the file hash to be domain separated from the chunk hash")
+		}
+	})
+
+	t.Run("Test MerkleRoot keeps the chunk hash algorithm", func(t *testing.T) {
+		root := MerkleRoot(testingChunkHashes(t, BLAKE3, 3))
+		if !strings.HasPrefix(root, BLAKE3+":") {
+			t.Errorf("Expected blake3 file hash, got %s", root)
+		}
+	})
+
+	t.Run("Test MerkleRoot treats legacy and prefixed chunk hashes alike", func(t *testing.T) {
+		hashes := testingChunkHashes(t, SHA256, 3)
+		legacy := make([]string, len(hashes))
+		for i, hash := range hashes {
+			_, legacy[i], _ = ParseHash(hash)
+		}
+		if MerkleRoot(hashes) != MerkleRoot(legacy) {
+			t.Errorf("Expected the same file hash for legacy chunk hashes")
+		}
+	})
+}
+
+func TestMerkleProofs(t *testing.T) {
+	t.Run("Test MerkleProofs verify for every chunk of every tree size", func(t *testing.T) {
+		for count := 1; count <= 17; count++ {
+			hashes := testingChunkHashes(t, SHA256, count)
+			root := MerkleRoot(hashes)
+			proofs := MerkleProofs(hashes)
+			if len(proofs) != count {
+				t.Fatalf("Expected %d proofs, got %d", count, len(proofs))
+			}
+			for i, proof := range proofs {
+				if !VerifyMerkleProof(root, hashes[i], proof) {
+					t.Errorf("Expected proof of chunk %d of %d to verify", i, count)
+				}
+			}
+		}
+	})
+
+	t.Run("Test VerifyMerkleProof rejects a proof for another chunk or position", func(t *testing.T) {
+		hashes := testingChunkHashes(t, BLAKE3, 6)
+		root := MerkleRoot(hashes)
+		proofs := MerkleProofs(hashes)
+
+		if VerifyMerkleProof(root, hashes[1], proofs[2]) {
+			t.Errorf("Expected proof to be bound to its chunk")
+		}
+
+		moved := proofs[2]
+		moved.Index = 3
+		if VerifyMerkleProof(root, hashes[2], moved) {
+			t.Errorf("Expected proof to be bound to its position")
+		}
+
+		truncated := proofs[2]
+		truncated.Siblings = truncated.Siblings[1:]
+		if VerifyMerkleProof(root, hashes[2], truncated) {
+			t.Errorf("Expected truncated proof to fail")
+		}
+
+		if VerifyMerkleProof(MerkleRoot(hashes[:5]), hashes[2], proofs[2]) {
+			t.Errorf("Expected proof to be bound to its file hash")
+		}
+	})
+}
+
+func TestVerifyFileHash(t *testing.T) {
+	t.Run("Test VerifyFileHash accepts Merkle and legacy file hashes", func(t *testing.T) {
+		hashes := []string{CalculateChunkHash([]byte("a")), CalculateChunkHash([]byte("b"))}
+
+		if !VerifyFileHash(FileHashFromChunkHashes(hashes), hashes) {
+			t.Errorf("Expected Merkle file hash to verify")
+		}
+		if !VerifyFileHash(LegacyFileHashFromChunkHashes(hashes), hashes) {
+			t.Errorf("Expected legacy file hash to verify")
+		}
+		if !VerifyFileHash(hashes[0], hashes[:1]) {
+			t.Errorf("Expected legacy single chunk file hash to verify")
+		}
+		if VerifyFileHash(FileHashFromChunkHashes(hashes), []string{hashes[1], hashes[0]}) {
+			t.Errorf("Expected reordered chunks to fail")
+		}
+	})
+}
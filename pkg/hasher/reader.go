@@ -0,0 +1,106 @@
+package hasher
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ChunkReader splits a stream into chunks without loading the whole stream into memory.
+// At most one maximum-sized chunk is buffered at a time.
+type ChunkReader struct {
+	reader    io.Reader
+	chunker   Chunker
+	algorithm string
+	buffer    []byte
+	buffered  int
+	eof       bool
+	order     int
+	hashes    []string
+	done      bool
+}
+
+// NewChunkReader creates a chunk reader over r using the given chunker config and hash algorithm
+func NewChunkReader(r io.Reader, config ChunkerConfig, algorithm string) (*ChunkReader, error) {
+	chunker, err := NewChunker(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := LookupAlgorithm(algorithm); err != nil {
+		return nil, err
+	}
+
+	return &ChunkReader{
+		reader:    r,
+		chunker:   chunker,
+		algorithm: algorithm,
+		buffer:    make([]byte, chunker.MaxChunkSize()),
+	}, nil
+}
+
+// Next returns the next chunk of the stream, or io.EOF once the stream is exhausted.
+// Each returned chunk owns its Data, so it can be used after further calls to Next.
+func (cr *ChunkReader) Next() (*FileChunk, error) {
+	if cr.done {
+		return nil, io.EOF
+	}
+
+	if err := cr.fill(); err != nil {
+		return nil, err
+	}
+
+	if cr.buffered == 0 {
+		cr.done = true
+		return nil, io.EOF
+	}
+
+	size := cr.chunker.Cut(cr.buffer[:cr.buffered])
+	data := make([]byte, size)
+	copy(data, cr.buffer[:size])
+	cr.buffered = copy(cr.buffer, cr.buffer[size:cr.buffered])
+
+	chunkHash, err := Sum(cr.algorithm, data)
+	if err != nil {
+		return nil, err
+	}
+
+	cr.order++
+	chunk := &FileChunk{
+		Data:       data,
+		ChunkHash:  chunkHash,
+		ChunkOrder: cr.order,
+	}
+
+	cr.hashes = append(cr.hashes, chunk.ChunkHash)
+
+	return chunk, nil
+}
+
+// FileHash returns the hash of the whole stream. It is only available after Next has returned io.EOF.
+func (cr *ChunkReader) FileHash() (string, error) {
+	if !cr.done {
+		return "", fmt.Errorf("file hash is not available before the whole stream is read")
+	}
+
+	return FileHashFromChunkHashes(cr.hashes), nil
+}
+
+// ChunksCount returns the number of chunks read so far
+func (cr *ChunkReader) ChunksCount() int {
+	return cr.order
+}
+
+// fill reads from the underlying reader until the buffer is full or the stream ends
+func (cr *ChunkReader) fill() error {
+	for !cr.eof && cr.buffered < len(cr.buffer) {
+		n, err := cr.reader.Read(cr.buffer[cr.buffered:])
+		cr.buffered += n
+		if errors.Is(err, io.EOF) {
+			cr.eof = true
+		} else if err != nil {
+			return fmt.Errorf("failed to read data: %w", err)
+		}
+	}
+	return nil
+}
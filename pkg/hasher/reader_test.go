@@ -0,0 +1,99 @@
+package hasher
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func readAllChunks(t *testing.T, reader *ChunkReader) []*FileChunk {
+	t.Helper()
+	var chunks []*FileChunk
+	for {
+		chunk, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return chunks
+		}
+		if err != nil {
+			t.Fatalf("Failed to read chunk: %v", err)
+		}
+		chunks = append(chunks, chunk)
+	}
+}
+
+func TestChunkReader(t *testing.T) {
+	t.Run("Test ChunkReader yields the same chunks and file hash as SplitDataIntoChunksWithConfig", func(t *testing.T) {
+		data := randomTestingData(t, 300*1024, 5)
+		config := FastCDCChunkerConfig(4*1024, 16*1024, 64*1024)
+
+		expectedChunks, expectedHash, err := SplitDataIntoChunksWithConfig(data, config)
+		if err != nil {
+			t.Fatalf("Failed to split data into chunks: %v", err)
+		}
+
+		// read one byte at a time to exercise buffer refills
+		reader, err := NewChunkReader(iotest.OneByteReader(bytes.NewReader(data)), config, DefaultAlgorithm)
+		if err != nil {
+			t.Fatalf("Failed to create chunk reader: %v", err)
+		}
+		chunks := readAllChunks(t, reader)
+
+		if len(chunks) != len(expectedChunks) {
+			t.Fatalf("Expected %d chunks, got %d", len(expectedChunks), len(chunks))
+		}
+		for i, chunk := range chunks {
+			if chunk.ChunkHash != expectedChunks[i].ChunkHash || !bytes.Equal(chunk.Data, expectedChunks[i].Data) {
+				t.Errorf("Chunk %d differs from SplitDataIntoChunksWithConfig", i)
+			}
+		}
+
+		fileHash, err := reader.FileHash()
+		if err != nil {
+			t.Fatalf("Failed to get file hash: %v", err)
+		}
+		if fileHash != expectedHash {
+			t.Errorf("Expected file hash %s, got %s", expectedHash, fileHash)
+		}
+		if reader.ChunksCount() != len(expectedChunks) {
+			t.Errorf("Expected chunks count %d, got %d", len(expectedChunks), reader.ChunksCount())
+		}
+	})
+
+	t.Run("Test ChunkReader chunks stay valid after later reads", func(t *testing.T) {
+		data := randomTestingData(t, 10*1024, 6)
+		reader, err := NewChunkReader(bytes.NewReader(data), FixedChunkerConfig(1024), DefaultAlgorithm)
+		if err != nil {
+			t.Fatalf("Failed to create chunk reader: %v", err)
+		}
+
+		var combined []byte
+		for _, chunk := range readAllChunks(t, reader) {
+			combined = append(combined, chunk.Data...)
+		}
+		if !bytes.Equal(combined, data) {
+			t.Errorf("Expected chunks to reassemble the original data")
+		}
+	})
+
+	t.Run("Test ChunkReader FileHash is not available before the end of the stream", func(t *testing.T) {
+		reader, err := NewChunkReader(bytes.NewReader([]byte("hello world")), DefaultChunkerConfig(), DefaultAlgorithm)
+		if err != nil {
+			t.Fatalf("Failed to create chunk reader: %v", err)
+		}
+		if _, err := reader.FileHash(); err == nil {
+			t.Errorf("Expected error before the stream is read")
+		}
+	})
+
+	t.Run("Test ChunkReader returns read errors", func(t *testing.T) {
+		reader, err := NewChunkReader(iotest.ErrReader(errors.New("disk failure")), DefaultChunkerConfig(), DefaultAlgorithm)
+		if err != nil {
+			t.Fatalf("Failed to create chunk reader: %v", err)
+		}
+		if _, err := reader.Next(); err == nil || errors.Is(err, io.EOF) {
+			t.Errorf("Expected read error, got %v", err)
+		}
+	})
+}